@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"term/pkg/client"
+	"term/pkg/server"
+)
+
+// runCLI sends a single command such as `term list-keys` to the running
+// daemon, prints its output and returns the process exit status. attach
+// and headless are handled here since they start a client instead,
+// completion, plugin, bench, export-recording and serial since they need no
+// daemon, subscribe since it prints until stopped, and start since it runs
+// a template's commands before attaching.
+func runCLI(args []string) int {
+	switch args[0] {
+	case "bench":
+		return client.RunBench(args[1:])
+	case "export-recording":
+		return client.RunExportRecording(args[1:])
+	case "headless":
+		return client.RunHeadless(args[1:])
+	case "serial":
+		return server.RunSerial(args[1:])
+	case "attach", "attach-session", "a":
+		return client.RunAttach(args[1:])
+	case "completion":
+		return server.RunCompletion(args[1:])
+	case "plugin":
+		return runPlugin(args[1:])
+	case "subscribe":
+		return client.RunSubscribe(args[1:])
+	case "start":
+		return client.RunStart(args[1:])
+	}
+
+	// new-session is the one command that starts the daemon if needed
+	start := args[0] == "new-session" || args[0] == "new"
+	output, err := client.SendCommand(args, start)
+	fmt.Print(output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+// Term is a terminal multiplexer. Run with no command, it attaches to the
+// main session, starting the daemon if none is running; other commands are
+// sent to the daemon or, like term daemon, run in place.
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"term/pkg/client"
+	"term/pkg/protocol"
+	"term/pkg/server"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "devel"
+
+// config is the global flags, given before the command and passed on to a
+// daemon the CLI starts. Its socket is also the one the CLI and clients
+// dial.
+var config = server.Config{Socket: protocol.SocketPath, LogLevel: "info"}
+
+func main() {
+	if inside := os.Getenv("TERM_MUX"); inside != "" {
+		config.Socket = strings.Split(inside, ",")[0] // the daemon of the pane we run in
+	}
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v, see term --help\n", err)
+		os.Exit(2)
+	}
+	client.Socket, client.DaemonFlags = config.Socket, globalFlags()
+	if len(args) > 0 && args[0] == "daemon" {
+		os.Exit(server.Run(config))
+	} else if len(args) > 0 {
+		os.Exit(runCLI(args))
+	} else {
+		os.Exit(client.RunClient(""))
+	}
+}
+
+// parseGlobalFlags sets the global flags from the start of args, as
+// --flag value or --flag=value, and returns the command after them.
+// --help and --version print and exit.
+func parseGlobalFlags(args []string) ([]string, error) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		args = args[1:]
+		switch name {
+		case "-h", "--help":
+			fmt.Print(usage())
+			os.Exit(0)
+		case "-V", "--version":
+			fmt.Println("term", versionString())
+			os.Exit(0)
+		case "--":
+			return args, nil
+		case "--socket", "--config", "--log-level", "--listen":
+		default:
+			return nil, fmt.Errorf("unknown flag %s", name)
+		}
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("%s needs a value", name)
+			}
+			value, args = args[0], args[1:]
+		}
+		switch name {
+		case "--socket":
+			if strings.HasPrefix(value, "@") && !server.AbstractSockets {
+				return nil, fmt.Errorf("abstract socket %s: only Linux has them", value)
+			}
+			config.Socket = value
+		case "--config":
+			config.File = value
+		case "--listen":
+			config.Listen = value
+		case "--log-level":
+			if !slices.Contains(server.LogLevels, value) {
+				return nil, fmt.Errorf("bad log level %q: one of %s", value, strings.Join(server.LogLevels, ", "))
+			}
+			config.LogLevel = value
+		}
+	}
+	return args, nil
+}
+
+// globalFlags returns the global flags given, to start the daemon with.
+func globalFlags() []string {
+	var flags []string
+	if config.Socket != protocol.SocketPath {
+		flags = append(flags, "--socket", config.Socket)
+	}
+	if config.File != "" {
+		flags = append(flags, "--config", config.File)
+	}
+	if config.LogLevel != "info" {
+		flags = append(flags, "--log-level", config.LogLevel)
+	}
+	if config.Listen != "" {
+		flags = append(flags, "--listen", config.Listen)
+	}
+	return flags
+}
+
+// versionString is version, with the commit it was built from when known.
+func versionString() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return version + " (" + s.Value[:12] + ")"
+		}
+	}
+	return version
+}
+
+// usage describes the command line, with the daemon's commands.
+func usage() string {
+	var b strings.Builder
+	b.WriteString(`usage: term [flags] [command [args...]]
+
+With no command, attach to the main session, starting the daemon if needed.
+
+Flags:
+  --socket path      talk to the daemon on path (default ` + protocol.SocketPath + `),
+                     or @name for an abstract socket (Linux), or tcp:host:port
+                     for a daemon's --listen address
+  --listen host:port also take clients on this loopback TCP address
+  --config file      read file instead of ~/.term.conf
+  --log-level level  what the daemon prints: ` + strings.Join(server.LogLevels, ", ") + ` (default info)
+  -h, --help         show this help
+  -V, --version      show the version
+
+Commands run by the CLI:
+  attach [-c directory] [-t name]  attach to a session
+  start [-d] template              make a session from a template
+  headless [-t name] [-x w] [-y h] a client driven by key, type, resize, sleep and dump lines on stdin
+  bench [-s MiB] [-x width] [-y height]  measure parsing and drawing speed
+  export-recording [--format gif|svg] [-o file] file.cast  render a recording as an animation
+  subscribe [event...]             print events as JSON lines
+  serial [-b baud] [-p parity] device  connect to a serial device, as new-window --serial runs
+  plugin install|remove|enable|disable|list
+  completion bash|zsh|fish
+  daemon                           run the daemon in the foreground
+
+Commands sent to the daemon:
+`)
+	names := make([]string, 0, len(protocol.CommandSummaries))
+	for name := range protocol.CommandSummaries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-18s %s\n", name, protocol.CommandSummaries[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"term/pkg/client"
+	"term/pkg/server"
+)
+
+// runPlugin implements `term plugin install|remove|enable|disable|list`,
+// managing the plugin directory and telling a running daemon to start or
+// stop plugins to match.
+func runPlugin(args []string) int {
+	usage := "usage: term plugin install path-or-git-url [name] | remove|enable|disable name | list"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 1
+	}
+	var err error
+	switch {
+	case args[0] == "install" && (len(args) == 2 || len(args) == 3):
+		name := strings.TrimSuffix(filepath.Base(strings.TrimRight(args[1], "/")), ".git")
+		if len(args) == 3 {
+			name = args[2]
+		}
+		if err = server.InstallPlugin(args[1], name); err == nil {
+			fmt.Printf("Installed %s; start it with: term plugin enable %s\n", name, name)
+		}
+	case args[0] == "remove" && len(args) == 2:
+		err = server.RemovePlugin(args[1])
+	case (args[0] == "enable" || args[0] == "disable") && len(args) == 2:
+		err = server.SetPluginEnabled(args[1], args[0] == "enable")
+	case args[0] == "list" && len(args) == 1:
+		entries, _ := os.ReadDir(server.PluginDir())
+		enabled := server.EnabledPlugins()
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			state := "disabled"
+			if slices.Contains(enabled, e.Name()) {
+				state = "enabled"
+			}
+			fmt.Printf("%s (%s)\n", e.Name(), state)
+		}
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if args[0] != "install" {
+		client.SendCommand([]string{"reload-plugins"}, false) // no daemon is fine
+	}
+	return 0
+}
@@ -1,17 +0,0 @@
-package main
-
-import (
-	"os"
-)
-
-const (
-	prefixKey = '\x01' // Ctrl+a
-)
-
-func main() {
-	if len(os.Args) > 1 && os.Args[1] == "daemon" {
-		runDaemon()
-	} else {
-		runClient()
-	}
-}
\ No newline at end of file
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// benchChunk is how much output each write in a benchmark carries, as
+// the daemon reads at most this much from a PTY at once.
+const benchChunk = 4096
+
+// RunBench implements `term bench [-s MiB] [-x width] [-y height]`,
+// feeding synthetic escape-heavy output through a pane's emulator and then
+// through it and the UI drawing onto a simulation screen, and printing
+// the throughput of each. It needs no daemon or terminal, so runs can be
+// compared before and after a change to parsing or drawing.
+func RunBench(args []string) int {
+	flags, args, err := protocol.ParseFlags(args, "s:x:y:")
+	size, width, height := 16, 120, 40
+	for flag, value := range flags {
+		n, convErr := strconv.Atoi(value)
+		if convErr != nil || n < 1 {
+			err = fmt.Errorf("bad -%c: %s", flag, value)
+		}
+		switch flag {
+		case 's':
+			size = n
+		case 'x':
+			width = n
+		case 'y':
+			height = n
+		}
+	}
+	if err != nil || len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: term bench [-s MiB] [-x width] [-y height]")
+		return 1
+	}
+	output := benchOutput(size << 20)
+
+	start := time.Now()
+	pb := vt.NewPaneBuffer(width, height)
+	for chunk := range slices.Chunk(output, benchChunk) {
+		pb.Write(chunk)
+	}
+	printBench("parse", len(output), time.Since(start), 0)
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer screen.Fini()
+	screen.SetSize(width, height+1) // +1 for the status line
+	ui := NewUI(screen)
+	pb = vt.NewPaneBuffer(width, height)
+	buffers := map[int]*vt.PaneBuffer{0: pb}
+	frames := 0
+	start = time.Now()
+	for chunk := range slices.Chunk(output, benchChunk) {
+		pb.Write(chunk)
+		ui.DrawScreen(buffers, 0, nil, "[bench]\t0:bench*\tPane: 0", "", "", nil, nil, nil)
+		frames++
+	}
+	printBench("render", len(output), time.Since(start), frames)
+	return 0
+}
+
+func printBench(name string, n int, elapsed time.Duration, frames int) {
+	mib := float64(n) / (1 << 20)
+	fmt.Printf("%-7s %.1f MiB in %s: %.1f MiB/s", name, mib, elapsed.Round(time.Millisecond), mib/elapsed.Seconds())
+	if frames > 0 {
+		fmt.Printf(", %d frames (%.0f/s)", frames, float64(frames)/elapsed.Seconds())
+	}
+	fmt.Println()
+}
+
+// benchOutput makes n bytes of output like a busy full-screen program
+// and a colourful build log together: SGR colours in the 256-colour and
+// truecolour forms, attributes, cursor movement, erasing, wide characters
+// and scrolling. It is the same every time, so runs compare.
+func benchOutput(n int) []byte {
+	r := rand.New(rand.NewSource(1))
+	words := []string{"build", "error:", "warning", "ok", "src/main.go:42", "漢字", "テスト", "→", "done", "0x1f3a"}
+	var b bytes.Buffer
+	for b.Len() < n {
+		switch r.Intn(8) {
+		case 0:
+			fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[K", r.Intn(40)+1, r.Intn(120)+1)
+		case 1:
+			fmt.Fprintf(&b, "\x1b[48;2;%d;%d;%dm", r.Intn(256), r.Intn(256), r.Intn(256))
+		case 2:
+			b.WriteString("\x1b[1;4m")
+		}
+		for range r.Intn(12) + 1 {
+			fmt.Fprintf(&b, "\x1b[38;5;%dm%s ", r.Intn(256), words[r.Intn(len(words))])
+		}
+		b.WriteString("\x1b[m\r\n")
+	}
+	return b.Bytes()[:n]
+}
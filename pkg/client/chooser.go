@@ -0,0 +1,199 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// Chooser is a list shown in an overlay that is filtered by fuzzy search as
+// the user types. Enter runs the command of the item under the cursor.
+type Chooser struct {
+	list    protocol.ChooserList
+	query   string
+	matches []int // positions in list.Items, best match first
+	cursor  int   // position in matches
+	rows    int   // matches shown at the last draw, for paging
+}
+
+func NewChooser(list protocol.ChooserList) *Chooser {
+	c := &Chooser{list: list, query: list.Query}
+	c.filter()
+	c.cursor = max(0, min(list.Selected, len(c.matches)-1))
+	return c
+}
+
+// filter finds the items matching the query. With no query every item is
+// kept in order.
+func (c *Chooser) filter() {
+	type match struct{ i, score int }
+	var found []match
+	for i, item := range c.list.Items {
+		if score, ok := fuzzyMatch(c.query, item.Text); ok {
+			found = append(found, match{i, score})
+		}
+	}
+	slices.SortStableFunc(found, func(a, b match) int { return b.score - a.score })
+	c.matches = c.matches[:0]
+	for _, m := range found {
+		c.matches = append(c.matches, m.i)
+	}
+	c.cursor = 0
+}
+
+// fuzzyMatch reports whether the letters of query appear in text in order,
+// ignoring case, and scores the match: letters that follow one another or
+// start a word count for more, and every letter skipped costs a little.
+func fuzzyMatch(query, text string) (int, bool) {
+	score := 0
+	q := []rune(strings.ToLower(query))
+	last := -2
+	prev := ' '
+	for i, r := range []rune(strings.ToLower(text)) {
+		if len(q) == 0 {
+			break
+		}
+		if r == q[0] {
+			switch {
+			case i == last+1:
+				score += 8
+			case !unicode.IsLetter(prev) && !unicode.IsDigit(prev):
+				score += 6
+			default:
+				score += 1
+			}
+			if last >= 0 {
+				score -= min(i-last-1, 4)
+			}
+			last = i
+			q = q[1:]
+		}
+		prev = r
+	}
+	return score, len(q) == 0
+}
+
+// Selected returns the item under the cursor, if any.
+func (c *Chooser) Selected() (protocol.ChooserItem, bool) {
+	if len(c.matches) == 0 {
+		return protocol.ChooserItem{}, false
+	}
+	return c.list.Items[c.matches[c.cursor]], true
+}
+
+// HandleChooserKey takes keys while a chooser is open: typing filters,
+// Up/Down and C-p/C-n move, PageUp/PageDown move a page, Tab copies the item's command into the query,
+// Enter picks and Escape or C-c closes. It returns the command to run for
+// the picked item.
+func (cs *ClientState) HandleChooserKey(ev *tcell.EventKey) (command string, handled bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	c := cs.chooser
+	if c == nil {
+		return "", false
+	}
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		cs.chooser = nil
+	case tcell.KeyEnter:
+		item, ok := c.Selected()
+		switch {
+		case c.list.RunQuery && (!ok || strings.Contains(strings.TrimSpace(c.query), " ")):
+			command = c.query // a command line with arguments
+		case ok:
+			command = item.Command
+		}
+		cs.chooser = nil
+	case tcell.KeyTab:
+		if item, ok := c.Selected(); ok && c.list.RunQuery {
+			c.query = item.Command + " "
+			c.filter()
+		}
+	case tcell.KeyUp, tcell.KeyCtrlP:
+		if c.cursor > 0 {
+			c.cursor--
+		}
+	case tcell.KeyDown, tcell.KeyCtrlN:
+		if c.cursor < len(c.matches)-1 {
+			c.cursor++
+		}
+	case tcell.KeyPgUp:
+		c.cursor = max(0, c.cursor-c.rows)
+	case tcell.KeyPgDn:
+		c.cursor = max(0, min(len(c.matches)-1, c.cursor+c.rows))
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if q := []rune(c.query); len(q) > 0 {
+			c.query = string(q[:len(q)-1])
+			c.filter()
+		}
+	case tcell.KeyCtrlU:
+		c.query = ""
+		c.filter()
+	case tcell.KeyRune:
+		c.query += string(ev.Rune())
+		c.filter()
+	}
+	cs.draw()
+	return command, true
+}
+
+// HandleChooserMessage opens a chooser with the list the daemon sent.
+func (cs *ClientState) HandleChooserMessage(payload []byte) {
+	var list protocol.ChooserList
+	if err := json.Unmarshal(payload, &list); err != nil {
+		return
+	}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.chooser = NewChooser(list)
+	cs.draw()
+}
+
+// drawChooser draws a chooser in a box in the middle of the screen: the
+// title, the query being typed and as many matches as fit, the one under
+// the cursor highlighted.
+func (ui *UI) drawChooser(c *Chooser) {
+	width, height := ui.screen.Size()
+	boxWidth := min(width-2, max(40, width*3/4))
+	boxHeight := min(height-2, max(5, len(c.list.Items)+3))
+	if boxWidth < 10 || boxHeight < 4 {
+		return
+	}
+	left, top := (width-boxWidth)/2, (height-boxHeight)/2
+	line := func(y int, text string, style vt.StyleID) {
+		for x := left; x < left+boxWidth; x++ {
+			ui.set(x, y, ' ', style)
+		}
+		ui.drawText(left+1, y, text, style, left+boxWidth-1)
+	}
+
+	title := c.list.Title
+	if len(c.list.Items) > 0 {
+		title = fmt.Sprintf("%s (%d/%d)", title, len(c.matches), len(c.list.Items))
+	}
+	line(top, title, ui.statusStyle)
+	line(top+1, "> "+c.query, vt.BlankCell.Style)
+	ui.screen.ShowCursor(left+3+runewidth.StringWidth(c.query), top+1)
+	rows := boxHeight - 2
+	c.rows = rows
+	first := max(0, c.cursor-rows+1)
+	for i := 0; i < rows; i++ {
+		style := vt.BlankCell.Style
+		text := ""
+		if n := first + i; n < len(c.matches) {
+			text = c.list.Items[c.matches[n]].Text
+			if n == c.cursor {
+				style = ui.selectionStyle
+			}
+		}
+		line(top+2+i, text, style)
+	}
+}
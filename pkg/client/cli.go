@@ -0,0 +1,128 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"term/pkg/protocol"
+)
+
+// Where the CLI and clients find the daemon: Socket is a socket path, @name
+// for an abstract socket (Linux) or tcp:host:port for a daemon's --listen
+// address. A daemon started because none is running there is given
+// DaemonFlags, term's global flags.
+var (
+	Socket      = protocol.SocketPath
+	DaemonFlags []string
+)
+
+// RunAttach implements `term attach [-c directory] [-t name]`, attaching
+// to the named session or the main one. -c sets the directory the
+// session's new windows start in.
+func RunAttach(args []string) int {
+	name, dir := "", ""
+	for len(args) >= 2 && (args[0] == "-t" || args[0] == "-c") {
+		if args[0] == "-t" {
+			name = args[1]
+		} else {
+			dir = args[1]
+		}
+		args = args[2:]
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: term attach [-c directory] [-t name]")
+		return 1
+	}
+	if name != "" {
+		if _, err := SendCommand([]string{"has-session", "-t", name}, false); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if dir != "" {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs // the CLI's working directory, not the daemon's
+		}
+		command := []string{"set-directory", dir}
+		if name != "" {
+			command = []string{"set-directory", "-t", name, dir}
+		}
+		if _, err := SendCommand(command, true); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return RunClient(name)
+}
+
+// SendCommand runs a command in the daemon and returns its output.
+func SendCommand(args []string, start bool) (string, error) {
+	conn, err := dialDaemon(start)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// Targets are relative to the pane the command runs in, if any
+	if inside := os.Getenv("TERM_MUX"); inside != "" {
+		conn.Write(protocol.Encode(protocol.MsgCLIPane, []byte(inside)))
+	}
+	payload, _ := json.Marshal(args)
+	if _, err := conn.Write(protocol.Encode(protocol.MsgCLICommand, payload)); err != nil { // one-shot command
+		return "", fmt.Errorf("error sending command: %w", err)
+	}
+
+	for {
+		msgType, payload, err := protocol.Read(conn)
+		if err != nil {
+			return "", fmt.Errorf("error reading reply: %w", err)
+		}
+		if msgType != protocol.MsgCLIResult { // command result
+			continue
+		}
+		var result struct {
+			Output string `json:"output"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(payload, &result); err != nil {
+			return "", fmt.Errorf("error decoding reply: %w", err)
+		}
+		if result.Error != "" {
+			return result.Output, errors.New(result.Error)
+		}
+		return result.Output, nil
+	}
+}
+
+// dialDaemon connects to the daemon, starting it first when start is set
+// and none is running.
+func dialDaemon(start bool) (net.Conn, error) {
+	conn, err := dial()
+	if err == nil {
+		return conn, nil
+	}
+	if !start || strings.HasPrefix(Socket, protocol.TCPPrefix) {
+		return nil, fmt.Errorf("no server running on %s", Socket)
+	}
+
+	cmd := exec.Command(os.Args[0], append(DaemonFlags, "daemon")...)
+	cmd.SysProcAttr = detachedProcess()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting daemon: %w", err)
+	}
+	for i := 0; i < 20; i++ {
+		conn, err = dial()
+		if err == nil {
+			return conn, nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("error connecting to daemon after starting it: %w", err)
+}
@@ -0,0 +1,444 @@
+// Package client is what runs in the user's terminal: it attaches to the
+// daemon, draws the panes it is sent and passes keys and mouse events on,
+// with copy mode, choosers and prompts handled locally. It also holds the
+// commands that need no daemon, such as headless, bench and
+// export-recording.
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gdamore/tcell/v2"
+	"github.com/hinshun/vt10x"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// RunClient attaches to session, or to the main session when it is empty,
+// and returns the exit status: 0 after detaching, 1 if the daemon went away
+// and 128 plus the signal number when a signal ended it. The terminal is
+// restored either way.
+func RunClient(session string) int {
+	// Attaching to our own daemon from inside one of its panes would feed the
+	// display back into itself
+	if inside := os.Getenv("TERM_MUX"); inside != "" && strings.Split(inside, ",")[0] == Socket {
+		fmt.Fprintln(os.Stderr, "sessions should be nested with care, unset $TERM_MUX to force")
+		return 1
+	}
+
+	// Piped or redirected, the display would be escape sequences in a file
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintln(os.Stderr, "not a terminal: the client needs one on standard output")
+		return 1
+	}
+
+	conn, err := dialDaemon(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+
+	if session != "" {
+		conn.Write(protocol.Encode(protocol.MsgAttachSession, []byte(session)))
+	}
+
+	// Let the session pick up SSH_AUTH_SOCK and friends from this terminal
+	if env, err := json.Marshal(os.Environ()); err == nil {
+		conn.Write(protocol.Encode(protocol.MsgEnvironment, env))
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err = screen.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	screen.EnableFocus()
+
+	// The terminal closing or the client being killed ends the event loop
+	// like detaching, so the screen is restored and the daemon told
+	chStop := make(chan os.Signal, 1)
+	notifyStop(chStop)
+	defer signal.Stop(chStop)
+	go func() {
+		for sig := range chStop {
+			screen.PostEvent(tcell.NewEventInterrupt(sig))
+		}
+	}()
+
+	// Initialize UI and client state
+	ui := NewUI(screen)
+	screen.SetStyle(ui.defStyle)
+	clientState := NewClientState(ui)
+
+	chWinSize := make(chan os.Signal, 1)
+	notifyResize(chWinSize)
+	go func() {
+		for range chWinSize {
+			screen.Sync()
+			width, height := screen.Size()
+			clientState.UpdatePaneBufferSizes()
+			ws := pty.Winsize{Rows: uint16(height - 1), Cols: uint16(width)} // -1 for status line
+			payload, err := json.Marshal(ws)
+			if err != nil {
+				continue
+			}
+
+			conn.Write(protocol.Encode(protocol.MsgResize, payload))
+		}
+	}()
+	chWinSize <- syscall.SIGWINCH // Initial resize
+
+	// Goroutine to handle incoming messages from the daemon
+	go func() {
+		for {
+			msgType, payload, err := protocol.Read(conn)
+			if err != nil {
+				screen.PostEvent(tcell.NewEventInterrupt(err))
+				return
+			}
+
+			clientState.HandleMessage(msgType, payload)
+		}
+	}()
+
+	// Input handling loop using tcell
+	input := &InputHandler{conn: conn, state: clientState, table: "root"}
+	var pending tcell.Event // read past committed text, handled next
+	for {
+		event := pending
+		if pending = nil; event == nil {
+			event = screen.PollEvent()
+		}
+		switch ev := event.(type) {
+		case *tcell.EventResize:
+			chWinSize <- syscall.SIGWINCH // Trigger resize handler
+		case *tcell.EventFocus:
+			payload, _ := json.Marshal(ev.Focused)
+			conn.Write(protocol.Encode(protocol.MsgFocus, payload))
+		case *tcell.EventKey:
+			text, next := input.committedText(screen, ev)
+			pending = next
+			if text != "" {
+				input.sendText(text)
+				continue
+			}
+			if detach := input.HandleKey(ev); detach {
+				conn.Write(protocol.Encode(protocol.MsgDetach, nil))
+				screen.Fini()
+				return 0
+			}
+		case *tcell.EventMouse:
+			input.HandleMouse(ev)
+		case *tcell.EventInterrupt:
+			screen.Fini()
+			if sig, ok := ev.Data().(syscall.Signal); ok {
+				conn.Write(protocol.Encode(protocol.MsgDetach, nil))
+				return 128 + int(sig)
+			}
+			fmt.Fprintln(os.Stderr, "lost connection to the daemon")
+			return 1
+		}
+	}
+}
+
+// InputHandler routes key events through the key tables, running bound
+// commands and sending everything else to the active pane.
+type InputHandler struct {
+	conn  net.Conn
+	state *ClientState
+	table string // key table the next key is looked up in
+
+	// After a repeatable binding, pressing the same key again within
+	// repeat-time runs it again without the prefix
+	repeatKey   string
+	repeatTable string
+	repeatUntil time.Time
+
+	// Bumped on every key so a pending hint popup knows it is stale
+	hintGen atomic.Uint64
+
+	// Mouse drag in progress: where button 1 went down and whether that
+	// entered copy mode
+	dragging     bool
+	dragX, dragY int
+	dragMoved    bool
+	dragEntered  bool
+
+	// Presses in the same place within doubleClickTime count up to a
+	// double or triple click; clickGen invalidates a pending clear
+	clicks    int
+	lastClick time.Time
+	clickGen  atomic.Uint64
+
+	middleDown bool // the middle button is held, so its press was handled
+
+	mouseToggles uint64 // ClientState.mouseToggles as of the last mouse event
+}
+
+// doubleClickTime is how close together clicks must be to select a word or
+// line, and how long that selection shows before it is copied and cleared.
+const doubleClickTime = 300 * time.Millisecond
+
+// HandleKey processes one key event and reports whether the client should
+// detach.
+func (ih *InputHandler) HandleKey(ev *tcell.EventKey) bool {
+	defer func() { ih.state.SetKeyTable(ih.table) }()
+	ih.hintGen.Add(1)
+	ih.state.SetOverlay("")
+	if url, handled := ih.state.HandleHintKey(ev); handled {
+		if url != "" {
+			ih.openURL(url)
+		}
+		return false
+	}
+	if command, handled := ih.state.HandleChooserKey(ev); handled {
+		if command != "" {
+			return ih.runCommand(command)
+		}
+		return false
+	}
+	if ih.table == "root" && ih.state.HandlePromptKey(ev) {
+		return false
+	}
+
+	name := vt.KeyName(ev)
+	table := ih.table
+	if name == ih.repeatKey && time.Now().Before(ih.repeatUntil) {
+		table = ih.repeatTable
+	}
+	ih.table = "root"
+	ih.repeatKey = ""
+
+	binding := ih.state.bindings.Lookup(table, name)
+	if table == "root" && ih.state.InCopyMode() {
+		// Copy mode keys come first and nothing reaches the pane
+		if b := ih.state.bindings.Lookup("copy-mode", name); b != nil {
+			binding = b
+		} else if binding == nil {
+			return false
+		}
+	}
+	if binding == nil {
+		if table == "prefix" && ev.Key() == tcell.KeyRune {
+			// Unrecognized command, send prefix and the command character
+			ih.sendPrefix()
+		}
+		if table == "root" || table == "prefix" {
+			ih.sendData(vt.KeyToBytes(ev, ih.keyMode()))
+		}
+		return false
+	}
+
+	if binding.Repeat && table != "root" {
+		ih.repeatKey = name
+		ih.repeatTable = table
+		ih.repeatUntil = time.Now().Add(time.Duration(ih.state.OptionNumber("repeat-time")) * time.Millisecond)
+	}
+	detach := ih.runCommand(binding.Command)
+	if ih.table != "root" {
+		ih.scheduleHint(ih.table)
+	}
+	return detach
+}
+
+// scheduleHint shows the bindings of table if no key is pressed within
+// which-key-delay.
+func (ih *InputHandler) scheduleHint(table string) {
+	delay := ih.state.OptionNumber("which-key-delay")
+	if delay <= 0 {
+		return
+	}
+	gen := ih.hintGen.Load()
+	time.AfterFunc(time.Duration(delay)*time.Millisecond, func() {
+		if ih.hintGen.Load() == gen {
+			ih.state.SetOverlay(ih.state.bindings.Hint(table))
+		}
+	})
+}
+
+// runCommand runs a bound command. Commands that only affect this client are
+// handled here; everything else is sent to the daemon.
+func (ih *InputHandler) runCommand(line string) bool {
+	args, err := protocol.ParseCommandLine(line)
+	if err != nil || len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "detach-client":
+		return true
+	case "send-prefix":
+		ih.sendPrefix()
+	case "switch-client":
+		if len(args) == 3 && args[1] == "-T" {
+			ih.table = args[2]
+		} else {
+			ih.sendCommand(args)
+		}
+	case "show-help":
+		ih.state.ShowHelp()
+	case "select-url":
+		if !ih.state.ShowURLHints() {
+			ih.state.SetOverlay("No URLs")
+		}
+	case "copy-mode":
+		ih.state.EnterCopyMode(len(args) == 2 && args[1] == "-u")
+	case "paste-primary":
+		ih.pastePrimary()
+	case "send-keys":
+		if len(args) == 3 && args[1] == "-X" {
+			switch args[2] {
+			case "copy-selection", "copy-selection-and-cancel":
+				ih.yank(ih.state.TakeSelection(args[2] == "copy-selection-and-cancel"))
+			default:
+				ih.state.CopyModeAction(args[2])
+			}
+		}
+	default:
+		ih.sendCommand(args)
+	}
+	return false
+}
+
+// sendCommand has the daemon run a command.
+func (ih *InputHandler) sendCommand(args []string) {
+	payload, _ := json.Marshal(args)
+	ih.conn.Write(protocol.Encode(protocol.MsgCommand, payload))
+}
+
+// HandleMouse scrolls with the wheel and selects by dragging with the left
+// button, copying the selection when the button is released. Pressing the
+// middle button runs the root table's MouseDown2Pane binding.
+func (ih *InputHandler) HandleMouse(ev *tcell.EventMouse) {
+	if toggles := ih.state.mouseToggles.Load(); toggles != ih.mouseToggles {
+		ih.mouseToggles = toggles
+		ih.dragging, ih.clicks = false, 0
+	}
+	if ih.state.Option("mouse") != "on" {
+		return // sent before it was turned off
+	}
+	x, y := ev.Position()
+	y-- // -1 for status line
+	buttons := ev.Buttons()
+	middle := buttons&tcell.Button3 != 0
+	middlePressed := middle && !ih.middleDown
+	ih.middleDown = middle
+	switch {
+	case middlePressed:
+		if b := ih.state.bindings.Lookup("root", "MouseDown2Pane"); b != nil && y >= 0 {
+			ih.runCommand(b.Command)
+		}
+	case buttons&tcell.WheelUp != 0:
+		ih.state.ScrollCopyMode(-3)
+	case buttons&tcell.WheelDown != 0:
+		ih.state.ScrollCopyMode(3)
+	case buttons&tcell.Button1 != 0 && !ih.dragging:
+		if y < 0 {
+			return
+		}
+		ih.clickGen.Add(1)
+		if ih.clicks > 0 && ih.clicks < 3 && x == ih.dragX && y == ih.dragY && time.Since(ih.lastClick) < doubleClickTime {
+			ih.clicks++
+		} else {
+			ih.clicks = 1
+			ih.dragEntered = !ih.state.InCopyMode()
+		}
+		ih.lastClick = time.Now()
+		ih.dragging, ih.dragMoved = true, false
+		ih.dragX, ih.dragY = x, y
+		if ih.clicks == 1 {
+			ih.state.SelectAt(x, y, true)
+		} else {
+			ih.state.SelectWordAt(x, y, ih.clicks == 3)
+		}
+	case buttons&tcell.Button1 != 0:
+		if x != ih.dragX || y != ih.dragY {
+			ih.dragMoved = true
+			ih.clicks = 0
+		}
+		ih.state.SelectAt(x, y, false)
+	case ih.dragging && buttons == tcell.ButtonNone:
+		ih.dragging = false
+		if ih.dragMoved {
+			ih.yank(ih.state.TakeSelection(true))
+		} else if ih.clicks > 1 {
+			// Copy the word or line now but leave it showing for a moment,
+			// unless another click comes first
+			ih.yank(ih.state.SelectionText())
+			gen, cancel := ih.clickGen.Load(), ih.dragEntered
+			time.AfterFunc(doubleClickTime, func() {
+				if ih.clickGen.Load() == gen {
+					ih.state.TakeSelection(cancel)
+				}
+			})
+		} else {
+			// A plain click drops the selection, and copy mode if the click
+			// started it
+			ih.state.TakeSelection(ih.dragEntered)
+		}
+	}
+}
+
+// openURL has the daemon open url with url-opener.
+func (ih *InputHandler) openURL(url string) {
+	command := ih.state.Option("url-opener") + " " + protocol.ShellQuote(url)
+	payload, _ := json.Marshal([]string{"run-shell", "-b", command})
+	ih.conn.Write(protocol.Encode(protocol.MsgCommand, payload))
+}
+
+// yank stores text as a paste buffer in the daemon and, with set-clipboard
+// on, in the outer terminal's clipboard, and with set-primary on in the
+// primary selection.
+func (ih *InputHandler) yank(text string) {
+	if text == "" {
+		return
+	}
+	ih.conn.Write(protocol.Encode(protocol.MsgYank, []byte(text)))
+	if ih.state.Option("set-clipboard") == "on" {
+		ih.state.ui.WriteRaw([]byte("\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x07"))
+	}
+	if ih.state.Option("set-primary") == "on" {
+		setPrimary(text)
+	}
+}
+
+func (ih *InputHandler) keyMode() vt.KeyMode {
+	keys := ih.state.ActiveKeyEncoding()
+	return vt.KeyMode{
+		AppCursor:       ih.state.ActivePaneMode()&vt10x.ModeAppCursor != 0,
+		Meta8bit:        ih.state.Option("meta-encoding") == "8bit",
+		ModifyOtherKeys: keys.ModifyOtherKeys,
+		KeyboardFlags:   keys.KeyboardFlags,
+	}
+}
+
+// sendPrefix passes the prefix key through to the pane, which is how a
+// nested session's prefix is reached.
+func (ih *InputHandler) sendPrefix() {
+	ih.sendData([]byte{prefixKey})
+}
+
+func (ih *InputHandler) sendData(data []byte) {
+	if len(data) > 0 {
+		ih.conn.Write(protocol.Encode(protocol.MsgData, data))
+	}
+}
+
+const (
+	prefixKey = '\x01' // Ctrl+a
+)
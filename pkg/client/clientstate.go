@@ -0,0 +1,433 @@
+package client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hinshun/vt10x"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// ClientState is shared by the message handler, the input loop and timers;
+// mutex guards the pane buffers, status and overlay.
+type ClientState struct {
+	paneBuffers  map[int]*vt.PaneBuffer
+	activePaneID int
+	status       string
+	ui           *UI
+	bindings     *protocol.KeyBindings
+	overlay      string // shown on top of the panes, e.g. key hints
+	keyEncodings map[int]protocol.KeyEncoding
+	copyMode     *CopyMode // nil while showing live output
+	urlHints     []urlHint // labels shown by select-url
+	hintTyped    string
+	floats       []protocol.FloatInfo // bottom first
+	chooser      *Chooser             // nil unless choosing from a list
+	keyTable     string               // table waiting for a key, shown on the status line unless root
+	mutex        sync.Mutex
+
+	// A notice or error from the daemon, shown instead of the status line
+	// until messageTimer clears it
+	message      protocol.Message
+	messageTimer *time.Timer
+
+	// Frame scheduling: the screen is drawn at most once per frameInterval,
+	// by a timer for draws asked for too soon after the last
+	lastDraw  time.Time
+	drawTimer *time.Timer // nil unless a draw is scheduled
+	images    []vt.Image  // drawn over the next frame
+
+	// Daemon options, read by the input loop as well as the message handler
+	options      map[string]string
+	optionsMutex sync.Mutex
+
+	// Bumped whenever the mouse option changes, so a drag cut short by
+	// turning the mouse off is not taken up again when it is turned on
+	mouseToggles atomic.Uint64
+}
+
+func NewClientState(ui *UI) *ClientState {
+	width, height := ui.Size()
+	paneBuffers := make(map[int]*vt.PaneBuffer)
+	activePaneID := 0
+
+	// Create initial pane buffer
+	paneBuffers[activePaneID] = vt.NewPaneBuffer(width, height-1) // -1 for status line
+
+	return &ClientState{
+		paneBuffers:  paneBuffers,
+		activePaneID: activePaneID,
+		status:       fmt.Sprintf("Pane: %d", activePaneID),
+		ui:           ui,
+		bindings:     protocol.NewKeyBindings(), // replaced by the daemon's table on attach
+		keyEncodings: make(map[int]protocol.KeyEncoding),
+	}
+}
+
+// HandleMessage acts on a message from the daemon.
+func (cs *ClientState) HandleMessage(msgType byte, payload []byte) {
+	switch msgType {
+	case protocol.MsgData:
+		cs.HandleDataMessage(payload)
+	case protocol.MsgResize: // only sent by clients
+	case protocol.MsgRedraw:
+		cs.HandleRedrawMessage(payload)
+	case protocol.MsgNewPane:
+		cs.HandleNewPaneMessage(payload)
+	case protocol.MsgSwitchPane:
+		cs.HandleSwitchPaneMessage(payload)
+	case protocol.MsgOptions:
+		cs.HandleOptionsMessage(payload)
+	case protocol.MsgKeyBindings:
+		cs.HandleKeyBindingsMessage(payload)
+	case protocol.MsgKeyEncoding:
+		cs.HandleKeyEncodingMessage(payload)
+	case protocol.MsgFloats:
+		cs.HandleFloatsMessage(payload)
+	case protocol.MsgChooser:
+		cs.HandleChooserMessage(payload)
+	case protocol.MsgSnapshot:
+		cs.HandleSnapshotMessage(payload)
+	case protocol.MsgTitle:
+		cs.HandleTitleMessage(payload)
+	case protocol.MsgMessage:
+		cs.HandleMessageMessage(payload)
+	}
+}
+
+func (cs *ClientState) HandleDataMessage(payload []byte) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if len(payload) >= 4 {
+		paneID := int(binary.BigEndian.Uint32(payload[:4]))
+		data := payload[4:]
+		cs.ensurePaneBuffer(paneID)
+		if pb, ok := cs.paneBuffers[paneID]; ok {
+			pb.SetHistoryLimit(cs.OptionNumber("history-limit"), cs.OptionNumber("history-memory")*1024)
+			pb.SetImageSupport(cs.imageSupport(paneID))
+			pb.Write(data)
+			for _, payload := range pb.TakePassthrough() {
+				// Only the visible pane may talk to the outer terminal
+				if paneID == cs.activePaneID && cs.Option("allow-passthrough") == "on" {
+					cs.ui.WriteRaw(payload)
+				}
+			}
+			// Only redraw if this pane is showing
+			if paneID == cs.activePaneID || cs.floatShown(paneID) {
+				cs.images = append(cs.images, pb.TakeImages()...)
+				cs.draw()
+			}
+		}
+	}
+}
+
+// ensurePaneBuffer creates the buffer of a pane that existed before this
+// client attached. The caller must hold cs.mutex.
+func (cs *ClientState) ensurePaneBuffer(paneID int) {
+	if _, ok := cs.paneBuffers[paneID]; !ok {
+		width, height := cs.ui.Size()
+		cs.paneBuffers[paneID] = vt.NewPaneBuffer(width, height-1) // -1 for status line
+		if f := cs.findFloat(paneID); f != nil {
+			cs.paneBuffers[paneID].Resize(f.Width-2, f.Height-2)
+		}
+	}
+}
+
+func (cs *ClientState) HandleRedrawMessage(payload []byte) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.status = string(payload)
+	cs.draw()
+}
+
+// HandleMessageMessage shows a notice or error from the daemon in place of
+// the status line for display-time milliseconds, or until the next one.
+func (cs *ClientState) HandleMessageMessage(payload []byte) {
+	var msg protocol.Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return
+	}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.showMessage(msg)
+}
+
+// showMessage shows a message instead of the status line for
+// display-time. The caller must hold cs.mutex.
+func (cs *ClientState) showMessage(msg protocol.Message) {
+	delay := time.Duration(cs.OptionNumber("display-time")) * time.Millisecond
+	cs.message = msg
+	if cs.messageTimer != nil {
+		cs.messageTimer.Stop()
+	}
+	cs.messageTimer = time.AfterFunc(delay, func() {
+		cs.mutex.Lock()
+		defer cs.mutex.Unlock()
+		if cs.message == msg {
+			cs.message = protocol.Message{}
+			cs.draw()
+		}
+	})
+	cs.draw()
+}
+
+func (cs *ClientState) HandleNewPaneMessage(payload []byte) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	var newPaneID int
+	if err := json.Unmarshal(payload, &newPaneID); err == nil {
+		width, height := cs.ui.Size()
+		cs.paneBuffers[newPaneID] = vt.NewPaneBuffer(width, height-1)
+		cs.activePaneID = newPaneID // Switch to new pane
+		cs.copyMode = nil
+		cs.status = fmt.Sprintf("Pane: %d", cs.activePaneID)
+		cs.draw()
+	}
+}
+
+// HandleTitleMessage sets the outer terminal's title for set-titles.
+func (cs *ClientState) HandleTitleMessage(payload []byte) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.ui.SetTitle(string(payload))
+}
+
+func (cs *ClientState) HandleSwitchPaneMessage(payload []byte) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	var targetPaneID int
+	if err := json.Unmarshal(payload, &targetPaneID); err == nil {
+		cs.ensurePaneBuffer(targetPaneID)
+		cs.activePaneID = targetPaneID
+		cs.copyMode = nil
+		cs.status = fmt.Sprintf("Pane: %d", cs.activePaneID)
+		cs.draw()
+	}
+}
+
+func (cs *ClientState) HandleOptionsMessage(payload []byte) {
+	var options map[string]string
+	if err := json.Unmarshal(payload, &options); err == nil {
+		cs.optionsMutex.Lock()
+		changed := cs.options["mouse"] != options["mouse"]
+		cs.options = options
+		cs.optionsMutex.Unlock()
+		if changed {
+			cs.mouseToggles.Add(1)
+			cs.ui.SetMouse(options["mouse"] == "on")
+		}
+		cs.ui.SetAmbiguousWidth(options["ambiguous-width"])
+		cs.mutex.Lock()
+		cs.ui.SetPaneStyles(options["window-style"], options["window-active-style"])
+		cs.ui.SetStatusJustify(options["status-justify"])
+		cs.draw()
+		cs.mutex.Unlock()
+	}
+}
+
+func (cs *ClientState) HandleKeyBindingsMessage(payload []byte) {
+	var tables map[string]protocol.KeyTable
+	if err := json.Unmarshal(payload, &tables); err == nil {
+		cs.bindings.SetTables(tables)
+	}
+}
+
+func (cs *ClientState) HandleKeyEncodingMessage(payload []byte) {
+	var keys protocol.KeyEncoding
+	if err := json.Unmarshal(payload, &keys); err == nil {
+		cs.mutex.Lock()
+		cs.keyEncodings[keys.PaneID] = keys
+		cs.mutex.Unlock()
+	}
+}
+
+func (cs *ClientState) Option(name string) string {
+	cs.optionsMutex.Lock()
+	defer cs.optionsMutex.Unlock()
+	return cs.options[name]
+}
+
+func (cs *ClientState) OptionNumber(name string) int {
+	n, _ := strconv.Atoi(cs.Option(name))
+	return n
+}
+
+func (cs *ClientState) UpdatePaneBufferSizes() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	width, height := cs.ui.Size()
+	for paneID, pb := range cs.paneBuffers {
+		if cs.findFloat(paneID) == nil { // floats keep their own size
+			pb.Resize(width, height-1) // -1 for status line
+		}
+	}
+}
+
+// HandleFloatsMessage takes the daemon's list of floats and sizes their
+// buffers to fit inside the borders.
+func (cs *ClientState) HandleFloatsMessage(payload []byte) {
+	var floats []protocol.FloatInfo
+	if err := json.Unmarshal(payload, &floats); err != nil {
+		return
+	}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.floats = floats
+	for _, f := range floats {
+		cs.ensurePaneBuffer(f.PaneID)
+		cs.paneBuffers[f.PaneID].Resize(f.Width-2, f.Height-2)
+	}
+	cs.draw()
+}
+
+// findFloat returns the float showing paneID, or nil. The caller must hold
+// cs.mutex.
+func (cs *ClientState) findFloat(paneID int) *protocol.FloatInfo {
+	for i := range cs.floats {
+		if cs.floats[i].PaneID == paneID {
+			return &cs.floats[i]
+		}
+	}
+	return nil
+}
+
+func (cs *ClientState) floatShown(paneID int) bool {
+	f := cs.findFloat(paneID)
+	return f != nil && f.Visible
+}
+
+// visibleFloats returns the floats to draw, bottom first. The caller must
+// hold cs.mutex.
+func (cs *ClientState) visibleFloats() []protocol.FloatInfo {
+	var floats []protocol.FloatInfo
+	for _, f := range cs.floats {
+		if f.Visible {
+			floats = append(floats, f)
+		}
+	}
+	return floats
+}
+
+// inputPaneID returns the pane keys go to: the top float while one is
+// shown, else the active pane. The caller must hold cs.mutex.
+func (cs *ClientState) inputPaneID() int {
+	if floats := cs.visibleFloats(); len(floats) > 0 {
+		return floats[len(floats)-1].PaneID
+	}
+	return cs.activePaneID
+}
+
+// SetOverlay shows text on top of the panes until it is replaced or cleared
+// with an empty string.
+func (cs *ClientState) SetOverlay(text string) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if cs.overlay != text {
+		cs.overlay = text
+		cs.draw()
+	}
+}
+
+// SetKeyTable shows on the status line that the next key is looked up in
+// table, such as after the prefix.
+func (cs *ClientState) SetKeyTable(table string) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if cs.keyTable != table {
+		cs.keyTable = table
+		cs.draw()
+	}
+}
+
+func (cs *ClientState) Draw() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.draw()
+}
+
+// frameInterval is the least time between two draws, so a burst of
+// messages is drawn once rather than once each.
+const frameInterval = 8 * time.Millisecond
+
+// draw redraws the screen now, or at the end of the frame if the last draw
+// was too recent. The caller must hold cs.mutex.
+func (cs *ClientState) draw() {
+	if cs.drawTimer != nil {
+		return // already coming
+	}
+	wait := frameInterval - time.Since(cs.lastDraw)
+	if wait <= 0 {
+		cs.drawNow()
+		return
+	}
+	cs.drawTimer = time.AfterFunc(wait, func() {
+		cs.mutex.Lock()
+		defer cs.mutex.Unlock()
+		cs.drawTimer = nil
+		cs.drawNow()
+	})
+}
+
+func (cs *ClientState) drawNow() {
+	cs.lastDraw = time.Now()
+	var copyMode *CopyMode
+	status, isError := cs.status, false
+	if cs.message.Text != "" {
+		status, isError = cs.message.Text, cs.message.Error
+	}
+	if cs.inCopyMode() {
+		copyMode = cs.copyMode
+		if prompt := copyMode.statusPrompt(); prompt != "" {
+			status, isError = prompt, false
+		}
+	}
+	cs.ui.SetStatusError(isError)
+	var hints []urlHint
+	for _, h := range cs.urlHints {
+		if strings.HasPrefix(h.label, cs.hintTyped) {
+			hints = append(hints, h)
+		}
+	}
+	var table string
+	if cs.keyTable != "" && cs.keyTable != "root" {
+		table = cs.bindings.TableLabel(cs.keyTable)
+	}
+	cs.ui.DrawScreen(cs.paneBuffers, cs.activePaneID, cs.visibleFloats(), status, table, cs.overlay, copyMode, hints, cs.chooser)
+	// Images go over the cells just drawn
+	for _, img := range cs.images {
+		cs.ui.DrawImage(img.X, img.Y+1, img.Data) // +1 for the status line
+	}
+	cs.images = nil
+}
+
+// ActivePaneMode returns the terminal modes of the pane keys go to.
+func (cs *ClientState) ActivePaneMode() vt10x.ModeFlag {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if pb, ok := cs.paneBuffers[cs.inputPaneID()]; ok {
+		return pb.Mode()
+	}
+	return 0
+}
+
+// ActiveKeyEncoding returns the extended key encoding the pane keys go to
+// asked for.
+func (cs *ClientState) ActiveKeyEncoding() protocol.KeyEncoding {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.keyEncodings[cs.inputPaneID()]
+}
+
+func (cs *ClientState) GetActivePaneID() int {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.activePaneID
+}
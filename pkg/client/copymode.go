@@ -0,0 +1,399 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+
+	"term/pkg/vt"
+)
+
+// CopyMode is a scrolled view of a pane's history. The view stays on the
+// same lines while output continues underneath it.
+type CopyMode struct {
+	paneID int
+	top    int // line number of the first visible line
+
+	search        string       // last search, repeated by n and N
+	searchForward bool         // direction of the last search
+	match         *searchMatch // current match, highlighted
+	prompt        *searchPrompt
+	selection     *vt.Selection
+	promptLine    *int // shell prompt last jumped to
+}
+
+// searchMatch is the position of a match by line number and column.
+type searchMatch struct {
+	line, col, length int
+}
+
+// searchPrompt is an incremental search being typed. Each change searches
+// again from where the prompt was opened, which is restored on cancel.
+type searchPrompt struct {
+	text    []rune
+	forward bool
+	top     int
+	match   *searchMatch
+}
+
+// copyModeActions are the actions of send-keys -X, moving the view by a
+// number of lines computed from the pane height. Moving down to the live
+// screen leaves copy mode.
+var copyModeActions = map[string]func(height int) int{
+	"scroll-up":      func(h int) int { return -1 },
+	"scroll-down":    func(h int) int { return 1 },
+	"page-up":        func(h int) int { return -h },
+	"page-down":      func(h int) int { return h },
+	"halfpage-up":    func(h int) int { return -h / 2 },
+	"halfpage-down":  func(h int) int { return h / 2 },
+	"history-top":    func(h int) int { return -1 << 30 },
+	"history-bottom": func(h int) int { return 1 << 30 },
+}
+
+// EnterCopyMode starts copy mode on the active pane, scrolled up a page if
+// pageUp is set. It is a no-op apart from the scroll if already active.
+func (cs *ClientState) EnterCopyMode(pageUp bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	pb, ok := cs.paneBuffers[cs.activePaneID]
+	if !ok {
+		return
+	}
+	if !cs.inCopyMode() {
+		cs.copyMode = &CopyMode{paneID: cs.activePaneID, top: pb.LiveTop()}
+	}
+	if pageUp {
+		_, height := pb.Size()
+		cs.moveCopyMode(pb, -height)
+	}
+	cs.draw()
+}
+
+// SelectAt starts a selection at a cell of the active pane, entering copy
+// mode if needed, or extends the current one to it.
+func (cs *ClientState) SelectAt(x, y int, start bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	pb, ok := cs.paneBuffers[cs.activePaneID]
+	if !ok {
+		return
+	}
+	if !cs.inCopyMode() {
+		cs.copyMode = &CopyMode{paneID: cs.activePaneID, top: pb.LiveTop()}
+	}
+	cm := cs.copyMode
+	width, height := pb.Size()
+	line, col := cm.top+min(max(y, 0), height-1), min(max(x, 0), width-1)
+	if start || cm.selection == nil {
+		cm.selection = &vt.Selection{StartLine: line, StartCol: col}
+	}
+	cm.selection.EndLine, cm.selection.EndCol = line, col
+	cs.draw()
+}
+
+// SelectWordAt selects the word under a cell of the active pane, or with
+// line set the whole line, entering copy mode if needed. Words are broken
+// at spaces and the word-separators option.
+func (cs *ClientState) SelectWordAt(x, y int, line bool) {
+	separators := " " + cs.Option("word-separators")
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	pb, ok := cs.paneBuffers[cs.activePaneID]
+	if !ok {
+		return
+	}
+	if !cs.inCopyMode() {
+		cs.copyMode = &CopyMode{paneID: cs.activePaneID, top: pb.LiveTop()}
+	}
+	cm := cs.copyMode
+	width, height := pb.Size()
+	n, col := cm.top+min(max(y, 0), height-1), min(max(x, 0), width-1)
+	text := pb.Lines(n, 1)[0].Text()
+	start, end := 0, len(text)-1
+	if !line && col < len(text) && !strings.ContainsRune(separators, text[col]) {
+		for start = col; start > 0 && !strings.ContainsRune(separators, text[start-1]); start-- {
+		}
+		for end = col; end < len(text)-1 && !strings.ContainsRune(separators, text[end+1]); end++ {
+		}
+	} else if !line {
+		start, end = col, col
+	}
+	cm.selection = &vt.Selection{StartLine: n, StartCol: start, EndLine: n, EndCol: end}
+	cs.draw()
+}
+
+// SelectionText returns the selected text, or "" if there is none.
+func (cs *ClientState) SelectionText() string {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if !cs.inCopyMode() || cs.copyMode.selection == nil {
+		return ""
+	}
+	return cs.copyMode.selection.Text(cs.paneBuffers[cs.copyMode.paneID])
+}
+
+// TakeSelection returns the selected text and clears the selection, leaving
+// copy mode too if cancel is set.
+func (cs *ClientState) TakeSelection(cancel bool) string {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if !cs.inCopyMode() {
+		return ""
+	}
+	text := ""
+	if sel := cs.copyMode.selection; sel != nil {
+		text = sel.Text(cs.paneBuffers[cs.copyMode.paneID])
+	}
+	cs.copyMode.selection = nil
+	if cancel {
+		cs.copyMode = nil
+	}
+	cs.draw()
+	return text
+}
+
+// ScrollCopyMode scrolls the active pane by delta lines, entering copy mode
+// to scroll up.
+func (cs *ClientState) ScrollCopyMode(delta int) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	pb, ok := cs.paneBuffers[cs.activePaneID]
+	if !ok {
+		return
+	}
+	if !cs.inCopyMode() {
+		if delta > 0 {
+			return
+		}
+		cs.copyMode = &CopyMode{paneID: cs.activePaneID, top: pb.LiveTop()}
+	}
+	cs.moveCopyMode(pb, delta)
+	cs.draw()
+}
+
+// CopyModeAction runs a send-keys -X action.
+func (cs *ClientState) CopyModeAction(action string) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if !cs.inCopyMode() {
+		return fmt.Errorf("not in copy mode")
+	}
+	pb := cs.paneBuffers[cs.copyMode.paneID]
+	cm := cs.copyMode
+	switch action {
+	case "cancel":
+		cs.copyMode = nil
+	case "search-forward-incremental", "search-backward-incremental":
+		cm.prompt = &searchPrompt{forward: action == "search-forward-incremental", top: cm.top, match: cm.match}
+	case "previous-prompt", "next-prompt":
+		if err := cm.jumpToPrompt(pb, action == "next-prompt"); err != nil {
+			return err
+		}
+	case "select-output":
+		if err := cm.selectOutput(pb); err != nil {
+			return err
+		}
+	case "search-again", "search-reverse":
+		if cm.search == "" {
+			return fmt.Errorf("no previous search")
+		}
+		forward := cm.searchForward == (action == "search-again")
+		cm.searchFrom(pb, cm.search, forward, cm.searchStart(pb, forward, true))
+	default:
+		move, ok := copyModeActions[action]
+		if !ok {
+			return fmt.Errorf("unknown copy mode action: %s", action)
+		}
+		_, height := pb.Size()
+		cs.moveCopyMode(pb, move(height))
+	}
+	cs.draw()
+	return nil
+}
+
+// HandlePromptKey edits the search prompt if one is open, reporting whether
+// it used the key.
+func (cs *ClientState) HandlePromptKey(ev *tcell.EventKey) bool {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if !cs.inCopyMode() || cs.copyMode.prompt == nil {
+		return false
+	}
+	cm := cs.copyMode
+	p := cm.prompt
+	pb := cs.paneBuffers[cm.paneID]
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		cm.prompt = nil
+		if len(p.text) > 0 {
+			cm.search, cm.searchForward = string(p.text), p.forward
+		}
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		cm.prompt = nil
+		cm.top, cm.match = p.top, p.match
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+		}
+	case tcell.KeyRune:
+		p.text = append(p.text, ev.Rune())
+	}
+	if cm.prompt != nil {
+		// Search again from the start for the text so far
+		cm.top, cm.match = p.top, p.match
+		if len(p.text) > 0 {
+			cm.searchFrom(pb, string(p.text), p.forward, cm.searchStart(pb, p.forward, false))
+		}
+	}
+	cs.draw()
+	return true
+}
+
+// searchStart is where a search begins: the current match, or else the top
+// or bottom of the view. With again set a match at the start is skipped.
+func (cm *CopyMode) searchStart(pb *vt.PaneBuffer, forward, again bool) searchMatch {
+	var start searchMatch
+	switch {
+	case cm.match != nil:
+		start = *cm.match
+		if again && forward {
+			start.col++
+		} else if again {
+			start.col--
+		}
+	case forward:
+		start = searchMatch{line: cm.top}
+	default:
+		width, height := pb.Size()
+		start = searchMatch{line: cm.top + height - 1, col: width}
+	}
+	return start
+}
+
+// searchFrom finds text from start, wrapping around the history, and
+// scrolls to the match. The view is left alone if there is none.
+func (cm *CopyMode) searchFrom(pb *vt.PaneBuffer, text string, forward bool, start searchMatch) {
+	_, height := pb.Size()
+	first := pb.HistoryBase()
+	lines := vt.RowsText(pb.Lines(first, pb.LiveTop()+height-first))
+	m, ok := findText(lines, compileSearch(text), forward, start.line-first, start.col)
+	if !ok {
+		cm.match = nil
+		return
+	}
+	m.line += first
+	cm.match = &m
+	cm.promptLine = nil
+	if m.line < cm.top || m.line >= cm.top+height {
+		cm.top = min(max(m.line-height/2, pb.HistoryBase()), pb.LiveTop())
+	}
+}
+
+// compileSearch turns search text into a regular expression. Text that
+// isn't a valid expression, such as a half typed one, is matched literally.
+// Matching ignores case unless the text has capitals.
+func compileSearch(text string) *regexp.Regexp {
+	flags := ""
+	if strings.ToLower(text) == text {
+		flags = "(?i)"
+	}
+	re, err := regexp.Compile(flags + text)
+	if err != nil {
+		re = regexp.MustCompile(flags + regexp.QuoteMeta(text))
+	}
+	return re
+}
+
+// lineMatches returns the non-empty matches of re in line as rune columns.
+func lineMatches(re *regexp.Regexp, line []rune) []searchMatch {
+	s := string(line)
+	var matches []searchMatch
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		if loc[1] > loc[0] {
+			col := utf8.RuneCountInString(s[:loc[0]])
+			matches = append(matches, searchMatch{col: col, length: utf8.RuneCountInString(s[loc[0]:loc[1]])})
+		}
+	}
+	return matches
+}
+
+// findText searches lines for re starting at line, col and wrapping around.
+func findText(lines [][]rune, re *regexp.Regexp, forward bool, line, col int) (searchMatch, bool) {
+	if len(lines) == 0 {
+		return searchMatch{}, false
+	}
+	line = min(max(line, 0), len(lines)-1)
+	for n := 0; n <= len(lines); n++ {
+		y := line
+		if forward {
+			y = (line + n) % len(lines)
+		} else {
+			y = ((line-n)%len(lines) + len(lines)) % len(lines)
+		}
+		matches := lineMatches(re, lines[y])
+		if !forward {
+			slices.Reverse(matches)
+		}
+		for _, m := range matches {
+			// The start line is searched from col on the first pass and in
+			// full once the search has wrapped around
+			if n == 0 && (forward && m.col < col || !forward && m.col > col) {
+				continue
+			}
+			m.line = y
+			return m, true
+		}
+	}
+	return searchMatch{}, false
+}
+
+// highlightPattern is the search whose matches are highlighted: the one
+// being typed, or else the last one.
+func (cm *CopyMode) highlightPattern() *regexp.Regexp {
+	text := cm.search
+	if cm.prompt != nil {
+		text = string(cm.prompt.text)
+	}
+	if text == "" {
+		return nil
+	}
+	return compileSearch(text)
+}
+
+// statusPrompt returns the search prompt to show in place of the status
+// line, or "" if there is none.
+func (cm *CopyMode) statusPrompt() string {
+	if cm.prompt == nil {
+		return ""
+	}
+	if cm.prompt.forward {
+		return "(search down) " + string(cm.prompt.text)
+	}
+	return "(search up) " + string(cm.prompt.text)
+}
+
+// moveCopyMode scrolls the copy mode view by delta lines, leaving copy mode
+// when it reaches the live screen. The caller must hold cs.mutex.
+func (cs *ClientState) moveCopyMode(pb *vt.PaneBuffer, delta int) {
+	cs.copyMode.promptLine = nil
+	top := min(max(cs.copyMode.top+delta, pb.HistoryBase()), pb.LiveTop())
+	if top == pb.LiveTop() && delta > 0 {
+		cs.copyMode = nil
+		return
+	}
+	cs.copyMode.top = top
+}
+
+func (cs *ClientState) InCopyMode() bool {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.inCopyMode()
+}
+
+func (cs *ClientState) inCopyMode() bool {
+	return cs.copyMode != nil && cs.copyMode.paneID == cs.activePaneID
+}
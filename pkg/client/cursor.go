@@ -0,0 +1,33 @@
+package client
+
+import (
+	"github.com/gdamore/tcell/v2"
+
+	"term/pkg/vt"
+)
+
+// applyCursor gives the outer terminal's cursor the shape and color of the
+// pane showing it. A color is reset once when a pane without one takes over
+// from a pane with one, since tcell writes the reset on every frame.
+func (ui *UI) applyCursor(pb *vt.PaneBuffer) {
+	color, ok := pb.CursorColor() // the default leaves it alone
+	if ok {
+		ui.cursorColored = true
+	} else if ui.cursorColored {
+		color = tcell.ColorReset
+		ui.cursorColored = false
+	}
+	ui.screen.SetCursorStyle(pb.CursorStyle(), color)
+}
+
+// showCursor puts the outer cursor at x, y in the shape and color of the
+// pane, or hides it if the pane's application hid its cursor.
+func (ui *UI) showCursor(pb *vt.PaneBuffer, x, y int) {
+	if !pb.CursorVisible() {
+		ui.screen.HideCursor()
+		ui.parkCursor(x, y)
+		return
+	}
+	ui.screen.ShowCursor(x, y)
+	ui.applyCursor(pb)
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// RunSubscribe implements `term subscribe [event...]`, printing each event
+// from the daemon as a line of JSON until interrupted.
+func RunSubscribe(events []string) int {
+	conn, err := dialDaemon(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+	payload, _ := json.Marshal(events)
+	conn.Write(protocol.Encode(protocol.MsgSubscribe, payload))
+	for {
+		msgType, payload, err := protocol.Read(conn)
+		if err != nil {
+			return 0
+		}
+		switch msgType {
+		case protocol.MsgEvent:
+			fmt.Println(string(payload))
+		case protocol.MsgCLIResult:
+			var result struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal(payload, &result)
+			fmt.Fprintln(os.Stderr, strings.TrimSpace(result.Error))
+			return 1
+		}
+	}
+}
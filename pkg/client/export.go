@@ -0,0 +1,528 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// Frames are taken from a recording when output pauses for
+// recordingFrameGap, and at least every recordingMaxFrameGap while it
+// keeps coming. Pauses longer than the recording's idle_time_limit, or
+// recordingIdleLimit, are shortened to it, and the last frame is held for
+// recordingEndHold before the animation starts again.
+const (
+	recordingFrameGap    = 20 * time.Millisecond
+	recordingMaxFrameGap = 100 * time.Millisecond
+	recordingIdleLimit   = 2 * time.Second
+	recordingEndHold     = 2 * time.Second
+)
+
+// Default colours of exported recordings.
+var (
+	recordingFG = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+	recordingBG = color.RGBA{0x1e, 0x1e, 0x1e, 0xff}
+)
+
+// recordingFrame is the screen at one moment of a recording.
+type recordingFrame struct {
+	at               time.Duration
+	rows             []vt.Row
+	cursorX, cursorY int
+	cursor           bool
+}
+
+// same reports whether two frames look the same.
+func (f recordingFrame) same(other recordingFrame) bool {
+	return f.cursor == other.cursor && f.cursorX == other.cursorX && f.cursorY == other.cursorY &&
+		slices.EqualFunc(f.rows, other.rows, slices.Equal)
+}
+
+// RunExportRecording implements
+// `term export-recording [--format gif|svg] [-o file] file.cast`, playing
+// an asciicast v2 recording (asciinema's format) through a pane's emulator
+// and writing the screens as an animated SVG, with real text, or GIF,
+// drawn with a small built-in font that has ASCII only. The format
+// defaults to the -o file's extension, else svg, and the file to the
+// recording's name with that extension.
+func RunExportRecording(args []string) int {
+	format, args, err := protocol.LongFlag(args, "format")
+	var flags map[byte]string
+	if err == nil {
+		flags, args, err = protocol.ParseFlags(args, "o:")
+	}
+	output := flags['o']
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(output), ".")
+		if format != "gif" {
+			format = "svg"
+		}
+	}
+	if err != nil || len(args) != 1 || format != "gif" && format != "svg" {
+		fmt.Fprintln(os.Stderr, "usage: term export-recording [--format gif|svg] [-o file] file.cast")
+		return 1
+	}
+	if output == "" {
+		output = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + "." + format
+	}
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer in.Close()
+	width, height, frames, err := readRecording(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	out, err := os.Create(output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if format == "gif" {
+		err = writeRecordingGIF(out, width, height, frames)
+	} else {
+		err = writeRecordingSVG(out, width, height, frames)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", output, err)
+		return 1
+	}
+	fmt.Printf("%s: %d frames, %s\n", output, len(frames), frames[len(frames)-1].at.Round(time.Millisecond))
+	return 0
+}
+
+// readRecording plays an asciicast v2 recording into a vt.PaneBuffer of its
+// size and returns the frames. Input and resize events are skipped: the
+// screen keeps the size in the header.
+func readRecording(r io.Reader) (int, int, []recordingFrame, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	if !scanner.Scan() {
+		return 0, 0, nil, fmt.Errorf("empty recording")
+	}
+	var header struct {
+		Version       int     `json:"version"`
+		Width         int     `json:"width"`
+		Height        int     `json:"height"`
+		IdleTimeLimit float64 `json:"idle_time_limit"`
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		return 0, 0, nil, fmt.Errorf("not an asciicast v2 recording")
+	}
+	if header.Width < 1 || header.Height < 1 {
+		return 0, 0, nil, fmt.Errorf("bad size %dx%d", header.Width, header.Height)
+	}
+	idle := recordingIdleLimit
+	if header.IdleTimeLimit > 0 {
+		idle = time.Duration(header.IdleTimeLimit * float64(time.Second))
+	}
+
+	pb := vt.NewPaneBuffer(header.Width, header.Height)
+	var frames []recordingFrame
+	var at, lastFrame time.Duration
+	last, dirty := 0.0, false
+	capture := func() {
+		x, y := pb.GetCursor()
+		f := recordingFrame{at: at, cursorX: x, cursorY: y, cursor: pb.CursorVisible()}
+		for _, row := range pb.Content().Rows() {
+			f.rows = append(f.rows, slices.Clone(row))
+		}
+		if n := len(frames); n == 0 || !frames[n-1].same(f) {
+			frames = append(frames, f)
+		}
+		lastFrame, dirty = at, false
+	}
+	capture()
+	for line := 2; scanner.Scan(); line++ {
+		var event [3]any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return 0, 0, nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		t, ok1 := event[0].(float64)
+		kind, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return 0, 0, nil, fmt.Errorf("line %d: not an event", line)
+		}
+		if kind != "o" {
+			continue
+		}
+		next := at + min(time.Duration((t-last)*float64(time.Second)), idle)
+		if dirty && (next-at >= recordingFrameGap || at-lastFrame >= recordingMaxFrameGap) {
+			capture()
+		}
+		at, last = max(next, at), t
+		pb.Write([]byte(data))
+		dirty = true
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, nil, err
+	}
+	capture()
+	return header.Width, header.Height, frames, nil
+}
+
+// frameDelays returns how long each frame shows.
+func frameDelays(frames []recordingFrame) []time.Duration {
+	delays := make([]time.Duration, len(frames))
+	for i := range frames {
+		if i+1 < len(frames) {
+			delays[i] = frames[i+1].at - frames[i].at
+		} else {
+			delays[i] = recordingEndHold
+		}
+	}
+	return delays
+}
+
+// cellColors returns the colours and attributes a cell is drawn with,
+// reverse video applied.
+func cellColors(c vt.Cell) (fg, bg color.RGBA, attrs tcell.AttrMask) {
+	tfg, tbg, attrs := c.Style.Style().Decompose()
+	fg, bg = rgba(tfg, recordingFG), rgba(tbg, recordingBG)
+	if attrs&tcell.AttrReverse != 0 {
+		fg, bg = bg, fg
+	}
+	return fg, bg, attrs
+}
+
+// rgba converts a tcell colour, def standing for the default.
+func rgba(c tcell.Color, def color.RGBA) color.RGBA {
+	r, g, b := c.RGB()
+	if r < 0 {
+		return def
+	}
+	return color.RGBA{uint8(r), uint8(g), uint8(b), 0xff}
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// SVG cell size in pixels, for 14px monospace text.
+const (
+	svgCellWidth  = 8.4
+	svgCellHeight = 18
+)
+
+// writeRecordingSVG writes frames as an SVG animated with SMIL: each
+// frame is a group made visible for its time, relative to an animation
+// that restarts when the last one ends.
+func writeRecordingSVG(w io.Writer, width, height int, frames []recordingFrame) error {
+	bw := bufio.NewWriter(w)
+	delays := frameDelays(frames)
+	total := frames[len(frames)-1].at + delays[len(delays)-1]
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%d" font-family="monospace" font-size="14" xml:space="preserve">`+"\n",
+		float64(width)*svgCellWidth, height*svgCellHeight)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(recordingBG))
+	fmt.Fprintf(bw, `<rect width="0" height="0"><animate id="loop" attributeName="x" from="0" to="0" begin="0s;loop.end" dur="%.3fs"/></rect>`+"\n", total.Seconds())
+	for i, f := range frames {
+		fmt.Fprintf(bw, `<g visibility="hidden"><set attributeName="visibility" to="visible" begin="loop.begin+%.3fs" dur="%.3fs"/>`+"\n",
+			f.at.Seconds(), delays[i].Seconds())
+		for y, row := range f.rows {
+			writeSVGRow(bw, row, y)
+		}
+		if f.cursor && f.cursorY < len(f.rows) {
+			fmt.Fprintf(bw, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" opacity="0.6"/>`+"\n",
+				float64(f.cursorX)*svgCellWidth, f.cursorY*svgCellHeight, svgCellWidth, svgCellHeight, hexColor(recordingFG))
+		}
+		bw.WriteString("</g>\n")
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// writeSVGRow writes a row's backgrounds as rectangles and its text in
+// runs of one style, a wide character ending a run so the next starts in
+// its own column.
+func writeSVGRow(w *bufio.Writer, row vt.Row, y int) {
+	for x := 0; x < len(row); {
+		_, bg, _ := cellColors(row[x])
+		end := x + 1
+		for ; end < len(row); end++ {
+			if _, other, _ := cellColors(row[end]); other != bg {
+				break
+			}
+		}
+		if bg != recordingBG {
+			fmt.Fprintf(w, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"/>`+"\n",
+				float64(x)*svgCellWidth, y*svgCellHeight, float64(end-x)*svgCellWidth, svgCellHeight, hexColor(bg))
+		}
+		x = end
+	}
+	for x := 0; x < len(row); {
+		fg, _, attrs := cellColors(row[x])
+		var text strings.Builder
+		end := x
+		for ; end < len(row); end++ {
+			c := row[end]
+			if other, _, otherAttrs := cellColors(c); end > x && (other != fg || otherAttrs != attrs) {
+				break
+			}
+			if c.Width == 0 {
+				continue
+			}
+			text.WriteRune(c.Rune)
+			if c.Width > 1 {
+				// Past the cells it covers, so what follows starts in
+				// its own column
+				end += int(c.Width)
+				break
+			}
+		}
+		if s := strings.TrimRight(text.String(), " "); s != "" {
+			fmt.Fprintf(w, `<text x="%.1f" y="%d" fill="%s"`, float64(x)*svgCellWidth, y*svgCellHeight+14, hexColor(fg))
+			if attrs&tcell.AttrBold != 0 {
+				w.WriteString(` font-weight="bold"`)
+			}
+			if attrs&tcell.AttrItalic != 0 {
+				w.WriteString(` font-style="italic"`)
+			}
+			if attrs&tcell.AttrUnderline != 0 {
+				w.WriteString(` text-decoration="underline"`)
+			}
+			fmt.Fprintf(w, ">%s</text>\n", html.EscapeString(s))
+		}
+		x = max(end, x+1)
+	}
+}
+
+// GIF cells are the font's 6x8 cells drawn at gifScale.
+const gifScale = 2
+
+// writeRecordingGIF writes frames as an animated GIF, with a palette of
+// the first 256 colours used and the nearest of them for any more.
+func writeRecordingGIF(w io.Writer, width, height int, frames []recordingFrame) error {
+	palette := color.Palette{recordingBG, recordingFG}
+	index := map[color.RGBA]uint8{recordingBG: 0, recordingFG: 1}
+	for _, f := range frames {
+		for _, row := range f.rows {
+			for _, c := range row {
+				fg, bg, _ := cellColors(c)
+				for _, col := range []color.RGBA{fg, bg} {
+					if _, ok := index[col]; !ok && len(palette) < 256 {
+						index[col] = uint8(len(palette))
+						palette = append(palette, col)
+					}
+				}
+			}
+		}
+	}
+	colorIndex := func(c color.RGBA) uint8 {
+		if i, ok := index[c]; ok {
+			return i
+		}
+		return uint8(palette.Index(c))
+	}
+
+	cellW, cellH := 6*gifScale, 8*gifScale
+	anim := &gif.GIF{}
+	for i, delay := range frameDelays(frames) {
+		f := frames[i]
+		img := image.NewPaletted(image.Rect(0, 0, width*cellW, height*cellH), palette)
+		for y, row := range f.rows {
+			for x, c := range row {
+				fg, bg, attrs := cellColors(c)
+				if f.cursor && x == f.cursorX && y == f.cursorY {
+					fg, bg = bg, fg
+				}
+				r := c.Rune
+				if c.Width == 0 {
+					r = ' ' // the rest of a wide character
+				}
+				drawGIFCell(img, x*cellW, y*cellH, r, colorIndex(fg), colorIndex(bg), attrs)
+			}
+		}
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, max(2, int(delay/(10*time.Millisecond))))
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// drawGIFCell draws one cell: the background, then the glyph from
+// fontGlyphs, bold drawn twice a pixel apart and underline on the bottom
+// row.
+func drawGIFCell(img *image.Paletted, x0, y0 int, r rune, fg, bg uint8, attrs tcell.AttrMask) {
+	for y := range 8 * gifScale {
+		for x := range 6 * gifScale {
+			img.SetColorIndex(x0+x, y0+y, bg)
+		}
+	}
+	dot := func(x, y int) {
+		for dy := range gifScale {
+			for dx := range gifScale {
+				img.SetColorIndex(x0+x*gifScale+dx, y0+y*gifScale+dy, fg)
+			}
+		}
+	}
+	if r == '█' {
+		for y := range 8 {
+			for x := range 6 {
+				dot(x, y)
+			}
+		}
+		return
+	}
+	glyph := fontGlyph(r)
+	for x, column := range glyph {
+		for y := range 8 {
+			if column&(1<<y) != 0 {
+				dot(x, y)
+				if attrs&tcell.AttrBold != 0 {
+					dot(x+1, y)
+				}
+			}
+		}
+	}
+	if attrs&tcell.AttrUnderline != 0 {
+		for x := range 6 {
+			dot(x, 7)
+		}
+	}
+}
+
+// fontGlyph returns the columns of a character in the built-in font,
+// standing in for box drawing with the nearest ASCII and for anything
+// else it lacks with a small box.
+func fontGlyph(r rune) [5]byte {
+	switch {
+	case r >= ' ' && r <= '~':
+		return fontGlyphs[r-' ']
+	case r >= '─' && r <= '╿':
+		switch r {
+		case '─', '━', '═', '╌', '╍':
+			r = '-'
+		case '│', '┃', '║', '╎', '╏':
+			r = '|'
+		default:
+			r = '+'
+		}
+		return fontGlyphs[r-' ']
+	case r == 0:
+		return fontGlyphs[0]
+	}
+	return [5]byte{0x00, 0x3e, 0x22, 0x3e, 0x00}
+}
+
+// fontGlyphs is a 5x7 font for printable ASCII, from space to ~, the
+// classic one of character LCDs: five columns a character, the low bit
+// the top row and bit 7 for descenders.
+var fontGlyphs = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, // space
+	{0x00, 0x00, 0x5f, 0x00, 0x00}, // !
+	{0x00, 0x07, 0x00, 0x07, 0x00}, // "
+	{0x14, 0x7f, 0x14, 0x7f, 0x14}, // #
+	{0x24, 0x2a, 0x7f, 0x2a, 0x12}, // $
+	{0x23, 0x13, 0x08, 0x64, 0x62}, // %
+	{0x36, 0x49, 0x56, 0x20, 0x50}, // &
+	{0x00, 0x08, 0x07, 0x03, 0x00}, // '
+	{0x00, 0x1c, 0x22, 0x41, 0x00}, // (
+	{0x00, 0x41, 0x22, 0x1c, 0x00}, // )
+	{0x2a, 0x1c, 0x7f, 0x1c, 0x2a}, // *
+	{0x08, 0x08, 0x3e, 0x08, 0x08}, // +
+	{0x00, 0x80, 0x70, 0x30, 0x00}, // ,
+	{0x08, 0x08, 0x08, 0x08, 0x08}, // -
+	{0x00, 0x00, 0x60, 0x60, 0x00}, // .
+	{0x20, 0x10, 0x08, 0x04, 0x02}, // /
+	{0x3e, 0x51, 0x49, 0x45, 0x3e}, // 0
+	{0x00, 0x42, 0x7f, 0x40, 0x00}, // 1
+	{0x72, 0x49, 0x49, 0x49, 0x46}, // 2
+	{0x21, 0x41, 0x49, 0x4d, 0x33}, // 3
+	{0x18, 0x14, 0x12, 0x7f, 0x10}, // 4
+	{0x27, 0x45, 0x45, 0x45, 0x39}, // 5
+	{0x3c, 0x4a, 0x49, 0x49, 0x31}, // 6
+	{0x41, 0x21, 0x11, 0x09, 0x07}, // 7
+	{0x36, 0x49, 0x49, 0x49, 0x36}, // 8
+	{0x46, 0x49, 0x49, 0x29, 0x1e}, // 9
+	{0x00, 0x00, 0x14, 0x00, 0x00}, // :
+	{0x00, 0x40, 0x34, 0x00, 0x00}, // ;
+	{0x00, 0x08, 0x14, 0x22, 0x41}, // <
+	{0x14, 0x14, 0x14, 0x14, 0x14}, // =
+	{0x00, 0x41, 0x22, 0x14, 0x08}, // >
+	{0x02, 0x01, 0x59, 0x09, 0x06}, // ?
+	{0x3e, 0x41, 0x5d, 0x59, 0x4e}, // @
+	{0x7c, 0x12, 0x11, 0x12, 0x7c}, // A
+	{0x7f, 0x49, 0x49, 0x49, 0x36}, // B
+	{0x3e, 0x41, 0x41, 0x41, 0x22}, // C
+	{0x7f, 0x41, 0x41, 0x41, 0x3e}, // D
+	{0x7f, 0x49, 0x49, 0x49, 0x41}, // E
+	{0x7f, 0x09, 0x09, 0x09, 0x01}, // F
+	{0x3e, 0x41, 0x41, 0x51, 0x73}, // G
+	{0x7f, 0x08, 0x08, 0x08, 0x7f}, // H
+	{0x00, 0x41, 0x7f, 0x41, 0x00}, // I
+	{0x20, 0x40, 0x41, 0x3f, 0x01}, // J
+	{0x7f, 0x08, 0x14, 0x22, 0x41}, // K
+	{0x7f, 0x40, 0x40, 0x40, 0x40}, // L
+	{0x7f, 0x02, 0x1c, 0x02, 0x7f}, // M
+	{0x7f, 0x04, 0x08, 0x10, 0x7f}, // N
+	{0x3e, 0x41, 0x41, 0x41, 0x3e}, // O
+	{0x7f, 0x09, 0x09, 0x09, 0x06}, // P
+	{0x3e, 0x41, 0x51, 0x21, 0x5e}, // Q
+	{0x7f, 0x09, 0x19, 0x29, 0x46}, // R
+	{0x26, 0x49, 0x49, 0x49, 0x32}, // S
+	{0x03, 0x01, 0x7f, 0x01, 0x03}, // T
+	{0x3f, 0x40, 0x40, 0x40, 0x3f}, // U
+	{0x1f, 0x20, 0x40, 0x20, 0x1f}, // V
+	{0x3f, 0x40, 0x38, 0x40, 0x3f}, // W
+	{0x63, 0x14, 0x08, 0x14, 0x63}, // X
+	{0x03, 0x04, 0x78, 0x04, 0x03}, // Y
+	{0x61, 0x59, 0x49, 0x4d, 0x43}, // Z
+	{0x00, 0x7f, 0x41, 0x41, 0x41}, // [
+	{0x02, 0x04, 0x08, 0x10, 0x20}, // backslash
+	{0x00, 0x41, 0x41, 0x41, 0x7f}, // ]
+	{0x04, 0x02, 0x01, 0x02, 0x04}, // ^
+	{0x40, 0x40, 0x40, 0x40, 0x40}, // _
+	{0x00, 0x03, 0x07, 0x08, 0x00}, // `
+	{0x20, 0x54, 0x54, 0x78, 0x40}, // a
+	{0x7f, 0x28, 0x44, 0x44, 0x38}, // b
+	{0x38, 0x44, 0x44, 0x44, 0x28}, // c
+	{0x38, 0x44, 0x44, 0x28, 0x7f}, // d
+	{0x38, 0x54, 0x54, 0x54, 0x18}, // e
+	{0x00, 0x08, 0x7e, 0x09, 0x02}, // f
+	{0x18, 0xa4, 0xa4, 0x9c, 0x78}, // g
+	{0x7f, 0x08, 0x04, 0x04, 0x78}, // h
+	{0x00, 0x44, 0x7d, 0x40, 0x00}, // i
+	{0x20, 0x40, 0x40, 0x3d, 0x00}, // j
+	{0x7f, 0x10, 0x28, 0x44, 0x00}, // k
+	{0x00, 0x41, 0x7f, 0x40, 0x00}, // l
+	{0x7c, 0x04, 0x78, 0x04, 0x78}, // m
+	{0x7c, 0x08, 0x04, 0x04, 0x78}, // n
+	{0x38, 0x44, 0x44, 0x44, 0x38}, // o
+	{0xfc, 0x18, 0x24, 0x24, 0x18}, // p
+	{0x18, 0x24, 0x24, 0x18, 0xfc}, // q
+	{0x7c, 0x08, 0x04, 0x04, 0x08}, // r
+	{0x48, 0x54, 0x54, 0x54, 0x24}, // s
+	{0x04, 0x04, 0x3f, 0x44, 0x24}, // t
+	{0x3c, 0x40, 0x40, 0x20, 0x7c}, // u
+	{0x1c, 0x20, 0x40, 0x20, 0x1c}, // v
+	{0x3c, 0x40, 0x30, 0x40, 0x3c}, // w
+	{0x44, 0x28, 0x10, 0x28, 0x44}, // x
+	{0x4c, 0x90, 0x90, 0x90, 0x7c}, // y
+	{0x44, 0x64, 0x54, 0x4c, 0x44}, // z
+	{0x00, 0x08, 0x36, 0x41, 0x00}, // {
+	{0x00, 0x00, 0x77, 0x00, 0x00}, // |
+	{0x00, 0x41, 0x36, 0x08, 0x00}, // }
+	{0x02, 0x01, 0x02, 0x04, 0x02}, // ~
+}
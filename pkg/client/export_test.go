@@ -0,0 +1,185 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"image/gif"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"term/pkg/vt"
+)
+
+// frameText is a frame's rows as text, trailing spaces trimmed.
+func frameText(f recordingFrame) string {
+	var rows []string
+	for _, row := range f.rows {
+		rows = append(rows, strings.TrimRight(string(row.Text()), " "))
+	}
+	return strings.Join(rows, "|")
+}
+
+func TestReadRecording(t *testing.T) {
+	tests := []struct {
+		name  string
+		cast  string
+		texts []string
+		at    []time.Duration
+	}{
+		{
+			name: "frames at pauses, input skipped",
+			cast: `{"version": 2, "width": 10, "height": 2}
+[0.0, "o", "hi"]
+[0.5, "o", "\r\nthere"]
+[0.6, "i", "x"]
+[0.75, "o", "!"]`,
+			texts: []string{"|", "hi|", "hi|there", "hi|there!"},
+			at:    []time.Duration{0, 0, 500 * time.Millisecond, 750 * time.Millisecond},
+		},
+		{
+			name: "output too close together for a frame",
+			cast: `{"version": 2, "width": 5, "height": 1}
+[0.0, "o", "a"]
+[0.001, "o", "b"]
+[0.002, "o", "c"]`,
+			texts: []string{"", "abc"},
+			at:    []time.Duration{0, 2 * time.Millisecond},
+		},
+		{
+			name: "pauses shortened to idle_time_limit",
+			cast: `{"version": 2, "width": 5, "height": 1, "idle_time_limit": 1}
+[1.0, "o", "a"]
+[60.0, "o", "b"]`,
+			texts: []string{"", "a", "ab"},
+			at:    []time.Duration{0, time.Second, 2 * time.Second},
+		},
+		{
+			name: "pauses shortened to recordingIdleLimit",
+			cast: `{"version": 2, "width": 5, "height": 1}
+[0.0, "o", "a"]
+[60.0, "o", "b"]`,
+			texts: []string{"", "a", "ab"},
+			at:    []time.Duration{0, 0, recordingIdleLimit},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, frames, err := readRecording(strings.NewReader(tt.cast))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var texts []string
+			var at []time.Duration
+			for _, f := range frames {
+				texts = append(texts, frameText(f))
+				at = append(at, f.at)
+			}
+			if !reflect.DeepEqual(texts, tt.texts) || !reflect.DeepEqual(at, tt.at) {
+				t.Errorf("frames %q at %v, want %q at %v", texts, at, tt.texts, tt.at)
+			}
+		})
+	}
+}
+
+func TestReadRecordingErrors(t *testing.T) {
+	tests := []struct {
+		cast string
+		want string
+	}{
+		{"", "empty recording"},
+		{`{"version": 1, "width": 80, "height": 24}`, "not an asciicast v2 recording"},
+		{`not json`, "not an asciicast v2 recording"},
+		{`{"version": 2, "width": 0, "height": 24}`, "bad size 0x24"},
+		{"{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.1, \"o\"", "line 2"},
+		{"{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.1, \"o\", 5]", "line 2: not an event"},
+	}
+	for _, tt := range tests {
+		_, _, _, err := readRecording(strings.NewReader(tt.cast))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("readRecording(%q) = %v, want an error with %q", tt.cast, err, tt.want)
+		}
+	}
+}
+
+// testRecording is a recording with styles and markup to escape.
+const testRecording = `{"version": 2, "width": 12, "height": 3}
+[0.0, "o", "\u001b[1;31mred\u001b[0m <b>"]
+[0.5, "o", "\r\n\u001b[44mblue\u001b[0m"]
+[1.0, "o", "\r\ndone"]`
+
+func TestWriteRecordingSVG(t *testing.T) {
+	width, height, frames, err := readRecording(strings.NewReader(testRecording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := writeRecordingSVG(&out, width, height, frames); err != nil {
+		t.Fatal(err)
+	}
+	svg := out.String()
+	if n := strings.Count(svg, "<g "); n != len(frames) {
+		t.Errorf("%d groups for %d frames", n, len(frames))
+	}
+	for _, want := range []string{
+		`width="101" height="54"`,
+		`font-weight="bold">red</text>`,
+		`&lt;b&gt;`,
+		`<rect x="0.0" y="18" width="33.6" height="18" fill="#000080"/>`,
+		`>done</text>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG has no %s", want)
+		}
+	}
+	if strings.Contains(svg, "<b>") {
+		t.Errorf("SVG has the recording's markup unescaped")
+	}
+}
+
+func TestWriteSVGRow(t *testing.T) {
+	// A wide character ends its run, so what follows starts in its own
+	// column
+	row := vt.Row{{Rune: '世', Width: 2}, {Rune: ' ', Width: 0}, {Rune: 'x', Width: 1}, {Rune: 'y', Width: 1}}
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	writeSVGRow(w, row, 1)
+	w.Flush()
+	want := `<text x="0.0" y="32" fill="#d0d0d0">世</text>
+<text x="16.8" y="32" fill="#d0d0d0">xy</text>
+`
+	if out.String() != want {
+		t.Errorf("writeSVGRow = %q, want %q", out.String(), want)
+	}
+}
+
+func TestWriteRecordingGIF(t *testing.T) {
+	width, height, frames, err := readRecording(strings.NewReader(testRecording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := writeRecordingGIF(&out, width, height, frames); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(frames) {
+		t.Fatalf("%d images for %d frames", len(anim.Image), len(frames))
+	}
+	if b := anim.Image[0].Bounds(); b.Dx() != width*6*gifScale || b.Dy() != height*8*gifScale {
+		t.Errorf("images are %dx%d, want %d by %d cells", b.Dx(), b.Dy(), width, height)
+	}
+	want := []int{0, 50, 50, int(recordingEndHold / (10 * time.Millisecond))}
+	if len(frames) != len(want) {
+		t.Fatalf("%d frames, want %d", len(frames), len(want))
+	}
+	for i, delay := range anim.Delay {
+		if delay != max(2, want[i]) {
+			t.Errorf("frame %d shows for %d0ms, want %d0ms", i, delay, max(2, want[i]))
+		}
+	}
+}
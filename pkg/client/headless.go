@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// RunHeadless implements `term headless [-t name] [-x width] [-y height]`:
+// a client that draws onto a tcell simulation screen rather than a
+// terminal, for scripts and integration tests of the daemon, protocol and
+// emulator together. It reads commands from standard input, one a line:
+//
+//	key name...  press keys ("C-a", "c", "Enter"), bound ones run as typed
+//	type text    type text into the pane
+//	resize w h   resize the screen
+//	sleep ms     wait, for output to arrive
+//	dump         print the screen (see dumpScreen)
+//
+// and detaches at the end of its input. Errors in the commands go to
+// standard error; the exit status is 1 if the daemon went away.
+func RunHeadless(args []string) int {
+	flags, args, err := protocol.ParseFlags(args, "t:x:y:")
+	width, height := 80, 24
+	for flag, value := range flags {
+		if flag == 't' {
+			continue
+		}
+		n, convErr := strconv.Atoi(value)
+		if convErr != nil || n < 1 {
+			err = fmt.Errorf("bad -%c: %s", flag, value)
+		} else if flag == 'x' {
+			width = n
+		} else {
+			height = n
+		}
+	}
+	if err != nil || len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: term headless [-t name] [-x width] [-y height]")
+		return 1
+	}
+
+	conn, err := dialDaemon(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+	if name := flags['t']; name != "" {
+		conn.Write(protocol.Encode(protocol.MsgAttachSession, []byte(name)))
+	}
+	if env, err := json.Marshal(os.Environ()); err == nil {
+		conn.Write(protocol.Encode(protocol.MsgEnvironment, env))
+	}
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer screen.Fini()
+	screen.SetSize(width, height+1) // +1 for the status line
+	ui := NewUI(screen)
+	clientState := NewClientState(ui)
+	resize := func() {
+		clientState.UpdatePaneBufferSizes()
+		payload, _ := json.Marshal(pty.Winsize{Rows: uint16(height), Cols: uint16(width)})
+		conn.Write(protocol.Encode(protocol.MsgResize, payload))
+	}
+	resize()
+
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		for {
+			msgType, payload, err := protocol.Read(conn)
+			if err != nil {
+				return
+			}
+			clientState.HandleMessage(msgType, payload)
+		}
+	}()
+
+	input := &InputHandler{conn: conn, state: clientState, table: "root"}
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	for {
+		var line string
+		var ok bool
+		select {
+		case <-lost:
+			fmt.Fprintln(os.Stderr, "lost connection to the daemon")
+			return 1
+		case line, ok = <-lines:
+		}
+		if !ok {
+			conn.Write(protocol.Encode(protocol.MsgDetach, nil))
+			return 0
+		}
+		command, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch command {
+		case "":
+		case "key":
+			for _, name := range strings.Fields(rest) {
+				ev := vt.KeyEvent(name)
+				if ev == nil {
+					fmt.Fprintf(os.Stderr, "unknown key: %s\n", name)
+					break
+				}
+				if detach := input.HandleKey(ev); detach {
+					conn.Write(protocol.Encode(protocol.MsgDetach, nil))
+					return 0
+				}
+			}
+		case "type":
+			input.sendText(rest)
+		case "resize":
+			var w, h int
+			if _, err := fmt.Sscanf(rest, "%d %d", &w, &h); err != nil || w < 1 || h < 1 {
+				fmt.Fprintln(os.Stderr, "usage: resize width height")
+				continue
+			}
+			width, height = w, h
+			screen.SetSize(width, height+1)
+			resize()
+		case "sleep":
+			ms, err := strconv.Atoi(rest)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "usage: sleep ms")
+				continue
+			}
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+		case "dump":
+			clientState.mutex.Lock()
+			clientState.drawNow()
+			clientState.mutex.Unlock()
+			fmt.Print(dumpScreen(screen))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command: %s\n", command)
+		}
+	}
+}
+
+// dumpScreen shows what a simulation screen shows: a line
+// "screen WxH cursor X,Y" (the cursor -1,-1 when hidden), then each row
+// with trailing blanks removed, the status line first.
+func dumpScreen(screen tcell.SimulationScreen) string {
+	cells, width, height := screen.GetContents()
+	x, y, visible := screen.GetCursor()
+	if !visible {
+		x, y = -1, -1
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "screen %dx%d cursor %d,%d\n", width, height, x, y)
+	for row := range height {
+		var line strings.Builder
+		for col := 0; col < width; col++ {
+			runes := cells[row*width+col].Runes
+			if len(runes) == 0 {
+				line.WriteByte(' ')
+				continue
+			}
+			line.WriteString(string(runes))
+			col += max(runewidth.RuneWidth(runes[0]), 1) - 1 // the rest of a wide character
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
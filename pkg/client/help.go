@@ -0,0 +1,13 @@
+package client
+
+import "term/pkg/protocol"
+
+// ShowHelp opens the help for the key bindings in use, searchable like any
+// chooser.
+func (cs *ClientState) ShowHelp() {
+	items := protocol.HelpItems(cs.bindings.Tables())
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.chooser = NewChooser(protocol.ChooserList{Title: "Help: type to search, Enter runs", Items: items})
+	cs.draw()
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+	"sync"
+
+	"term/pkg/vt"
+)
+
+// sixelTerms are outer terminals known to draw sixel images, by TERM or
+// TERM_PROGRAM prefix.
+var sixelTerms = []string{"foot", "mlterm", "contour", "yaft", "WezTerm", "wezterm", "iTerm.app", "mintty"}
+
+// inlineImageTerms are outer terminals known to draw iTerm2 inline images,
+// by TERM_PROGRAM.
+var inlineImageTerms = []string{"iTerm.app", "WezTerm", "mintty"}
+
+// outerSixel guesses whether the outer terminal draws sixel images.
+var outerSixel = sync.OnceValue(func() bool {
+	if os.Getenv("KONSOLE_VERSION") != "" {
+		return true
+	}
+	for _, name := range []string{os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")} {
+		for _, t := range sixelTerms {
+			if strings.HasPrefix(name, t) {
+				return true
+			}
+		}
+	}
+	return false
+})
+
+// outerInlineImages guesses whether the outer terminal draws iTerm2 inline
+// images.
+var outerInlineImages = sync.OnceValue(func() bool {
+	for _, t := range inlineImageTerms {
+		if strings.HasPrefix(os.Getenv("TERM_PROGRAM"), t) {
+			return true
+		}
+	}
+	return false
+})
+
+// imageSupport returns which images may be drawn for a pane on this
+// client's terminal. Only the active pane draws images.
+func (cs *ClientState) imageSupport(paneID int) vt.ImageSupport {
+	support := vt.ImageSupport{Placeholder: cs.Option("image-placeholder") == "on"}
+	if paneID != cs.activePaneID {
+		return support
+	}
+	cw, ch := cs.ui.CellSize()
+	if cw == 0 || ch == 0 {
+		return support
+	}
+	support.CellWidth, support.CellHeight = cw, ch
+	support.Sixel = imageOption(cs.Option("sixel"), outerSixel)
+	support.Inline = imageOption(cs.Option("inline-images"), outerInlineImages)
+	return support
+}
+
+// imageOption reads an auto/on/off image option, guessing for auto.
+func imageOption(value string, guess func() bool) bool {
+	switch value {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	return guess()
+}
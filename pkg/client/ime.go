@@ -0,0 +1,103 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+
+	"term/pkg/vt"
+)
+
+// Input methods compose text in the outer terminal, which draws the
+// pre-edit string at its cursor and sends the committed text as if typed;
+// tcell has no composition events to pass on. The client's part is to keep
+// the outer cursor where the text will go, to measure text by its width in
+// columns when drawing it, and to send a committed string to the pane in
+// one piece.
+
+// plainRune reports whether ev is a character typed without modifiers other
+// than Shift.
+func plainRune(ev *tcell.EventKey) bool {
+	return ev.Key() == tcell.KeyRune && ev.Modifiers()&^tcell.ModShift == 0
+}
+
+// committedText gathers the characters that arrived together with ev, as
+// text committed by an input method or pasted does, when they all go to the
+// pane. It returns them if there are more than one, and any event read past
+// them for the caller to handle next.
+func (ih *InputHandler) committedText(screen tcell.Screen, ev *tcell.EventKey) (text string, next tcell.Event) {
+	if !screen.HasPendingEvent() || ih.table != "root" || !ih.takesText(ev) || !ih.state.TakesText() {
+		return "", nil
+	}
+	runes := []rune{ev.Rune()}
+	for screen.HasPendingEvent() {
+		event := screen.PollEvent()
+		if key, ok := event.(*tcell.EventKey); ok && ih.takesText(key) {
+			runes = append(runes, key.Rune())
+			continue
+		}
+		next = event
+		break
+	}
+	if len(runes) == 1 {
+		return "", next
+	}
+	return string(runes), next
+}
+
+// takesText reports whether ev is a character that goes to the pane as it
+// is: plain and bound to nothing.
+func (ih *InputHandler) takesText(ev *tcell.EventKey) bool {
+	return plainRune(ev) && ih.state.bindings.Lookup("root", vt.KeyName(ev)) == nil
+}
+
+// sendText writes committed text to the pane as UTF-8, as terminals send
+// input method text even when keys are reported as escape codes.
+func (ih *InputHandler) sendText(text string) {
+	ih.hintGen.Add(1)
+	ih.state.SetOverlay("")
+	ih.repeatKey = ""
+	ih.sendData([]byte(text))
+}
+
+// TakesText reports whether typed characters go to the active pane: no
+// list, URL labels or copy mode is waiting for keys.
+func (cs *ClientState) TakesText() bool {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.chooser == nil && len(cs.urlHints) == 0 && !cs.inCopyMode()
+}
+
+// drawText draws text from x on row y, wide characters taking two columns,
+// up to column end. It returns the column after the text.
+func (ui *UI) drawText(x, y int, text string, style vt.StyleID, end int) int {
+	for _, r := range text {
+		w := runewidth.RuneWidth(r)
+		if w == 0 {
+			continue
+		}
+		if x+w > end {
+			break
+		}
+		ui.setCell(x, y, vt.Cell{Rune: r, Style: style, Width: uint8(w)})
+		if w == 2 {
+			ui.setCell(x+1, y, vt.Cell{Style: style}) // covered
+		}
+		x += w
+	}
+	return x
+}
+
+// parkCursor leaves the outer terminal's hidden cursor at x, y once the
+// frame is shown, so an input method's pre-edit text appears there rather
+// than wherever drawing ended.
+func (ui *UI) parkCursor(x, y int) {
+	ui.parkX, ui.parkY = x, y
+}
+
+func (ui *UI) moveParkedCursor() {
+	if ui.parkX >= 0 {
+		ui.WriteRaw([]byte(fmt.Sprintf("\x1b[%d;%dH", ui.parkY+1, ui.parkX+1)))
+	}
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// clientToken returns the token a client authenticates with.
+func clientToken() (string, error) {
+	if token := os.Getenv(protocol.TokenEnv); token != "" {
+		return token, nil
+	}
+	data, err := os.ReadFile(protocol.TokenPath())
+	if err != nil {
+		return "", fmt.Errorf("no token: set %s to the contents of the daemon's %s", protocol.TokenEnv, protocol.TokenPath())
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// dial connects to the daemon at Socket: its unix socket, or with
+// tcp:host:port its --listen address, sending the token first.
+func dial() (net.Conn, error) {
+	addr, ok := strings.CutPrefix(Socket, protocol.TCPPrefix)
+	if !ok {
+		return dialSocket(Socket)
+	}
+	token, err := clientToken()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(protocol.Encode(protocol.MsgAuth, []byte(token))); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
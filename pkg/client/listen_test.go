@@ -0,0 +1,28 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"term/pkg/protocol"
+)
+
+func TestClientToken(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv(protocol.TokenEnv, "")
+	if _, err := clientToken(); err == nil {
+		t.Errorf("clientToken() with no token file = nil error")
+	}
+	os.MkdirAll(filepath.Dir(protocol.TokenPath()), 0700)
+	if err := os.WriteFile(protocol.TokenPath(), []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := clientToken(); got != "from-file" {
+		t.Errorf("clientToken() = %q, want the file's", got)
+	}
+	t.Setenv(protocol.TokenEnv, "from-env")
+	if got, _ := clientToken(); got != "from-env" {
+		t.Errorf("clientToken() = %q, want $%s first", got, protocol.TokenEnv)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package client
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// dialSocket connects to the unix socket at path.
+func dialSocket(path string) (net.Conn, error) {
+	return net.Dial("unix", path)
+}
+
+// detachedProcess starts a process in a session of its own, out of reach
+// of the terminal's hangup.
+func detachedProcess() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// notifyResize relays the signal sent when the terminal changes size.
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
+
+// notifyStop relays the signals that end a client: the terminal closing,
+// or being killed or interrupted.
+func notifyStop(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// primaryCommand returns the command that writes the primary selection,
+// or reads it when paste is set: wl-copy and wl-paste on Wayland, else
+// xclip on X11. It is nil outside a graphical session.
+func primaryCommand(paste bool) *exec.Cmd {
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "" && paste:
+		return exec.Command("wl-paste", "--primary", "--no-newline")
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		return exec.Command("wl-copy", "--primary")
+	case os.Getenv("DISPLAY") != "" && paste:
+		return exec.Command("xclip", "-selection", "primary", "-out")
+	case os.Getenv("DISPLAY") != "":
+		return exec.Command("xclip", "-selection", "primary", "-in")
+	}
+	return nil
+}
+
+// setPrimary copies text to the primary selection, as selecting text does
+// in other terminals on Linux, without waiting. Errors, such as the tool
+// not being installed, are ignored: the text is in a paste buffer anyway.
+func setPrimary(text string) {
+	cmd := primaryCommand(false)
+	if cmd == nil {
+		return
+	}
+	cmd.Stdin = strings.NewReader(text) // stderr stays off the screen
+	go cmd.Run()
+}
+
+// pastePrimary implements paste-primary, bound to the middle button: the
+// primary selection is pasted into the active pane through a paste buffer,
+// which the daemon brackets for applications that ask and then deletes.
+func (ih *InputHandler) pastePrimary() {
+	cmd := primaryCommand(true)
+	if cmd == nil {
+		ih.state.SetOverlay("No primary selection outside X11 or Wayland")
+		return
+	}
+	go func() {
+		out, err := cmd.Output()
+		if err != nil || len(out) == 0 {
+			return
+		}
+		ih.sendCommand([]string{"set-buffer", "-b", "primary", string(out)})
+		ih.sendCommand([]string{"paste-buffer", "-d", "-b", "primary"})
+	}()
+}
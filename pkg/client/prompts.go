@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+
+	"term/pkg/vt"
+)
+
+// jumpToPrompt scrolls copy mode to the previous or next prompt, counting
+// from the last prompt jumped to or else the edge of the view.
+func (cm *CopyMode) jumpToPrompt(pb *vt.PaneBuffer, forward bool) error {
+	var line int
+	var ok bool
+	switch {
+	case forward && cm.promptLine != nil:
+		line, ok = pb.PromptBelow(*cm.promptLine)
+	case forward:
+		line, ok = pb.PromptBelow(cm.top)
+	case cm.promptLine != nil:
+		line, ok = pb.PromptAbove(*cm.promptLine)
+	default:
+		_, height := pb.Size()
+		line, ok = pb.PromptAbove(cm.top + height)
+	}
+	if !ok {
+		return fmt.Errorf("no prompt")
+	}
+	cm.promptLine = &line
+	cm.top = min(max(line, pb.HistoryBase()), pb.LiveTop())
+	return nil
+}
+
+// selectOutput selects the last command's output, scrolling to show its
+// start.
+func (cm *CopyMode) selectOutput(pb *vt.PaneBuffer) error {
+	sel, ok := pb.LastOutput()
+	if !ok {
+		return fmt.Errorf("no command output")
+	}
+	cm.selection = sel
+	if _, height := pb.Size(); sel.StartLine < cm.top || sel.StartLine >= cm.top+height {
+		cm.top = min(max(sel.StartLine, pb.HistoryBase()), pb.LiveTop())
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"term/pkg/protocol"
+)
+
+// loadHistory loads a pane's history from the daemon's history file before
+// its replay arrives, once.
+func (cs *ClientState) loadHistory(p protocol.PaneState) {
+	pb := cs.paneBuffers[p.ID]
+	if p.HistoryFile == "" {
+		return
+	}
+	pb.SetHistoryLimit(cs.OptionNumber("history-limit"), cs.OptionNumber("history-memory")*1024)
+	if err := pb.OpenHistory(p.HistoryFile, p.HistoryLines); err != nil {
+		cs.showMessage(protocol.Message{Text: fmt.Sprintf("History file for pane %d: %v", p.ID, err), Error: true})
+	}
+}
+
+// HandleSnapshotMessage sets the client up to show the session it attached
+// to: a buffer for each of its panes and floats, showing the active pane. Buffers of panes no session has any more are dropped.
+func (cs *ClientState) HandleSnapshotMessage(payload []byte) {
+	var snapshot protocol.Snapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		return
+	}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	exists := make(map[int]bool)
+	for _, s := range snapshot.Sessions {
+		for _, f := range s.Floats {
+			exists[f.PaneID] = true
+		}
+		if s.Name == snapshot.Session {
+			cs.floats = s.Floats
+			for _, f := range s.Floats {
+				cs.ensurePaneBuffer(f.PaneID)
+				cs.paneBuffers[f.PaneID].Resize(f.Width-2, f.Height-2)
+			}
+		}
+		for _, w := range s.Windows {
+			for _, p := range w.Panes {
+				exists[p.ID] = true
+				if s.Name == snapshot.Session {
+					// Sized to this client's screen, which its resize
+					// gives the pane too
+					cs.ensurePaneBuffer(p.ID)
+					cs.loadHistory(p)
+				}
+			}
+		}
+	}
+	for id := range cs.paneBuffers {
+		if !exists[id] {
+			delete(cs.paneBuffers, id)
+		}
+	}
+	if snapshot.ActivePane >= 0 {
+		cs.activePaneID = snapshot.ActivePane
+		cs.copyMode = nil
+		cs.status = fmt.Sprintf("Pane: %d", cs.activePaneID)
+	}
+	cs.draw()
+}
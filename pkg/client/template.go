@@ -0,0 +1,511 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A session template describes a project's session in TOML, for
+// `term start`:
+//
+//	name = "blog"                # the session, default the file's name
+//	root = "~/src/blog"          # where panes start
+//
+//	[[windows]]
+//	name = "editor"
+//	panes = ["vim", "npm run dev"]
+//
+//	[[windows]]
+//	name = "logs"
+//	root = "log"                 # relative to the session's root
+//	[[windows.panes]]
+//	command = "tail -f app.log"
+//	root = "/var/log/blog"
+//
+// Each pane's command is typed into its shell, so the shell stays when the
+// command ends; a pane without one is a plain shell.
+type Template struct {
+	Name    string
+	Root    string
+	Windows []TemplateWindow
+}
+
+type TemplateWindow struct {
+	Name  string
+	Root  string
+	Panes []TemplatePane
+}
+
+type TemplatePane struct {
+	Command string
+	Root    string
+}
+
+// templateDir is where `term start name` finds name.toml.
+func templateDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "term", "templates")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "term", "templates")
+}
+
+// findTemplate returns the file a `term start` argument names: a path to
+// one, or the name of one in templateDir.
+func findTemplate(arg string) string {
+	if strings.ContainsRune(arg, os.PathSeparator) || strings.HasSuffix(arg, ".toml") {
+		return arg
+	}
+	return filepath.Join(templateDir(), arg+".toml")
+}
+
+// LoadTemplate reads a template, resolving every pane's directory.
+func LoadTemplate(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t := &Template{Name: strings.TrimSuffix(filepath.Base(path), ".toml")}
+	if err := t.decode(doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// decode fills t from a parsed document, checking every key.
+func (t *Template) decode(doc map[string]any) error {
+	var err error
+	for key, value := range doc {
+		switch key {
+		case "name":
+			t.Name, err = tomlString(key, value)
+		case "root":
+			t.Root, err = tomlString(key, value)
+		case "windows":
+			tables, ok := value.([]map[string]any)
+			if !ok {
+				return fmt.Errorf("windows must be [[windows]] tables")
+			}
+			for _, table := range tables {
+				w, err := decodeTemplateWindow(table)
+				if err != nil {
+					return err
+				}
+				t.Windows = append(t.Windows, w)
+			}
+		default:
+			return fmt.Errorf("unknown key: %s", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(t.Windows) == 0 {
+		t.Windows = []TemplateWindow{{}}
+	}
+	root, err := expandDir(t.Root, "")
+	if err != nil {
+		return err
+	}
+	t.Root = root
+	for i := range t.Windows {
+		w := &t.Windows[i]
+		if w.Root, err = expandDir(w.Root, t.Root); err != nil {
+			return err
+		}
+		if len(w.Panes) == 0 {
+			w.Panes = []TemplatePane{{}}
+		}
+		for j := range w.Panes {
+			if w.Panes[j].Root, err = expandDir(w.Panes[j].Root, w.Root); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func decodeTemplateWindow(table map[string]any) (TemplateWindow, error) {
+	var w TemplateWindow
+	var err error
+	for key, value := range table {
+		switch key {
+		case "name":
+			w.Name, err = tomlString("window "+key, value)
+		case "root":
+			w.Root, err = tomlString("window "+key, value)
+		case "panes":
+			switch panes := value.(type) {
+			case []any:
+				for _, v := range panes {
+					command, err := tomlString("pane command", v)
+					if err != nil {
+						return w, err
+					}
+					w.Panes = append(w.Panes, TemplatePane{Command: command})
+				}
+			case []map[string]any:
+				for _, table := range panes {
+					var p TemplatePane
+					for key, value := range table {
+						switch key {
+						case "command":
+							p.Command, err = tomlString("pane "+key, value)
+						case "root":
+							p.Root, err = tomlString("pane "+key, value)
+						default:
+							err = fmt.Errorf("unknown pane key: %s", key)
+						}
+						if err != nil {
+							return w, err
+						}
+					}
+					w.Panes = append(w.Panes, p)
+				}
+			default:
+				err = fmt.Errorf("panes must be a list of commands or [[windows.panes]] tables")
+			}
+		default:
+			err = fmt.Errorf("unknown window key: %s", key)
+		}
+		if err != nil {
+			return w, err
+		}
+	}
+	return w, nil
+}
+
+func tomlString(key string, value any) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return s, nil
+}
+
+// expandDir makes dir absolute: ~ is the home directory and relative paths
+// start at parent, or the current directory. An empty dir is parent.
+func expandDir(dir, parent string) (string, error) {
+	if dir == "" {
+		return parent, nil
+	}
+	if rest, ok := strings.CutPrefix(dir, "~"); ok && (rest == "" || rest[0] == '/') {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = home + rest
+	}
+	if !filepath.IsAbs(dir) && parent != "" {
+		dir = filepath.Join(parent, dir)
+	}
+	return filepath.Abs(dir)
+}
+
+// Commands returns the commands that create the template's session, in
+// order. Each new window or pane becomes the session's active one, so
+// commands after it target the session alone.
+func (t *Template) Commands() [][]string {
+	target := t.Name + ":"
+	var commands [][]string
+	withDir := func(command []string, dir string) []string {
+		if dir != "" {
+			command = append(command, "-c", dir)
+		}
+		return command
+	}
+	withName := func(command []string, name string) []string {
+		if name != "" {
+			command = append(command, "-n", name)
+		}
+		return command
+	}
+	for i, w := range t.Windows {
+		for j, p := range w.Panes {
+			switch {
+			case i == 0 && j == 0:
+				commands = append(commands, withName(withDir([]string{"new-session", "-d", "-s", t.Name}, p.Root), w.Name))
+			case j == 0:
+				commands = append(commands, withName(withDir([]string{"new-window", "-t", t.Name}, p.Root), w.Name))
+			default:
+				commands = append(commands, withDir([]string{"split-window", "-t", target}, p.Root))
+			}
+			if p.Command != "" {
+				commands = append(commands, []string{"send-keys", "-l", "-t", target, p.Command},
+					[]string{"send-keys", "-t", target, "Enter"})
+			}
+		}
+	}
+	if len(t.Windows) > 1 {
+		// The last window is active; the first is after it
+		commands = append(commands, []string{"select-window", "-n", "-t", target})
+	}
+	return commands
+}
+
+// RunStart implements `term start [-d] template`, creating the template's
+// session unless it exists and attaching to it, which -d skips.
+func RunStart(args []string) int {
+	detached := len(args) > 0 && args[0] == "-d"
+	if detached {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: term start [-d] template")
+		return 1
+	}
+	t, err := LoadTemplate(findTemplate(args[0]))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := SendCommand([]string{"has-session", "-t", t.Name}, false); err != nil {
+		for i, command := range t.Commands() {
+			if _, err := SendCommand(command, i == 0); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", command[0], err)
+				return 1
+			}
+		}
+	}
+	if detached {
+		return 0
+	}
+	return RunClient(t.Name)
+}
+
+// parseTOML reads the part of TOML templates need: key = value pairs whose
+// values are strings, integers, booleans or arrays of them, [tables] and
+// [[arrays of tables]], one level of which may be nested as [[a.b]].
+func parseTOML(text string) (map[string]any, error) {
+	doc := make(map[string]any)
+	table := doc
+	lines := strings.Split(text, "\n")
+	for n := 0; n < len(lines); n++ {
+		lineNo := n + 1
+		line := strings.TrimSpace(stripTOMLComment(lines[n]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			var err error
+			if table, err = tomlTable(doc, line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		if unquoted, err := strconv.Unquote(key); err == nil {
+			key = unquoted
+		} else if key == "" || strings.ContainsAny(key, " .\"'") {
+			return nil, fmt.Errorf("line %d: bad key: %s", lineNo, key)
+		}
+		value = strings.TrimSpace(value)
+		// Arrays may go on over lines until their brackets close
+		for strings.HasPrefix(value, "[") && !tomlBalanced(value) && n+1 < len(lines) {
+			n++
+			value += " " + strings.TrimSpace(stripTOMLComment(lines[n]))
+		}
+		v, rest, err := tomlValue(value)
+		if err == nil && strings.TrimSpace(rest) != "" {
+			err = fmt.Errorf("unexpected %q", rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if _, dup := table[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", lineNo, key)
+		}
+		table[key] = v
+	}
+	return doc, nil
+}
+
+// tomlTable finds or makes the table a [header] or [[header]] line names.
+func tomlTable(doc map[string]any, line string) (map[string]any, error) {
+	name, array := strings.CutPrefix(line, "[[")
+	closing := "]]"
+	if !array {
+		name, closing = strings.TrimPrefix(line, "["), "]"
+	}
+	name, ok := strings.CutSuffix(name, closing)
+	if !ok || strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("bad table: %s", line)
+	}
+	parent := doc
+	parts := strings.Split(strings.TrimSpace(name), ".")
+	for _, part := range parts[:len(parts)-1] {
+		switch v := parent[part].(type) {
+		case map[string]any:
+			parent = v
+		case []map[string]any:
+			parent = v[len(v)-1] // the last of an array of tables
+		default:
+			return nil, fmt.Errorf("no table %s for %s", part, name)
+		}
+	}
+	last := parts[len(parts)-1]
+	if !array {
+		if _, dup := parent[last]; dup {
+			return nil, fmt.Errorf("%s is set twice", name)
+		}
+		table := make(map[string]any)
+		parent[last] = table
+		return table, nil
+	}
+	tables, ok := parent[last].([]map[string]any)
+	if !ok && parent[last] != nil {
+		return nil, fmt.Errorf("%s is not an array of tables", name)
+	}
+	table := make(map[string]any)
+	parent[last] = append(tables, table)
+	return table, nil
+}
+
+// tomlValue reads the value at the start of s and returns what follows it.
+func tomlValue(s string) (any, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return tomlBasicString(s)
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case strings.HasPrefix(s, "["):
+		values := []any{}
+		s = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(s, "]") {
+			v, rest, err := tomlValue(s)
+			if err != nil {
+				return nil, "", err
+			}
+			values = append(values, v)
+			s = strings.TrimSpace(rest)
+			if next, ok := strings.CutPrefix(s, ","); ok {
+				s = strings.TrimSpace(next)
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, "", fmt.Errorf("expected , or ] in array")
+			}
+		}
+		return values, s[1:], nil
+	}
+	end := strings.IndexAny(s, ",] \t")
+	if end < 0 {
+		end = len(s)
+	}
+	word, rest := s[:end], s[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad value: %s", word)
+	}
+	return n, rest, nil
+}
+
+// tomlBasicString reads a "double quoted" string with its escapes.
+func tomlBasicString(s string) (any, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				return nil, "", fmt.Errorf("unterminated string")
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				size := 4
+				if e == 'U' {
+					size = 8
+				}
+				if i+size >= len(s) {
+					return nil, "", fmt.Errorf("bad escape in string")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return nil, "", fmt.Errorf("bad escape in string")
+				}
+				b.WriteRune(rune(r))
+				i += size
+			default:
+				return nil, "", fmt.Errorf("bad escape in string: \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, "", fmt.Errorf("unterminated string")
+}
+
+// stripTOMLComment cuts a # comment off a line, leaving any in strings.
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+// tomlBalanced reports whether the brackets of an array value close, not
+// counting those in strings.
+func tomlBalanced(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth == 0
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]any
+	}{
+		{
+			name: "values",
+			text: `name = "blog"
+count = 1_000
+on = true
+off = false
+raw = 'C:\path'
+escaped = "a\tb\"c\u00e9"
+"quoted key" = 1`,
+			want: map[string]any{
+				"name":       "blog",
+				"count":      int64(1000),
+				"on":         true,
+				"off":        false,
+				"raw":        `C:\path`,
+				"escaped":    "a\tb\"cé",
+				"quoted key": int64(1),
+			},
+		},
+		{
+			name: "comments",
+			text: `# a comment
+name = "a # not a comment" # a comment
+other = 'also # not one'`,
+			want: map[string]any{"name": "a # not a comment", "other": "also # not one"},
+		},
+		{
+			name: "arrays over lines",
+			text: `panes = [
+	"vim",   # the editor
+	"npm run dev",
+	["nested", 2],
+]`,
+			want: map[string]any{"panes": []any{"vim", "npm run dev", []any{"nested", int64(2)}}},
+		},
+		{
+			name: "tables",
+			text: `[server]
+port = 8080
+[client]
+port = 8081`,
+			want: map[string]any{
+				"server": map[string]any{"port": int64(8080)},
+				"client": map[string]any{"port": int64(8081)},
+			},
+		},
+		{
+			name: "nested arrays of tables",
+			text: `[[windows]]
+name = "editor"
+[[windows]]
+name = "logs"
+[[windows.panes]]
+command = "tail -f app.log"
+[[windows.panes]]
+root = "/var/log"`,
+			want: map[string]any{"windows": []map[string]any{
+				{"name": "editor"},
+				{"name": "logs", "panes": []map[string]any{
+					{"command": "tail -f app.log"},
+					{"root": "/var/log"},
+				}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.text)
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // in the error
+	}{
+		{"name", "line 1: expected key = value"},
+		{"a = 1\na = 2", "line 2: a is set twice"},
+		{`name = "open`, "unterminated string"},
+		{`name = "\q"`, `bad escape in string: \q`},
+		{`name = "\u12"`, "bad escape in string"},
+		{"name = yes", "bad value: yes"},
+		{"name = 1 2", `unexpected " 2"`},
+		{"a b = 1", "bad key: a b"},
+		{"[]", "bad table"},
+		{"[a]\n[a]", "line 2: a is set twice"},
+		{"a = 1\n[[a]]", "a is not an array of tables"},
+		{"[[a.b]]", "no table a for a.b"},
+		{"panes = [1 2]", "expected , or ] in array"},
+	}
+	for _, tt := range tests {
+		_, err := parseTOML(tt.text)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseTOML(%q) = %v, want an error with %q", tt.text, err, tt.want)
+		}
+	}
+}
+
+func TestTemplateCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		template Template
+		want     [][]string
+	}{
+		{
+			name:     "one shell",
+			template: Template{Name: "plain", Windows: []TemplateWindow{{Panes: []TemplatePane{{}}}}},
+			want:     [][]string{{"new-session", "-d", "-s", "plain"}},
+		},
+		{
+			name: "windows and splits",
+			template: Template{Name: "blog", Windows: []TemplateWindow{
+				{Name: "editor", Panes: []TemplatePane{
+					{Command: "vim", Root: "/srv/blog"},
+					{Command: "npm run dev", Root: "/srv/blog"},
+				}},
+				{Name: "logs", Panes: []TemplatePane{
+					{Command: "tail -f app.log", Root: "/var/log/blog"},
+				}},
+			}},
+			want: [][]string{
+				{"new-session", "-d", "-s", "blog", "-c", "/srv/blog", "-n", "editor"},
+				{"send-keys", "-l", "-t", "blog:", "vim"},
+				{"send-keys", "-t", "blog:", "Enter"},
+				{"split-window", "-t", "blog:", "-c", "/srv/blog"},
+				{"send-keys", "-l", "-t", "blog:", "npm run dev"},
+				{"send-keys", "-t", "blog:", "Enter"},
+				{"new-window", "-t", "blog", "-c", "/var/log/blog", "-n", "logs"},
+				{"send-keys", "-l", "-t", "blog:", "tail -f app.log"},
+				{"send-keys", "-t", "blog:", "Enter"},
+				{"select-window", "-n", "-t", "blog:"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.template.Commands(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Commands() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateDecode(t *testing.T) {
+	doc, err := parseTOML(`root = "/srv/blog"
+[[windows]]
+panes = ["vim", ""]
+[[windows]]
+name = "logs"
+root = "log"
+[[windows.panes]]
+command = "tail -f app.log"
+[[windows.panes]]
+root = "/tmp"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Template{Name: "blog"}
+	if err := got.decode(doc); err != nil {
+		t.Fatal(err)
+	}
+	want := Template{Name: "blog", Root: "/srv/blog", Windows: []TemplateWindow{
+		{Root: "/srv/blog", Panes: []TemplatePane{
+			{Command: "vim", Root: "/srv/blog"},
+			{Root: "/srv/blog"},
+		}},
+		{Name: "logs", Root: "/srv/blog/log", Panes: []TemplatePane{
+			{Command: "tail -f app.log", Root: "/srv/blog/log"},
+			{Root: "/tmp"},
+		}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decode = %+v, want %+v", got, want)
+	}
+
+	for _, text := range []string{"colour = 1", "[[windows]]\nsize = 1", "windows = 1", "name = 1"} {
+		doc, err := parseTOML(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := new(Template).decode(doc); err == nil {
+			t.Errorf("decode(%q) succeeded", text)
+		}
+	}
+}
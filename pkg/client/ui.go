@@ -0,0 +1,501 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+type UI struct {
+	screen            tcell.Screen
+	defStyle          tcell.Style
+	statusStyle       vt.StyleID
+	matchStyle        vt.StyleID // copy mode search matches
+	currentMatchStyle vt.StyleID
+	selectionStyle    vt.StyleID
+	hintStyle         vt.StyleID // select-url labels
+	positionStyle     vt.StyleID // copy mode's position in the history
+	tableStyle        vt.StyleID // the key table waiting for a key
+	errorStyle        vt.StyleID // the status line while showing an error
+
+	// window-style and window-active-style, nil when not set
+	inactivePaneStyle, activePaneStyle *vt.PaneStyle
+	statusJustify                      string // where the window list goes, see drawStatus
+	statusError                        bool   // the status line shows an error
+
+	title         string // last set on the outer terminal
+	cursorColored bool   // a pane's cursor color was applied, see applyCursor
+	parkX, parkY  int    // where the hidden cursor is left, see parkCursor; -1 for nowhere
+
+	// Each frame is composed in frame and only the cells that differ from
+	// shown, the last frame drawn, are passed to tcell
+	frame, shown *vt.Grid
+}
+
+func NewUI(screen tcell.Screen) *UI {
+	defStyle := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset)
+	statusStyle := defStyle.Reverse(true)
+
+	return &UI{
+		screen:            screen,
+		defStyle:          defStyle,
+		statusStyle:       vt.InternStyle(statusStyle),
+		matchStyle:        vt.InternStyle(defStyle.Background(tcell.ColorOlive).Foreground(tcell.ColorBlack)),
+		currentMatchStyle: vt.InternStyle(defStyle.Background(tcell.ColorYellow).Foreground(tcell.ColorBlack)),
+		selectionStyle:    vt.InternStyle(defStyle.Reverse(true)),
+		hintStyle:         vt.InternStyle(defStyle.Background(tcell.ColorRed).Foreground(tcell.ColorWhite).Bold(true)),
+		positionStyle:     vt.InternStyle(defStyle.Background(tcell.ColorYellow).Foreground(tcell.ColorBlack)),
+		tableStyle:        vt.InternStyle(defStyle.Background(tcell.ColorTeal).Foreground(tcell.ColorBlack).Bold(true)),
+		errorStyle:        vt.InternStyle(defStyle.Background(tcell.ColorMaroon).Foreground(tcell.ColorWhite).Bold(true)),
+	}
+}
+
+func (ui *UI) DrawScreen(paneBuffers map[int]*vt.PaneBuffer, activePaneID int, floats []protocol.FloatInfo, status, table string, overlay string, copyMode *CopyMode, hints []urlHint, chooser *Chooser) {
+	width, height := ui.screen.Size()
+	if ui.frame == nil {
+		ui.frame = vt.NewGrid(width, height)
+	} else {
+		ui.frame.Resize(width, height)
+		ui.frame.Clear()
+	}
+	ui.parkX = -1
+
+	// Check if this is a multi-line status message (like help)
+	lines := []string{}
+	if len(status) > 0 {
+		// Split status into lines
+		currentLine := ""
+		for _, r := range status {
+			if r == '\n' {
+				lines = append(lines, currentLine)
+				currentLine = ""
+			} else {
+				currentLine += string(r)
+			}
+		}
+		if currentLine != "" {
+			lines = append(lines, currentLine)
+		}
+	}
+
+	// If it's a multi-line message, display it as an overlay
+	if len(lines) > 1 {
+		// Display multi-line content in the center of the screen
+		startY := (height - len(lines)) / 2
+		for i, line := range lines {
+			y := startY + i
+			if y >= 0 && y < height {
+				// Clear the line
+				for x := 0; x < width; x++ {
+					ui.set(x, y, ' ', ui.statusStyle)
+				}
+				// Draw the line content
+				for j, r := range line {
+					if j < width {
+						ui.set(j, y, r, ui.statusStyle)
+					}
+				}
+			}
+		}
+	} else {
+		// Single line status - draw at top
+		// Clear the entire status line with the status style
+		style := ui.statusStyle
+		if ui.statusError {
+			style = ui.errorStyle
+		}
+		for x := 0; x < width; x++ {
+			ui.set(x, 0, ' ', style)
+		}
+
+		// Draw the status text, and which table the next key goes to
+		end := width
+		if table != "" {
+			end = ui.drawTable(table, width)
+		}
+		ui.drawStatus(status, style, end)
+
+		// Draw active pane content below status bar, styled as without
+		// focus while a float has it
+		paneStyle := ui.activePaneStyle
+		if len(floats) > 0 {
+			paneStyle = ui.inactivePaneStyle
+		}
+		if pb, ok := paneBuffers[activePaneID]; ok {
+			var content []vt.Row
+			if copyMode != nil {
+				_, height := pb.Size()
+				content = pb.Lines(copyMode.top, height)
+			} else {
+				content = pb.Content().Rows()
+			}
+			var pattern *regexp.Regexp
+			if copyMode != nil {
+				pattern = copyMode.highlightPattern()
+			}
+			for y, row := range content {
+				for x, c := range row {
+					if c.Width == 0 {
+						continue // covered by a wide character
+					}
+					style := paneStyle.Apply(c.Style)
+					if copyMode != nil && copyMode.selection != nil && copyMode.selection.Contains(copyMode.top+y, x) {
+						style = ui.selectionStyle
+					} else if c == vt.BlankCell && paneStyle == nil {
+						continue // already blank from Clear
+					}
+					c.Style = style
+					ui.setCell(x, y+1, c) // +1 for status line
+				}
+				if pattern == nil {
+					continue
+				}
+				// Every match in view is highlighted, the current one
+				// brighter
+				line := row.Text()
+				for _, m := range lineMatches(pattern, line) {
+					style := ui.matchStyle
+					if cur := copyMode.match; cur != nil && cur.line == copyMode.top+y && cur.col == m.col {
+						style = ui.currentMatchStyle
+					}
+					for x := m.col; x < m.col+m.length && x < len(line); x++ {
+						ui.set(x, y+1, line[x], style)
+					}
+				}
+			}
+			if copyMode != nil {
+				ui.drawPosition(pb.LiveTop()-copyMode.top, pb.HistoryLen(), width)
+			}
+			for _, h := range hints {
+				for i, r := range h.label {
+					if h.x+i < width {
+						ui.set(h.x+i, h.y+1, r, ui.hintStyle)
+					}
+				}
+			}
+			// Ensure cursor position is within bounds
+			cursorX, cursorY := pb.GetCursor()
+			cursorY += 1 // +1 for status line
+			if copyMode != nil && copyMode.prompt != nil {
+				ui.screen.ShowCursor(runewidth.StringWidth(status), 0)
+			} else if copyMode != nil {
+				ui.screen.HideCursor()
+			} else if cursorX >= 0 && cursorX < width && cursorY >= 1 && cursorY < height {
+				ui.showCursor(pb, cursorX, cursorY)
+			}
+		}
+
+		// Floats go over the layout, the last on top with the cursor
+		for i, f := range floats {
+			pb, ok := paneBuffers[f.PaneID]
+			if !ok {
+				continue
+			}
+			style := ui.inactivePaneStyle
+			if i == len(floats)-1 {
+				style = ui.activePaneStyle
+			}
+			ui.drawFloat(f, pb, style)
+			if i == len(floats)-1 && copyMode == nil {
+				cursorX, cursorY := pb.GetCursor()
+				ui.showCursor(pb, f.X+1+cursorX, f.Y+1+cursorY+1) // +1 for status line
+			}
+		}
+	}
+	if overlay != "" {
+		ui.drawOverlay(strings.Split(strings.TrimRight(overlay, "\n"), "\n"))
+	}
+	if chooser != nil {
+		ui.drawChooser(chooser)
+	}
+	ui.flush()
+	ui.screen.Show()
+	ui.moveParkedCursor()
+}
+
+// drawStatus draws the status line in its first end columns. Tabs split it
+// into segments: the first goes at the left, the last at the right and one
+// between them where status-justify puts it. What doesn't fit is cut with
+// an ellipsis, the right segment first, then the middle.
+func (ui *UI) drawStatus(status string, style vt.StyleID, end int) {
+	segments := strings.Split(status, "\t")
+	left, middle, right := segments[0], "", ""
+	switch len(segments) {
+	case 1:
+	case 2:
+		right = segments[1]
+	default:
+		middle, right = segments[1], strings.Join(segments[2:], " ")
+	}
+	left = truncate(left, end)
+	room := end - runewidth.StringWidth(left) - 1 // a space after the left
+	middle = truncate(middle, room)
+	room -= runewidth.StringWidth(middle) + 2 // two spaces before the right
+	right = truncate(right, room)
+
+	leftEnd := runewidth.StringWidth(left) + 1
+	rightStart := end - runewidth.StringWidth(right)
+	width := runewidth.StringWidth(middle)
+	x := leftEnd
+	switch ui.statusJustify {
+	case "centre":
+		x = (end - width) / 2
+	case "right":
+		x = rightStart - width
+		if right != "" {
+			x -= 2
+		}
+	}
+	if right != "" {
+		x = min(x, rightStart-2-width)
+	}
+	x = max(x, leftEnd)
+
+	ui.drawText(0, 0, left, style, end)
+	ui.drawText(x, 0, middle, style, end)
+	ui.drawText(rightStart, 0, right, style, end)
+}
+
+// truncate cuts text to width columns, ending it with an ellipsis when
+// cut.
+func truncate(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(text, width, "…")
+}
+
+// drawTable shows the label of the key table waiting for a key at the right
+// end of the status line, and returns the column it starts at.
+func (ui *UI) drawTable(label string, width int) int {
+	label = " " + label + " "
+	x := max(width-runewidth.StringWidth(label), 0)
+	ui.drawText(x, 0, label, ui.tableStyle, width)
+	return x
+}
+
+// drawPosition shows how many lines copy mode is scrolled back out of how
+// many the history holds, as [offset/lines] in the pane's top right corner.
+func (ui *UI) drawPosition(offset, lines, width int) {
+	label := fmt.Sprintf("[%d/%d]", offset, lines)
+	for i, r := range label {
+		ui.set(width-len(label)+i, 1, r, ui.positionStyle) // +1 for status line
+	}
+}
+
+// set puts a character in the frame being composed.
+func (ui *UI) set(x, y int, r rune, style vt.StyleID) {
+	ui.setCell(x, y, vt.Cell{Rune: r, Style: style, Width: 1})
+}
+
+func (ui *UI) setCell(x, y int, c vt.Cell) {
+	if w, h := ui.frame.Size(); x >= 0 && x < w && y >= 0 && y < h {
+		ui.frame.Set(x, y, c)
+	}
+}
+
+// flush passes tcell the cells of the frame that changed since the last
+// one, skipping rows that are the same, and keeps the frame as shown.
+func (ui *UI) flush() {
+	styles := vt.Styles()
+	changed := ui.frame.Diff(ui.shown)
+	sameSize := false
+	if ui.shown != nil {
+		shownWidth, shownHeight := ui.shown.Size()
+		width, height := ui.frame.Size()
+		sameSize = shownWidth == width && shownHeight == height
+	}
+	for _, y := range changed {
+		row := ui.frame.Row(y)
+		for x, c := range row {
+			if c.Width == 0 || sameSize && ui.shown.Cell(x, y) == c {
+				continue
+			}
+			ui.screen.SetContent(x, y, c.Rune, nil, styles[c.Style])
+		}
+	}
+	ui.frame, ui.shown = ui.shown, ui.frame
+}
+
+// Invalidate makes the next frame draw every cell, for when the screen
+// may no longer show the last frame.
+func (ui *UI) Invalidate() {
+	ui.shown = nil
+}
+
+// drawFloat draws a float's pane, in paneStyle, inside a border with its
+// name on top.
+func (ui *UI) drawFloat(f protocol.FloatInfo, pb *vt.PaneBuffer, paneStyle *vt.PaneStyle) {
+	top, bottom := f.Y+1, f.Y+f.Height // +1 for status line
+	right := f.X + f.Width - 1
+	style := vt.BlankCell.Style
+	for x := f.X; x <= right; x++ {
+		ui.set(x, top, '─', style)
+		ui.set(x, bottom, '─', style)
+	}
+	for y := top; y <= bottom; y++ {
+		ui.set(f.X, y, '│', style)
+		ui.set(right, y, '│', style)
+	}
+	ui.set(f.X, top, '┌', style)
+	ui.set(right, top, '┐', style)
+	ui.set(f.X, bottom, '└', style)
+	ui.set(right, bottom, '┘', style)
+	for i, r := range []rune(" " + f.Name + " ") {
+		if x := f.X + 2 + i; x < right-1 {
+			ui.set(x, top, r, style)
+		}
+	}
+
+	for y, row := range pb.Content().Rows() {
+		if y >= f.Height-2 {
+			break
+		}
+		for x, c := range row {
+			if x >= f.Width-2 {
+				break
+			}
+			if c.Width == 2 && x == f.Width-3 {
+				c = vt.BlankCell // would cover the border
+			}
+			c.Style = paneStyle.Apply(c.Style)
+			ui.setCell(f.X+1+x, top+1+y, c)
+		}
+	}
+}
+
+// drawOverlay draws lines in a box anchored to the bottom right corner,
+// above the pane content.
+func (ui *UI) drawOverlay(lines []string) {
+	width, height := ui.screen.Size()
+	boxWidth := 0
+	for _, line := range lines {
+		if n := len([]rune(line)); n > boxWidth {
+			boxWidth = n
+		}
+	}
+	boxWidth += 2 // one column of padding each side
+	if boxWidth > width {
+		boxWidth = width
+	}
+	if len(lines) > height-1 {
+		lines = lines[:height-1] // keep the status line visible
+	}
+	startX := width - boxWidth
+	startY := height - len(lines)
+	for i, line := range lines {
+		y := startY + i
+		for x := startX; x < width; x++ {
+			ui.set(x, y, ' ', ui.statusStyle)
+		}
+		x := startX + 1
+		for _, r := range line {
+			if x >= width {
+				break
+			}
+			ui.set(x, y, r, ui.statusStyle)
+			x++
+		}
+	}
+}
+
+// SetMouse turns reporting of mouse clicks, drags and the wheel on or off.
+func (ui *UI) SetMouse(on bool) {
+	if on {
+		ui.screen.EnableMouse(tcell.MouseButtonEvents | tcell.MouseDragEvents)
+	} else {
+		ui.screen.DisableMouse()
+	}
+}
+
+// SetAmbiguousWidth makes characters of ambiguous East Asian width, such
+// as ○ or §, take two columns ("wide") or one ("narrow"), so the screen is
+// laid out as the outer terminal draws them. "auto" goes by
+// RUNEWIDTH_EASTASIAN or else the client's locale.
+func (ui *UI) SetAmbiguousWidth(mode string) {
+	var wide bool
+	switch mode {
+	case "wide":
+		wide = true
+	case "narrow":
+		wide = false
+	default:
+		if env := os.Getenv("RUNEWIDTH_EASTASIAN"); env != "" {
+			wide = env == "1"
+		} else {
+			wide = runewidth.IsEastAsian()
+		}
+	}
+	if wide != runewidth.DefaultCondition.EastAsianWidth {
+		runewidth.DefaultCondition.EastAsianWidth = wide
+		ui.Clear() // tcell measures a cell when its character changes
+	}
+}
+
+// SetStatusError sets whether the status line shows an error, drawn in
+// errorStyle.
+func (ui *UI) SetStatusError(isError bool) {
+	ui.statusError = isError
+}
+
+// SetStatusJustify sets status-justify: left, centre or right.
+func (ui *UI) SetStatusJustify(justify string) {
+	ui.statusJustify = justify
+}
+
+// SetPaneStyles sets window-style and window-active-style; values that
+// don't parse are no style.
+func (ui *UI) SetPaneStyles(inactive, active string) {
+	ui.inactivePaneStyle, _ = vt.ParsePaneStyle(inactive)
+	ui.activePaneStyle, _ = vt.ParsePaneStyle(active)
+}
+
+// SetTitle sets the outer terminal's title, if it changed.
+func (ui *UI) SetTitle(title string) {
+	if title != ui.title {
+		ui.title = title
+		ui.screen.SetTitle(title)
+		ui.screen.Show()
+	}
+}
+
+// WriteRaw sends bytes straight to the outer terminal, bypassing tcell.
+func (ui *UI) WriteRaw(data []byte) {
+	if tty, ok := ui.screen.Tty(); ok {
+		tty.Write(data)
+	}
+}
+
+// CellSize returns the size of a cell in pixels, or zeros if the outer
+// terminal does not say.
+func (ui *UI) CellSize() (int, int) {
+	if tty, ok := ui.screen.Tty(); ok {
+		if ws, err := tty.WindowSize(); err == nil {
+			return ws.CellDimensions()
+		}
+	}
+	return 0, 0
+}
+
+// DrawImage writes an image sequence to the outer terminal with its top left
+// corner at screen cell x, y, leaving the cursor where it was.
+func (ui *UI) DrawImage(x, y int, data []byte) {
+	ui.WriteRaw(append([]byte(fmt.Sprintf("\x1b7\x1b[%d;%dH", y+1, x+1)), append(data, "\x1b8"...)...))
+}
+
+func (ui *UI) Clear() {
+	ui.screen.Clear()
+	ui.screen.Show()
+	ui.Invalidate()
+}
+
+func (ui *UI) Size() (int, int) {
+	return ui.screen.Size()
+}
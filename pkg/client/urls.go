@@ -0,0 +1,123 @@
+package client
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+
+	"term/pkg/vt"
+)
+
+// urlPattern finds URLs on a single line of the screen.
+var urlPattern = regexp.MustCompile("(?:https?|ftp|file)://[^\\s<>\"'`]+|www\\.[^\\s<>\"'`]+")
+
+// urlHint is a URL found on screen and the label typed to open it.
+type urlHint struct {
+	label string
+	url   string
+	x, y  int // where the URL starts in the pane
+}
+
+// findURLs returns the URLs in lines, labelled in reading order.
+func findURLs(lines [][]rune) []urlHint {
+	var hints []urlHint
+	for y, line := range lines {
+		s := string(line)
+		for _, loc := range urlPattern.FindAllStringIndex(s, -1) {
+			url := trimURL(s[loc[0]:loc[1]])
+			hints = append(hints, urlHint{url: url, x: utf8.RuneCountInString(s[:loc[0]]), y: y})
+		}
+	}
+	for i, label := range hintLabels(len(hints)) {
+		hints[i].label = label
+	}
+	return hints
+}
+
+// trimURL drops punctuation that usually ends the sentence around a URL
+// rather than the URL itself, keeping a closing bracket that has a match.
+func trimURL(url string) string {
+	for len(url) > 0 {
+		last := url[len(url)-1]
+		switch {
+		case strings.IndexByte(".,;:!?", last) >= 0:
+		case last == ')' && strings.Count(url, "(") < strings.Count(url, ")"):
+		case last == ']' && strings.Count(url, "[") < strings.Count(url, "]"):
+		default:
+			return url
+		}
+		url = url[:len(url)-1]
+	}
+	return url
+}
+
+// hintLabels returns n labels, single letters while they last and two
+// letters otherwise, so no label is a prefix of another.
+func hintLabels(n int) []string {
+	const letters = "asdfghjklqwertyuiopzxcvbnm"
+	labels := make([]string, 0, n)
+	if n <= len(letters) {
+		for i := 0; i < n; i++ {
+			labels = append(labels, letters[i:i+1])
+		}
+		return labels
+	}
+	for i := 0; i < n && i < len(letters)*len(letters); i++ {
+		labels = append(labels, string([]byte{letters[i/len(letters)], letters[i%len(letters)]}))
+	}
+	return labels
+}
+
+// ShowURLHints labels the URLs in view of the active pane, reporting
+// whether there were any.
+func (cs *ClientState) ShowURLHints() bool {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	pb, ok := cs.paneBuffers[cs.activePaneID]
+	if !ok {
+		return false
+	}
+	var lines []vt.Row
+	if cs.inCopyMode() {
+		_, height := pb.Size()
+		lines = pb.Lines(cs.copyMode.top, height)
+	} else {
+		lines = pb.Content().Rows()
+	}
+	cs.urlHints = findURLs(vt.RowsText(lines))
+	cs.hintTyped = ""
+	cs.draw()
+	return len(cs.urlHints) > 0
+}
+
+// HandleHintKey takes keys typed while URL hints are showing. It returns
+// the URL once a label is complete; Escape or a key matching no label
+// hides the hints.
+func (cs *ClientState) HandleHintKey(ev *tcell.EventKey) (url string, handled bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if len(cs.urlHints) == 0 {
+		return "", false
+	}
+	typed := cs.hintTyped
+	if ev.Key() == tcell.KeyRune {
+		typed += string(ev.Rune())
+	}
+	matched := false
+	for _, h := range cs.urlHints {
+		if h.label == typed {
+			url = h.url
+		}
+		if strings.HasPrefix(h.label, typed) {
+			matched = true
+		}
+	}
+	if url != "" || !matched || ev.Key() != tcell.KeyRune {
+		cs.urlHints = nil
+	}
+	cs.hintTyped = typed
+	cs.draw()
+	return url, true
+}
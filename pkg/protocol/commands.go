@@ -0,0 +1,243 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CommandAliases are the short names commands can also be run by, as in
+// tmux.
+var CommandAliases = map[string]string{
+	"set":      "set-option",
+	"source":   "source-file",
+	"bind":     "bind-key",
+	"unbind":   "unbind-key",
+	"lsk":      "list-keys",
+	"lsp":      "list-panes",
+	"ls":       "list-sessions",
+	"new":      "new-session",
+	"has":      "has-session",
+	"selectp":  "select-pane",
+	"selectw":  "select-window",
+	"send":     "send-keys",
+	"display":  "display-message",
+	"killp":    "kill-pane",
+	"killw":    "kill-window",
+	"linkw":    "link-window",
+	"rename":   "rename-session",
+	"respawnw": "respawn-window",
+	"movep":    "move-pane",
+	"movew":    "move-window",
+	"unlinkw":  "unlink-window",
+	"neww":     "new-window",
+	"splitw":   "split-window",
+	"pasteb":   "paste-buffer",
+	"setb":     "set-buffer",
+	"showb":    "show-buffer",
+	"lsb":      "list-buffers",
+	"deleteb":  "delete-buffer",
+	"saveb":    "save-buffer",
+	"loadb":    "load-buffer",
+	"run":      "run-shell",
+	"setenv":   "set-environment",
+	"showenv":  "show-environment",
+	"showmsgs": "show-messages",
+	"newf":     "new-float",
+	"lsf":      "list-floats",
+	"lsc":      "list-clients",
+	"switchc":  "switch-client",
+}
+
+// CommandSummaries describe commands in a few words for the command
+// palette, including those the client runs itself.
+var CommandSummaries = map[string]string{
+	"bind-key":         "Bind a key to a command",
+	"adopt-pane":       "Take a running process into a new window",
+	"choose-container": "Open a pane in a running Docker container",
+	"choose-host":      "Open a window connected to an SSH host",
+	"choose-pod":       "Open a pane in a Kubernetes pod",
+	"choose-tree":      "Find a session, window or pane",
+	"command-palette":  "Search and run commands",
+	"command-prompt":   "Type a command to run",
+	"copy-mode":        "Scroll and copy from history",
+	"delete-buffer":    "Delete a paste buffer",
+	"delete-macro":     "Delete a keyboard macro",
+	"detach-client":    "Detach from the session",
+	"display-message":  "Show or print a message with #{} variables",
+	"dump-screen":      "Print a pane's screen, or a hash of it",
+	"has-session":      "Check that a session exists",
+	"kill-float":       "Close a float",
+	"kill-pane":        "Close a pane",
+	"kill-window":      "Close a window, or unlink it if linked elsewhere",
+	"last-pane":        "Go back to the previous pane",
+	"last-window":      "Go back to the previous window",
+	"link-window":      "Show a window in another session too",
+	"info":             "Show the daemon's pid, socket and totals",
+	"list-buffers":     "List paste buffers",
+	"list-clients":     "List attached clients",
+	"list-floats":      "List floats",
+	"list-keys":        "List key bindings",
+	"list-macros":      "List keyboard macros",
+	"list-panes":       "List panes",
+	"list-plugins":     "List running plugins",
+	"list-sessions":    "List sessions",
+	"list-targets":     "List targets for shell completion",
+	"list-watches":     "List output watches",
+	"load-buffer":      "Read a file into a paste buffer",
+	"move-float":       "Move a float",
+	"move-pane":        "Move a pane to another window",
+	"move-window":      "Move a window to another session or index",
+	"new-float":        "Open a floating pane",
+	"new-session":      "Create a session",
+	"new-window":       "Create a window",
+	"next-pane":        "Go to the next pane",
+	"next-window":      "Go to the next window",
+	"paste-buffer":     "Paste a buffer into a pane",
+	"paste-primary":    "Paste the primary selection",
+	"play-macro":       "Type a keyboard macro into a pane",
+	"previous-window":  "Go to the previous window",
+	"record-macro":     "Start or stop recording a keyboard macro",
+	"rename-session":   "Rename a session",
+	"resize-float":     "Resize a float",
+	"respawn-window":   "Restart the commands of a window's panes",
+	"reload-plugins":   "Start and stop plugins to match the enabled list",
+	"run-lua":          "Run Lua code or a Lua file",
+	"run-shell":        "Run a shell command",
+	"save-buffer":      "Write a paste buffer to a file",
+	"select-pane":      "Make a pane active",
+	"select-url":       "Open a URL shown in the pane",
+	"select-window":    "Make a window active",
+	"send-keys":        "Send keys to a pane",
+	"send-prefix":      "Send the prefix key to the pane",
+	"set-buffer":       "Set a paste buffer's text",
+	"set-directory":    "Set where new windows or panes start",
+	"set-environment":  "Set a variable for new panes",
+	"set-option":       "Set an option",
+	"share-pane":       "Share a pane read-only in web browsers",
+	"show-buffer":      "Show a paste buffer",
+	"show-environment": "Show variables for new panes",
+	"show-help":        "Show help",
+	"show-messages":    "Show recent messages",
+	"source-file":      "Run the commands in a file",
+	"split-window":     "Add a pane to the window",
+	"switch-client":    "Switch to another session or pane",
+	"toggle-float":     "Show or hide a float",
+	"toggle-freeze":    "Freeze or resume a pane's output",
+	"toggle-logging":   "Start or stop logging a pane's output",
+	"unbind-key":       "Remove a key binding",
+	"unlink-window":    "Remove a linked window from a session",
+	"unshare-pane":     "Stop sharing a pane",
+	"unwatch-pane":     "Stop watching a pane's output",
+	"watch-pane":       "Act on pane output matching a pattern",
+}
+
+// ParseCommandLine splits a line into words, honouring single and double
+// quotes and backslash escapes. A # outside quotes starts a comment.
+func ParseCommandLine(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '#' && !inWord:
+			return args, nil
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// JoinCommandLine is the inverse of ParseCommandLine, quoting words that
+// would otherwise be split or lost.
+func JoinCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t'\"\\#") {
+			arg = "'" + strings.ReplaceAll(arg, "'", "'\\''") + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// LongFlag removes --name value from args, returning "" when it isn't
+// given.
+func LongFlag(args []string, name string) (string, []string, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg != "--"+name {
+			continue
+		}
+		if i+1 == len(args) {
+			return "", nil, fmt.Errorf("--%s needs a value", name)
+		}
+		return args[i+1], slices.Concat(args[:i], args[i+2:]), nil
+	}
+	return "", args, nil
+}
+
+// ParseFlags removes a command's leading flags from args, up to and
+// including any --. spec lists the flags getopt style, with a colon after
+// those taking a value; the result maps each flag given to its value.
+func ParseFlags(args []string, spec string) (map[byte]string, []string, error) {
+	flags := make(map[byte]string)
+	for len(args) > 0 && len(args[0]) == 2 && args[0][0] == '-' {
+		if args[0] == "--" {
+			return flags, args[1:], nil
+		}
+		i := strings.IndexByte(spec, args[0][1])
+		if i < 0 || args[0][1] == ':' {
+			return nil, nil, fmt.Errorf("unknown flag: %s", args[0])
+		}
+		if i+1 < len(spec) && spec[i+1] == ':' {
+			if len(args) < 2 {
+				return nil, nil, fmt.Errorf("%s needs a value", args[0])
+			}
+			flags[args[0][1]] = args[1]
+			args = args[1:]
+		} else {
+			flags[args[0][1]] = ""
+		}
+		args = args[1:]
+	}
+	return flags, args, nil
+}
+
+// ShellQuote quotes s as a single /bin/sh word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
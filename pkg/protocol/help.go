@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PrefixKeyName returns the name of the key that enters the prefix table.
+func PrefixKeyName(tables map[string]KeyTable) string {
+	for key, b := range tables["root"] {
+		if b.Command == "switch-client -T prefix" {
+			return key
+		}
+	}
+	return "prefix"
+}
+
+// KeyLabel shows a key the way it is typed: prefix keys after the prefix
+// key and keys of other tables after the table name.
+func KeyLabel(table, key, prefix string) string {
+	switch table {
+	case "root":
+		return key
+	case "prefix":
+		return prefix + " " + key
+	}
+	return table + ":" + key
+}
+
+// CommandSummary returns the summary of the command a command line runs.
+// Copy mode actions and key table switches are described by their
+// arguments.
+func CommandSummary(line string) string {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return ""
+	}
+	name := args[0]
+	if alias, ok := CommandAliases[name]; ok {
+		name = alias
+	}
+	switch {
+	case len(args) == 3 && name == "send-keys" && args[1] == "-X":
+		return "Copy mode: " + strings.ReplaceAll(args[2], "-", " ")
+	case len(args) == 3 && name == "switch-client" && args[1] == "-T":
+		return "Wait for a key from the " + args[2] + " table"
+	}
+	return CommandSummaries[name]
+}
+
+// HelpItems describes every key binding, root and prefix tables first and
+// copy mode last, followed by the commands no key runs. Picking a binding
+// runs its command, except in copy mode.
+func HelpItems(tables map[string]KeyTable) []ChooserItem {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	order := func(name string) int {
+		switch name {
+		case "root":
+			return 0
+		case "prefix":
+			return 1
+		case "copy-mode":
+			return 3
+		}
+		return 2
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if order(a) != order(b) {
+			return order(a) - order(b)
+		}
+		return strings.Compare(a, b)
+	})
+
+	var items []ChooserItem
+	prefix := PrefixKeyName(tables)
+	bound := make(map[string]bool)
+	for _, name := range names {
+		for _, key := range tables[name].SortedKeys() {
+			line := tables[name][key].Command
+			text := fmt.Sprintf("%-18s %-32s %s", KeyLabel(name, key, prefix), line, CommandSummary(line))
+			item := ChooserItem{Text: strings.TrimRight(text, " "), Command: line}
+			if name == "copy-mode" {
+				item.Command = "" // only means something in copy mode
+			}
+			items = append(items, item)
+			command, _, _ := strings.Cut(line, " ")
+			if alias, ok := CommandAliases[command]; ok {
+				command = alias
+			}
+			bound[command] = true
+		}
+	}
+	var unbound []string
+	for name := range CommandSummaries {
+		if !bound[name] {
+			unbound = append(unbound, name)
+		}
+	}
+	slices.Sort(unbound)
+	for _, name := range unbound {
+		text := fmt.Sprintf("%-18s %-32s %s", "", name, CommandSummaries[name])
+		items = append(items, ChooserItem{Text: strings.TrimRight(text, " "), Command: name})
+	}
+	return items
+}
@@ -0,0 +1,252 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Binding is the command a key runs in a key table. Repeatable bindings can
+// be pressed again within repeat-time without going back through the prefix.
+type Binding struct {
+	Command string `json:"command"`
+	Repeat  bool   `json:"repeat,omitempty"`
+}
+
+// KeyTable maps key names such as "C-a", "n" or "Up" to bindings.
+type KeyTable map[string]*Binding
+
+// KeyBindings holds every key table by name. Keys pressed in the root table
+// that have no binding are sent to the active pane; any other table returns
+// to root after one key. The copy-mode table is used in place of root while
+// a pane is in copy mode.
+type KeyBindings struct {
+	tables map[string]KeyTable
+	mutex  sync.Mutex
+}
+
+func NewKeyBindings() *KeyBindings {
+	kb := &KeyBindings{tables: make(map[string]KeyTable)}
+	kb.Bind("root", "C-a", "switch-client -T prefix", false)
+	kb.Bind("prefix", "C-a", "send-prefix", false)
+	kb.Bind("prefix", "d", "detach-client", false)
+	kb.Bind("prefix", "c", "new-window", false)
+	kb.Bind("prefix", "n", "next-window", true)
+	kb.Bind("prefix", "p", "previous-window", true)
+	kb.Bind("prefix", "&", "kill-pane", false)
+	kb.Bind("prefix", "\"", "split-window", false)
+	kb.Bind("prefix", "o", "next-pane", true)
+	kb.Bind("prefix", "l", "last-window", false)
+	kb.Bind("prefix", ";", "last-pane", false)
+	kb.Bind("prefix", "?", "show-help", false)
+	kb.Bind("prefix", "[", "copy-mode", false)
+	kb.Bind("prefix", "]", "paste-buffer", false)
+	kb.Bind("prefix", "u", "select-url", false)
+	kb.Bind("prefix", "`", "toggle-float -n scratch", false)
+	kb.Bind("prefix", "s", "choose-tree", false)
+	kb.Bind("prefix", "S", "choose-host", false)
+	kb.Bind("prefix", ":", "command-palette", false)
+	kb.Bind("prefix", "$", "command-prompt -p 'Rename session' -I 'rename-session '", false)
+	kb.Bind("prefix", "P", "toggle-logging", false)
+	kb.Bind("prefix", "F", "toggle-freeze", false)
+	kb.Bind("prefix", "q", "record-macro", false)
+	kb.Bind("prefix", "@", "play-macro", false)
+	kb.Bind("prefix", "m", "set-option mouse", false)
+	kb.Bind("root", "S-PageUp", "copy-mode -u", false)
+	kb.Bind("root", "MouseDown2Pane", "paste-primary", false)
+
+	// Keys in copy mode, looked up before the root table
+	for key, action := range map[string]string{
+		"q": "cancel", "Escape": "cancel", "End": "cancel", "S-End": "cancel",
+		"Up": "scroll-up", "k": "scroll-up", "C-y": "scroll-up",
+		"Down": "scroll-down", "j": "scroll-down", "C-e": "scroll-down",
+		"PageUp": "page-up", "S-PageUp": "page-up", "C-b": "page-up",
+		"PageDown": "page-down", "S-PageDown": "page-down", "C-f": "page-down",
+		"C-u": "halfpage-up", "C-d": "halfpage-down",
+		"g": "history-top", "Home": "history-top", "G": "history-bottom",
+		"/": "search-forward-incremental", "?": "search-backward-incremental",
+		"n": "search-again", "N": "search-reverse",
+		"Enter": "copy-selection-and-cancel", "y": "copy-selection-and-cancel",
+		"{": "previous-prompt", "}": "next-prompt", "o": "select-output",
+	} {
+		kb.Bind("copy-mode", key, "send-keys -X "+action, false)
+	}
+	return kb
+}
+
+func (kb *KeyBindings) Bind(table, key, command string, repeat bool) {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	if kb.tables[table] == nil {
+		kb.tables[table] = make(KeyTable)
+	}
+	kb.tables[table][NormalizeKeyName(key)] = &Binding{Command: command, Repeat: repeat}
+}
+
+func (kb *KeyBindings) Unbind(table, key string) error {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	key = NormalizeKeyName(key)
+	if _, ok := kb.tables[table][key]; !ok {
+		return fmt.Errorf("key not bound in table %s: %s", table, key)
+	}
+	delete(kb.tables[table], key)
+	return nil
+}
+
+func (kb *KeyBindings) Lookup(table, key string) *Binding {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	return kb.tables[table][key]
+}
+
+// Tables returns a copy of all key tables, suitable for sending to clients.
+func (kb *KeyBindings) Tables() map[string]KeyTable {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	tables := make(map[string]KeyTable, len(kb.tables))
+	for name, table := range kb.tables {
+		tables[name] = make(KeyTable, len(table))
+		for key, b := range table {
+			tables[name][key] = b
+		}
+	}
+	return tables
+}
+
+func (kb *KeyBindings) SetTables(tables map[string]KeyTable) {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	kb.tables = tables
+}
+
+// List returns one bind-key line per binding, root and prefix tables first.
+// If only is set, just that table is listed.
+func (kb *KeyBindings) List(only string) string {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+
+	var names []string
+	for name := range kb.tables {
+		if only == "" || name == only {
+			names = append(names, name)
+		}
+	}
+	order := func(name string) int {
+		switch name {
+		case "root":
+			return 0
+		case "prefix":
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if order(names[i]) != order(names[j]) {
+			return order(names[i]) < order(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	tableWidth, keyWidth := 0, 0
+	for _, name := range names {
+		tableWidth = max(tableWidth, len(name))
+		for key := range kb.tables[name] {
+			keyWidth = max(keyWidth, len(key))
+		}
+	}
+	var b strings.Builder
+	for _, name := range names {
+		t := kb.tables[name]
+		for _, key := range t.SortedKeys() {
+			flag := "  "
+			if t[key].Repeat {
+				flag = "-r"
+			}
+			quoted := key
+			if strings.ContainsAny(key, "\"'#\\") {
+				quoted = "\\" + key
+			}
+			fmt.Fprintf(&b, "bind-key %s -T %-*s %-*s %s\n", flag, tableWidth, name, keyWidth+1, quoted, t[key].Command)
+		}
+	}
+	return b.String()
+}
+
+// Hint describes the bindings of a table, one "key  command" per line, for
+// the popup shown while the table waits for a key.
+func (kb *KeyBindings) Hint(table string) string {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	t := kb.tables[table]
+	if len(t) == 0 {
+		return ""
+	}
+	keys := t.SortedKeys()
+	keyWidth := 0
+	for _, key := range keys {
+		if len(key) > keyWidth {
+			keyWidth = len(key)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", table)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%-*s  %s\n", keyWidth, key, t[key].Command)
+	}
+	return b.String()
+}
+
+// TableLabel names a key table for the status line: by the root key that
+// switches to it, as ^A for C-a, or else by its name.
+func (kb *KeyBindings) TableLabel(table string) string {
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	for _, key := range kb.tables["root"].SortedKeys() {
+		if kb.tables["root"][key].Command != "switch-client -T "+table {
+			continue
+		}
+		if ctrl, ok := strings.CutPrefix(key, "C-"); ok && len(ctrl) == 1 {
+			return "^" + strings.ToUpper(ctrl)
+		}
+		return key
+	}
+	return table
+}
+
+// SortedKeys returns the keys of a table in a stable order.
+func (t KeyTable) SortedKeys() []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NormalizeKeyName puts a user-written key name into the form produced by
+// vt.KeyName, so "^A", "c-A" and "C-a" all bind the same key.
+func NormalizeKeyName(name string) string {
+	if len(name) == 2 && name[0] == '^' {
+		return "C-" + strings.ToLower(name[1:])
+	}
+	prefix := ""
+	for len(name) > 2 && name[1] == '-' {
+		switch name[0] {
+		case 'C', 'c':
+			prefix += "C-"
+		case 'M', 'm':
+			prefix += "M-"
+		case 'S', 's':
+			prefix += "S-"
+		default:
+			return prefix + name
+		}
+		name = name[2:]
+	}
+	if strings.HasPrefix(prefix, "C-") && len(name) == 1 {
+		name = strings.ToLower(name)
+	}
+	return prefix + name
+}
@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// TokenEnv is the environment variable a client takes the token from,
+// for clients that don't share the daemon's home directory.
+const TokenEnv = "TERM_MUX_TOKEN"
+
+// TCPPrefix marks a --socket that is a --listen address.
+const TCPPrefix = "tcp:"
+
+// TokenPath is the file holding the token TCP clients authenticate with.
+func TokenPath() string {
+	return filepath.Join(DataDir(), "token")
+}
+
+// DataDir is where term keeps what it installs and records, by the XDG base
+// directory spec.
+func DataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "term")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "term")
+}
@@ -0,0 +1,83 @@
+package protocol
+
+// ChooserItem is one line of a chooser and the command Enter runs for it.
+type ChooserItem struct {
+	Text    string `json:"text"`
+	Command string `json:"command"`
+}
+
+// ChooserList is what the daemon sends a client to pick from (MsgChooser).
+// Selected is the item the cursor starts on and Query the text already
+// typed. With RunQuery set, Enter runs what was typed as a command when it
+// has arguments or matches nothing.
+type ChooserList struct {
+	Title    string        `json:"title"`
+	Items    []ChooserItem `json:"items"`
+	Selected int           `json:"selected"`
+	Query    string        `json:"query,omitempty"`
+	RunQuery bool          `json:"runQuery,omitempty"`
+}
+
+// FloatInfo describes a float to clients (MsgFloats).
+type FloatInfo struct {
+	PaneID  int    `json:"pane"`
+	Name    string `json:"name"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Visible bool   `json:"visible"`
+}
+
+// Message is the payload of MsgMessage: a notice or an error the
+// client shows in its message line for display-time milliseconds.
+type Message struct {
+	Text  string `json:"text"`
+	Error bool   `json:"error,omitempty"`
+}
+
+// KeyEncoding is the extended key encoding a pane's application asked for,
+// which clients need to know when encoding keys for it.
+type KeyEncoding struct {
+	PaneID          int `json:"pane"`
+	ModifyOtherKeys int `json:"modifyOtherKeys,omitempty"` // xterm modifyOtherKeys level
+	KeyboardFlags   int `json:"keyboardFlags,omitempty"`   // CSI u progressive enhancement flags
+}
+
+// Snapshot is the daemon's state as an attaching client is sent it: every
+// session with its windows and panes, and which of them the client shows.
+// The panes' screens follow as their replay (replay.go).
+type Snapshot struct {
+	Session    string         `json:"session_name"` // the one attached to
+	ActivePane int            `json:"pane_id"`      // -1 when it has no windows
+	Sessions   []SessionState `json:"sessions"`
+}
+
+type SessionState struct {
+	Name    string        `json:"session_name"`
+	Windows []WindowState `json:"windows"`
+	Floats  []FloatInfo   `json:"floats"` // bottom first
+}
+
+// WindowState describes a window. Its panes all fill the area below the
+// status line and the active one is shown.
+type WindowState struct {
+	Index  int         `json:"window_index"`
+	Name   string      `json:"window_name"`
+	Active bool        `json:"window_active"`
+	Panes  []PaneState `json:"panes"`
+}
+
+type PaneState struct {
+	ID     int    `json:"pane_id"`
+	Index  int    `json:"pane_index"`
+	Title  string `json:"pane_title"`
+	Width  int    `json:"pane_width"`
+	Height int    `json:"pane_height"`
+	Active bool   `json:"pane_active"`
+
+	// With history-file on, where the daemon keeps the pane's history and
+	// how many lines of it come before the replay, for the client to load
+	HistoryFile  string `json:"history_file,omitempty"`
+	HistoryLines int    `json:"history_lines,omitempty"`
+}
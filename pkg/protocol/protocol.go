@@ -0,0 +1,84 @@
+// Package protocol is the wire format spoken between term's daemon, its
+// attached clients and the term command line over the daemon's Unix
+// socket. Each message is one type byte, a 4-byte big-endian payload length
+// and the payload. It also holds what both ends agree on: the payloads,
+// key tables, command lines and where term keeps its files.
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// SocketPath is where the daemon listens.
+const SocketPath = "/tmp/term.sock"
+
+// Message types. Unless noted, payloads are JSON.
+const (
+	MsgData          byte = 0x00 // a pane's 4-byte id and output; from clients, typed input
+	MsgResize        byte = 0x01 // the client's terminal size less the status line, as a pty.Winsize
+	MsgNewWindow     byte = 0x02 // no payload
+	MsgNextWindow    byte = 0x03 // no payload
+	MsgPrevWindow    byte = 0x04 // no payload
+	MsgKillPane      byte = 0x05 // no payload
+	MsgSplitPane     byte = 0x06 // no payload
+	MsgNextPane      byte = 0x07 // no payload
+	MsgRedraw        byte = 0x08 // the status line, as text
+	MsgNewPane       byte = 0x0A // a pane added to the layout
+	MsgSwitchPane    byte = 0x0B // the id of the active pane
+	MsgLastWindow    byte = 0x0C // no payload
+	MsgLastPane      byte = 0x0D // no payload
+	MsgOptions       byte = 0x0E // every option value by name
+	MsgCommand       byte = 0x0F // command words from an attached client
+	MsgKeyBindings   byte = 0x10 // every key table
+	MsgCLICommand    byte = 0x11 // command words from the command line
+	MsgCLIResult     byte = 0x12 // output and error of a MsgCLICommand
+	MsgFocus         byte = 0x13 // whether the client's terminal has focus
+	MsgYank          byte = 0x14 // text copied in a client, as text
+	MsgKeyEncoding   byte = 0x15 // the key modes of a pane
+	MsgEnvironment   byte = 0x16 // the client's NAME=value environment
+	MsgAttachSession byte = 0x17 // the session to attach to, as text, sent first
+	MsgCLIPane       byte = 0x18 // the command line's TERM_MUX, as text, sent before MsgCLICommand
+	MsgFloats        byte = 0x19 // every float, bottom first
+	MsgChooser       byte = 0x1A // a list for the client to pick from
+	MsgSubscribe     byte = 0x1B // the events to stream back, sent first; all when empty
+	MsgEvent         byte = 0x1C // an event and its fields, to subscribers
+	MsgDetach        byte = 0x1D // no payload; the client is leaving and closes the connection
+	MsgSnapshot      byte = 0x1E // every session, window, pane and float, and the pane to show, on attach
+	MsgTitle         byte = 0x1F // the outer terminal's title under set-titles, as text
+	MsgMessage       byte = 0x20 // an error or notice for the client's message line
+	MsgAuth          byte = 0x21 // the daemon's token, as text, sent first on TCP connections
+)
+
+// Encode frames a payload with the 5-byte message header.
+func Encode(msgType byte, payload []byte) []byte {
+	header := make([]byte, 5)
+	header[0] = msgType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+// Read reads one framed message.
+func Read(r io.Reader) (byte, []byte, error) {
+	return ReadLimit(r, math.MaxUint32)
+}
+
+// ReadLimit reads one framed message, failing before it reads or makes
+// room for a payload longer than limit, for peers not yet trusted.
+func ReadLimit(r io.Reader, limit uint32) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > limit {
+		return 0, nil, fmt.Errorf("message of %d bytes, over %d", n, limit)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
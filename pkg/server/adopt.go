@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"term/pkg/protocol"
+)
+
+// cmdAdoptPane implements adopt-pane [-t target-session] pid, an
+// experimental command taking a process running on another terminal into a
+// new window, named after it, so it outlives that terminal. The window
+// runs reptyr, which attaches to the process with ptrace and moves its
+// standard input, output and error and controlling terminal to the pane's
+// PTY. That needs ptrace allowed: on Linux, kernel.yama.ptrace_scope 0,
+// or root. Processes sharing the terminal (a pipeline, the shell's other
+// jobs) stay behind.
+func cmdAdoptPane(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "t:")
+	if err != nil || len(args) != 1 {
+		return "", fmt.Errorf("usage: adopt-pane [-t target-session] pid")
+	}
+	pid, err := strconv.Atoi(args[0])
+	if err != nil || pid < 1 {
+		return "", fmt.Errorf("bad pid: %s", args[0])
+	}
+	if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+		return "", fmt.Errorf("no process %d", pid)
+	}
+	reptyr, err := exec.LookPath("reptyr")
+	if err != nil {
+		return "", fmt.Errorf("adopt-pane needs reptyr installed")
+	}
+	s, err := ctx.resolveSession(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	name := processName(pid)
+	if name == "" {
+		name = args[0]
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.newWindow([]string{reptyr, strconv.Itoa(pid)}, "", name)
+	return "", err
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// maxBuffers is how many automatic paste buffers are kept; older ones are
+// dropped. Buffers named by the user are kept until deleted.
+const maxBuffers = 50
+
+// pasteBuffer is a paste buffer. Yanked text goes into automatic buffers
+// named buffer0, buffer1 and so on; set-buffer and load-buffer can name
+// their own.
+type pasteBuffer struct {
+	name      string
+	text      string
+	automatic bool
+}
+
+// AddBuffer stores yanked text as the newest paste buffer.
+func (d *Daemon) AddBuffer(text string) {
+	if text == "" {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.addBuffer(&pasteBuffer{name: "buffer" + strconv.Itoa(d.nextBuffer), text: text, automatic: true})
+	d.nextBuffer++
+}
+
+// addBuffer puts b first, dropping the oldest automatic buffer when there
+// are too many. The caller must hold d.mutex.
+func (d *Daemon) addBuffer(b *pasteBuffer) {
+	d.buffers = append([]*pasteBuffer{b}, d.buffers...)
+	automatic := 0
+	for i, other := range d.buffers {
+		if other.automatic {
+			if automatic++; automatic > maxBuffers {
+				d.buffers = append(d.buffers[:i], d.buffers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// findBuffer returns the position of the buffer called name, or of the
+// newest buffer when name is empty, or -1. The caller must hold d.mutex.
+func (d *Daemon) findBuffer(name string) int {
+	for i, b := range d.buffers {
+		if name == "" || b.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Buffer returns the text of the buffer called name, or of the newest
+// buffer when name is empty.
+func (d *Daemon) Buffer(name string) (string, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if i := d.findBuffer(name); i >= 0 {
+		return d.buffers[i].text, true
+	}
+	return "", false
+}
+
+// SetBuffer replaces the text of the buffer called name, or creates it as
+// the newest buffer. An empty name makes a new automatic buffer.
+func (d *Daemon) SetBuffer(name, text string) {
+	if name == "" {
+		d.AddBuffer(text)
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if i := d.findBuffer(name); i >= 0 {
+		d.buffers[i].text = text
+		return
+	}
+	d.addBuffer(&pasteBuffer{name: name, text: text})
+}
+
+// AppendBuffer adds text to the end of the buffer called name, or of the
+// newest buffer when name is empty, creating it if needed.
+func (d *Daemon) AppendBuffer(name, text string) {
+	d.mutex.Lock()
+	if i := d.findBuffer(name); i >= 0 {
+		d.buffers[i].text += text
+		d.mutex.Unlock()
+		return
+	}
+	d.mutex.Unlock()
+	d.SetBuffer(name, text)
+}
+
+// RenameBuffer gives the buffer called name, or the newest, a new name.
+// Named that way it is no longer dropped automatically.
+func (d *Daemon) RenameBuffer(name, newName string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	i := d.findBuffer(name)
+	if i < 0 {
+		return bufferError(name)
+	}
+	if j := d.findBuffer(newName); j >= 0 && j != i {
+		d.buffers = append(d.buffers[:j], d.buffers[j+1:]...)
+		if j < i {
+			i--
+		}
+	}
+	d.buffers[i].name = newName
+	d.buffers[i].automatic = false
+	return nil
+}
+
+// DeleteBuffer removes the buffer called name, or the newest.
+func (d *Daemon) DeleteBuffer(name string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	i := d.findBuffer(name)
+	if i < 0 {
+		return bufferError(name)
+	}
+	d.buffers = append(d.buffers[:i], d.buffers[i+1:]...)
+	return nil
+}
+
+// ListBuffers describes every buffer, newest first, one per line.
+func (d *Daemon) ListBuffers() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var b strings.Builder
+	for _, buf := range d.buffers {
+		preview := []rune(buf.text)
+		if len(preview) > 50 {
+			preview = preview[:50]
+		}
+		fmt.Fprintf(&b, "%s: %d bytes: %q\n", buf.name, len(buf.text), string(preview))
+	}
+	return b.String()
+}
+
+func bufferError(name string) error {
+	if name == "" {
+		return fmt.Errorf("no buffers")
+	}
+	return fmt.Errorf("no buffer %s", name)
+}
+
+// bufferPath resolves a file name for save-buffer, load-buffer and
+// source-file. ~ is the home directory and relative paths start at the
+// current pane's working directory, which is the CLI's own when run from a
+// pane.
+func (ctx *CommandContext) bufferPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if t, err := ctx.resolveTarget(""); err == nil {
+		if cwd := t.pane.checkForeground().Cwd; cwd != "" {
+			return filepath.Join(cwd, path)
+		}
+	}
+	return path
+}
+
+// cmdPasteBuffer implements paste-buffer [-d] [-b name] [-t target-pane],
+// pasting the newest buffer, or the one named, and with -d deleting it.
+func cmdPasteBuffer(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "b:dt:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: paste-buffer [-d] [-b name] [-t target-pane]")
+	}
+	name := flags['b']
+	text, ok := ctx.daemon.Buffer(name)
+	if !ok {
+		return "", bufferError(name)
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	t.pane.Paste(text)
+	if _, ok := flags['d']; ok {
+		return "", ctx.daemon.DeleteBuffer(name)
+	}
+	return "", nil
+}
+
+// cmdSetBuffer implements set-buffer [-a] [-b name] [-n new-name] [text].
+// It sets a buffer's text, or with -a appends to it, and -n renames it.
+func cmdSetBuffer(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "ab:n:")
+	if err != nil {
+		return "", err
+	}
+	name, newName := flags['b'], flags['n']
+	if len(args) > 1 || (len(args) == 0 && newName == "") {
+		return "", fmt.Errorf("usage: set-buffer [-a] [-b name] [-n new-name] [text]")
+	}
+	if len(args) == 1 {
+		if _, ok := flags['a']; ok {
+			ctx.daemon.AppendBuffer(name, args[0])
+		} else {
+			ctx.daemon.SetBuffer(name, args[0])
+		}
+	}
+	if newName != "" {
+		return "", ctx.daemon.RenameBuffer(name, newName)
+	}
+	return "", nil
+}
+
+// cmdShowBuffer implements show-buffer [-b name].
+func cmdShowBuffer(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "b:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: show-buffer [-b name]")
+	}
+	name := flags['b']
+	text, ok := ctx.daemon.Buffer(name)
+	if !ok {
+		return "", bufferError(name)
+	}
+	return text, nil
+}
+
+// cmdListBuffers implements list-buffers.
+func cmdListBuffers(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: list-buffers")
+	}
+	return ctx.daemon.ListBuffers(), nil
+}
+
+// cmdDeleteBuffer implements delete-buffer [-b name].
+func cmdDeleteBuffer(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "b:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: delete-buffer [-b name]")
+	}
+	return "", ctx.daemon.DeleteBuffer(flags['b'])
+}
+
+// cmdSaveBuffer implements save-buffer [-a] [-b name] path, writing a
+// buffer to a file, or with -a appending to it.
+func cmdSaveBuffer(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "ab:")
+	if err != nil || len(args) != 1 {
+		return "", fmt.Errorf("usage: save-buffer [-a] [-b name] path")
+	}
+	text, ok := ctx.daemon.Buffer(flags['b'])
+	if !ok {
+		return "", bufferError(flags['b'])
+	}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if _, ok := flags['a']; ok {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(ctx.bufferPath(args[0]), mode, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	return "", f.Close()
+}
+
+// cmdLoadBuffer implements load-buffer [-b name] path, reading a file into
+// a buffer ready for paste-buffer.
+func cmdLoadBuffer(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "b:")
+	if err != nil || len(args) != 1 {
+		return "", fmt.Errorf("usage: load-buffer [-b name] path")
+	}
+	data, err := os.ReadFile(ctx.bufferPath(args[0]))
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 {
+		return "", fmt.Errorf("%s is empty", args[0])
+	}
+	ctx.daemon.SetBuffer(flags['b'], string(data))
+	return "", nil
+}
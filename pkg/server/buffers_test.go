@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"term/pkg/protocol"
+)
+
+func TestBufferCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "saved")
+	ctx := &CommandContext{daemon: &Daemon{}}
+	tests := []struct {
+		command string
+		want    string // the output, or in the error
+		err     bool
+	}{
+		{"show-buffer", "no buffers", true},
+		{"set-buffer hello", "", false},
+		{"show-buffer", "hello", false},
+		{"set-buffer -b notes first", "", false},
+		{"set-buffer -a -b notes ' second'", "", false},
+		{"show-buffer -b notes", "first second", false},
+		{"show-buffer", "first second", false},
+		{"set-buffer -b notes -n kept", "", false},
+		{"show-buffer -b notes", "no buffer notes", true},
+		{"list-buffers", "kept: 12 bytes: \"first second\"\nbuffer0: 5 bytes: \"hello\"\n", false},
+		{"set-buffer -b buffer0 -n kept", "", false},
+		{"list-buffers", "kept: 5 bytes: \"hello\"\n", false},
+		{"save-buffer -b kept " + file, "", false},
+		{"save-buffer -a " + file, "", false},
+		{"load-buffer -b loaded " + file, "", false},
+		{"show-buffer -b loaded", "hellohello", false},
+		{"delete-buffer -b kept", "", false},
+		{"delete-buffer -b kept", "no buffer kept", true},
+		{"list-buffers", "loaded: 10 bytes: \"hellohello\"\n", false},
+		{"set-buffer -b x", "usage: set-buffer", true},
+	}
+	for _, tt := range tests {
+		args, err := protocol.ParseCommandLine(tt.command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ctx.RunCommand(args)
+		switch {
+		case tt.err && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s = %q, %v, want an error with %q", tt.command, got, err, tt.want)
+		case !tt.err && (err != nil || got != tt.want):
+			t.Errorf("%s = %q, %v, want %q", tt.command, got, err, tt.want)
+		}
+	}
+}
+
+func TestAutomaticBuffers(t *testing.T) {
+	// Yanks past maxBuffers drop the oldest automatic buffer, never a
+	// named one
+	d := &Daemon{}
+	d.SetBuffer("named", "kept")
+	for i := range maxBuffers + 5 {
+		d.AddBuffer(fmt.Sprint(i))
+	}
+	if len(d.buffers) != maxBuffers+1 {
+		t.Errorf("%d buffers, want %d", len(d.buffers), maxBuffers+1)
+	}
+	if text, ok := d.Buffer("named"); !ok || text != "kept" {
+		t.Errorf("named buffer = %q, %v, want it kept", text, ok)
+	}
+	if text, _ := d.Buffer(""); text != fmt.Sprint(maxBuffers+4) {
+		t.Errorf("newest buffer = %q, want the last yank", text)
+	}
+	if _, ok := d.Buffer("buffer4"); ok {
+		t.Errorf("buffer4 was kept past maxBuffers")
+	}
+	if _, ok := d.Buffer("buffer5"); !ok {
+		t.Errorf("buffer5 was dropped too soon")
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// cmdChooseTree implements choose-tree, opening a chooser on every session,
+// window and pane, with each pane's command, directory and title to search
+// by. Picking one switches to it.
+func cmdChooseTree(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 || ctx.client == nil {
+		return "", fmt.Errorf("usage: choose-tree")
+	}
+	list := protocol.ChooserList{Title: "Choose a session, window or pane"}
+	_, current := ctx.session.Current()
+	for _, s := range ctx.daemon.Sessions() {
+		s.mutex.Lock()
+		list.Items = append(list.Items, protocol.ChooserItem{
+			Text:    fmt.Sprintf("%s: %d windows", s.Name(), len(s.windows)),
+			Command: "switch-client -t " + protocol.ShellQuote(s.Name()+":"),
+		})
+		for _, w := range s.windows {
+			target := fmt.Sprintf("%s:%d", s.Name(), w.index)
+			list.Items = append(list.Items, protocol.ChooserItem{
+				Text:    fmt.Sprintf("  %s %s", target, w.name),
+				Command: "switch-client -t " + protocol.ShellQuote(target),
+			})
+			for i, p := range w.panes {
+				vars := s.paneFormatVars(w, i)
+				text := expandFormat("    #{session_name}:#{window_index}.#{pane_index} #{pane_current_command} #{pane_current_path}", vars)
+				if title := vars["pane_title"]; title != "" {
+					text += " - " + title
+				}
+				if p.id == current {
+					list.Selected = len(list.Items)
+				}
+				list.Items = append(list.Items, protocol.ChooserItem{
+					Text:    text,
+					Command: fmt.Sprintf("switch-client -t %%%d", p.id),
+				})
+			}
+		}
+		s.mutex.Unlock()
+	}
+	payload, _ := json.Marshal(list)
+	ctx.client.conn.Write(protocol.Encode(protocol.MsgChooser, payload))
+	return "", nil
+}
+
+// cmdCommandPalette implements command-palette, opening a chooser on every
+// command and key binding with the keys that run it. A command line typed
+// with arguments, or matching nothing, is run as it is.
+func cmdCommandPalette(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 || ctx.client == nil {
+		return "", fmt.Errorf("usage: command-palette")
+	}
+	tables := ctx.daemon.bindings.Tables()
+	prefix := protocol.PrefixKeyName(tables)
+	keys := make(map[string][]string) // command line to the keys bound to it
+	for name, table := range tables {
+		if name == "copy-mode" {
+			continue // only reached from copy mode
+		}
+		for _, key := range table.SortedKeys() {
+			line := table[key].Command
+			keys[line] = append(keys[line], protocol.KeyLabel(name, key, prefix))
+		}
+	}
+	lines := make(map[string]bool)
+	for name := range commandTable {
+		if _, ok := protocol.CommandAliases[name]; !ok {
+			lines[name] = true
+		}
+	}
+	for name := range protocol.CommandSummaries {
+		lines[name] = true
+	}
+	for line := range keys {
+		lines[line] = true
+	}
+
+	list := protocol.ChooserList{Title: "Run a command", RunQuery: true}
+	for _, line := range slices.Sorted(maps.Keys(lines)) {
+		text := fmt.Sprintf("%-32s %-14s %s", line, strings.Join(keys[line], ", "), protocol.CommandSummary(line))
+		list.Items = append(list.Items, protocol.ChooserItem{Text: strings.TrimRight(text, " "), Command: line})
+	}
+	payload, _ := json.Marshal(list)
+	ctx.client.conn.Write(protocol.Encode(protocol.MsgChooser, payload))
+	return "", nil
+}
+
+// cmdCommandPrompt implements command-prompt [-p prompt] [-I initial],
+// asking for a command line, started with initial, to run.
+func cmdCommandPrompt(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "p:I:")
+	if err != nil || len(args) != 0 || ctx.client == nil {
+		return "", fmt.Errorf("usage: command-prompt [-p prompt] [-I initial]")
+	}
+	list := protocol.ChooserList{Title: flags['p'], Query: flags['I'], RunQuery: true}
+	if list.Title == "" {
+		list.Title = "Run a command"
+	}
+	payload, _ := json.Marshal(list)
+	ctx.client.conn.Write(protocol.Encode(protocol.MsgChooser, payload))
+	return "", nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// addClient registers an attached client, numbering it for list-clients.
+func (d *Daemon) addClient(sm *SessionManager) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.nextClient++
+	sm.id, sm.attached = d.nextClient, time.Now()
+	d.clients[sm.conn] = sm
+	sm.session.fire("client-attached", map[string]any{"client_id": sm.id, "session_name": sm.session.Name()})
+}
+
+func (d *Daemon) removeClient(sm *SessionManager) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.clients, sm.conn)
+	sm.session.fire("client-detached", map[string]any{"client_id": sm.id, "session_name": sm.session.Name()})
+}
+
+// Clients returns the attached clients in the order they attached.
+func (d *Daemon) Clients() []*SessionManager {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	clients := make([]*SessionManager, 0, len(d.clients))
+	for _, sm := range d.clients {
+		clients = append(clients, sm)
+	}
+	slices.SortFunc(clients, func(a, b *SessionManager) int { return a.id - b.id })
+	return clients
+}
+
+// ClientInfo describes a client for list-clients --format json.
+type ClientInfo struct {
+	ID       int       `json:"client_id"`
+	Session  string    `json:"session_name"`
+	Focused  bool      `json:"client_focused"`
+	Attached time.Time `json:"client_created"`
+}
+
+// cmdListClients implements list-clients [--format json], one line per
+// attached client with its session and whether its terminal has focus.
+func cmdListClients(ctx *CommandContext, args []string) (string, error) {
+	asJSON, args, err := formatFlag(args)
+	if err != nil {
+		return "", err
+	}
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: list-clients [--format json]")
+	}
+	// A client's session is the one holding its connection; sm.session
+	// belongs to the client's own goroutine
+	sessions := make(map[net.Conn]*Session)
+	focus := make(map[net.Conn]bool)
+	for _, s := range ctx.daemon.Sessions() {
+		s.clientMutex.Lock()
+		for conn, focused := range s.clients {
+			sessions[conn], focus[conn] = s, focused
+		}
+		s.clientMutex.Unlock()
+	}
+	clients := make([]ClientInfo, 0)
+	for _, sm := range ctx.daemon.Clients() {
+		if s := sessions[sm.conn]; s != nil {
+			clients = append(clients, ClientInfo{ID: sm.id, Session: s.Name(), Focused: focus[sm.conn], Attached: sm.attached})
+		}
+	}
+	if asJSON {
+		return jsonOutput(clients)
+	}
+
+	var b strings.Builder
+	for _, c := range clients {
+		fmt.Fprintf(&b, "%d: %s, attached %s", c.ID, c.Session, c.Attached.Format("15:04:05"))
+		if c.Focused {
+			b.WriteString(" (focused)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
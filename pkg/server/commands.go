@@ -0,0 +1,643 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// CommandContext is what a command runs against. client is nil when the
+// command comes from the config file.
+type CommandContext struct {
+	daemon  *Daemon
+	session *Session
+	client  *SessionManager
+	pane    *Pane    // the pane a CLI command was run from, if any
+	script  bool     // run by Lua code, which holds the Scripts lock
+	env     []string // added to run-shell's environment, such as a watch's match
+}
+
+type commandFunc func(ctx *CommandContext, args []string) (string, error)
+
+var commandTable map[string]commandFunc
+
+func init() {
+	commandTable = map[string]commandFunc{
+		"set-option":       cmdSetOption,
+		"bind-key":         cmdBindKey,
+		"unbind-key":       cmdUnbindKey,
+		"new-window":       cmdNewWindow,
+		"split-window":     cmdSplitWindow,
+		"next-window":      cmdNextWindow,
+		"previous-window":  cmdPreviousWindow,
+		"next-pane":        cmdNextPane,
+		"last-window":      cmdLastWindow,
+		"last-pane":        cmdLastPane,
+		"kill-pane":        cmdKillPane,
+		"respawn-window":   cmdRespawnWindow,
+		"select-pane":      cmdSelectPane,
+		"select-window":    cmdSelectWindow,
+		"send-keys":        cmdSendKeys,
+		"dump-screen":      cmdDumpScreen,
+		"display-message":  cmdDisplayMessage,
+		"show-help":        cmdShowHelp,
+		"list-keys":        cmdListKeys,
+		"list-panes":       cmdListPanes,
+		"list-sessions":    cmdListSessions,
+		"new-session":      cmdNewSession,
+		"has-session":      cmdHasSession,
+		"paste-buffer":     cmdPasteBuffer,
+		"set-buffer":       cmdSetBuffer,
+		"show-buffer":      cmdShowBuffer,
+		"list-buffers":     cmdListBuffers,
+		"delete-buffer":    cmdDeleteBuffer,
+		"save-buffer":      cmdSaveBuffer,
+		"load-buffer":      cmdLoadBuffer,
+		"run-shell":        cmdRunShell,
+		"set-environment":  cmdSetEnvironment,
+		"show-environment": cmdShowEnvironment,
+		"show-messages":    cmdShowMessages,
+		"new-float":        cmdNewFloat,
+		"toggle-float":     cmdToggleFloat,
+		"move-float":       cmdMoveFloat,
+		"resize-float":     cmdResizeFloat,
+		"kill-float":       cmdKillFloat,
+		"list-floats":      cmdListFloats,
+		"switch-client":    cmdSwitchClient,
+		"choose-tree":      cmdChooseTree,
+		"choose-container": cmdChooseContainer,
+		"adopt-pane":       cmdAdoptPane,
+		"share-pane":       cmdSharePane,
+		"unshare-pane":     cmdUnsharePane,
+		"choose-pod":       cmdChoosePod,
+		"choose-host":      cmdChooseHost,
+		"command-palette":  cmdCommandPalette,
+		"command-prompt":   cmdCommandPrompt,
+		"list-targets":     cmdListTargets,
+		"list-clients":     cmdListClients,
+		"info":             cmdInfo,
+		"run-lua":          cmdRunLua,
+		"list-plugins":     cmdListPlugins,
+		"reload-plugins":   cmdReloadPlugins,
+		"watch-pane":       cmdWatchPane,
+		"unwatch-pane":     cmdUnwatchPane,
+		"list-watches":     cmdListWatches,
+		"toggle-logging":   cmdToggleLogging,
+		"toggle-freeze":    cmdToggleFreeze,
+		"record-macro":     cmdRecordMacro,
+		"play-macro":       cmdPlayMacro,
+		"list-macros":      cmdListMacros,
+		"delete-macro":     cmdDeleteMacro,
+		"source-file":      cmdSourceFile,
+		"link-window":      cmdLinkWindow,
+		"unlink-window":    cmdUnlinkWindow,
+		"kill-window":      cmdKillWindow,
+		"move-window":      cmdMoveWindow,
+		"move-pane":        cmdMovePane,
+		"rename-session":   cmdRenameSession,
+		"set-directory":    cmdSetDirectory,
+	}
+	for alias, name := range protocol.CommandAliases {
+		commandTable[alias] = commandTable[name]
+	}
+}
+
+// RunCommand executes a single parsed command line.
+func (ctx *CommandContext) RunCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	fn, ok := commandTable[args[0]]
+	if !ok {
+		if output, found, err := ctx.daemon.scripts.Run(ctx, args[0], args[1:]); found {
+			return output, err
+		}
+		if output, found, err := ctx.daemon.plugins.Run(ctx, args[0], args[1:]); found {
+			return output, err
+		}
+		return "", fmt.Errorf("unknown command: %s", args[0])
+	}
+	return fn(ctx, args[1:])
+}
+
+// cmdSetOption implements set-option name [value], and with -w
+// set-option -w [-t target-window] name [value] for the options set per
+// window.
+func cmdSetOption(ctx *CommandContext, args []string) (string, error) {
+	if len(args) > 0 && args[0] == "-w" {
+		return setWindowOption(ctx, args[1:])
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return "", fmt.Errorf("usage: set-option [-w [-t target-window]] name [value]")
+	}
+	value := ""
+	if len(args) == 2 {
+		value = args[1]
+	}
+	if err := ctx.daemon.options.Set(args[0], value); err != nil {
+		return "", err
+	}
+	if ctx.session != nil {
+		ctx.daemon.broadcast(ctx.session.createOptionsMessage())
+	}
+	if value == "" && optionTable[args[0]].typ == optionFlag && ctx.client != nil {
+		// Toggled, likely from a key, so say which way
+		ctx.client.showMessage("%s %s", args[0], ctx.daemon.options.String(args[0]))
+	}
+	return "", nil
+}
+
+// setWindowOption sets one of windowOptions on a window; no value unsets
+// it.
+func setWindowOption(ctx *CommandContext, args []string) (string, error) {
+	spec, args, err := targetFlag(args)
+	if err != nil || len(args) < 1 || len(args) > 2 {
+		return "", fmt.Errorf("usage: set-option -w [-t target-window] name [value]")
+	}
+	value := ""
+	if len(args) == 2 {
+		value = args[1]
+	}
+	t, err := ctx.resolveTarget(spec)
+	if err != nil {
+		return "", err
+	}
+	switch args[0] {
+	case "monitor-content":
+		var pattern *regexp.Regexp
+		if value != "" {
+			if pattern, err = regexp.Compile(value); err != nil {
+				return "", fmt.Errorf("bad pattern: %w", err)
+			}
+		}
+		t.session.mutex.Lock()
+		t.window.monitorContent = pattern
+		t.session.mutex.Unlock()
+	default:
+		return "", fmt.Errorf("invalid window option: %s", args[0])
+	}
+	return "", nil
+}
+
+// cmdBindKey implements bind-key [-n] [-r] [-T table] key command [args...].
+func cmdBindKey(ctx *CommandContext, args []string) (string, error) {
+	table := "prefix"
+	repeat := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		switch args[0] {
+		case "-n":
+			table = "root"
+		case "-r":
+			repeat = true
+		case "-T":
+			if len(args) < 2 {
+				return "", fmt.Errorf("-T needs a table name")
+			}
+			table = args[1]
+			args = args[1:]
+		default:
+			return "", fmt.Errorf("unknown flag: %s", args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return "", fmt.Errorf("usage: bind-key [-n] [-r] [-T table] key command [args...]")
+	}
+	ctx.daemon.bindings.Bind(table, args[0], protocol.JoinCommandLine(args[1:]), repeat)
+	ctx.daemon.syncKeyBindings()
+	return "", nil
+}
+
+// cmdUnbindKey implements unbind-key [-n] [-T table] key.
+func cmdUnbindKey(ctx *CommandContext, args []string) (string, error) {
+	table := "prefix"
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		switch args[0] {
+		case "-n":
+			table = "root"
+		case "-T":
+			if len(args) < 2 {
+				return "", fmt.Errorf("-T needs a table name")
+			}
+			table = args[1]
+			args = args[1:]
+		default:
+			return "", fmt.Errorf("unknown flag: %s", args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: unbind-key [-n] [-T table] key")
+	}
+	if err := ctx.daemon.bindings.Unbind(table, args[0]); err != nil {
+		return "", err
+	}
+	ctx.daemon.syncKeyBindings()
+	return "", nil
+}
+
+// targetFlag removes a leading -t target from args, returning it or "" for
+// the current pane.
+func targetFlag(args []string) (string, []string, error) {
+	if len(args) > 0 && args[0] == "-t" {
+		if len(args) < 2 {
+			return "", nil, fmt.Errorf("-t needs a target")
+		}
+		return args[1], args[2:], nil
+	}
+	return "", args, nil
+}
+
+// formatFlag removes --format text|json from args, reporting whether JSON
+// was asked for.
+func formatFlag(args []string) (bool, []string, error) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg != "--format" {
+			continue
+		}
+		if i+1 == len(args) {
+			return false, nil, fmt.Errorf("--format needs text or json")
+		}
+		format := args[i+1]
+		if format != "text" && format != "json" {
+			return false, nil, fmt.Errorf("unknown format: %s", format)
+		}
+		return format == "json", slices.Concat(args[:i], args[i+2:]), nil
+	}
+	return false, args, nil
+}
+
+// jsonOutput renders v as the output of a command run with --format json.
+func jsonOutput(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// cmdNewWindow implements new-window [-c start-directory] [-n name]
+// [-t target-session] [--docker container | --pod namespace/pod |
+// --ssh host | --serial device [--baud rate] [--parity parity]], the
+// long flags naming the window after where its pane runs (see
+// remoteFlags) unless -n does.
+func cmdNewWindow(ctx *CommandContext, args []string) (string, error) {
+	command, title, args, err := remoteFlags(args)
+	if err != nil {
+		return "", err
+	}
+	flags, args, err := protocol.ParseFlags(args, "c:n:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: new-window [-c start-directory] [-n name] [-t target-session] [--docker container | --pod namespace/pod | --ssh host | --serial device [--baud rate] [--parity none|even|odd]]")
+	}
+	s, err := ctx.resolveSession(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	name := flags['n']
+	if name == "" {
+		name = title
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	w, err := s.newWindow(command, ctx.startDirectory(flags['c']), name)
+	if err == nil && title != "" {
+		w.ActivePane().SetTitle(title)
+	}
+	return "", err
+}
+
+// cmdSplitWindow implements split-window [-c start-directory]
+// [-t target-pane] [--docker container | --pod namespace/pod |
+// --ssh host | --serial device [--baud rate] [--parity parity]], the long
+// flags titling the pane after where it runs.
+func cmdSplitWindow(ctx *CommandContext, args []string) (string, error) {
+	command, title, args, err := remoteFlags(args)
+	if err != nil {
+		return "", err
+	}
+	flags, args, err := protocol.ParseFlags(args, "c:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: split-window [-c start-directory] [-t target-pane] [--docker container | --pod namespace/pod | --ssh host | --serial device [--baud rate] [--parity none|even|odd]]")
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	p, err := t.session.SplitWindow(t.window, command, ctx.startDirectory(flags['c']))
+	if err == nil && title != "" {
+		p.SetTitle(title)
+	}
+	return "", err
+}
+
+// remoteFlags removes the --docker, --pod, --ssh and --serial flags of
+// new-window and split-window from args, returning the command the pane
+// runs to reach the container (dockerCommand), pod (podCommand), host
+// (sshCommand) or serial device (serialCommand, with --baud and --parity)
+// and the name it goes by. With none of them the command is nil, for the
+// default.
+func remoteFlags(args []string) ([]string, string, []string, error) {
+	baud, args, err := protocol.LongFlag(args, "baud")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	parity, args, err := protocol.LongFlag(args, "parity")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var command []string
+	title, serial := "", false
+	for _, flag := range []string{"docker", "pod", "ssh", "serial"} {
+		value, rest, err := protocol.LongFlag(args, flag)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		args = rest
+		if value == "" {
+			continue
+		}
+		if command != nil {
+			return nil, "", nil, fmt.Errorf("only one of --docker, --pod, --ssh and --serial")
+		}
+		switch flag {
+		case "docker":
+			command = dockerCommand(value)
+		case "pod":
+			if command, err = podCommand(value); err != nil {
+				return nil, "", nil, err
+			}
+		case "ssh":
+			command = sshCommand(value)
+		case "serial":
+			if command, err = serialCommand(value, baud, parity); err != nil {
+				return nil, "", nil, err
+			}
+			serial = true
+		}
+		title = value
+		if serial {
+			title = filepath.Base(value)
+		}
+	}
+	if (baud != "" || parity != "") && !serial {
+		return nil, "", nil, fmt.Errorf("--baud and --parity go with --serial")
+	}
+	return command, title, args, nil
+}
+
+// startDirectory resolves a -c directory for a new pane as bufferPath does
+// file names; "" leaves the daemon's own.
+func (ctx *CommandContext) startDirectory(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return ctx.bufferPath(dir)
+}
+
+func cmdNextWindow(ctx *CommandContext, args []string) (string, error) {
+	ctx.session.NextWindow()
+	return "", nil
+}
+
+func cmdPreviousWindow(ctx *CommandContext, args []string) (string, error) {
+	ctx.session.PrevWindow()
+	return "", nil
+}
+
+func cmdNextPane(ctx *CommandContext, args []string) (string, error) {
+	ctx.session.NextPane()
+	return "", nil
+}
+
+// cmdLastWindow implements last-window, going back to the window the
+// client was in before, or without a client the one the session was.
+func cmdLastWindow(ctx *CommandContext, args []string) (string, error) {
+	if !ctx.selectLast(ctx.session, true) {
+		return "", fmt.Errorf("no last window")
+	}
+	return "", nil
+}
+
+// cmdLastPane implements last-pane, as last-window does for panes.
+func cmdLastPane(ctx *CommandContext, args []string) (string, error) {
+	if !ctx.selectLast(ctx.session, false) {
+		return "", fmt.Errorf("no last pane")
+	}
+	return "", nil
+}
+
+// selectLast selects s's last window, or pane: the client's when one runs
+// the command in its own session, else the session's, as the CLI and
+// scripts have no client.
+func (ctx *CommandContext) selectLast(s *Session, window bool) bool {
+	if ctx.client != nil && ctx.client.session == s {
+		if window {
+			return s.SelectWindowID(ctx.client.lastWindowID)
+		}
+		return s.SelectPaneID(ctx.client.lastPaneID)
+	}
+	s.mutex.Lock()
+	windowID, paneID := s.lastWindowID, s.lastPaneID
+	s.mutex.Unlock()
+	if window {
+		return s.SelectWindowID(windowID)
+	}
+	return s.SelectPaneID(paneID)
+}
+
+// cmdSelectWindow implements select-window [-l | -n | -p] [-t target-window],
+// making the window active in its session, or with -l, -n or -p the last,
+// next or previous window of the target's session. Attached clients switch
+// with it.
+func cmdSelectWindow(ctx *CommandContext, args []string) (string, error) {
+	move := ""
+	if len(args) > 0 && (args[0] == "-l" || args[0] == "-n" || args[0] == "-p") {
+		move, args = args[0], args[1:]
+	}
+	spec, args, err := targetFlag(args)
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: select-window [-l | -n | -p] [-t target-window]")
+	}
+	t, err := ctx.resolveTarget(spec)
+	if err != nil {
+		return "", err
+	}
+	switch move {
+	case "-l":
+		if !ctx.selectLast(t.session, true) {
+			return "", fmt.Errorf("no last window")
+		}
+	case "-n":
+		t.session.NextWindow()
+	case "-p":
+		t.session.PrevWindow()
+	default:
+		t.session.SelectWindowID(t.window.id)
+	}
+	return "", nil
+}
+
+// cmdKillPane implements kill-pane [-k | -s signal] [-t target-pane],
+// sending the pane's processes SIGTERM, SIGKILL with -k, or signal, and
+// closing it.
+func cmdKillPane(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "ks:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: kill-pane [-k | -s signal] [-t target-pane]")
+	}
+	sig := syscall.SIGTERM
+	if _, ok := flags['k']; ok {
+		sig = syscall.SIGKILL
+	} else if name, ok := flags['s']; ok {
+		if sig, err = parseSignal(name); err != nil {
+			return "", err
+		}
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	return "", t.session.KillPane(t.pane, sig)
+}
+
+// cmdRespawnWindow implements respawn-window [-t target-window], killing
+// the window's panes and starting their commands again in place.
+func cmdRespawnWindow(ctx *CommandContext, args []string) (string, error) {
+	spec, args, err := targetFlag(args)
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: respawn-window [-t target-window]")
+	}
+	t, err := ctx.resolveTarget(spec)
+	if err != nil {
+		return "", err
+	}
+	t.session.mutex.Lock()
+	defer t.session.mutex.Unlock()
+	if !slices.Contains(t.session.windows, t.window) {
+		return "", fmt.Errorf("window %d is gone", t.window.index)
+	}
+	return "", t.session.respawnWindow(t.window)
+}
+
+// cmdSelectPane implements select-pane [-l | -m | -M] [-t target-pane]. It
+// makes the pane and its window active, or with -l the last pane of the
+// target's session. -m marks the pane as the ~ target and -M clears the mark.
+func cmdSelectPane(ctx *CommandContext, args []string) (string, error) {
+	flag := ""
+	if len(args) > 0 && (args[0] == "-l" || args[0] == "-m" || args[0] == "-M") {
+		flag, args = args[0], args[1:]
+	}
+	spec, args, err := targetFlag(args)
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: select-pane [-l | -m | -M] [-t target-pane]")
+	}
+	switch flag {
+	case "-M":
+		ctx.daemon.SetMarkedPane(-1)
+		return "", nil
+	}
+	t, err := ctx.resolveTarget(spec)
+	if err != nil {
+		return "", err
+	}
+	if flag == "-m" {
+		ctx.daemon.SetMarkedPane(t.pane.id)
+	} else if flag == "-l" {
+		if !ctx.selectLast(t.session, false) {
+			return "", fmt.Errorf("no last pane")
+		}
+	} else {
+		t.session.SelectPaneID(t.pane.id)
+	}
+	return "", nil
+}
+
+// cmdSendKeys implements send-keys [-l] [-t target-pane] key.... Each key
+// is a name such as Enter, C-c or M-x, or else text typed as it is; with -l
+// every argument is text.
+func cmdSendKeys(ctx *CommandContext, args []string) (string, error) {
+	literal := false
+	if len(args) > 0 && args[0] == "-l" {
+		literal, args = true, args[1:]
+	}
+	spec, args, err := targetFlag(args)
+	if err != nil {
+		return "", err
+	}
+	t, err := ctx.resolveTarget(spec)
+	if err != nil {
+		return "", err
+	}
+	keys := t.pane.KeyEncoding()
+	mode := vt.KeyMode{ModifyOtherKeys: keys.ModifyOtherKeys, KeyboardFlags: keys.KeyboardFlags}
+	var data []byte
+	for _, arg := range args {
+		if ev := vt.KeyEvent(arg); ev != nil && !literal {
+			data = append(data, vt.KeyToBytes(ev, mode)...)
+		} else {
+			data = append(data, arg...)
+		}
+	}
+	_, err = t.pane.ptmx.Write(data)
+	return "", err
+}
+
+// cmdListKeys implements list-keys [-T table], printing each binding as the
+// bind-key command that would recreate it.
+func cmdListKeys(ctx *CommandContext, args []string) (string, error) {
+	only := ""
+	if len(args) == 2 && args[0] == "-T" {
+		only = args[1]
+	} else if len(args) != 0 {
+		return "", fmt.Errorf("usage: list-keys [-T table]")
+	}
+	return ctx.daemon.bindings.List(only), nil
+}
+
+// cmdRunShell implements run-shell [-b] command, running it with /bin/sh in
+// the daemon and returning its output. With -b it runs in the background
+// and the output is logged instead.
+func cmdRunShell(ctx *CommandContext, args []string) (string, error) {
+	background := false
+	if len(args) > 0 && args[0] == "-b" {
+		background = true
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: run-shell [-b] command")
+	}
+	cmd := exec.Command("/bin/sh", "-c", strings.Join(args, " "))
+	if ctx.env != nil {
+		cmd.Env = append(os.Environ(), ctx.env...)
+	}
+	if background {
+		go func() {
+			out, err := cmd.CombinedOutput()
+			output := strings.TrimRight(string(out), "\n")
+			switch {
+			case err != nil && output != "":
+				ctx.daemon.errorf("run-shell %q failed: %v: %s", cmd.Args[2], err, output)
+			case err != nil:
+				ctx.daemon.errorf("run-shell %q failed: %v", cmd.Args[2], err)
+			case output != "":
+				ctx.daemon.logf("run-shell %q: %s", cmd.Args[2], output)
+			}
+		}()
+		return "", nil
+	}
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// commandFlags lists the flags of each command getopt style, a colon after
+// those taking a value, for shell completion. -t values complete as
+// targets.
+var commandFlags = map[string]string{
+	"adopt-pane":       "t:",
+	"attach":           "c:t:",
+	"bench":            "s:x:y:",
+	"headless":         "t:x:y:",
+	"bind-key":         "nrT:",
+	"choose-host":      "s",
+	"choose-pod":       "n:",
+	"command-prompt":   "I:p:",
+	"delete-buffer":    "b:",
+	"delete-macro":     "n:",
+	"display-message":  "pt:",
+	"dump-screen":      "eHt:",
+	"export-recording": "o:",
+	"has-session":      "t:",
+	"kill-float":       "n:t:",
+	"kill-pane":        "ks:t:",
+	"kill-window":      "t:",
+	"link-window":      "s:t:",
+	"list-floats":      "t:",
+	"list-keys":        "T:",
+	"list-panes":       "at:",
+	"list-targets":     "s",
+	"load-buffer":      "b:",
+	"move-float":       "n:x:y:t:",
+	"move-pane":        "s:t:",
+	"move-window":      "s:t:",
+	"new-float":        "n:x:y:w:h:t:",
+	"new-session":      "c:dn:s:t:x:y:",
+	"new-window":       "c:n:t:",
+	"paste-buffer":     "db:t:",
+	"play-macro":       "n:N:t:",
+	"record-macro":     "n:",
+	"rename-session":   "t:",
+	"set-directory":    "wt:",
+	"respawn-window":   "t:",
+	"resize-float":     "n:w:h:t:",
+	"run-lua":          "f:",
+	"run-shell":        "b",
+	"save-buffer":      "ab:",
+	"select-pane":      "lmMt:",
+	"select-window":    "lnpt:",
+	"send-keys":        "lt:",
+	"serial":           "b:p:",
+	"set-buffer":       "ab:n:",
+	"set-environment":  "gru",
+	"share-pane":       "l:m:t:",
+	"show-buffer":      "b:",
+	"show-environment": "gs",
+	"source-file":      "q",
+	"split-window":     "c:t:",
+	"switch-client":    "t:",
+	"toggle-float":     "n:t:",
+	"toggle-freeze":    "t:",
+	"toggle-logging":   "t:",
+	"unbind-key":       "nT:",
+	"unlink-window":    "t:",
+	"unwatch-pane":     "t:",
+	"watch-pane":       "c:ot:",
+}
+
+// formatCommands take --format text|json.
+var formatCommands = map[string]bool{
+	"info":          true,
+	"list-clients":  true,
+	"list-panes":    true,
+	"list-sessions": true,
+}
+
+// completionCommands returns the words a CLI command line can start with,
+// sorted, and the names each one is known by.
+func completionCommands() ([]string, map[string][]string) {
+	names := map[string][]string{
+		"attach":           {"attach", "attach-session", "a"},
+		"bench":            {"bench"},
+		"headless":         {"headless"},
+		"export-recording": {"export-recording"},
+		"serial":           {"serial"},
+		"completion":       {"completion"},
+		"plugin":           {"plugin"},
+		"start":            {"start"},
+		"subscribe":        {"subscribe"},
+	}
+	for name := range commandTable {
+		if _, ok := protocol.CommandAliases[name]; !ok {
+			names[name] = append(names[name], name)
+		}
+	}
+	for alias, name := range protocol.CommandAliases {
+		names[name] = append(names[name], alias)
+	}
+	var words []string
+	for _, aliases := range names {
+		words = append(words, aliases...)
+	}
+	slices.Sort(words)
+	return words, names
+}
+
+// cliSummary describes a command, or a word only the CLI knows.
+func cliSummary(name string) string {
+	switch name {
+	case "attach":
+		return "Attach to a session"
+	case "bench":
+		return "Measure parsing and drawing throughput"
+	case "completion":
+		return "Print a shell completion script"
+	case "export-recording":
+		return "Render an asciicast recording as an animated GIF or SVG"
+	case "headless":
+		return "Run a client without a terminal, driven from stdin"
+	case "plugin":
+		return "Install, remove, enable, disable or list plugins"
+	case "serial":
+		return "Connect the terminal to a serial device"
+	case "subscribe":
+		return "Print events from the daemon as JSON lines"
+	}
+	return protocol.CommandSummaries[name]
+}
+
+// eventNames lists every event term subscribe takes, sorted.
+func eventNames() []string {
+	names := slices.Collect(maps.Keys(hookEvents))
+	names = append(names, slices.Collect(maps.Keys(streamEvents))...)
+	slices.Sort(names)
+	return names
+}
+
+// flagWords splits a commandFlags spec into the flags that take no value
+// and those that do, each written with its dash.
+func flagWords(spec string) (plain, valued []string) {
+	for i := 0; i < len(spec); i++ {
+		if spec[i] == ':' {
+			continue
+		}
+		if i+1 < len(spec) && spec[i+1] == ':' {
+			valued = append(valued, "-"+spec[i:i+1])
+		} else {
+			plain = append(plain, "-"+spec[i:i+1])
+		}
+	}
+	return plain, valued
+}
+
+// RunCompletion implements `term completion bash|zsh|fish`, printing a
+// script that completes commands, their flags, option names and, by asking
+// the daemon with list-targets, -t targets.
+func RunCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: term completion bash|zsh|fish")
+		return 1
+	}
+	prog := filepath.Base(os.Args[0])
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion(prog))
+	case "zsh":
+		fmt.Print(zshCompletion(prog))
+	case "fish":
+		fmt.Print(fishCompletion(prog))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown shell: %s\n", args[0])
+		return 1
+	}
+	return 0
+}
+
+func bashCompletion(prog string) string {
+	words, names := completionCommands()
+	fn := "_" + strings.ReplaceAll(prog, "-", "_")
+	var b strings.Builder
+	fmt.Fprintf(&b, "# bash completion for %s, load with: source <(%s completion bash)\n", prog, prog)
+	b.WriteString("COMP_WORDBREAKS=${COMP_WORDBREAKS//:} # targets contain colons\n")
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	b.WriteString("\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(words, " "))
+	b.WriteString("\t\treturn\n\tfi\n")
+	b.WriteString("\tcase $prev in\n")
+	b.WriteString("\t-t)\n\t\tlocal only=\n")
+	b.WriteString("\t\tcase ${COMP_WORDS[1]} in attach|attach-session|a) only=-s ;; esac\n")
+	fmt.Fprintf(&b, "\t\tCOMPREPLY=($(compgen -W \"$(%s list-targets $only 2>/dev/null)\" -- \"$cur\"))\n\t\treturn ;;\n", prog)
+	b.WriteString("\t--format) COMPREPLY=($(compgen -W \"text json\" -- \"$cur\")); return ;;\n")
+	b.WriteString("\tesac\n")
+	b.WriteString("\tcase ${COMP_WORDS[1]} in\n")
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		candidates := ""
+		if spec, ok := commandFlags[name]; ok {
+			plain, valued := flagWords(spec)
+			candidates = strings.Join(append(plain, valued...), " ")
+		}
+		if formatCommands[name] {
+			candidates = strings.TrimSpace(candidates + " --format")
+		}
+		switch name {
+		case "set-option":
+			candidates = strings.Join(optionNames(), " ")
+		case "completion":
+			candidates = "bash zsh fish"
+		case "plugin":
+			candidates = "install remove enable disable list"
+		case "subscribe":
+			candidates = strings.Join(eventNames(), " ")
+		}
+		if candidates == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", strings.Join(names[name], "|"), candidates)
+	}
+	b.WriteString("\tesac\n}\n")
+	fmt.Fprintf(&b, "complete -o default -F %s %s\n", fn, prog)
+	return b.String()
+}
+
+func zshCompletion(prog string) string {
+	_, names := completionCommands()
+	fn := "_" + strings.ReplaceAll(prog, "-", "_")
+	var b strings.Builder
+	fmt.Fprintf(&b, "#compdef %s\n# zsh completion for %s, load with: source <(%s completion zsh)\n", prog, prog, prog)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("\tlocal -a commands\n\tcommands=(\n")
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		for _, alias := range names[name] {
+			fmt.Fprintf(&b, "\t\t%s\n", protocol.ShellQuote(alias+":"+cliSummary(name)))
+		}
+	}
+	b.WriteString("\t)\n")
+	b.WriteString("\tif (( CURRENT == 2 )); then\n\t\t_describe command commands\n\t\treturn\n\tfi\n")
+	b.WriteString("\tif [[ ${words[CURRENT-1]} == -t ]]; then\n")
+	b.WriteString("\t\tlocal only=\n\t\tcase ${words[2]} in attach|attach-session|a) only=-s ;; esac\n")
+	fmt.Fprintf(&b, "\t\tlocal -a targets\n\t\ttargets=(${(f)\"$(%s list-targets $only 2>/dev/null)\"})\n", prog)
+	b.WriteString("\t\tcompadd -a targets\n\t\treturn\n\tfi\n")
+	b.WriteString("\tif [[ ${words[CURRENT-1]} == --format ]]; then\n\t\tcompadd text json\n\t\treturn\n\tfi\n")
+	b.WriteString("\tcase ${words[2]} in\n")
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		var candidates []string
+		if spec, ok := commandFlags[name]; ok {
+			plain, valued := flagWords(spec)
+			candidates = append(plain, valued...)
+		}
+		if formatCommands[name] {
+			candidates = append(candidates, "--format")
+		}
+		switch name {
+		case "set-option":
+			candidates = optionNames()
+		case "completion":
+			candidates = []string{"bash", "zsh", "fish"}
+		case "plugin":
+			candidates = []string{"install", "remove", "enable", "disable", "list"}
+		case "subscribe":
+			candidates = eventNames()
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s) compadd -- %s ;;\n", strings.Join(names[name], "|"), strings.Join(candidates, " "))
+	}
+	b.WriteString("\t*) _files ;;\n\tesac\n}\n")
+	fmt.Fprintf(&b, "compdef %s %s\n", fn, prog)
+	return b.String()
+}
+
+func fishCompletion(prog string) string {
+	_, names := completionCommands()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for %s, load with: %s completion fish | source\n", prog, prog)
+	fmt.Fprintf(&b, "complete -c %s -f\n", prog)
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		for _, alias := range names[name] {
+			fmt.Fprintf(&b, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", prog, alias, protocol.ShellQuote(cliSummary(name)))
+		}
+		seen := fmt.Sprintf("'__fish_seen_subcommand_from %s'", strings.Join(names[name], " "))
+		switch name {
+		case "set-option":
+			fmt.Fprintf(&b, "complete -c %s -n %s -a %s\n", prog, seen, protocol.ShellQuote(strings.Join(optionNames(), " ")))
+		case "completion":
+			fmt.Fprintf(&b, "complete -c %s -n %s -a 'bash zsh fish'\n", prog, seen)
+		case "plugin":
+			fmt.Fprintf(&b, "complete -c %s -n %s -a 'install remove enable disable list'\n", prog, seen)
+		case "subscribe":
+			fmt.Fprintf(&b, "complete -c %s -n %s -a %s\n", prog, seen, protocol.ShellQuote(strings.Join(eventNames(), " ")))
+		}
+		if formatCommands[name] {
+			fmt.Fprintf(&b, "complete -c %s -n %s -l format -x -a 'text json'\n", prog, seen)
+		}
+		plain, valued := flagWords(commandFlags[name])
+		for _, flag := range plain {
+			fmt.Fprintf(&b, "complete -c %s -n %s -s %s\n", prog, seen, flag[1:])
+		}
+		for _, flag := range valued {
+			if flag == "-t" {
+				only := ""
+				if name == "attach" {
+					only = " -s"
+				}
+				fmt.Fprintf(&b, "complete -c %s -n %s -s t -x -a '(%s list-targets%s 2>/dev/null)'\n", prog, seen, prog, only)
+			} else {
+				fmt.Fprintf(&b, "complete -c %s -n %s -s %s -r\n", prog, seen, flag[1:])
+			}
+		}
+	}
+	return b.String()
+}
+
+// cmdListTargets implements list-targets [-s], printing every session,
+// window and pane as a target, one per line, for shell completion. With -s
+// only sessions are listed.
+func cmdListTargets(ctx *CommandContext, args []string) (string, error) {
+	sessionsOnly := len(args) == 1 && args[0] == "-s"
+	if len(args) != 0 && !sessionsOnly {
+		return "", fmt.Errorf("usage: list-targets [-s]")
+	}
+	var b strings.Builder
+	for _, s := range ctx.daemon.Sessions() {
+		b.WriteString(s.Name() + "\n")
+		if sessionsOnly {
+			continue
+		}
+		s.mutex.Lock()
+		for _, w := range s.windows {
+			fmt.Fprintf(&b, "%s:%d\n", s.Name(), w.index)
+			if w.name != "" {
+				fmt.Fprintf(&b, "%s:%s\n", s.Name(), w.name)
+			}
+			for i, p := range w.panes {
+				fmt.Fprintf(&b, "%s:%d.%d\n%%%d\n", s.Name(), w.index, w.paneIndex(i, s.options), p.id)
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"term/pkg/protocol"
+)
+
+// configPath returns the location of the user's config file, or the one
+// given with --config.
+func (d *Daemon) configPath() string {
+	if d.config.File != "" {
+		return d.config.File
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".term.conf")
+}
+
+// workspaceCommands create sessions, windows and panes or type into them.
+// In the config file they build the workspace the daemon starts with, so
+// reloading it skips them rather than build it again.
+var workspaceCommands = map[string]bool{
+	"new-float":    true,
+	"new-session":  true,
+	"new-window":   true,
+	"send-keys":    true,
+	"split-window": true,
+}
+
+// LoadConfig runs each line of the config file as a command, as the daemon
+// starts or on reload, when workspace commands are skipped. A missing file
+// is not an error; a bad line is reported and skipped.
+func (d *Daemon) LoadConfig(path string, reload bool) error {
+	err := d.sourceFile(&CommandContext{daemon: d, session: d.mainSession}, path, reload)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// sourceFile runs each line of a file as a command in ctx, logging and
+// skipping bad lines, and with reload the workspaceCommands.
+func (d *Daemon) sourceFile(ctx *CommandContext, path string, reload bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		args, err := protocol.ParseCommandLine(scanner.Text())
+		if err == nil && reload && len(args) > 0 {
+			name := args[0]
+			if full, ok := protocol.CommandAliases[name]; ok {
+				name = full
+			}
+			if workspaceCommands[name] {
+				continue
+			}
+		}
+		if err == nil {
+			_, err = ctx.RunCommand(args)
+		}
+		if err != nil {
+			d.errorf("Config %s:%d: %v", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// syncConfig sends every client the options and key bindings after a file
+// was sourced. Styles are options, so they follow.
+func (d *Daemon) syncConfig() {
+	for _, s := range d.Sessions() {
+		s.Broadcast(s.createOptionsMessage())
+	}
+	d.syncKeyBindings()
+}
+
+// reloadOnHangup sources the config file again whenever the daemon gets
+// SIGHUP. The daemon runs in a session of its own, so no terminal sends it.
+func (d *Daemon) reloadOnHangup() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := d.LoadConfig(d.configPath(), true); err != nil {
+				d.errorf("Error loading config: %v", err)
+			}
+			d.syncConfig()
+			d.logf("Reloaded %s", d.configPath())
+		}
+	}()
+}
+
+// cmdSourceFile implements source-file [-q] path, running the commands in a
+// file as the config file's are run. -q says nothing if it does not exist.
+func cmdSourceFile(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "q")
+	if err != nil || len(args) != 1 {
+		return "", fmt.Errorf("usage: source-file [-q] path")
+	}
+	err = ctx.daemon.sourceFile(ctx, ctx.bufferPath(args[0]), false)
+	ctx.daemon.syncConfig()
+	if _, quiet := flags['q']; quiet && os.IsNotExist(err) {
+		return "", nil
+	}
+	return "", err
+}
@@ -0,0 +1,249 @@
+// Package server is the daemon: it owns the sessions, windows and panes
+// and their processes, runs commands from clients, the command line, the
+// config file, scripts and plugins, and serves clients over the socket.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"term/pkg/protocol"
+)
+
+// Config is how a daemon runs, from term's global flags.
+type Config struct {
+	Socket   string // a socket path, or @name for an abstract socket (Linux)
+	File     string // the config file read at startup, ~/.term.conf when empty
+	LogLevel string // one of LogLevels
+	Listen   string // a loopback host:port to take clients on too, see listen.go
+}
+
+// LogLevels are the Config.LogLevel values, most verbose first: debug adds
+// the daemon's tracing of clients, windows and panes to the messages it
+// logs.
+var LogLevels = []string{"debug", "info", "none"}
+
+// The running daemon's socket and log level, for a pane's TERM_MUX and the
+// logging done where no daemon is at hand.
+var (
+	socketPath = protocol.SocketPath
+	logLevel   = "info"
+)
+
+type Daemon struct {
+	config      Config
+	listener    net.Listener
+	tcpListener net.Listener // --listen, see listen.go
+	token       string       // what TCP clients authenticate with
+	mainSession *Session     // The session clients attach to by default
+	sessions    []*Session   // every session, mainSession first
+	options     *Options
+	bindings    *protocol.KeyBindings
+	buffers     []*pasteBuffer // paste buffers, newest first
+	nextBuffer  int            // number of the next automatic buffer
+	environ     *Environment   // set-environment -g, applied to every session's panes
+	markedPane  int            // pane id marked with select-pane -m, or -1
+	messages    *messageLog    // for show-messages
+	scripts     *Scripts
+	plugins     *Plugins
+	macros      *Macros                      // recorded with record-macro, see macros.go
+	subscribers *Subscribers                 // connections streamed events, see events.go
+	shares      map[int]*paneShare           // panes shared with share-pane by id, see share.go
+	clients     map[net.Conn]*SessionManager // attached clients, see clients.go
+	nextClient  int
+	started     time.Time
+	historyKey  string // names the panes' history files, see historyfile.go
+	mutex       sync.Mutex
+
+	// Every session's mutex, as windows can be linked into several
+	// sessions and move between them
+	sessionMutex sync.Mutex
+}
+
+// NewDaemon starts a daemon listening on config's socket, with its
+// main-session set up from the config file, scripts and plugins. It runs
+// in this process, which can only have the one.
+func NewDaemon(config Config) (*Daemon, error) {
+	if strings.HasPrefix(config.Socket, protocol.TCPPrefix) {
+		return nil, fmt.Errorf("can't listen on %s: use --listen", config.Socket)
+	}
+	listener, err := listenSocket(config.Socket)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on socket: %w", err)
+	}
+	socketPath, logLevel = config.Socket, config.LogLevel
+
+	d := &Daemon{
+		config:     config,
+		listener:   listener,
+		options:    NewOptions(),
+		bindings:   protocol.NewKeyBindings(),
+		environ:    NewEnvironment(),
+		markedPane: -1,
+		messages:   &messageLog{},
+		clients:    make(map[net.Conn]*SessionManager),
+		shares:     make(map[int]*paneShare),
+		started:    time.Now(),
+	}
+	d.historyKey = daemonHistoryKey(config.Socket, d.started)
+	if config.Listen != "" {
+		if d.token, err = daemonToken(); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("error making token: %w", err)
+		}
+		if d.tcpListener, err = listenTCP(config.Listen); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("error listening on %s: %w", config.Listen, err)
+		}
+	}
+	d.scripts = NewScripts(d)
+	d.plugins = NewPlugins(d)
+	d.subscribers = NewSubscribers()
+	d.macros = NewMacros()
+	if err := d.macros.Load(); err != nil {
+		d.errorf("Error loading macros: %v", err)
+	}
+	// Create the main session when the daemon starts
+	d.mainSession, _ = d.addSession("main-session", nil)
+
+	// Load the config before the first window so options like base-index apply
+	if err := d.LoadConfig(d.configPath(), false); err != nil {
+		d.errorf("Error loading config: %v", err)
+	}
+	ctx := &CommandContext{daemon: d, session: d.mainSession}
+	if output, err := d.scripts.LoadFile(ctx, scriptPath()); err != nil {
+		d.errorf("Error loading script: %v", err)
+	} else if output != "" {
+		d.logf("%s", strings.TrimSuffix(output, "\n"))
+	}
+	d.plugins.Sync()
+	if len(d.mainSession.windows) == 0 {
+		d.mainSession.NewWindow()
+	}
+	return d, nil
+}
+
+// Run serves clients on the socket, and on the --listen address if any,
+// until the socket is closed.
+func (d *Daemon) Run() {
+	if d.tcpListener != nil {
+		go d.serve(d.tcpListener, d.authenticate)
+	}
+	d.serve(d.listener, func(conn net.Conn) error {
+		if !allowedPeer(conn) {
+			return fmt.Errorf("from another user")
+		}
+		return nil
+	})
+}
+
+// serve accepts connections on listener, serving those admit lets in;
+// its error says where a refused one came from.
+func (d *Daemon) serve(listener net.Listener, admit func(net.Conn) error) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			defer recoverPanic(d.errorf, "client connection", nil)
+			if err := admit(conn); err != nil {
+				d.errorf("Refused a connection %v", err)
+				return
+			}
+			// Clients attach to the main session unless they name another
+			sm := NewSessionManager(conn, d)
+			sm.Run() // This will block until the client disconnects or detaches
+		}()
+	}
+}
+
+func (d *Daemon) createKeyBindingsMessage() []byte {
+	payload, _ := json.Marshal(d.bindings.Tables())
+	return protocol.Encode(protocol.MsgKeyBindings, payload)
+}
+
+// syncKeyBindings sends the current key tables to every attached client.
+func (d *Daemon) syncKeyBindings() {
+	d.broadcast(d.createKeyBindingsMessage())
+}
+
+func (d *Daemon) Close() {
+	d.listener.Close()
+	if d.tcpListener != nil {
+		d.tcpListener.Close()
+	}
+	d.plugins.Close()
+	for _, s := range d.Sessions() {
+		s.Close() // Close every session when the daemon exits
+	}
+}
+
+// DaemonInfo describes the daemon for info --format json.
+type DaemonInfo struct {
+	PID      int       `json:"pid"`
+	Socket   string    `json:"socket"`
+	Listen   string    `json:"listen,omitempty"`
+	Started  time.Time `json:"started"`
+	Sessions int       `json:"sessions"`
+	Windows  int       `json:"windows"`
+	Panes    int       `json:"panes"`
+	Clients  int       `json:"clients"`
+}
+
+// cmdInfo implements info [--format json], describing the daemon: its pid,
+// socket, when it started and how many sessions, windows, panes (floats
+// included) and clients it has.
+func cmdInfo(ctx *CommandContext, args []string) (string, error) {
+	asJSON, args, err := formatFlag(args)
+	if err != nil {
+		return "", err
+	}
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: info [--format json]")
+	}
+	d := ctx.daemon
+	info := DaemonInfo{PID: os.Getpid(), Socket: d.config.Socket, Listen: d.config.Listen, Started: d.started, Clients: len(d.Clients())}
+	for _, s := range d.Sessions() {
+		s.mutex.Lock()
+		info.Sessions++
+		info.Windows += len(s.windows)
+		for _, w := range s.windows {
+			info.Panes += len(w.panes)
+		}
+		info.Panes += len(s.floats)
+		s.mutex.Unlock()
+	}
+	if asJSON {
+		return jsonOutput(info)
+	}
+	up := time.Since(info.Started).Round(time.Second)
+	if info.Listen != "" {
+		info.Socket += " and " + info.Listen
+	}
+	return fmt.Sprintf("pid %d on %s, started %s (up %s)\n%d sessions, %d windows, %d panes, %d clients\n",
+		info.PID, info.Socket, info.Started.Format("2006-01-02 15:04:05"), up,
+		info.Sessions, info.Windows, info.Panes, info.Clients), nil
+}
+
+// Run runs a daemon with config until its socket is closed, and
+// returns the exit status.
+func Run(config Config) int {
+	d, err := NewDaemon(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+	defer d.Close()
+
+	d.reloadOnHangup()
+	d.Run()
+	return 0
+}
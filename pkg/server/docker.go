@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// dockerCommand is what a pane opened into a container runs. The "--"
+// keeps a container name starting with "-" from being read as an option.
+func dockerCommand(container string) []string {
+	return []string{"docker", "exec", "-it", "--", container, "sh"}
+}
+
+// cmdChooseContainer implements choose-container, opening a chooser on the
+// running Docker containers with their images and status. Picking one
+// opens a pane in it with split-window --docker.
+func cmdChooseContainer(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 || ctx.client == nil {
+		return "", fmt.Errorf("usage: choose-container")
+	}
+	out, err := exec.Command("docker", "ps", "--format", "{{.Names}}\t{{.Image}}\t{{.Status}}").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("docker ps: %w", err)
+	}
+	list := protocol.ChooserList{Title: "Open a pane in a container"}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, rest, _ := strings.Cut(line, "\t")
+		if name == "" {
+			continue
+		}
+		list.Items = append(list.Items, protocol.ChooserItem{
+			Text:    name + "  " + strings.ReplaceAll(rest, "\t", "  "),
+			Command: "split-window --docker " + protocol.ShellQuote(name),
+		})
+	}
+	if len(list.Items) == 0 {
+		return "", fmt.Errorf("no running containers")
+	}
+	payload, _ := json.Marshal(list)
+	ctx.client.conn.Write(protocol.Encode(protocol.MsgChooser, payload))
+	return "", nil
+}
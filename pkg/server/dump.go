@@ -0,0 +1,38 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"term/pkg/protocol"
+)
+
+// cmdDumpScreen implements dump-screen [-e] [-H] [-t target-pane], printing
+// the text on a pane's screen, one line a row with trailing blanks removed.
+// -e adds its colours and attributes as SGR escape sequences; -H prints a
+// SHA-256 hash of the screen with them instead, which stays the same for
+// as long as the screen does. The screen is the daemon's own copy, which
+// has seen all of the pane's output, however much the replay keeps.
+func cmdDumpScreen(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "eHt:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: dump-screen [-e] [-H] [-t target-pane]")
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	_, escapes := flags['e']
+	if _, ok := flags['H']; ok {
+		sum := sha256.Sum256([]byte(t.pane.dumpScreen(true)))
+		return fmt.Sprintf("%x\n", sum), nil
+	}
+	return t.pane.dumpScreen(escapes), nil
+}
+
+// dumpScreen returns the pane's screen, see cmdDumpScreen.
+func (p *Pane) dumpScreen(escapes bool) string {
+	p.replayMutex.Lock()
+	defer p.replayMutex.Unlock()
+	return p.screen.Dump(escapes)
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"term/pkg/protocol"
+)
+
+// defaultUpdateEnvironment lists the variables copied from a client's
+// environment each time it attaches, so agent and display forwarding keep
+// working in new panes after reattaching from another machine.
+const defaultUpdateEnvironment = "DISPLAY KRB5CCNAME SSH_AGENT_PID SSH_ASKPASS SSH_AUTH_SOCK SSH_CONNECTION WAYLAND_DISPLAY WINDOWID XAUTHORITY"
+
+// Environment holds what one scope changes in the environment new panes
+// inherit: variables it sets and variables it removes. The daemon has a
+// global one and each session its own, applied on top.
+type Environment struct {
+	vars    map[string]string
+	removed map[string]bool
+	mutex   sync.Mutex
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{vars: make(map[string]string), removed: make(map[string]bool)}
+}
+
+func (e *Environment) Set(name, value string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.removed, name)
+	e.vars[name] = value
+}
+
+// Remove marks name to be left out of new panes' environment.
+func (e *Environment) Remove(name string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.vars, name)
+	e.removed[name] = true
+}
+
+// Unset forgets any change to name, so it is inherited again.
+func (e *Environment) Unset(name string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.vars, name)
+	delete(e.removed, name)
+}
+
+// names returns every variable the environment sets or removes, sorted. The
+// caller must hold e.mutex.
+func (e *Environment) names() []string {
+	names := make([]string, 0, len(e.vars)+len(e.removed))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	for name := range e.removed {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Apply returns base, a list of NAME=value entries, with the environment's
+// changes made to it.
+func (e *Environment) Apply(base []string) []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	env := make([]string, 0, len(base)+len(e.vars))
+	for _, kv := range base {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := e.vars[name]; ok || e.removed[name] {
+			continue
+		}
+		env = append(env, kv)
+	}
+	for _, name := range e.names() {
+		if value, ok := e.vars[name]; ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// List prints the changes as NAME=value, or -NAME for removed variables,
+// limited to name when it is not empty. With shell set it prints commands
+// instead, so a shell started before a reattach can pick up the new values
+// with eval "$(term show-environment -s)".
+func (e *Environment) List(name string, shell bool) string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var b strings.Builder
+	for _, n := range e.names() {
+		if name != "" && n != name {
+			continue
+		}
+		value, ok := e.vars[n]
+		switch {
+		case shell && ok:
+			fmt.Fprintf(&b, "%s=%s; export %s;\n", n, protocol.ShellQuote(value), n)
+		case shell:
+			fmt.Fprintf(&b, "unset %s;\n", n)
+		case ok:
+			fmt.Fprintf(&b, "%s=%s\n", n, value)
+		default:
+			fmt.Fprintf(&b, "-%s\n", n)
+		}
+	}
+	return b.String()
+}
+
+// paneEnvironment is the environment a new pane's shell starts with: the
+// daemon's own, changed by the global environment and then the session's.
+func (s *Session) paneEnvironment() []string {
+	return s.environ.Apply(s.globalEnv.Apply(os.Environ()))
+}
+
+// UpdateEnvironment copies the variables named by update-environment from
+// an attaching client's environment. Variables the client does not have are
+// removed, so a stale SSH_AUTH_SOCK is not handed to new panes.
+func (s *Session) UpdateEnvironment(clientEnv []string) {
+	values := make(map[string]string, len(clientEnv))
+	for _, kv := range clientEnv {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			values[name] = value
+		}
+	}
+	for _, name := range strings.Fields(s.options.String("update-environment")) {
+		if value, ok := values[name]; ok {
+			s.environ.Set(name, value)
+		} else {
+			s.environ.Remove(name)
+		}
+	}
+}
+
+// environmentScope returns the global environment with -g, otherwise the
+// session's.
+func (ctx *CommandContext) environmentScope(global bool) *Environment {
+	if global {
+		return ctx.daemon.environ
+	}
+	return ctx.session.environ
+}
+
+// cmdSetEnvironment implements set-environment [-g] [-r | -u] name [value].
+// Changes apply to panes created afterwards. -r removes the variable from
+// new panes' environment and -u drops this scope's change to it.
+func cmdSetEnvironment(ctx *CommandContext, args []string) (string, error) {
+	global, remove, unset := false, false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		switch args[0] {
+		case "-g":
+			global = true
+		case "-r":
+			remove = true
+		case "-u":
+			unset = true
+		default:
+			return "", fmt.Errorf("unknown flag: %s", args[0])
+		}
+		args = args[1:]
+	}
+	env := ctx.environmentScope(global)
+	switch {
+	case (remove || unset) && len(args) == 1 && !(remove && unset):
+		if remove {
+			env.Remove(args[0])
+		} else {
+			env.Unset(args[0])
+		}
+	case !remove && !unset && len(args) == 2:
+		if args[0] == "" || strings.Contains(args[0], "=") {
+			return "", fmt.Errorf("bad variable name: %s", args[0])
+		}
+		env.Set(args[0], args[1])
+	default:
+		return "", fmt.Errorf("usage: set-environment [-g] [-r | -u] name [value]")
+	}
+	return "", nil
+}
+
+// cmdShowEnvironment implements show-environment [-g] [-s] [name].
+func cmdShowEnvironment(ctx *CommandContext, args []string) (string, error) {
+	global, shell := false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		switch args[0] {
+		case "-g":
+			global = true
+		case "-s":
+			shell = true
+		default:
+			return "", fmt.Errorf("unknown flag: %s", args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return "", fmt.Errorf("usage: show-environment [-g] [-s] [name]")
+	}
+	name := ""
+	if len(args) == 1 {
+		name = args[0]
+	}
+	return ctx.environmentScope(global).List(name, shell), nil
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+
+	"term/pkg/protocol"
+)
+
+// streamEvents are the events only subscribers get: too frequent for
+// scripts and plugins, which see hookEvents.
+var streamEvents = map[string]bool{
+	"pane-output": true, // session_name, pane_id, data
+}
+
+// eventQueue is how many events a subscriber may fall behind by before it
+// is disconnected.
+const eventQueue = 1024
+
+// eventMessage is the payload of protocol.MsgEvent.
+type eventMessage struct {
+	Event  string         `json:"event"`
+	Fields map[string]any `json:"fields"`
+}
+
+type subscriber struct {
+	events map[string]bool // nil for every event
+	queue  chan []byte
+	conn   net.Conn
+}
+
+// Subscribers are the connections that sent protocol.MsgSubscribe, each
+// streamed the events it asked for as protocol.MsgEvent messages.
+type Subscribers struct {
+	list  map[*subscriber]bool
+	mutex sync.Mutex
+}
+
+func NewSubscribers() *Subscribers {
+	return &Subscribers{list: make(map[*subscriber]bool)}
+}
+
+// Serve streams events to conn until it closes. payload is the JSON list
+// of events wanted, every one when empty.
+func (ss *Subscribers) Serve(conn net.Conn, payload []byte) {
+	sub := &subscriber{queue: make(chan []byte, eventQueue), conn: conn}
+	var events []string
+	json.Unmarshal(payload, &events)
+	for _, event := range events {
+		if !hookEvents[event] && !streamEvents[event] {
+			reply, _ := json.Marshal(map[string]string{"error": "unknown event: " + event})
+			conn.Write(protocol.Encode(protocol.MsgCLIResult, reply))
+			return
+		}
+		if sub.events == nil {
+			sub.events = make(map[string]bool)
+		}
+		sub.events[event] = true
+	}
+	ss.mutex.Lock()
+	ss.list[sub] = true
+	ss.mutex.Unlock()
+	defer func() {
+		ss.mutex.Lock()
+		delete(ss.list, sub)
+		ss.mutex.Unlock()
+	}()
+
+	// Nothing more is read, so a read ending means the subscriber left
+	go func() {
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}()
+	for msg := range sub.queue {
+		if _, err := conn.Write(msg); err != nil {
+			return
+		}
+	}
+}
+
+// Wants reports whether any subscriber wants event, so the fields of
+// frequent events are only built when needed.
+func (ss *Subscribers) Wants(event string) bool {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	for sub := range ss.list {
+		if sub.events == nil || sub.events[event] {
+			return true
+		}
+	}
+	return false
+}
+
+// Send queues event for the subscribers that want it. One too far behind
+// is disconnected rather than holding up the daemon.
+func (ss *Subscribers) Send(event string, fields map[string]any) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	var msg []byte
+	for sub := range ss.list {
+		if sub.events != nil && !sub.events[event] {
+			continue
+		}
+		if msg == nil {
+			payload, _ := json.Marshal(eventMessage{Event: event, Fields: fields})
+			msg = protocol.Encode(protocol.MsgEvent, payload)
+		}
+		select {
+		case sub.queue <- msg:
+		default:
+			delete(ss.list, sub)
+			close(sub.queue)
+			sub.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/creack/pty"
+
+	"term/pkg/protocol"
+)
+
+// Float is a pane drawn in a box above the window layout, like a scratch
+// terminal. It belongs to the session rather than a window, keeps running
+// while hidden and closes when its command exits.
+type Float struct {
+	name          string
+	pane          *Pane
+	x, y          int // top left corner of the border, below the status line
+	width, height int // including the border
+	visible       bool
+}
+
+// innerSize is the size of the float's pane, inside the border.
+func (f *Float) innerSize() *pty.Winsize {
+	return &pty.Winsize{Rows: uint16(f.height - 2), Cols: uint16(f.width - 2)}
+}
+
+// paneArea returns the size of the area below the status line. The caller
+// must hold s.mutex.
+func (s *Session) paneArea() (cols, rows int) {
+	if s.size == nil {
+		return defaultSessionWidth, defaultSessionHeight - 1
+	}
+	return int(s.size.Cols), int(s.size.Rows)
+}
+
+// findFloat returns the position of the float called name, or of the top
+// one when name is empty, or -1. The caller must hold s.mutex.
+func (s *Session) findFloat(name string) int {
+	for i := len(s.floats) - 1; i >= 0; i-- {
+		if name == "" || s.floats[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// topFloat returns the visible float drawn above the others, or nil. The
+// caller must hold s.mutex.
+func (s *Session) topFloat() *Float {
+	for i := len(s.floats) - 1; i >= 0; i-- {
+		if s.floats[i].visible {
+			return s.floats[i]
+		}
+	}
+	return nil
+}
+
+// inputPane returns the pane that gets keyboard input: the top visible
+// float, or else the active pane. The caller must hold s.mutex.
+func (s *Session) inputPane() *Pane {
+	if f := s.topFloat(); f != nil {
+		return f.pane
+	}
+	return s.ActivePane()
+}
+
+// newFloat starts a float running command, or the default shell, and shows
+// it on top. The caller must hold s.mutex.
+func (s *Session) newFloat(f *Float, command []string) error {
+	if s.findFloat(f.name) >= 0 {
+		return fmt.Errorf("duplicate float: %s", f.name)
+	}
+	p, err := s.newPane(command, "", f.innerSize())
+	if err != nil {
+		return err
+	}
+	f.pane = p
+	f.visible = true
+	s.floats = append(s.floats, f)
+	debugf("Session %s: New float %s with pane %d\n", s.Name(), f.name, p.id)
+	s.floatsChanged()
+	return nil
+}
+
+// raiseFloat shows the float at position i above the others. The caller
+// must hold s.mutex.
+func (s *Session) raiseFloat(i int) {
+	f := s.floats[i]
+	s.floats = append(slices.Delete(s.floats, i, i+1), f)
+	f.visible = true
+}
+
+// removeFloat closes the float at position i. The caller must hold s.mutex.
+func (s *Session) removeFloat(i int) {
+	s.floats[i].pane.Close()
+	s.floats = slices.Delete(s.floats, i, i+1)
+	s.floatsChanged()
+}
+
+// paneExited closes the float whose command has ended. Window panes stay
+// until they are killed.
+func (s *Session) paneExited(p *Pane) {
+	s.fire("pane-exited", map[string]any{"session_name": s.Name(), "pane_id": p.id})
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, f := range s.floats {
+		if f.pane == p {
+			s.removeFloat(i)
+			return
+		}
+	}
+}
+
+// floatsChanged tells clients about the floats and moves focus to the pane
+// that now gets input. The caller must hold s.mutex.
+func (s *Session) floatsChanged() {
+	s.Broadcast(s.createFloatsMessage())
+	s.updateFocus()
+}
+
+// createFloatsMessage lists every float, bottom first. The caller must hold
+// s.mutex.
+func (s *Session) createFloatsMessage() []byte {
+	payload, _ := json.Marshal(s.floatInfos())
+	return protocol.Encode(protocol.MsgFloats, payload)
+}
+
+// floatInfos describes every float, bottom first. The caller must hold
+// s.mutex.
+func (s *Session) floatInfos() []protocol.FloatInfo {
+	floats := make([]protocol.FloatInfo, 0, len(s.floats))
+	for _, f := range s.floats {
+		floats = append(floats, protocol.FloatInfo{
+			PaneID:  f.pane.id,
+			Name:    f.name,
+			X:       f.x,
+			Y:       f.y,
+			Width:   f.width,
+			Height:  f.height,
+			Visible: f.visible,
+		})
+	}
+	return floats
+}
+
+// floatValue parses a float position or size: a number of cells, a
+// percentage of total, or +n or -n relative to current.
+func floatValue(spec string, current, total int) (int, error) {
+	if spec != "" && (spec[0] == '+' || spec[0] == '-') {
+		n, err := strconv.Atoi(spec[1:])
+		if err != nil {
+			return 0, fmt.Errorf("bad offset: %s", spec)
+		}
+		if spec[0] == '-' {
+			n = -n
+		}
+		return current + n, nil
+	}
+	if percent, ok := strings.CutSuffix(spec, "%"); ok {
+		n, err := strconv.Atoi(percent)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad percentage: %s", spec)
+		}
+		return total * n / 100, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad number: %s", spec)
+	}
+	return n, nil
+}
+
+// placeFloat applies the -x, -y, -w and -h flags to f and keeps it within
+// the pane area. The caller must hold s.mutex.
+func (s *Session) placeFloat(f *Float, flags map[byte]string) error {
+	cols, rows := s.paneArea()
+	for _, v := range []struct {
+		flag  byte
+		value *int
+		total int
+	}{
+		{'w', &f.width, cols},
+		{'h', &f.height, rows},
+		{'x', &f.x, cols},
+		{'y', &f.y, rows},
+	} {
+		spec, ok := flags[v.flag]
+		if !ok {
+			continue
+		}
+		n, err := floatValue(spec, *v.value, v.total)
+		if err != nil {
+			return err
+		}
+		*v.value = n
+	}
+	f.width = max(3, min(f.width, cols))
+	f.height = max(3, min(f.height, rows))
+	f.x = max(0, min(f.x, cols-f.width))
+	f.y = max(0, min(f.y, rows-f.height))
+	return nil
+}
+
+// floatFlags parses the flags of a float command and finds its session.
+func (ctx *CommandContext) floatFlags(args []string, spec string) (*Session, map[byte]string, []string, error) {
+	flags, args, err := protocol.ParseFlags(args, spec)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	s, err := ctx.resolveSession(flags['t'])
+	return s, flags, args, err
+}
+
+// floatError reports that no float is called name.
+func floatError(name string) error {
+	if name == "" {
+		return fmt.Errorf("no floats")
+	}
+	return fmt.Errorf("no float %s", name)
+}
+
+// cmdNewFloat implements new-float [-n name] [-x col] [-y row] [-w width]
+// [-h height] [-t target-session] [--] [command...]. The float starts
+// centered, four fifths of the pane area in size, unless placed otherwise.
+func cmdNewFloat(ctx *CommandContext, args []string) (string, error) {
+	s, flags, args, err := ctx.floatFlags(args, "n:x:y:w:h:t:")
+	if err != nil {
+		return "", err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name := flags['n']
+	if name == "" {
+		for i := 0; name == "" || s.findFloat(name) >= 0; i++ {
+			name = "float" + strconv.Itoa(i)
+		}
+	}
+	// Size first, so the float can be centered before it is moved
+	size := make(map[byte]string)
+	for _, c := range []byte("wh") {
+		if v, ok := flags[c]; ok {
+			size[c] = v
+			delete(flags, c)
+		}
+	}
+	f, err := s.centeredFloat(name, size)
+	if err != nil {
+		return "", err
+	}
+	if err := s.placeFloat(f, flags); err != nil {
+		return "", err
+	}
+	return "", s.newFloat(f, args)
+}
+
+// centeredFloat returns a float in the middle of the pane area, four fifths
+// of its size unless size has -w or -h. The caller must hold s.mutex.
+func (s *Session) centeredFloat(name string, size map[byte]string) (*Float, error) {
+	cols, rows := s.paneArea()
+	f := &Float{name: name, width: cols * 4 / 5, height: rows * 4 / 5}
+	if err := s.placeFloat(f, size); err != nil {
+		return nil, err
+	}
+	f.x, f.y = (cols-f.width)/2, (rows-f.height)/2
+	return f, nil
+}
+
+// cmdToggleFloat implements toggle-float [-n name] [-t target-session]. A
+// float that is hidden or covered is shown on top; the top one is hidden. A
+// float named but not yet there is started with the default shell, which
+// is how the scratchpad binding gets its float.
+func cmdToggleFloat(ctx *CommandContext, args []string) (string, error) {
+	s, flags, args, err := ctx.floatFlags(args, "n:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: toggle-float [-n name] [-t target-session]")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := s.findFloat(flags['n'])
+	if i < 0 && flags['n'] != "" {
+		f, err := s.centeredFloat(flags['n'], nil)
+		if err != nil {
+			return "", err
+		}
+		return "", s.newFloat(f, nil)
+	}
+	if i < 0 {
+		return "", floatError(flags['n'])
+	}
+	if f := s.floats[i]; f == s.topFloat() {
+		f.visible = false
+	} else {
+		s.raiseFloat(i)
+	}
+	s.floatsChanged()
+	return "", nil
+}
+
+// cmdMoveFloat implements move-float [-n name] [-x col] [-y row]
+// [-t target-session]. Positions may be relative, like -x +5.
+func cmdMoveFloat(ctx *CommandContext, args []string) (string, error) {
+	s, flags, args, err := ctx.floatFlags(args, "n:x:y:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: move-float [-n name] [-x col] [-y row] [-t target-session]")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := s.findFloat(flags['n'])
+	if i < 0 {
+		return "", floatError(flags['n'])
+	}
+	if err := s.placeFloat(s.floats[i], flags); err != nil {
+		return "", err
+	}
+	s.floatsChanged()
+	return "", nil
+}
+
+// cmdResizeFloat implements resize-float [-n name] [-w width] [-h height]
+// [-t target-session]. Sizes may be relative, like -w -10.
+func cmdResizeFloat(ctx *CommandContext, args []string) (string, error) {
+	s, flags, args, err := ctx.floatFlags(args, "n:w:h:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: resize-float [-n name] [-w width] [-h height] [-t target-session]")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := s.findFloat(flags['n'])
+	if i < 0 {
+		return "", floatError(flags['n'])
+	}
+	f := s.floats[i]
+	if err := s.placeFloat(f, flags); err != nil {
+		return "", err
+	}
+	f.pane.Resize(f.innerSize())
+	s.floatsChanged()
+	return "", nil
+}
+
+// cmdKillFloat implements kill-float [-n name] [-t target-session].
+func cmdKillFloat(ctx *CommandContext, args []string) (string, error) {
+	s, flags, args, err := ctx.floatFlags(args, "n:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: kill-float [-n name] [-t target-session]")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := s.findFloat(flags['n'])
+	if i < 0 {
+		return "", floatError(flags['n'])
+	}
+	s.removeFloat(i)
+	return "", nil
+}
+
+// cmdListFloats implements list-floats [-t target-session], top first.
+func cmdListFloats(ctx *CommandContext, args []string) (string, error) {
+	s, _, args, err := ctx.floatFlags(args, "t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: list-floats [-t target-session]")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var b strings.Builder
+	for i := len(s.floats) - 1; i >= 0; i-- {
+		f := s.floats[i]
+		fmt.Fprintf(&b, "%s: %%%d %dx%d at %d,%d", f.name, f.pane.id, f.width, f.height, f.x, f.y)
+		if !f.visible {
+			b.WriteString(" (hidden)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
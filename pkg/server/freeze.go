@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+
+	"term/pkg/protocol"
+)
+
+// Freeze stops the pane's output from reaching clients, so its screen stays
+// still while the application keeps running. Output is held until limit
+// bytes have built up; after that the reader stops reading the PTY, so the
+// application blocks writing to it until the pane is thawed.
+func (p *Pane) Freeze(limit int) {
+	p.freezeMutex.Lock()
+	defer p.freezeMutex.Unlock()
+	p.frozen = true
+	p.freezeLimit = limit
+}
+
+// Thaw lets the pane's output through again, starting with what was held,
+// and returns how many bytes that was.
+func (p *Pane) Thaw() int {
+	p.freezeMutex.Lock()
+	defer p.freezeMutex.Unlock()
+	if !p.frozen {
+		return 0
+	}
+	held := len(p.held)
+	p.flushHeld()
+	p.frozen = false
+	p.thawed.Broadcast()
+	return held
+}
+
+// Frozen reports whether the pane is frozen.
+func (p *Pane) Frozen() bool {
+	p.freezeMutex.Lock()
+	defer p.freezeMutex.Unlock()
+	return p.frozen
+}
+
+// emit queues output read from the PTY, or holds it while the pane is
+// frozen, waiting for a thaw once the hold is full.
+func (p *Pane) emit(data []byte) {
+	p.freezeMutex.Lock()
+	if !p.frozen {
+		p.freezeMutex.Unlock()
+		p.queue(data)
+		return
+	}
+	p.held = append(p.held, data...)
+	for p.frozen && len(p.held) >= p.freezeLimit {
+		p.thawed.Wait()
+	}
+	p.freezeMutex.Unlock()
+}
+
+// flushHeld queues the output held while frozen. The caller must hold
+// p.freezeMutex.
+func (p *Pane) flushHeld() {
+	if len(p.held) > 0 {
+		p.queued.Add(int64(len(p.held)))
+		p.output <- p.held
+		p.held = nil
+	}
+}
+
+// cmdToggleFreeze implements toggle-freeze [-t target-pane], freezing a
+// pane's output so it can be read while it scrolls, or letting it through
+// again. A frozen pane holds up to freeze-limit KiB of output before its
+// application is stopped from writing more.
+func cmdToggleFreeze(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: toggle-freeze [-t target-pane]")
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+
+	var message string
+	if t.pane.Frozen() {
+		held := t.pane.Thaw()
+		message = fmt.Sprintf("Resumed pane %%%d, %d bytes held", t.pane.id, held)
+	} else {
+		t.pane.Freeze(t.session.options.Number("freeze-limit") * 1024)
+		message = fmt.Sprintf("Froze pane %%%d", t.pane.id)
+	}
+	t.session.redraw()
+	if ctx.client != nil {
+		ctx.client.showMessage("%s", message)
+		return "", nil
+	}
+	return message + "\n", nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"slices"
+	"sync"
+)
+
+// sessionGroup is sessions sharing one set of windows, made with
+// new-session -t. Each member keeps its own active window, clients and
+// floats. Like all sessions they share the daemon's session mutex, so a
+// change to the windows made under it is copied to every member before
+// anyone looks.
+type sessionGroup struct {
+	name     string // the session the group was made from
+	sessions []*Session
+	mutex    sync.Mutex // guards name and sessions, for readers not holding the sessions' mutex
+}
+
+// joinGroup makes the new session s share peer's windows, starting the
+// group if peer has none.
+func (s *Session) joinGroup(peer *Session) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	g := peer.group.Load()
+	if g == nil {
+		g = &sessionGroup{name: peer.Name(), sessions: []*Session{peer}}
+		peer.group.Store(g)
+	}
+	g.mutex.Lock()
+	g.sessions = append(g.sessions, s)
+	g.mutex.Unlock()
+	s.group.Store(g)
+	s.windows = slices.Clone(peer.windows)
+	s.nextWindowID = peer.nextWindowID
+	s.activeWindow = peer.activeWindow
+	if peer.size != nil {
+		size := *peer.size
+		s.size = &size
+	}
+}
+
+// members returns the sessions showing s's windows: its group, or s alone.
+func (s *Session) members() []*Session {
+	g := s.group.Load()
+	if g == nil {
+		return []*Session{s}
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return slices.Clone(g.sessions)
+}
+
+// GroupName returns the name of the session's group, or "".
+func (s *Session) GroupName() string {
+	if g := s.group.Load(); g != nil {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		return g.name
+	}
+	return ""
+}
+
+// broadcastGroup sends a message to the clients of every session showing
+// s's windows, as pane output and key encodings go to all of them.
+func (s *Session) broadcastGroup(data []byte) {
+	for _, m := range s.members() {
+		m.Broadcast(data)
+	}
+}
+
+// syncWindows copies s's windows to the rest of its group after a change.
+// A member whose active window is gone moves to its neighbour, and one
+// showing changed, whose panes changed, is switched to its active pane;
+// the rest redraw their status lines. The caller must hold s.mutex.
+func (s *Session) syncWindows(changed *Window) {
+	if s.group.Load() == nil {
+		return
+	}
+	for _, m := range s.members() {
+		if m == s {
+			continue
+		}
+		var active *Window
+		if m.activeWindow < len(m.windows) {
+			active = m.windows[m.activeWindow]
+		}
+		m.windows = slices.Clone(s.windows)
+		m.nextWindowID = s.nextWindowID
+		if len(m.windows) == 0 {
+			continue // s is about to make one
+		}
+		if i := slices.Index(m.windows, active); i >= 0 {
+			m.activeWindow = i
+			if active != changed {
+				m.redraw()
+				continue
+			}
+		} else {
+			m.activeWindow = min(m.activeWindow, len(m.windows)-1)
+		}
+		m.switchPane(m.ActivePane().id)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"term/pkg/protocol"
+)
+
+// runCommands runs command lines as from the CLI in session s, failing
+// the test at the first error.
+func runCommands(t *testing.T, d *Daemon, s *Session, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		args, err := protocol.ParseCommandLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := &CommandContext{daemon: d, session: s}
+		if _, err := ctx.RunCommand(args); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+}
+
+// windowNames lists a session's windows as index:name.
+func windowNames(s *Session) string {
+	var names []string
+	for _, w := range s.windows {
+		names = append(names, fmt.Sprintf("%d:%s", w.index, w.name))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestSessionGroup(t *testing.T) {
+	d, work := targetFixture()
+	peer := fixtureSession(d, "peer")
+	peer.joinGroup(work)
+
+	if got, want := windowNames(peer), windowNames(work); got != want {
+		t.Fatalf("grouped session has windows %s, want %s", got, want)
+	}
+	for _, s := range []*Session{work, peer} {
+		if s.GroupName() != "work" || !slices.Equal(s.members(), []*Session{work, peer}) {
+			t.Errorf("%s is in group %q of %d, want both in work", s.Name(), s.GroupName(), len(s.members()))
+		}
+	}
+
+	// Each keeps its own active window
+	runCommands(t, d, peer, "select-window -t peer:1")
+	if work.activeWindow != 0 || peer.activeWindow != 1 {
+		t.Errorf("active windows %d and %d, want 0 and 1", work.activeWindow, peer.activeWindow)
+	}
+
+	// Windows changed in one are changed in both
+	runCommands(t, d, work, "kill-window -t work:1")
+	if got, want := windowNames(peer), "0:editor 3:dup 4:dup"; got != want {
+		t.Errorf("after kill-window, grouped session has windows %s, want %s", got, want)
+	}
+	if got, want := windowNames(work), windowNames(peer); got != want {
+		t.Errorf("group's windows differ: %s and %s", got, want)
+	}
+	if w := peer.windows[peer.activeWindow]; w.index != 3 {
+		t.Errorf("grouped session shows window %d after its window was killed, want its neighbour 3", w.index)
+	}
+
+	out, err := cmdListSessions(&CommandContext{daemon: d, session: work}, nil)
+	if err != nil || strings.Count(out, "(group work)") != 2 {
+		t.Errorf("list-sessions = %q, %v, want both sessions in group work", out, err)
+	}
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// cmdShowHelp implements show-help, printing the help an attached client
+// shows with prefix ?.
+func cmdShowHelp(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: show-help")
+	}
+	var b strings.Builder
+	for _, item := range protocol.HelpItems(ctx.daemon.bindings.Tables()) {
+		b.WriteString(item.Text + "\n")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"time"
+
+	"term/pkg/vt"
+)
+
+// historyFileMaxAge is how long a pane's history file is kept after it was
+// last written.
+const historyFileMaxAge = 30 * 24 * time.Hour
+
+// historyDir returns the directory history files go in: the history-dir
+// option, or term/history under the XDG state directory.
+func historyDir(option string) string {
+	if option != "" {
+		return option
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "term", "history")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "state", "term", "history")
+}
+
+// daemonHistoryKey names a daemon's history files after its socket, hashed,
+// and when it started. Pane ids start over with every daemon and daemons on
+// other sockets share the directory, so a pane id alone could give a new
+// pane another's old output.
+func daemonHistoryKey(socket string, started time.Time) string {
+	h := fnv.New32a()
+	h.Write([]byte(socket))
+	return fmt.Sprintf("%08x-%d", h.Sum32(), started.UnixNano())
+}
+
+// historyPath is the file a pane of the daemon with key keeps its
+// history in.
+func historyPath(dir, key string, paneID int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-pane-%d.hist", key, paneID))
+}
+
+// removeStaleHistory deletes history files not written for
+// historyFileMaxAge, such as those of panes that are gone.
+func removeStaleHistory(dir string) {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.hist"))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > historyFileMaxAge {
+			os.Remove(path)
+		}
+	}
+}
+
+// startHistory makes the pane's screen write its history to the pane's
+// file in dir, keeping limit lines (see WriteHistory), cleaning up stale
+// files of other panes on the way.
+func (p *Pane) startHistory(dir, key string, limit int) error {
+	if dir == "" {
+		return fmt.Errorf("no history directory")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	removeStaleHistory(dir)
+	path := historyPath(dir, key, p.id)
+	hf, err := vt.CreateHistoryFile(path)
+	if err != nil {
+		return err
+	}
+	p.replayMutex.Lock()
+	defer p.replayMutex.Unlock()
+	p.historyPath = path
+	p.screen.WriteHistory(hf, limit)
+	return nil
+}
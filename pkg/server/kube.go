@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// podCommand is what a pane opened into namespace/pod runs. kubectl takes
+// everything after "--" as the command, so the pod is named as pod/name
+// and the namespace given with --namespace=, neither of which can be read
+// as an option.
+func podCommand(pod string) ([]string, error) {
+	namespace, name, ok := strings.Cut(pod, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("bad pod %q: namespace/pod", pod)
+	}
+	return []string{"kubectl", "exec", "-it", "--namespace=" + namespace, "pod/" + name, "--", "sh"}, nil
+}
+
+// cmdChoosePod implements choose-pod [-n namespace], opening a chooser on
+// the running pods of a namespace, or of every namespace. Picking one
+// opens a pane in it with split-window --pod.
+func cmdChoosePod(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "n:")
+	if err != nil || len(args) != 0 || ctx.client == nil {
+		return "", fmt.Errorf("usage: choose-pod [-n namespace]")
+	}
+	kubectl := []string{"get", "pods", "--no-headers", "-o",
+		"custom-columns=NAMESPACE:.metadata.namespace,NAME:.metadata.name,STATUS:.status.phase"}
+	if namespace := flags['n']; namespace != "" {
+		kubectl = append(kubectl, "-n", namespace)
+	} else {
+		kubectl = append(kubectl, "--all-namespaces")
+	}
+	out, err := exec.Command("kubectl", kubectl...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("kubectl get pods: %w", err)
+	}
+	list := protocol.ChooserList{Title: "Open a pane in a pod"}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != "Running" {
+			continue
+		}
+		pod := fields[0] + "/" + fields[1]
+		list.Items = append(list.Items, protocol.ChooserItem{
+			Text:    pod,
+			Command: "split-window --pod " + protocol.ShellQuote(pod),
+		})
+	}
+	if len(list.Items) == 0 {
+		return "", fmt.Errorf("no running pods")
+	}
+	payload, _ := json.Marshal(list)
+	ctx.client.conn.Write(protocol.Encode(protocol.MsgChooser, payload))
+	return "", nil
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// linked reports whether w is linked into s or its group.
+func (w *Window) linked(s *Session) bool {
+	return slices.IndexFunc(w.links, func(l *Session) bool {
+		return slices.Contains(s.members(), l)
+	}) >= 0
+}
+
+// unlink forgets that w is linked into s or its group.
+func (w *Window) unlink(s *Session) {
+	members := s.members()
+	w.links = slices.DeleteFunc(w.links, func(l *Session) bool {
+		return slices.Contains(members, l)
+	})
+}
+
+// windowChanged tells the sessions showing w that its panes changed: the
+// rest of s's group, and the sessions w is linked into, which drop it once
+// it has no panes. The caller must hold s.mutex.
+func (s *Session) windowChanged(w *Window) {
+	s.syncWindows(w)
+	members := s.members()
+	for _, l := range slices.Clone(w.links) {
+		if slices.Contains(members, l) {
+			continue
+		}
+		i := slices.IndexFunc(l.windows, func(o *Window) bool { return o.windowContent == w.windowContent })
+		if i < 0 {
+			continue
+		}
+		if len(w.panes) == 0 {
+			l.dropWindow(i)
+			continue
+		}
+		l.syncWindows(l.windows[i])
+		if l.activeWindow == i {
+			l.switchPane(l.ActivePane().id)
+		}
+	}
+}
+
+// dropWindow removes the window at position i from s and its group,
+// unlinking it, and shows the active window, making a new one if none is
+// left. The caller must hold s.mutex.
+func (s *Session) dropWindow(i int) {
+	s.windows[i].unlink(s)
+	s.windows[i].showPanes()
+	s.windows = slices.Delete(s.windows, i, i+1)
+	if i < s.activeWindow || s.activeWindow >= len(s.windows) {
+		s.activeWindow--
+	}
+	if s.options.Flag("renumber-windows") {
+		s.renumberWindows()
+	}
+	s.syncWindows(nil)
+	if len(s.windows) == 0 {
+		// No more windows, keep the session alive with a new one
+		s.activeWindow = 0
+		s.newWindow(nil, "", "")
+		return
+	}
+	s.switchPane(s.ActivePane().id)
+}
+
+// linkWindow links w into s at index, or the first free one if index is
+// "", and makes it active. The caller must hold s.mutex.
+func (s *Session) linkWindow(w *Window, index string) error {
+	if w.linked(s) {
+		return fmt.Errorf("window %s is already in session %s", w.name, s.Name())
+	}
+	n, err := s.freeWindowIndex(index)
+	if err != nil {
+		return err
+	}
+	link := &Window{id: s.nextWindowID, index: n, windowContent: w.windowContent}
+	s.nextWindowID++
+	w.links = append(w.links, s)
+	w.showPanes()
+	pos := s.insertWindow(link)
+	s.syncWindows(nil)
+	s.selectWindow(pos)
+	return nil
+}
+
+// freeWindowIndex parses index, which must not be in use in s, or returns
+// the first free one if it is "". The caller must hold s.mutex.
+func (s *Session) freeWindowIndex(index string) (int, error) {
+	if index == "" {
+		return s.nextWindowIndex(), nil
+	}
+	n, err := strconv.Atoi(index)
+	if err != nil {
+		return 0, fmt.Errorf("bad window index: %s", index)
+	}
+	if slices.ContainsFunc(s.windows, func(o *Window) bool { return o.index == n }) {
+		return 0, fmt.Errorf("index %d in use in session %s", n, s.Name())
+	}
+	return n, nil
+}
+
+// showPanes sends the output of w's panes to the sessions it is linked
+// into after they change. The caller must hold s.mutex.
+func (w *windowContent) showPanes() {
+	for _, p := range w.panes {
+		p.showIn(w.links)
+	}
+}
+
+// showIn makes p's output and key encodings go to the clients of links and
+// their groups. Sessions not shown p before are first sent its replay and
+// key encoding, so their clients pick it up where the others are.
+func (p *Pane) showIn(links []*Session) {
+	p.replayMutex.Lock()
+	defer p.replayMutex.Unlock()
+	var shown []*Session
+	for _, l := range *p.shownIn.Load() {
+		shown = append(shown, l.members()...)
+	}
+	for _, l := range links {
+		for _, m := range l.members() {
+			if slices.Contains(shown, m) {
+				continue
+			}
+			if output := p.replayOutput(); len(output) > 0 {
+				m.Broadcast(createDataMessage(p.id, output))
+			}
+			m.Broadcast(createKeyEncodingMessage(p.KeyEncoding()))
+		}
+	}
+	links = slices.Clone(links)
+	p.shownIn.Store(&links)
+}
+
+// broadcast sends a message about p to the clients of every session it is
+// shown in.
+func (p *Pane) broadcast(data []byte) {
+	for _, l := range *p.shownIn.Load() {
+		l.broadcastGroup(data)
+	}
+}
+
+// cmdLinkWindow implements link-window [-s src-window]
+// [-t dst-session[:index]], showing a window in another session as well,
+// at index or the first free one.
+func cmdLinkWindow(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "s:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: link-window [-s src-window] [-t dst-session[:index]]")
+	}
+	src, err := ctx.resolveTarget(flags['s'])
+	if err != nil {
+		return "", err
+	}
+	name, index, _ := strings.Cut(flags['t'], ":")
+	dst, err := ctx.resolveSession(name)
+	if err != nil {
+		return "", err
+	}
+	dst.mutex.Lock()
+	defer dst.mutex.Unlock()
+	if !slices.Contains(src.session.windows, src.window) {
+		return "", fmt.Errorf("window %d is gone", src.window.index)
+	}
+	return "", dst.linkWindow(src.window, index)
+}
+
+// cmdUnlinkWindow implements unlink-window [-t target-window], removing a
+// window from a session while it stays in the others it is linked into.
+func cmdUnlinkWindow(ctx *CommandContext, args []string) (string, error) {
+	spec, args, err := targetFlag(args)
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: unlink-window [-t target-window]")
+	}
+	t, err := ctx.resolveTarget(spec)
+	if err != nil {
+		return "", err
+	}
+	t.session.mutex.Lock()
+	defer t.session.mutex.Unlock()
+	i := slices.Index(t.session.windows, t.window)
+	switch {
+	case i < 0:
+		return "", fmt.Errorf("window %d is gone", t.window.index)
+	case len(t.window.links) < 2:
+		return "", fmt.Errorf("window %d is only in session %s", t.window.index, t.session.Name())
+	}
+	t.session.dropWindow(i)
+	return "", nil
+}
+
+// cmdKillWindow implements kill-window [-t target-window]. A window linked
+// into other sessions is only unlinked from this one; otherwise its panes
+// are closed.
+func cmdKillWindow(ctx *CommandContext, args []string) (string, error) {
+	spec, args, err := targetFlag(args)
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: kill-window [-t target-window]")
+	}
+	t, err := ctx.resolveTarget(spec)
+	if err != nil {
+		return "", err
+	}
+	s := t.session
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := slices.Index(s.windows, t.window)
+	if i < 0 {
+		return "", fmt.Errorf("window %d is gone", t.window.index)
+	}
+	if len(t.window.links) < 2 {
+		for _, p := range t.window.panes {
+			p.Close()
+		}
+		t.window.panes = nil
+		s.fire("window-closed", map[string]any{"session_name": s.Name(), "window_index": t.window.index})
+	}
+	s.dropWindow(i)
+	return "", nil
+}
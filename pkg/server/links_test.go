@@ -0,0 +1,54 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"term/pkg/protocol"
+)
+
+func TestLinkWindow(t *testing.T) {
+	d, work := targetFixture()
+	other := d.FindSession("other")
+	runCommands(t, d, work, "link-window -s work:1 -t other")
+	if got, want := windowNames(other), "0:shell 1:logs"; got != want {
+		t.Fatalf("after link-window, other has windows %s, want %s", got, want)
+	}
+	logs := work.windows[1]
+	if other.windows[1].windowContent != logs.windowContent || other.activeWindow != 1 {
+		t.Errorf("linked window isn't shared and active")
+	}
+	if p := logs.panes[0]; !slices.Equal(*p.shownIn.Load(), []*Session{work, other}) {
+		t.Errorf("linked window's pane is shown in %d sessions, want 2", len(*p.shownIn.Load()))
+	}
+
+	errors := []struct {
+		command string
+		want    string
+	}{
+		{"link-window -s work:1 -t other", "already in session other"},
+		{"link-window -s work:0 -t other:1", "index 1 in use"},
+		{"unlink-window -t work:0", "only in session work"},
+	}
+	for _, tt := range errors {
+		args, _ := protocol.ParseCommandLine(tt.command)
+		ctx := &CommandContext{daemon: d, session: work}
+		if _, err := ctx.RunCommand(args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s = %v, want an error with %q", tt.command, err, tt.want)
+		}
+	}
+
+	// Killing a linked window only unlinks it; its panes go on in the
+	// other session
+	runCommands(t, d, work, "kill-window -t work:1")
+	if got, want := windowNames(work), "0:editor 3:dup 4:dup"; got != want {
+		t.Errorf("after kill-window, work has windows %s, want %s", got, want)
+	}
+	if len(other.windows) != 2 || len(other.windows[1].panes) != 1 || !slices.Equal(other.windows[1].links, []*Session{other}) {
+		t.Errorf("the window went from the session it is still linked into")
+	}
+	if p := logs.panes[0]; !slices.Equal(*p.shownIn.Load(), []*Session{other}) {
+		t.Errorf("unlinked window's pane is still shown in work")
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"term/pkg/protocol"
+)
+
+// A daemon started with --listen 127.0.0.1:PORT also takes clients over
+// TCP on that loopback address, for clients in a container or WSL distro
+// that can't reach its unix socket. They connect with
+// --socket tcp:127.0.0.1:PORT. As anyone on the machine can open a
+// loopback connection, each one must start with an Auth message carrying
+// the daemon's token, kept in protocol.TokenPath; a client reads it from
+// $TERM_MUX_TOKEN, else from the same file.
+
+// authTimeout is how long a TCP connection has to authenticate.
+const authTimeout = 10 * time.Second
+
+// daemonToken returns the token, making a new one the first time.
+func daemonToken() (string, error) {
+	if data, err := os.ReadFile(protocol.TokenPath()); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(key)
+	if err := os.MkdirAll(filepath.Dir(protocol.TokenPath()), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(protocol.TokenPath(), []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// listenTCP listens on addr, which must be a loopback address: the token
+// is sent in the clear. A name such as localhost is resolved first, and
+// the address it resolves to is the one listened on.
+func listenTCP(addr string) (net.Listener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !tcpAddr.IP.IsLoopback() {
+		return nil, fmt.Errorf("%s is not a loopback address", addr)
+	}
+	return net.ListenTCP("tcp", tcpAddr)
+}
+
+// authenticate reads the Auth message a TCP connection must start with
+// and checks its token.
+func (d *Daemon) authenticate(conn net.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	msgType, payload, err := protocol.ReadLimit(conn, uint32(len(d.token)))
+	if err != nil {
+		return fmt.Errorf("from %s: %w", conn.RemoteAddr(), err)
+	}
+	if msgType != protocol.MsgAuth || subtle.ConstantTimeCompare(payload, []byte(d.token)) != 1 {
+		return fmt.Errorf("from %s: bad token", conn.RemoteAddr())
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"term/pkg/protocol"
+)
+
+func TestListenTCP(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"127.0.0.1:0", true},
+		{"localhost:0", true},
+		{"[::1]:0", true},
+		{"0.0.0.0:0", false},
+		{":0", false},
+		{"192.0.2.1:0", false},
+	}
+	for _, tt := range tests {
+		l, err := listenTCP(tt.addr)
+		if l != nil {
+			l.Close()
+		}
+		if tt.ok && err != nil && !strings.Contains(err.Error(), "assign requested address") {
+			t.Errorf("listenTCP(%s): %v", tt.addr, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "not a loopback address")) {
+			t.Errorf("listenTCP(%s) = %v, want it refused as not loopback", tt.addr, err)
+		}
+	}
+}
+
+func TestDaemonToken(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv(protocol.TokenEnv, "")
+	token, err := daemonToken()
+	if err != nil || len(token) != 64 {
+		t.Fatalf("daemonToken() = %q, %v", token, err)
+	}
+	if again, _ := daemonToken(); again != token {
+		t.Errorf("second daemonToken() = %q, want the saved %q", again, token)
+	}
+	if info, err := os.Stat(protocol.TokenPath()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file: %v, %v, want mode 0600", info, err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	d := &Daemon{token: "secret"}
+	tests := []struct {
+		name string
+		msg  []byte
+		ok   bool
+	}{
+		{"right token", protocol.Encode(protocol.MsgAuth, []byte("secret")), true},
+		{"wrong token", protocol.Encode(protocol.MsgAuth, []byte("secreT")), false},
+		{"short token", protocol.Encode(protocol.MsgAuth, []byte("sec")), false},
+		{"too long", protocol.Encode(protocol.MsgAuth, []byte(strings.Repeat("x", 1<<20))), false},
+		{"no Auth first", protocol.Encode(protocol.MsgCLICommand, []byte("secret")), false},
+	}
+	for _, tt := range tests {
+		server, client := net.Pipe()
+		go func() {
+			client.Write(tt.msg)
+			client.Close()
+		}()
+		err := d.authenticate(server)
+		server.Close()
+		if tt.ok != (err == nil) {
+			t.Errorf("%s: authenticate = %v", tt.name, err)
+		}
+	}
+}
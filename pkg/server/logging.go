@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// logTimeFormat starts each line of a pane log with log-timestamps on.
+const logTimeFormat = "2006-01-02 15:04:05 "
+
+// paneLog is a file a pane's output is copied to by toggle-logging.
+type paneLog struct {
+	file       *os.File
+	timestamps bool
+	strip      bool           // write lines of plain text, without escape sequences
+	lines      vt.LineScanner // with strip
+	midLine    bool           // without strip, the last write did not end a line
+}
+
+// logDir returns where pane logs go: log-dir, or ~/term-logs.
+func logDir(options *Options) string {
+	if dir := options.String("log-dir"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "term-logs")
+}
+
+// StartLog opens path, appending to it, and copies the pane's output there
+// from now on.
+func (p *Pane) StartLog(path string, timestamps, strip bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	p.logMutex.Lock()
+	defer p.logMutex.Unlock()
+	if p.log != nil {
+		p.log.file.Close()
+	}
+	p.log = &paneLog{file: file, timestamps: timestamps, strip: strip}
+	return nil
+}
+
+// StopLog closes the pane's log, if it has one, returning its path.
+func (p *Pane) StopLog() string {
+	p.logMutex.Lock()
+	defer p.logMutex.Unlock()
+	if p.log == nil {
+		return ""
+	}
+	path := p.log.file.Name()
+	if line := p.log.lines.Partial(); p.log.strip && line != "" {
+		p.log.writeLine(line)
+	}
+	p.log.file.Close()
+	p.log = nil
+	return path
+}
+
+// LogPath returns the file the pane is logging to, or "".
+func (p *Pane) LogPath() string {
+	p.logMutex.Lock()
+	defer p.logMutex.Unlock()
+	if p.log == nil {
+		return ""
+	}
+	return p.log.file.Name()
+}
+
+// writeLog copies output to the pane's log, if it has one. Write errors
+// stop the logging.
+func (p *Pane) writeLog(output []byte) {
+	p.logMutex.Lock()
+	defer p.logMutex.Unlock()
+	if p.log == nil {
+		return
+	}
+	if err := p.log.write(output); err != nil {
+		p.log.file.Close()
+		p.log = nil
+	}
+}
+
+func (l *paneLog) write(data []byte) error {
+	if l.strip {
+		var err error
+		l.lines.Scan(data, func(line string) {
+			if err == nil {
+				err = l.writeLine(line)
+			}
+		})
+		return err
+	}
+	if !l.timestamps {
+		_, err := l.file.Write(data)
+		return err
+	}
+	var b bytes.Buffer
+	stamp := time.Now().Format(logTimeFormat)
+	for len(data) > 0 {
+		if !l.midLine {
+			b.WriteString(stamp)
+		}
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		b.Write(data[:end])
+		l.midLine = data[end-1] != '\n'
+		data = data[end:]
+	}
+	_, err := l.file.Write(b.Bytes())
+	return err
+}
+
+func (l *paneLog) writeLine(line string) error {
+	if l.timestamps {
+		line = time.Now().Format(logTimeFormat) + line
+	}
+	_, err := l.file.WriteString(line + "\n")
+	return err
+}
+
+// cmdToggleLogging implements toggle-logging [-t target-pane], starting or
+// stopping copying a pane's output to <session>-<pane id>-<date>.log in
+// log-dir. log-timestamps starts each line with the time and
+// log-strip-escapes writes plain text; both apply when logging starts.
+func cmdToggleLogging(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: toggle-logging [-t target-pane]")
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+
+	var message string
+	if path := t.pane.StopLog(); path != "" {
+		message = "Stopped logging to " + path
+	} else {
+		options := t.session.options
+		name := fmt.Sprintf("%s-%d-%s.log", t.session.Name(), t.pane.id, time.Now().Format("2006-01-02"))
+		path := filepath.Join(logDir(options), name)
+		if err := t.pane.StartLog(path, options.Flag("log-timestamps"), options.Flag("log-strip-escapes")); err != nil {
+			return "", err
+		}
+		message = "Logging to " + path
+	}
+	t.session.redraw()
+	if ctx.client != nil {
+		ctx.client.showMessage("%s", message)
+		return "", nil
+	}
+	return message + "\n", nil
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"term/pkg/protocol"
+)
+
+// defaultMacro is the macro record-macro and play-macro use without -n.
+const defaultMacro = "default"
+
+// Macros holds the keystrokes recorded with record-macro by name. They are
+// kept in macros.json in the data directory, written on every change and
+// read when the daemon starts.
+type Macros struct {
+	keys  map[string]string
+	path  string // "" when there is no data directory
+	mutex sync.Mutex
+}
+
+func NewMacros() *Macros {
+	m := &Macros{keys: make(map[string]string)}
+	if dir := protocol.DataDir(); dir != "" {
+		m.path = filepath.Join(dir, "macros.json")
+	}
+	return m
+}
+
+// Load reads the saved macros. A missing file is no error.
+func (m *Macros) Load() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return json.Unmarshal(data, &m.keys)
+}
+
+// save writes every macro. The caller must hold m.mutex.
+func (m *Macros) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, data, 0600)
+}
+
+// Set stores a macro, replacing any with the same name.
+func (m *Macros) Set(name, keys string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.keys[name] = keys
+	return m.save()
+}
+
+// Get returns the keystrokes of the macro called name.
+func (m *Macros) Get(name string) (string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys, ok := m.keys[name]
+	return keys, ok
+}
+
+// Delete removes the macro called name.
+func (m *Macros) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.keys[name]; !ok {
+		return fmt.Errorf("no macro %s", name)
+	}
+	delete(m.keys, name)
+	return m.save()
+}
+
+// List describes every macro by name, one per line.
+func (m *Macros) List() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(m.keys)) {
+		keys := []rune(m.keys[name])
+		preview := keys[:min(len(keys), 50)]
+		fmt.Fprintf(&b, "%s: %d bytes: %q\n", name, len(m.keys[name]), string(preview))
+	}
+	return b.String()
+}
+
+// macroRecording is the macro a client is recording: what it sends to
+// panes, added by SessionManager.handleMessage.
+type macroRecording struct {
+	name string
+	keys strings.Builder
+}
+
+// cmdRecordMacro implements record-macro [-n name], starting to record the
+// keys this client sends to panes, or when it is recording, stopping and
+// saving them as the macro.
+func cmdRecordMacro(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "n:")
+	if err != nil || len(args) != 0 || ctx.client == nil {
+		return "", fmt.Errorf("usage: record-macro [-n name]")
+	}
+	sm := ctx.client
+	if r := sm.recording; r != nil {
+		sm.recording = nil
+		if r.keys.Len() == 0 {
+			sm.showMessage("Nothing recorded for macro %s", r.name)
+			return "", nil
+		}
+		if err := ctx.daemon.macros.Set(r.name, r.keys.String()); err != nil {
+			return "", err
+		}
+		sm.showMessage("Recorded macro %s: %d bytes", r.name, r.keys.Len())
+		return "", nil
+	}
+	name := flags['n']
+	if name == "" {
+		name = defaultMacro
+	}
+	sm.recording = &macroRecording{name: name}
+	sm.showMessage("Recording macro %s, record-macro again to stop", name)
+	return "", nil
+}
+
+// cmdPlayMacro implements play-macro [-n name] [-N count] [-t target-pane],
+// typing a macro's keys into a pane count times.
+func cmdPlayMacro(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "n:N:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: play-macro [-n name] [-N count] [-t target-pane]")
+	}
+	name := flags['n']
+	if name == "" {
+		name = defaultMacro
+	}
+	keys, ok := ctx.daemon.macros.Get(name)
+	if !ok {
+		return "", fmt.Errorf("no macro %s", name)
+	}
+	count := 1
+	if n, ok := flags['N']; ok {
+		if count, err = strconv.Atoi(n); err != nil || count < 1 {
+			return "", fmt.Errorf("bad count: %s", n)
+		}
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	t.pane.ptmx.Write([]byte(strings.Repeat(keys, count)))
+	return "", nil
+}
+
+// cmdListMacros implements list-macros.
+func cmdListMacros(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: list-macros")
+	}
+	return ctx.daemon.macros.List(), nil
+}
+
+// cmdDeleteMacro implements delete-macro -n name.
+func cmdDeleteMacro(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "n:")
+	if err != nil || len(args) != 0 || flags['n'] == "" {
+		return "", fmt.Errorf("usage: delete-macro -n name")
+	}
+	return "", ctx.daemon.macros.Delete(flags['n'])
+}
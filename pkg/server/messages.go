@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"term/pkg/protocol"
+)
+
+// logEntry is one message kept for show-messages.
+type logEntry struct {
+	time time.Time
+	text string
+}
+
+// messageLog keeps the most recent messages: the daemon has one for
+// everything not caused by a particular client, such as config errors and
+// hook failures, and each client one for errors of the commands it ran.
+type messageLog struct {
+	entries []logEntry
+	mutex   sync.Mutex
+}
+
+// Add records text, keeping at most limit entries.
+func (l *messageLog) Add(limit int, text string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.entries = append(l.entries, logEntry{time: time.Now(), text: text})
+	if limit < 1 {
+		limit = 1
+	}
+	if len(l.entries) > limit {
+		l.entries = slices.Delete(l.entries, 0, len(l.entries)-limit)
+	}
+}
+
+func (l *messageLog) Entries() []logEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return slices.Clone(l.entries)
+}
+
+// logMessage prints a message to the daemon's output, unless --log-level is
+// none, and keeps it for show-messages. It returns the message.
+func logMessage(log *messageLog, options *Options, format string, args ...any) string {
+	text := fmt.Sprintf(format, args...)
+	if logLevel != "none" {
+		fmt.Println(text)
+	}
+	log.Add(options.Number("message-limit"), text)
+	return text
+}
+
+// debugf prints the daemon's tracing of what it does, with --log-level
+// debug.
+func debugf(format string, args ...any) {
+	if logLevel == "debug" {
+		fmt.Printf(format, args...)
+	}
+}
+
+func createMessage(text string, isError bool) []byte {
+	payload, _ := json.Marshal(protocol.Message{Text: text, Error: isError})
+	return protocol.Encode(protocol.MsgMessage, payload)
+}
+
+// logf logs a notice and shows it to every attached client.
+func (d *Daemon) logf(format string, args ...any) {
+	d.tell(createMessage(logMessage(d.messages, d.options, format, args...), false))
+}
+
+// errorf logs an error and shows it to every attached client.
+func (d *Daemon) errorf(format string, args ...any) {
+	d.tell(createMessage(logMessage(d.messages, d.options, format, args...), true))
+}
+
+func (d *Daemon) tell(msg []byte) {
+	for _, sm := range d.Clients() {
+		sm.conn.Write(msg)
+	}
+}
+
+// logf logs a notice and shows it to the clients of s and its group.
+func (s *Session) logf(format string, args ...any) {
+	s.broadcastGroup(createMessage(logMessage(s.messages, s.options, format, args...), false))
+}
+
+// errorf logs an error and shows it to the clients of s and its group.
+func (s *Session) errorf(format string, args ...any) {
+	s.broadcastGroup(createMessage(logMessage(s.messages, s.options, format, args...), true))
+}
+
+// showMessage records a notice for this client and shows it in its message
+// line.
+func (sm *SessionManager) showMessage(format string, args ...any) {
+	text := logMessage(&sm.messages, sm.daemon.options, format, args...)
+	sm.conn.Write(createMessage(text, false))
+}
+
+// showError records an error of this client's, such as a command that
+// failed, and shows it in its message line.
+func (sm *SessionManager) showError(format string, args ...any) {
+	text := logMessage(&sm.messages, sm.daemon.options, format, args...)
+	sm.conn.Write(createMessage(text, true))
+}
+
+// cmdShowMessages implements show-messages, listing the daemon's recent
+// messages together with those of the client running it, oldest first.
+func cmdShowMessages(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: show-messages")
+	}
+	entries := ctx.daemon.messages.Entries()
+	if ctx.client != nil {
+		entries = append(entries, ctx.client.messages.Entries()...)
+		slices.SortStableFunc(entries, func(a, b logEntry) int {
+			return a.time.Compare(b.time)
+		})
+	}
+	if len(entries) == 0 {
+		return "No messages\n", nil
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s %s\n", e.time.Format("15:04:05"), e.text)
+	}
+	return b.String(), nil
+}
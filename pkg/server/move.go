@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// cmdMoveWindow implements move-window [-s src-window]
+// [-t dst-session[:index]], moving a window to another session, at index or
+// the first free one, or to a new index in its own. Its panes keep running.
+func cmdMoveWindow(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "s:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: move-window [-s src-window] [-t dst-session[:index]]")
+	}
+	src, err := ctx.resolveTarget(flags['s'])
+	if err != nil {
+		return "", err
+	}
+	name, index, _ := strings.Cut(flags['t'], ":")
+	dst, err := ctx.resolveSession(name)
+	if err != nil {
+		return "", err
+	}
+	s := src.session
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := slices.Index(s.windows, src.window)
+	if i < 0 {
+		return "", fmt.Errorf("window %d is gone", src.window.index)
+	}
+	if slices.Contains(s.members(), dst) {
+		n, err := s.freeWindowIndex(index)
+		if err != nil {
+			return "", err
+		}
+		w := s.windows[i]
+		s.windows = slices.Delete(s.windows, i, i+1)
+		w.index = n
+		pos := s.insertWindow(w)
+		s.syncWindows(nil)
+		s.selectWindow(pos)
+		return "", nil
+	}
+	if err := dst.linkWindow(src.window, index); err != nil {
+		return "", err
+	}
+	if dst.size != nil {
+		for _, p := range src.window.panes {
+			p.Resize(dst.size)
+		}
+	}
+	s.dropWindow(i)
+	return "", nil
+}
+
+// cmdMovePane implements move-pane [-s src-pane] [-t dst-window], moving a
+// pane into another window, in this session or another, where it becomes
+// the active pane. Its process keeps running; a window left without panes
+// is closed.
+func cmdMovePane(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "s:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: move-pane [-s src-pane] [-t dst-window]")
+	}
+	src, err := ctx.resolveTarget(flags['s'])
+	if err != nil {
+		return "", err
+	}
+	dst, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	s, ds := src.session, dst.session
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := slices.Index(s.windows, src.window)
+	switch {
+	case i < 0 || !slices.Contains(src.window.panes, src.pane):
+		return "", fmt.Errorf("pane %d is gone", src.pane.id)
+	case !slices.Contains(ds.windows, dst.window):
+		return "", fmt.Errorf("window %d is gone", dst.window.index)
+	case src.window.windowContent == dst.window.windowContent:
+		return "", fmt.Errorf("pane %d is already in window %d", src.pane.id, dst.window.index)
+	}
+
+	p := src.pane
+	src.window.removePane(p.id)
+	p.showIn(dst.window.links)
+	if ds.size != nil {
+		p.Resize(ds.size)
+	}
+	dst.window.panes = append(dst.window.panes, p)
+	dst.window.activePane = len(dst.window.panes) - 1
+
+	if len(src.window.panes) > 0 {
+		s.fire("layout-changed", map[string]any{"session_name": s.Name(), "window_index": src.window.index, "window_panes": len(src.window.panes)})
+		s.switchPane(s.ActivePane().id)
+	} else {
+		s.fire("window-closed", map[string]any{"session_name": s.Name(), "window_index": src.window.index})
+		s.dropWindow(i)
+	}
+	s.windowChanged(src.window)
+
+	ds.fire("layout-changed", map[string]any{"session_name": ds.Name(), "window_index": dst.window.index, "window_panes": len(dst.window.panes)})
+	ds.selectWindow(slices.Index(ds.windows, dst.window))
+	ds.windowChanged(dst.window)
+	return "", nil
+}
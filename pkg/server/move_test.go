@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"term/pkg/protocol"
+)
+
+// paneIDs lists the panes of each of a session's windows as
+// index:id,id.
+func paneIDs(s *Session) string {
+	var windows []string
+	for _, w := range s.windows {
+		var ids []string
+		for _, p := range w.panes {
+			ids = append(ids, fmt.Sprint(p.id))
+		}
+		windows = append(windows, fmt.Sprintf("%d:%s", w.index, strings.Join(ids, ",")))
+	}
+	return strings.Join(windows, " ")
+}
+
+func TestMoveWindow(t *testing.T) {
+	tests := []struct {
+		command     string
+		work, other string // the panes of each session's windows after
+	}{
+		{"move-window -s work:1 -t other", "0:10,11 3:13 4:14", "0:20 1:12"},
+		{"move-window -s work:1 -t other:7", "0:10,11 3:13 4:14", "0:20 7:12"},
+		{"move-window -s work:1 -t work:9", "0:10,11 3:13 4:14 9:12", "0:20"},
+		{"move-window -s work:4 -t work", "0:10,11 1:12 2:14 3:13", "0:20"},
+	}
+	for _, tt := range tests {
+		d, work := targetFixture()
+		other := d.FindSession("other")
+		src, _ := (&CommandContext{daemon: d, session: work}).resolveTarget(strings.Fields(tt.command)[2])
+		runCommands(t, d, work, tt.command)
+		if got := paneIDs(work); got != tt.work {
+			t.Errorf("%s: work has %s, want %s", tt.command, got, tt.work)
+		}
+		if got := paneIDs(other); got != tt.other {
+			t.Errorf("%s: other has %s, want %s", tt.command, got, tt.other)
+		}
+		dst := work
+		if strings.Contains(tt.command, "-t other") {
+			dst = other
+		}
+		if shown := *src.pane.shownIn.Load(); !slices.Equal(shown, []*Session{dst}) {
+			t.Errorf("%s: moved pane shown in %d sessions, want only its new one", tt.command, len(shown))
+		}
+	}
+}
+
+func TestMovePane(t *testing.T) {
+	d, work := targetFixture()
+	other := d.FindSession("other")
+	runCommands(t, d, work, "move-pane -s work:0.0 -t other:0")
+	if got, want := paneIDs(work), "0:11 1:12 3:13 4:14"; got != want {
+		t.Errorf("work has %s, want %s", got, want)
+	}
+	if got, want := paneIDs(other), "0:20,10"; got != want {
+		t.Errorf("other has %s, want %s", got, want)
+	}
+	if w := other.windows[0]; w.ActivePane().id != 10 {
+		t.Errorf("moved pane isn't active in its new window")
+	}
+
+	// A window left without panes closes
+	runCommands(t, d, work, "move-pane -s work:1 -t work:0")
+	if got, want := paneIDs(work), "0:11,12 3:13 4:14"; got != want {
+		t.Errorf("work has %s, want %s", got, want)
+	}
+
+	args, _ := protocol.ParseCommandLine("move-pane -s work:0.0 -t work:0")
+	if _, err := (&CommandContext{daemon: d, session: work}).RunCommand(args); err == nil || !strings.Contains(err.Error(), "already in window") {
+		t.Errorf("moving a pane into its own window = %v, want an error", err)
+	}
+}
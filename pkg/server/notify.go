@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// commandDone is called when the shell in a pane reports a command
+// finished. A command that ran for at least notify-command-time seconds in
+// a pane nobody is looking at flags its window in the status line and runs
+// the notify-command shell command, if set.
+func (s *Session) commandDone(p *Pane, status int, duration time.Duration) {
+	s.fire("command-done", map[string]any{
+		"session_name": s.Name(),
+		"pane_id":      p.id,
+		"status":       status,
+		"duration":     int(duration.Seconds()),
+	})
+	threshold := s.options.Number("notify-command-time")
+	if threshold <= 0 || duration < time.Duration(threshold)*time.Second {
+		return
+	}
+
+	s.mutex.Lock()
+	if p == s.focusedPane {
+		s.mutex.Unlock()
+		return
+	}
+	for i, w := range s.windows {
+		for _, wp := range w.panes {
+			if wp == p && i != s.activeWindow {
+				w.alert = true
+			}
+		}
+	}
+	s.redraw()
+	s.mutex.Unlock()
+
+	s.logf("Command in pane %d finished with status %d after %s", p.id, status, duration.Round(time.Second))
+	if command := s.options.String("notify-command"); command != "" {
+		go func() {
+			if err := runNotifyCommand(command, p.id, status, duration); err != nil {
+				s.errorf("notify-command failed: %v", err)
+			}
+		}()
+	}
+}
+
+// runNotifyCommand runs the notify-command hook with details of the
+// finished command in its environment.
+func runNotifyCommand(command string, paneID, status int, duration time.Duration) error {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("TERM_MUX_PANE=%d", paneID),
+		fmt.Sprintf("TERM_MUX_STATUS=%d", status),
+		fmt.Sprintf("TERM_MUX_DURATION=%d", int(duration.Seconds())))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"term/pkg/vt"
+)
+
+type optionType int
+
+const (
+	optionNumber optionType = iota
+	optionFlag
+	optionString
+)
+
+type optionDef struct {
+	typ optionType
+	def string
+}
+
+// optionTable lists every option the daemon understands with its type and
+// default value. Options not in this table are rejected by set-option.
+var optionTable = map[string]optionDef{
+	"allow-passthrough":   {optionFlag, "off"},
+	"ambiguous-width":     {optionString, "auto"}, // columns of East Asian ambiguous characters: auto follows each client's locale
+	"automatic-rename":    {optionFlag, "on"},     // name windows after the active pane's running command
+	"base-index":          {optionNumber, "0"},
+	"default-command":     {optionString, ""}, // what new panes run, by default-shell; "" for the shell itself
+	"default-shell":       {optionString, defaultShell},
+	"display-time":        {optionNumber, "750"},  // ms a message shows in the status line
+	"freeze-limit":        {optionNumber, "1024"}, // KiB of output a frozen pane holds before stopping its application
+	"history-dir":         {optionString, ""},     // where history files go, default under XDG_STATE_HOME
+	"history-file":        {optionFlag, "off"},    // keep each pane's history on disk
+	"history-limit":       {optionNumber, "2000"}, // lines of scrollback kept per pane
+	"history-memory":      {optionNumber, "4096"}, // KiB of scrollback kept per pane, 0 for no cap
+	"image-placeholder":   {optionFlag, "on"},     // write [image] where an image is not drawn
+	"inline-images":       {optionString, "auto"}, // draw iTerm2 inline images: auto guesses from TERM_PROGRAM
+	"log-dir":             {optionString, ""},     // where toggle-logging writes, default ~/term-logs
+	"log-strip-escapes":   {optionFlag, "on"},     // log plain text rather than raw output
+	"log-timestamps":      {optionFlag, "off"},    // start each logged line with the time
+	"login-shell":         {optionFlag, "off"},    // start the shell with -l, reading login profiles
+	"message-limit":       {optionNumber, "100"},  // messages kept for show-messages
+	"meta-encoding":       {optionString, "escape"},
+	"mouse":               {optionFlag, "off"},
+	"notify-command":      {optionString, ""},     // shell command run when a long command finishes unseen
+	"notify-command-time": {optionNumber, "10"},   // seconds a command must run to notify, 0 disables
+	"output-limit":        {optionNumber, "4096"}, // KiB of a pane's output waiting for clients before more is dropped, 0 for no cap
+	"pane-base-index":     {optionNumber, "0"},
+	"renumber-windows":    {optionFlag, "off"},
+	"replay-limit":        {optionNumber, "64"}, // KiB of each pane's recent output sent to clients as they attach, 0 for none
+	"repeat-time":         {optionNumber, "500"},
+	"set-clipboard":       {optionFlag, "on"},  // copy yanked text to the outer terminal with OSC 52
+	"set-primary":         {optionFlag, "off"}, // also copy it to the primary selection with wl-copy or xclip
+	"set-titles":          {optionFlag, "off"}, // set the outer terminal's title to set-titles-string
+	"set-titles-string":   {optionString, defaultTitlesString},
+	"sixel":               {optionString, "auto"}, // draw sixel images: auto guesses from TERM
+	"ssh-hosts":           {optionString, ""},     // hosts choose-host lists before those in ~/.ssh/config
+	"status-justify":      {optionString, "left"}, // where the window list goes in the status line
+	"status-right":        {optionString, ""},     // appended to the status line, with #{} pane variables
+	"update-environment":  {optionString, defaultUpdateEnvironment},
+	"url-opener":          {optionString, defaultURLOpener()},
+	"which-key-delay":     {optionNumber, "1000"}, // ms before key hints show, 0 disables
+	"window-active-style": {optionString, ""},     // the pane with focus, see vt.ParsePaneStyle
+	"window-style":        {optionString, ""},     // panes drawn without focus, such as the one under a float
+	"word-separators":     {optionString, "\"'()[]{}<>,;|"},
+}
+
+// windowOptions are the options set on one window with set-option -w.
+var windowOptions = []string{
+	"monitor-content", // flag the window with + when a line of output matches this regular expression
+}
+
+// optionNames returns the names of every option, for completion.
+func optionNames() []string {
+	return slices.Sorted(slices.Values(append(slices.Collect(maps.Keys(optionTable)), windowOptions...)))
+}
+
+// optionChoices restricts string options to a fixed set of values.
+var optionChoices = map[string][]string{
+	"ambiguous-width": {"auto", "narrow", "wide"},
+	"inline-images":   {"auto", "on", "off"},
+	"meta-encoding":   {"escape", "8bit"},
+	"sixel":           {"auto", "on", "off"},
+	"status-justify":  {"left", "centre", "right"},
+}
+
+// optionChecks validates string options that take more than a choice.
+var optionChecks = map[string]func(string) error{
+	"window-active-style": vt.CheckPaneStyle,
+	"window-style":        vt.CheckPaneStyle,
+}
+
+// Options holds the current value of every option, stored as strings and
+// converted by the typed getters.
+type Options struct {
+	values map[string]string
+	mutex  sync.Mutex
+}
+
+func NewOptions() *Options {
+	values := make(map[string]string)
+	for name, def := range optionTable {
+		values[name] = def.def
+	}
+	return &Options{values: values}
+}
+
+// Set validates value against the option's type and stores it. Flags accept
+// on/off; an empty value toggles the flag.
+func (o *Options) Set(name, value string) error {
+	def, ok := optionTable[name]
+	if !ok {
+		return fmt.Errorf("invalid option: %s", name)
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	switch def.typ {
+	case optionNumber:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("value is not a number: %s", value)
+		}
+	case optionString:
+		if choices := optionChoices[name]; len(choices) > 0 && !slices.Contains(choices, value) {
+			return fmt.Errorf("bad value for %s: %s (expected %s)", name, value, strings.Join(choices, ", "))
+		}
+		if check := optionChecks[name]; check != nil {
+			if err := check(value); err != nil {
+				return fmt.Errorf("bad value for %s: %w", name, err)
+			}
+		}
+	case optionFlag:
+		switch value {
+		case "on", "off":
+		case "":
+			if o.values[name] == "on" {
+				value = "off"
+			} else {
+				value = "on"
+			}
+		default:
+			return fmt.Errorf("bad value for %s: %s (expected on or off)", name, value)
+		}
+	}
+	o.values[name] = value
+	return nil
+}
+
+func (o *Options) String(name string) string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.values[name]
+}
+
+func (o *Options) Number(name string) int {
+	n, _ := strconv.Atoi(o.String(name))
+	return n
+}
+
+func (o *Options) Flag(name string) bool {
+	return o.String(name) == "on"
+}
+
+// Values returns a copy of all option values, as sent to clients.
+func (o *Options) Values() map[string]string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	values := make(map[string]string, len(o.values))
+	for name, value := range o.values {
+		values[name] = value
+	}
+	return values
+}
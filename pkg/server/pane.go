@@ -0,0 +1,424 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/creack/pty"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+const defaultShell = "/bin/zsh"
+
+type Pane struct {
+	ptmx   *os.File
+	output chan []byte
+	id     int
+	pid    int // the shell
+
+	// Bytes sent on output and not yet taken by NextOutput. Past
+	// outputLimit more is dropped, and truncated, used by the reader only,
+	// says the next output is to be marked with truncatedMarker
+	queued      atomic.Int64
+	outputLimit func() int
+	truncated   bool
+
+	// What the pane was started with, which respawn-window runs again
+	command []string
+	dir     string
+
+	csi         vt.CSIScanner
+	osc         vt.OSCScanner
+	focusEvents atomic.Bool // the application enabled focus reporting (mode 1004)
+	bracketed   atomic.Bool // the application enabled bracketed paste (mode 2004)
+
+	// Extended key encoding requested by the application; onKeysChange is
+	// called from the reader goroutine whenever it changes
+	keys          protocol.KeyEncoding
+	keyboardStack []int
+	keysMutex     sync.Mutex
+	onKeysChange  func(protocol.KeyEncoding)
+
+	// Shell integration: when the running command started (OSC 133;C) and
+	// how the last one ended (OSC 133;D). onCommandDone is called from the
+	// reader goroutine.
+	commandStart  time.Time
+	lastStatus    int
+	lastDuration  time.Duration
+	commandMutex  sync.Mutex
+	onCommandDone func(status int, duration time.Duration)
+
+	// Title set by the application with OSC 0 or OSC 2
+	title      string
+	titleMutex sync.Mutex
+
+	// What runs in the foreground, as of the last checkForeground
+	foreground atomic.Pointer[ProcessInfo]
+
+	// Output watches from watch-pane, matched against lines by the
+	// session's output goroutine
+	lines        vt.LineScanner
+	triggers     []*Trigger
+	triggerMutex sync.Mutex
+
+	// Where toggle-logging copies output, written by the output goroutine
+	log      *paneLog
+	logMutex sync.Mutex
+
+	// Sessions, one per group, whose clients are sent the pane's output:
+	// those its window is linked into, set by showIn (links.go)
+	shownIn atomic.Pointer[[]*Session]
+
+	// Recent output sent to clients as they attach, see replay.go, and
+	// the screen it all leaves, which dump-screen and share-pane read
+	// (dump.go). Both are kept by the session's output goroutine. With
+	// history-file on the screen's history goes to historyPath, where
+	// the replay follows on from line replayTop (historyfile.go).
+	replay       []byte // newest output, after replayBlocks
+	replayMarks  []replayMark
+	replayBlocks []replayBlock
+	replayTop    int
+	screen       *vt.PaneBuffer
+	historyPath  string
+	replayMutex  sync.Mutex
+
+	// Output held by toggle-freeze; the reader waits on thawed once
+	// freezeLimit bytes are held
+	frozen      bool
+	held        []byte
+	freezeLimit int
+	freezeMutex sync.Mutex
+	thawed      *sync.Cond
+}
+
+// nextPaneID numbers panes across all sessions, so clients, history files
+// and TERM_MUX never see two panes with the same id.
+var nextPaneID atomic.Int64
+
+// paneArgs returns the arguments a pane runs for command. With no command
+// that is default-command, or else the shell, as a login shell under
+// login-shell. A single word is run by the shell so it may hold a command
+// line; more are run directly.
+func paneArgs(opts *Options, command []string) []string {
+	shell := opts.String("default-shell")
+	if len(command) == 0 {
+		if line := opts.String("default-command"); line != "" {
+			command = []string{line}
+		}
+	}
+	switch len(command) {
+	case 0:
+		if opts.Flag("login-shell") {
+			return []string{shell, "-l"}
+		}
+		return []string{shell}
+	case 1:
+		return []string{shell, "-c", command[0]}
+	}
+	return command
+}
+
+// NewPane starts args in a new pane, in dir. ws is the initial size, if
+// known.
+func NewPane(env []string, args []string, dir string, ws *pty.Winsize) (*Pane, error) {
+	id := int(nextPaneID.Add(1) - 1)
+	cmd := exec.Command(args[0], args[1:]...)
+	// Set environment for proper terminal support
+	// TERM_MUX lets programs (and nested clients) know they run inside a pane
+	cmd.Env = append(env, "TERM=xterm-256color",
+		fmt.Sprintf("TERM_MUX=%s,%d,%d", socketPath, os.Getpid(), id))
+	cmd.Dir = dir // "" for the daemon's own
+	ptmx, err := pty.StartWithSize(cmd, ws)
+	if err != nil {
+		return nil, fmt.Errorf("error starting pty: %w", err)
+	}
+
+	rows, cols, _ := pty.Getsize(ptmx)
+	if rows < 1 || cols < 1 {
+		rows, cols = 24, 80
+	}
+	p := &Pane{
+		ptmx:   ptmx,
+		output: make(chan []byte, 1024),
+		id:     id,
+		pid:    cmd.Process.Pid,
+		keys:   protocol.KeyEncoding{PaneID: id},
+		screen: vt.NewPaneBuffer(cols, rows),
+	}
+	p.thawed = sync.NewCond(&p.freezeMutex)
+	return p, nil
+}
+
+// Resize sets the size of the pane's PTY and of its screen in the daemon.
+func (p *Pane) Resize(ws *pty.Winsize) {
+	pty.Setsize(p.ptmx, ws)
+	if ws.Rows < 1 || ws.Cols < 1 {
+		return
+	}
+	p.replayMutex.Lock()
+	p.screen.Resize(int(ws.Cols), int(ws.Rows))
+	p.replayMutex.Unlock()
+}
+
+// Start reads the pane's output until its PTY closes. A panic reading it is
+// reported with errorf and closes the pane.
+func (p *Pane) Start(errorf func(format string, args ...any)) {
+	go func() {
+		defer func() {
+			p.Thaw()
+			close(p.output)
+		}()
+		defer recoverPanic(errorf, fmt.Sprintf("pane %d", p.id), func() { p.ptmx.Close() })
+		buf := make([]byte, 4096)
+		for {
+			n, err := p.ptmx.Read(buf)
+			if err != nil {
+				return
+			}
+			p.csi.Scan(buf[:n], p.handleCSI)
+			p.osc.Scan(buf[:n], p.handleOSC)
+			// buf is read into again while this is still queued
+			p.emit(append([]byte(nil), buf[:n]...))
+		}
+	}()
+}
+
+// outputFrame is the least time between two output messages for a pane
+// while it is printing faster than that; maxOutputMessage bounds how much
+// output one message gathers.
+const (
+	outputFrame      = 16 * time.Millisecond
+	maxOutputMessage = 1 << 20
+)
+
+// truncatedMarker takes the place of output dropped by queue. CAN ends an
+// escape sequence cut short by the drop.
+const truncatedMarker = "\x18\x1b[m\r\n[output truncated]\r\n"
+
+// queue passes output read from the PTY to the session's output goroutine.
+// While more than outputLimit bytes wait there, because the pane prints
+// faster than its clients take it, the output is dropped instead, and
+// truncatedMarker goes before the next that fits, so one runaway pane can't
+// take up the daemon's memory. Called by the reader only.
+func (p *Pane) queue(data []byte) {
+	queued := int(p.queued.Load())
+	if limit := p.outputLimit(); limit > 0 && queued > 0 && queued+len(data) > limit {
+		p.truncated = true
+		return
+	}
+	if p.truncated {
+		p.truncated = false
+		data = append([]byte(truncatedMarker), data...)
+	}
+	p.queued.Add(int64(len(data)))
+	p.output <- data
+}
+
+// NextOutput waits for output and gathers whatever else arrives before a
+// frame has passed since the previous message was sent at last, so a flood
+// of output goes to clients as a few large messages rather than thousands of
+// small ones. Output after a quiet spell is returned straight away. ok is
+// false once the pane has exited.
+func (p *Pane) NextOutput(last time.Time) (out []byte, ok bool) {
+	out, ok = <-p.output
+	if !ok {
+		return nil, false
+	}
+	p.queued.Add(-int64(len(out)))
+	timer := time.NewTimer(time.Until(last.Add(outputFrame)))
+	defer timer.Stop()
+	for len(out) < maxOutputMessage {
+		select {
+		case more, open := <-p.output:
+			if !open {
+				return out, true // the close is seen on the next call
+			}
+			p.queued.Add(-int64(len(more)))
+			out = append(out, more...)
+		case <-timer.C:
+			return out, true
+		}
+	}
+	return out, true
+}
+
+// handleCSI follows the modes and key encoding requests in the pane's
+// output that the daemon acts on.
+func (p *Pane) handleCSI(marker byte, params []int, final byte) {
+	switch {
+	case marker == '?' && (final == 'h' || final == 'l'):
+		for _, mode := range params {
+			switch mode {
+			case 1004:
+				p.focusEvents.Store(final == 'h')
+			case 2004:
+				p.bracketed.Store(final == 'h')
+			}
+		}
+	case marker == '>' && final == 'm' && len(params) > 0 && params[0] == 4:
+		level := 0
+		if len(params) > 1 {
+			level = params[1]
+		}
+		p.updateKeys(func(k *protocol.KeyEncoding) { k.ModifyOtherKeys = level })
+	case marker == '>' && final == 'u': // push keyboard flags
+		flags := 0
+		if len(params) > 0 {
+			flags = params[0]
+		}
+		p.updateKeys(func(k *protocol.KeyEncoding) {
+			p.keyboardStack = append(p.keyboardStack, k.KeyboardFlags)
+			k.KeyboardFlags = flags
+		})
+	case marker == '<' && final == 'u': // pop keyboard flags
+		count := 1
+		if len(params) > 0 && params[0] > 0 {
+			count = params[0]
+		}
+		p.updateKeys(func(k *protocol.KeyEncoding) {
+			for ; count > 0 && len(p.keyboardStack) > 0; count-- {
+				k.KeyboardFlags = p.keyboardStack[len(p.keyboardStack)-1]
+				p.keyboardStack = p.keyboardStack[:len(p.keyboardStack)-1]
+			}
+			if count > 0 {
+				k.KeyboardFlags = 0
+			}
+		})
+	case marker == '=' && final == 'u': // set keyboard flags
+		flags, mode := 0, 1
+		if len(params) > 0 {
+			flags = params[0]
+		}
+		if len(params) > 1 {
+			mode = params[1]
+		}
+		p.updateKeys(func(k *protocol.KeyEncoding) {
+			switch mode {
+			case 1:
+				k.KeyboardFlags = flags
+			case 2:
+				k.KeyboardFlags |= flags
+			case 3:
+				k.KeyboardFlags &^= flags
+			}
+		})
+	case marker == '?' && final == 'u' && len(params) == 0: // query keyboard flags
+		p.keysMutex.Lock()
+		flags := p.keys.KeyboardFlags
+		p.keysMutex.Unlock()
+		fmt.Fprintf(p.ptmx, "\x1b[?%du", flags)
+	}
+}
+
+// handleOSC times commands from the shell integration marks around them.
+func (p *Pane) handleOSC(payload []byte) {
+	if cmd, title, ok := strings.Cut(string(payload), ";"); ok && (cmd == "0" || cmd == "2") {
+		p.titleMutex.Lock()
+		p.title = title
+		p.titleMutex.Unlock()
+		return
+	}
+	mark, ok := strings.CutPrefix(string(payload), "133;")
+	if !ok || mark == "" {
+		return
+	}
+	p.commandMutex.Lock()
+	switch mark[0] {
+	case 'C':
+		p.commandStart = time.Now()
+	case 'D':
+		if p.commandStart.IsZero() {
+			break // a prompt with no command run
+		}
+		status := 0
+		if params := strings.Split(mark, ";"); len(params) > 1 {
+			status, _ = strconv.Atoi(params[1])
+		}
+		p.lastStatus, p.lastDuration = status, time.Since(p.commandStart)
+		p.commandStart = time.Time{}
+		done, duration := p.onCommandDone, p.lastDuration
+		p.commandMutex.Unlock()
+		if done != nil {
+			done(status, duration)
+		}
+		return
+	}
+	p.commandMutex.Unlock()
+}
+
+// Title returns the title the application last set.
+func (p *Pane) Title() string {
+	p.titleMutex.Lock()
+	defer p.titleMutex.Unlock()
+	return p.title
+}
+
+// SetTitle sets the pane's title, until the application sets its own.
+func (p *Pane) SetTitle(title string) {
+	p.titleMutex.Lock()
+	p.title = title
+	p.titleMutex.Unlock()
+}
+
+// LastCommand returns the exit status and duration of the last command the
+// shell reported finishing.
+func (p *Pane) LastCommand() (status int, duration time.Duration) {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+	return p.lastStatus, p.lastDuration
+}
+
+func (p *Pane) updateKeys(fn func(*protocol.KeyEncoding)) {
+	p.keysMutex.Lock()
+	old := p.keys
+	fn(&p.keys)
+	keys := p.keys
+	p.keysMutex.Unlock()
+	if keys != old && p.onKeysChange != nil {
+		p.onKeysChange(keys)
+	}
+}
+
+// KeyEncoding returns the key encoding the application asked for.
+func (p *Pane) KeyEncoding() protocol.KeyEncoding {
+	p.keysMutex.Lock()
+	defer p.keysMutex.Unlock()
+	return p.keys
+}
+
+// SendFocus reports focus in or out to the application if it asked for focus
+// events.
+func (p *Pane) SendFocus(focused bool) {
+	if !p.focusEvents.Load() {
+		return
+	}
+	if focused {
+		p.ptmx.Write([]byte("\x1b[I"))
+	} else {
+		p.ptmx.Write([]byte("\x1b[O"))
+	}
+}
+
+// Paste writes text to the application as if typed, wrapped in bracketed
+// paste markers if it asked for them. Line feeds become carriage returns,
+// as a terminal sends for Enter.
+func (p *Pane) Paste(text string) {
+	data := strings.ReplaceAll(text, "\n", "\r")
+	if p.bracketed.Load() {
+		data = "\x1b[200~" + data + "\x1b[201~"
+	}
+	p.ptmx.Write([]byte(data))
+}
+
+func (p *Pane) Close() {
+	p.Thaw() // the reader may be waiting
+	p.ptmx.Close()
+}
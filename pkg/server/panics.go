@@ -0,0 +1,27 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// recoverPanic, deferred first thing in a goroutine serving one client
+// connection or pane, stops a panic there from ending the daemon and every
+// pane with it. It reports the panic with errorf, prints the stack to the
+// daemon's output and runs teardown, which closes what the goroutine
+// served; the goroutine's own deferred calls, such as unlocking, have run
+// by then. Other sessions, clients and panes carry on.
+func recoverPanic(errorf func(format string, args ...any), what string, teardown func()) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	errorf("Panic in %s, closed it: %v", what, r)
+	if logLevel != "none" {
+		fmt.Fprintf(os.Stdout, "%s", debug.Stack())
+	}
+	if teardown != nil {
+		teardown()
+	}
+}
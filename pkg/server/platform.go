@@ -0,0 +1,39 @@
+package server
+
+// What the daemon needs from the operating system beyond the standard
+// library lives in build-constrained files, so a new platform means new
+// files rather than changes all over:
+//
+//	platform_unix.go   every Unix: the socket and a terminal's foreground
+//	                   process group
+//	platform_linux.go  Linux: /proc for working directories and
+//	                   SO_PEERCRED for who is on the other end of the socket
+//	platform_other.go  the other Unixes (macOS, the BSDs): lsof for working
+//	                   directories and no peer credentials
+//
+// Each of them defines the same functions, documented here once:
+//
+//	AbstractSockets bool
+//	sttyDevice string
+//	listenSocket(path string) (net.Listener, error)
+//	foregroundProcessGroup(tty *os.File) int
+//	processCwd(pid int) string
+//	peerUID(conn net.Conn) (uid int, ok bool)
+//
+// The client's platform files do the same for dialing the socket, signals
+// and starting the daemon in a session of its own, and vt's for file
+// locks. Window sizes travel as pty.Winsize, which creack/pty defines for
+// every platform it supports.
+
+import (
+	"net"
+	"os"
+)
+
+// allowedPeer reports whether a connection to the daemon comes from its
+// own user or root. Where the platform can't tell, the socket's
+// permissions are all there is and the connection is let in.
+func allowedPeer(conn net.Conn) bool {
+	uid, ok := peerUID(conn)
+	return !ok || uid == 0 || uid == os.Getuid()
+}
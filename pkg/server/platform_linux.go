@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// AbstractSockets is whether --socket @name can name a socket in the
+// abstract namespace, one with no file, reachable from containers sharing
+// the host's network namespace without sharing its /tmp. Anyone who can
+// reach it can connect, so peerUID does the checking.
+const AbstractSockets = true
+
+// sttyDevice is the flag giving stty a device other than its input.
+const sttyDevice = "-F"
+
+// processCwd returns the working directory of a process, where /proc says.
+func processCwd(pid int) string {
+	cwd, _ := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	return cwd
+}
+
+// peerUID returns the user of the process at the other end of a unix
+// socket connection, from SO_PEERCRED.
+func peerUID(conn net.Conn) (int, bool) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var cred *syscall.Ucred
+	raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return 0, false
+	}
+	return int(cred.Uid), true
+}
@@ -0,0 +1,38 @@
+//go:build unix && !linux
+
+package server
+
+import (
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// AbstractSockets is false: only Linux has the abstract namespace.
+const AbstractSockets = false
+
+// sttyDevice is the flag giving stty a device other than its input.
+const sttyDevice = "-f"
+
+// processCwd returns the working directory of a process as lsof reports
+// it, there being no /proc to read it from.
+func processCwd(pid int) string {
+	out, err := exec.Command("lsof", "-a", "-p", strconv.Itoa(pid), "-d", "cwd", "-Fn").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if name, ok := strings.CutPrefix(line, "n"); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// peerUID can't tell who is at the other end of a connection here without
+// going beyond the syscall package, so leaves it to the socket's
+// permissions.
+func peerUID(conn net.Conn) (int, bool) {
+	return 0, false
+}
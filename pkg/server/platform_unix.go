@@ -0,0 +1,41 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// listenSocket listens on a unix socket at path, replacing whatever is
+// there, readable and writable only by its owner. A path starting with @
+// is a name in the abstract namespace instead (see AbstractSockets), with
+// no file to replace or permissions to set, and goes away with the daemon.
+func listenSocket(path string) (net.Listener, error) {
+	if strings.HasPrefix(path, "@") {
+		return net.Listen("unix", path) // the net package turns @ into the leading NUL
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// foregroundProcessGroup returns the process group in the foreground of
+// the terminal whose master side is tty, or 0 if it can't be found.
+func foregroundProcessGroup(tty *os.File) int {
+	var pgrp int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp))); errno != 0 {
+		return 0
+	}
+	return int(pgrp)
+}
@@ -0,0 +1,522 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"term/pkg/protocol"
+)
+
+// Plugins are programs the daemon runs, talking to them with one JSON
+// object per line on the plugin's stdin and stdout. Each message has a
+// type:
+//
+//	daemon to plugin:
+//	  init     {version, name}: sent first
+//	  event    {event, fields}: an event the plugin registered for, as with term.on
+//	  command  {id, name, args, session}: run a command the plugin registered
+//	  result   {id, output, error}: the result of a run
+//	  shutdown {}: stdin closes next; the plugin is killed after pluginGrace
+//	plugin to daemon:
+//	  register {commands: {name: summary}, events: [...]}: may be sent again
+//	  result   {id, output, error}: the result of a command
+//	  run      {id, args, session}: run a command, in the main session by default
+//	  status   {segment, text}: set #{plugin_<segment>} for status-right
+//	  log      {text}: add to show-messages
+//
+// Version is pluginVersion and changes only when existing messages change.
+//
+// This is not the socket protocol clients and the command line speak
+// (pkg/protocol): that one has no way for the daemon to call into the
+// other side, as command, event and shutdown do here, and its binary
+// framing would keep plugins from being a few lines of shell and jq. A
+// plugin is also its own process's child, so its stdin and stdout are the
+// connection and its exit is the disconnect.
+const pluginVersion = 1
+
+// pluginGrace is how long a plugin has to exit after shutdown, and to
+// answer a command.
+const pluginGrace = 5 * time.Second
+
+// pluginQueue is how many messages a plugin may fall behind by in reading
+// its stdin before it is killed.
+const pluginQueue = 1024
+
+type pluginMessage struct {
+	Type     string            `json:"type"`
+	Version  int               `json:"version,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	ID       int               `json:"id,omitempty"`
+	Args     []string          `json:"args,omitempty"`
+	Session  string            `json:"session,omitempty"`
+	Event    string            `json:"event,omitempty"`
+	Fields   map[string]any    `json:"fields,omitempty"`
+	Commands map[string]string `json:"commands,omitempty"`
+	Events   []string          `json:"events,omitempty"`
+	Segment  string            `json:"segment,omitempty"`
+	Text     string            `json:"text,omitempty"`
+	Output   string            `json:"output,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Plugin is a running plugin process. Messages to it are queued for a
+// writer goroutine, so a plugin that stops reading holds up only itself.
+type Plugin struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	errorf func(format string, args ...any)
+
+	queue    chan []byte       // nil once the plugin is stopping or gone
+	commands map[string]string // name to summary
+	events   map[string]bool
+	segments map[string]string
+	pending  map[int]chan pluginMessage // commands waiting for a result
+	nextID   int
+	exited   chan struct{}
+	mutex    sync.Mutex
+}
+
+// Plugins runs the enabled plugins of the daemon.
+type Plugins struct {
+	daemon  *Daemon
+	running map[string]*Plugin
+	mutex   sync.Mutex
+}
+
+func NewPlugins(d *Daemon) *Plugins {
+	return &Plugins{daemon: d, running: make(map[string]*Plugin)}
+}
+
+// PluginDir is where plugins are installed, each in a directory of its own
+// holding an executable named plugin, with the names of the enabled ones in
+// the file enabled.
+func PluginDir() string {
+	if dir := protocol.DataDir(); dir != "" {
+		return filepath.Join(dir, "plugins")
+	}
+	return ""
+}
+
+// EnabledPlugins reads the names of the enabled plugins.
+func EnabledPlugins() []string {
+	data, err := os.ReadFile(filepath.Join(PluginDir(), "enabled"))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// Sync starts the enabled plugins that are not running and stops the
+// running ones that are no longer enabled.
+func (ps *Plugins) Sync() {
+	enabled := EnabledPlugins()
+	ps.mutex.Lock()
+	var stop []*Plugin
+	for name, p := range ps.running {
+		if !slices.Contains(enabled, name) {
+			stop = append(stop, p)
+			delete(ps.running, name)
+		}
+	}
+	ps.mutex.Unlock()
+	for _, p := range stop {
+		p.stop()
+	}
+
+	for _, name := range enabled {
+		ps.mutex.Lock()
+		_, ok := ps.running[name]
+		ps.mutex.Unlock()
+		if ok {
+			continue
+		}
+		if err := ps.start(name); err != nil {
+			ps.daemon.errorf("Plugin %s: %v", name, err)
+		}
+	}
+}
+
+// start runs a plugin and reads its messages until it exits.
+func (ps *Plugins) start(name string) error {
+	dir := filepath.Join(PluginDir(), name)
+	cmd := exec.Command(filepath.Join(dir, "plugin"))
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr // the daemon's output
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p := &Plugin{
+		name:     name,
+		cmd:      cmd,
+		stdin:    stdin,
+		errorf:   ps.daemon.errorf,
+		queue:    make(chan []byte, pluginQueue),
+		commands: make(map[string]string),
+		events:   make(map[string]bool),
+		segments: make(map[string]string),
+		pending:  make(map[int]chan pluginMessage),
+		exited:   make(chan struct{}),
+	}
+	ps.mutex.Lock()
+	ps.running[name] = p
+	ps.mutex.Unlock()
+	go p.write(p.queue)
+	p.send(pluginMessage{Type: "init", Version: pluginVersion, Name: name})
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var msg pluginMessage
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				ps.daemon.errorf("Plugin %s: bad message: %v", name, err)
+				continue
+			}
+			ps.handle(p, msg)
+		}
+		err := cmd.Wait()
+		p.closeQueue()
+		close(p.exited)
+		ps.mutex.Lock()
+		if ps.running[name] == p {
+			delete(ps.running, name)
+		}
+		ps.mutex.Unlock()
+		p.mutex.Lock()
+		for id, ch := range p.pending {
+			close(ch)
+			delete(p.pending, id)
+		}
+		p.mutex.Unlock()
+		ps.daemon.logf("Plugin %s exited: %v", name, err)
+	}()
+	return nil
+}
+
+// handle acts on a message from a plugin.
+func (ps *Plugins) handle(p *Plugin, msg pluginMessage) {
+	switch msg.Type {
+	case "register":
+		p.mutex.Lock()
+		for command, summary := range msg.Commands {
+			if _, ok := commandTable[command]; ok {
+				ps.daemon.errorf("Plugin %s: %s is a built-in command", p.name, command)
+				continue
+			}
+			p.commands[command] = summary
+		}
+		for _, event := range msg.Events {
+			if hookEvents[event] {
+				p.events[event] = true
+			}
+		}
+		p.mutex.Unlock()
+	case "result":
+		p.mutex.Lock()
+		ch, ok := p.pending[msg.ID]
+		delete(p.pending, msg.ID)
+		p.mutex.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case "run":
+		go func() {
+			defer recoverPanic(ps.daemon.errorf, "plugin "+p.name+" command", nil)
+			ctx := &CommandContext{daemon: ps.daemon, session: ps.daemon.mainSession}
+			if msg.Session != "" {
+				ctx.session = ps.daemon.FindSession(msg.Session)
+			}
+			reply := pluginMessage{Type: "result", ID: msg.ID}
+			if ctx.session == nil {
+				reply.Error = "no such session: " + msg.Session
+			} else if output, err := ctx.RunCommand(msg.Args); err != nil {
+				reply.Output, reply.Error = output, err.Error()
+			} else {
+				reply.Output = output
+			}
+			p.send(reply)
+		}()
+	case "status":
+		p.mutex.Lock()
+		p.segments[msg.Segment] = msg.Text
+		p.mutex.Unlock()
+	case "log":
+		ps.daemon.logf("Plugin %s: %s", p.name, msg.Text)
+	default:
+		ps.daemon.errorf("Plugin %s: unknown message type %q", p.name, msg.Type)
+	}
+}
+
+// send queues a message for the plugin. One too far behind is killed
+// rather than holding up the daemon.
+func (p *Plugin) send(msg pluginMessage) {
+	data, _ := json.Marshal(msg)
+	p.mutex.Lock()
+	if p.queue == nil {
+		p.mutex.Unlock()
+		return
+	}
+	select {
+	case p.queue <- append(data, '\n'):
+		p.mutex.Unlock()
+		return
+	default:
+	}
+	close(p.queue)
+	p.queue = nil
+	p.mutex.Unlock()
+	p.errorf("Plugin %s fell behind reading messages; killing it", p.name)
+	p.cmd.Process.Kill()
+}
+
+// write writes the queued messages to the plugin's stdin, closing it once
+// the queue is closed. Those after a failed write are thrown away.
+func (p *Plugin) write(queue chan []byte) {
+	var err error
+	for data := range queue {
+		if err == nil {
+			_, err = p.stdin.Write(data)
+		}
+	}
+	p.stdin.Close()
+}
+
+// closeQueue stops queueing messages, closing the plugin's stdin once
+// those queued are written.
+func (p *Plugin) closeQueue() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.queue != nil {
+		close(p.queue)
+		p.queue = nil
+	}
+}
+
+// stop asks the plugin to exit, killing it if it has not after
+// pluginGrace.
+func (p *Plugin) stop() {
+	p.send(pluginMessage{Type: "shutdown"})
+	p.closeQueue()
+	go func() {
+		select {
+		case <-p.exited:
+		case <-time.After(pluginGrace):
+			p.cmd.Process.Kill()
+		}
+	}()
+}
+
+// Close stops every plugin, when the daemon exits.
+func (ps *Plugins) Close() {
+	ps.mutex.Lock()
+	running := ps.running
+	ps.running = make(map[string]*Plugin)
+	ps.mutex.Unlock()
+	for _, p := range running {
+		p.stop()
+	}
+}
+
+func (ps *Plugins) plugins() []*Plugin {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return slices.Collect(maps.Values(ps.running))
+}
+
+// Fire sends event to the plugins that registered for it.
+func (ps *Plugins) Fire(event string, fields map[string]any) {
+	for _, p := range ps.plugins() {
+		p.mutex.Lock()
+		wanted := p.events[event]
+		p.mutex.Unlock()
+		if wanted {
+			p.send(pluginMessage{Type: "event", Event: event, Fields: fields})
+		}
+	}
+}
+
+// Run runs the command name if a plugin registered it, waiting up to
+// pluginGrace for the result.
+func (ps *Plugins) Run(ctx *CommandContext, name string, args []string) (string, bool, error) {
+	for _, p := range ps.plugins() {
+		p.mutex.Lock()
+		_, ok := p.commands[name]
+		if !ok {
+			p.mutex.Unlock()
+			continue
+		}
+		p.nextID++
+		id := p.nextID
+		ch := make(chan pluginMessage, 1)
+		p.pending[id] = ch
+		p.mutex.Unlock()
+
+		p.send(pluginMessage{Type: "command", ID: id, Name: name, Args: args, Session: ctx.session.Name()})
+		select {
+		case reply, ok := <-ch:
+			if !ok {
+				return "", true, fmt.Errorf("plugin %s exited", p.name)
+			}
+			if reply.Error != "" {
+				return reply.Output, true, fmt.Errorf("%s", reply.Error)
+			}
+			return reply.Output, true, nil
+		case <-time.After(pluginGrace):
+			p.mutex.Lock()
+			delete(p.pending, id)
+			p.mutex.Unlock()
+			return "", true, fmt.Errorf("plugin %s did not answer", p.name)
+		}
+	}
+	return "", false, nil
+}
+
+// Segments returns the status segments of every plugin as #{} variables.
+func (ps *Plugins) Segments() map[string]string {
+	vars := make(map[string]string)
+	for _, p := range ps.plugins() {
+		p.mutex.Lock()
+		for segment, text := range p.segments {
+			vars["plugin_"+segment] = text
+		}
+		p.mutex.Unlock()
+	}
+	return vars
+}
+
+// fire tells scripts, plugins and subscribers about an event in the
+// session.
+func (s *Session) fire(event string, fields map[string]any) {
+	s.scripts.Fire(s, event, fields)
+	s.plugins.Fire(event, fields)
+	s.subscribers.Send(event, fields)
+}
+
+// cmdListPlugins implements list-plugins, listing the running plugins with
+// their commands and the events they watch.
+func cmdListPlugins(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: list-plugins")
+	}
+	plugins := ctx.daemon.plugins.plugins()
+	slices.SortFunc(plugins, func(a, b *Plugin) int { return strings.Compare(a.name, b.name) })
+	var b strings.Builder
+	for _, p := range plugins {
+		p.mutex.Lock()
+		fmt.Fprintf(&b, "%s: pid %d", p.name, p.cmd.Process.Pid)
+		if len(p.events) > 0 {
+			fmt.Fprintf(&b, ", events %s", strings.Join(slices.Sorted(maps.Keys(p.events)), " "))
+		}
+		b.WriteString("\n")
+		for _, name := range slices.Sorted(maps.Keys(p.commands)) {
+			fmt.Fprintf(&b, "  %-20s %s\n", name, p.commands[name])
+		}
+		p.mutex.Unlock()
+	}
+	return b.String(), nil
+}
+
+// cmdReloadPlugins implements reload-plugins, starting and stopping
+// plugins to match the enabled list.
+func cmdReloadPlugins(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: reload-plugins")
+	}
+	ctx.daemon.plugins.Sync()
+	return "", nil
+}
+
+// checkPluginName refuses names that are not a directory of their own
+// in the plugin directory, such as "", ".." or "a/b".
+func checkPluginName(name string) error {
+	if name == "" || name == "enabled" || strings.ContainsAny(name, "/. ") {
+		return fmt.Errorf("bad plugin name: %q", name)
+	}
+	return nil
+}
+
+// InstallPlugin copies a plugin directory, or clones a git repository,
+// into the plugin directory as name.
+func InstallPlugin(source, name string) error {
+	if err := checkPluginName(name); err != nil {
+		return err
+	}
+	dest := filepath.Join(PluginDir(), name)
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("plugin %s is already installed", name)
+	}
+	if err := os.MkdirAll(PluginDir(), 0o755); err != nil {
+		return err
+	}
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		if err := os.CopyFS(dest, os.DirFS(source)); err != nil {
+			return err
+		}
+	} else {
+		cmd := exec.Command("git", "clone", "--depth", "1", "--", source, dest)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("git clone %s: %w", source, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dest, "plugin")); err != nil || info.Mode()&0o111 == 0 {
+		os.RemoveAll(dest)
+		return fmt.Errorf("%s has no executable named plugin", source)
+	}
+	return nil
+}
+
+// RemovePlugin disables a plugin and deletes its directory.
+func RemovePlugin(name string) error {
+	if err := checkPluginName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(PluginDir(), name)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("plugin %s is not installed", name)
+	}
+	if err := SetPluginEnabled(name, false); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// SetPluginEnabled adds a plugin to the enabled list or removes it.
+func SetPluginEnabled(name string, enable bool) error {
+	if err := checkPluginName(name); err != nil {
+		return err
+	}
+	if enable {
+		if _, err := os.Stat(filepath.Join(PluginDir(), name, "plugin")); err != nil {
+			return fmt.Errorf("plugin %s is not installed", name)
+		}
+	}
+	enabled := slices.DeleteFunc(EnabledPlugins(), func(n string) bool { return n == name })
+	if enable {
+		enabled = append(enabled, name)
+	}
+	data := strings.Join(enabled, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	return os.WriteFile(filepath.Join(PluginDir(), "enabled"), []byte(data), 0o644)
+}
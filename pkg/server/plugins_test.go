@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPluginSendFallenBehind(t *testing.T) {
+	// A plugin that never reads its stdin must not hold up whoever sends
+	// to it, such as an event fired under the session lock
+	cmd := exec.Command("sleep", "60")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var logged []string
+	p := &Plugin{
+		name:   "stuck",
+		cmd:    cmd,
+		stdin:  stdin,
+		errorf: func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) },
+		queue:  make(chan []byte, pluginQueue),
+	}
+	go p.write(p.queue)
+
+	done := make(chan struct{})
+	go func() {
+		fields := map[string]any{"data": strings.Repeat("x", 1024)}
+		for range 4 * pluginQueue {
+			p.send(pluginMessage{Type: "event", Event: "pane-output", Fields: fields})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send blocked on a plugin that doesn't read")
+	}
+	if err := cmd.Wait(); err == nil || len(logged) != 1 {
+		t.Errorf("plugin exited with %v after logging %q, want it killed once", err, logged)
+	}
+	p.send(pluginMessage{Type: "shutdown"}) // dropped, not a send on a closed queue
+}
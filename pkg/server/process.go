@@ -0,0 +1,344 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+
+	"term/pkg/protocol"
+)
+
+// ProcessInfo describes a process running in a pane.
+type ProcessInfo struct {
+	PID  int
+	Name string
+	Cwd  string // empty if it can't be found
+}
+
+// Foreground returns the process in the foreground of the pane's terminal
+// as of the last checkForeground, which watchProcesses calls each
+// processInterval, or the shell before the first.
+func (p *Pane) Foreground() ProcessInfo {
+	if fg := p.foreground.Load(); fg != nil {
+		return *fg
+	}
+	return ProcessInfo{PID: p.pid}
+}
+
+// checkForeground finds the process in the foreground of the pane's
+// terminal, or the shell if that can't be found, and keeps it for
+// Foreground. Finding its name and directory may run ps or lsof, so it is
+// never called with s.mutex held.
+func (p *Pane) checkForeground() ProcessInfo {
+	pid := p.pid
+	if pgrp := foregroundProcessGroup(p.ptmx); pgrp > 0 {
+		pid = pgrp // the group leader
+	}
+	fg := ProcessInfo{PID: pid, Name: processName(pid), Cwd: processCwd(pid)}
+	p.foreground.Store(&fg)
+	return fg
+}
+
+// paneSignals are the signals kill-pane -s takes, by name without SIG.
+var paneSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// parseSignal returns the signal called name, with or without SIG, or
+// numbered name.
+func parseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := paneSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal: %s", name)
+}
+
+// Signal sends sig to the process group of the pane's shell and to the one
+// in the foreground, as the shell doesn't pass signals on to its jobs.
+// Processes already gone are no error.
+func (p *Pane) Signal(sig syscall.Signal) error {
+	fg := foregroundProcessGroup(p.ptmx)
+	err := syscall.Kill(-p.pid, sig)
+	if fg > 0 && fg != p.pid {
+		if fgErr := syscall.Kill(-fg, sig); err == nil || err == syscall.ESRCH {
+			err = fgErr
+		}
+	}
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
+
+// processName returns the command name of a process, from /proc where there
+// is one and ps otherwise.
+func processName(pid int) string {
+	if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+		return strings.TrimSpace(string(comm))
+	}
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(strings.TrimSpace(string(out)))
+}
+
+// paneFormatVars returns the values of the #{} variables for a pane. The
+// caller must hold s.mutex.
+func (s *Session) paneFormatVars(w *Window, i int) map[string]string {
+	p := w.panes[i]
+	fg := p.Foreground()
+	rows, cols, _ := pty.Getsize(p.ptmx)
+	return map[string]string{
+		"session_name":         s.Name(),
+		"session_windows":      strconv.Itoa(len(s.windows)),
+		"window_id":            strconv.Itoa(w.id),
+		"window_index":         strconv.Itoa(w.index),
+		"window_name":          w.name,
+		"window_panes":         strconv.Itoa(len(w.panes)),
+		"pane_index":           strconv.Itoa(w.paneIndex(i, s.options)),
+		"pane_id":              strconv.Itoa(p.id),
+		"pane_pid":             strconv.Itoa(p.pid),
+		"pane_active":          formatBool(i == w.activePane),
+		"pane_width":           strconv.Itoa(cols),
+		"pane_height":          strconv.Itoa(rows),
+		"pane_current_command": fg.Name,
+		"pane_current_pid":     strconv.Itoa(fg.PID),
+		"pane_current_path":    fg.Cwd,
+		"pane_title":           p.Title(),
+	}
+}
+
+// formatBool is a true or false format variable, 1 or 0 as in tmux.
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// expandFormat replaces each #{name} in format with its value. Unknown
+// names expand to nothing.
+func expandFormat(format string, vars map[string]string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(format, "#{")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(format[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(format[:start])
+		b.WriteString(vars[format[start+2:start+end]])
+		format = format[start+end+1:]
+	}
+	b.WriteString(format)
+	return b.String()
+}
+
+// cmdDisplayMessage implements display-message [-p] [-t target-pane]
+// message, expanding the message's #{} variables for the pane and showing
+// it in the client's message line, or printing it with -p or from the CLI,
+// so scripts can ask for any of them:
+//
+//	term display -p '#{pane_current_path} #{pane_pid}' -t work:1.0
+//
+// An unknown variable expands to nothing, as in the status line.
+func cmdDisplayMessage(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "pt:")
+	if err == nil && len(args) > 1 {
+		// Flags may follow the message too, as in the example
+		message := args[0]
+		var after map[byte]string
+		after, args, err = protocol.ParseFlags(args[1:], "pt:")
+		maps.Copy(flags, after)
+		args = append([]string{message}, args...)
+	}
+	if err != nil || len(args) != 1 {
+		return "", fmt.Errorf("usage: display-message [-p] [-t target-pane] message")
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	s := t.session
+	s.mutex.Lock()
+	wi, pi := s.findPane(t.pane.id)
+	if wi < 0 {
+		s.mutex.Unlock()
+		return "", fmt.Errorf("can't find pane: %%%d", t.pane.id)
+	}
+	message := expandFormat(args[0], s.paneFormatVars(s.windows[wi], pi))
+	s.mutex.Unlock()
+
+	if _, ok := flags['p']; ok || ctx.client == nil {
+		return message + "\n", nil
+	}
+	ctx.client.showMessage("%s", message)
+	return "", nil
+}
+
+// processInterval is how often windows are renamed after their running
+// command and the status line checked for changes.
+const processInterval = time.Second
+
+// watchProcesses checks what runs in each pane, keeps window names
+// following the active pane's foreground command while automatic-rename
+// is on, and redraws the status line when it changes, such as when
+// status-right shows the current path. The same goes for the title under
+// set-titles. Panes are checked without s.mutex, which everything else
+// in the session waits on, as that may run ps.
+func (s *Session) watchProcesses() {
+	last, lastTitle := "", ""
+	ticker := time.NewTicker(processInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.removed:
+			return
+		case <-ticker.C:
+		}
+		s.mutex.Lock()
+		var panes []*Pane
+		for _, w := range s.windows {
+			panes = append(panes, w.panes...)
+		}
+		for _, f := range s.floats {
+			panes = append(panes, f.pane)
+		}
+		s.mutex.Unlock()
+		for _, p := range panes {
+			p.checkForeground()
+		}
+
+		s.mutex.Lock()
+		if s.options.Flag("automatic-rename") {
+			for _, w := range s.windows {
+				if p := w.ActivePane(); p != nil && !w.named {
+					if name := p.Foreground().Name; name != "" {
+						w.name = name
+					}
+				}
+			}
+		}
+		status, title := s.statusLine(), ""
+		if s.options.Flag("set-titles") {
+			title = s.title()
+		}
+		s.mutex.Unlock()
+		if status != last {
+			s.Broadcast(s.createRedrawMessage(status))
+			last = status
+		}
+		if title != lastTitle && title != "" {
+			s.Broadcast(protocol.Encode(protocol.MsgTitle, []byte(title)))
+			lastTitle = title
+		}
+	}
+}
+
+// PaneInfo describes a pane for list-panes --format json, with the names of
+// the matching #{} variables.
+type PaneInfo struct {
+	Session        string `json:"session_name"`
+	WindowIndex    int    `json:"window_index"`
+	WindowName     string `json:"window_name"`
+	Index          int    `json:"pane_index"`
+	ID             int    `json:"pane_id"`
+	PID            int    `json:"pane_pid"`
+	CurrentCommand string `json:"pane_current_command"`
+	CurrentPID     int    `json:"pane_current_pid"`
+	CurrentPath    string `json:"pane_current_path"`
+	Title          string `json:"pane_title"`
+	Active         bool   `json:"pane_active"`
+	Marked         bool   `json:"pane_marked"`
+}
+
+// cmdListPanes implements list-panes [-a | -t target-window] [--format
+// json], listing the panes of a window, or of every window, with what is
+// running in them.
+func cmdListPanes(ctx *CommandContext, args []string) (string, error) {
+	asJSON, args, err := formatFlag(args)
+	if err != nil {
+		return "", err
+	}
+	s, only := ctx.session, (*Window)(nil)
+	if len(args) != 1 || args[0] != "-a" {
+		spec, args, err := targetFlag(args)
+		if err != nil || len(args) != 0 {
+			return "", fmt.Errorf("usage: list-panes [-a | -t target-window] [--format json]")
+		}
+		t, err := ctx.resolveTarget(spec)
+		if err != nil {
+			return "", err
+		}
+		s, only = t.session, t.window
+	}
+	panes := s.ListPanes(only, ctx.daemon.MarkedPane())
+	if asJSON {
+		return jsonOutput(panes)
+	}
+	var b strings.Builder
+	for _, p := range panes {
+		if only == nil {
+			fmt.Fprintf(&b, "%d.", p.WindowIndex)
+		}
+		fmt.Fprintf(&b, "%d: %s (pid %d, shell %d) %s", p.Index, p.CurrentCommand, p.CurrentPID, p.PID, p.CurrentPath)
+		if p.Active {
+			b.WriteString(" (active)")
+		}
+		if p.Marked {
+			b.WriteString(" (marked)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// ListPanes describes the panes of window only, or of all windows when it
+// is nil, noting the pane with id marked.
+func (s *Session) ListPanes(only *Window, marked int) []PaneInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	panes := make([]PaneInfo, 0)
+	for wi, w := range s.windows {
+		if only != nil && w != only {
+			continue
+		}
+		for i, p := range w.panes {
+			fg := p.Foreground()
+			panes = append(panes, PaneInfo{
+				Session:        s.Name(),
+				WindowIndex:    w.index,
+				WindowName:     w.name,
+				Index:          w.paneIndex(i, s.options),
+				ID:             p.id,
+				PID:            p.pid,
+				CurrentCommand: fg.Name,
+				CurrentPID:     fg.PID,
+				CurrentPath:    fg.Cwd,
+				Title:          p.Title(),
+				Active:         wi == s.activeWindow && i == w.activePane,
+				Marked:         p.id == marked,
+			})
+		}
+	}
+	return panes
+}
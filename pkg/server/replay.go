@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+
+	"term/pkg/protocol"
+	"term/pkg/vt"
+)
+
+// sendOutput keeps output for replay and the pane's screen and sends it to
+// the clients of the sessions showing the pane and the rest of their
+// groups. Holding p.replayMutex across both means a client added by
+// AddClientReplaying sees each piece of output exactly once, either in its
+// replay or live.
+func (s *Session) sendOutput(p *Pane, output []byte) {
+	p.replayMutex.Lock()
+	defer p.replayMutex.Unlock()
+	p.keepOutput(output, s.options.Number("replay-limit")*1024)
+	p.broadcast(createDataMessage(p.id, output))
+}
+
+// replayBlockSize is how much output the replay keeps as it is; older
+// output is compressed in blocks of about this size.
+const replayBlockSize = 16 * 1024
+
+// replayMarkGap is about how far apart replay marks are in a long piece of
+// output, and so how close to replay-limit the replay is cut.
+const replayMarkGap = 4 * 1024
+
+// replayBlock is compressed replay output, starting and ending after a
+// line break.
+type replayBlock struct {
+	data  []byte // flate-compressed output
+	size  int    // bytes of output
+	lines int    // lines printed before its end, as in replayMark
+}
+
+// replayMark is a place in the replay just after a line break and how
+// many lines the pane had printed before it: those its screen had saved
+// to its history and those above the cursor, which a client starting on a
+// blank screen there never sees and loads from the history file instead.
+type replayMark struct {
+	end, lines int
+}
+
+// keepOutput writes output to the pane's screen and adds it to its replay,
+// dropping the oldest output beyond limit bytes. The replay starts at a
+// mark where possible, after a line break so it is not fed to clients from
+// the middle of an escape sequence, and with replayTop the history lines
+// saved before it, which clients load from the history file: the output
+// is written to the screen a piece at a time, ending at line breaks about
+// replayMarkGap bytes apart, to make a mark after each. Output before the
+// first mark past replayBlockSize is compressed, and the oldest blocks are
+// dropped whole. The caller must hold p.replayMutex.
+func (p *Pane) keepOutput(output []byte, limit int) {
+	if limit <= 0 {
+		p.writeScreen(output)
+		p.replay, p.replayMarks, p.replayBlocks, p.replayTop = nil, nil, nil, p.screen.LiveTop()
+		return
+	}
+	for len(output) > 0 {
+		piece := output
+		if i := bytes.IndexByte(output[min(replayMarkGap, len(output)):], '\n'); i >= 0 {
+			piece = output[:min(replayMarkGap, len(output))+i+1]
+		} else if i := bytes.LastIndexByte(output, '\n'); i >= 0 {
+			piece = output[:i+1]
+		}
+		output = output[len(piece):]
+		p.writeScreen(piece)
+		p.replay = append(p.replay, piece...)
+		if piece[len(piece)-1] == '\n' {
+			_, y := p.screen.GetCursor()
+			p.replayMarks = append(p.replayMarks, replayMark{end: len(p.replay), lines: p.screen.LiveTop() + y})
+		}
+	}
+
+	size := len(p.replay)
+	for _, b := range p.replayBlocks {
+		size += b.size
+	}
+	for len(p.replayBlocks) > 0 && size > limit {
+		size -= p.replayBlocks[0].size
+		p.replayTop = p.replayBlocks[0].lines
+		p.replayBlocks = p.replayBlocks[1:]
+	}
+	if size > limit {
+		p.replayTop = p.cutReplay(len(p.replay) - limit)
+	}
+	for {
+		i := slices.IndexFunc(p.replayMarks, func(m replayMark) bool { return m.end >= replayBlockSize })
+		if i < 0 {
+			break
+		}
+		m := p.replayMarks[i]
+		p.replayBlocks = append(p.replayBlocks, replayBlock{
+			data:  vt.Compress(p.replay[:m.end]),
+			size:  m.end,
+			lines: m.lines,
+		})
+		p.cutReplay(m.end)
+	}
+}
+
+// cutReplay drops at least the first cut bytes of the replay's
+// uncompressed output, up to the next mark, returning the lines printed
+// before what is left.
+func (p *Pane) cutReplay(cut int) (lines int) {
+	i := slices.IndexFunc(p.replayMarks, func(m replayMark) bool { return m.end >= cut })
+	if i >= 0 {
+		cut, lines = p.replayMarks[i].end, p.replayMarks[i].lines
+		i++
+	} else {
+		// No line break since: the start of a long line is lost, and
+		// with it any history line the file has of it
+		i, lines = len(p.replayMarks), p.screen.LiveTop()
+	}
+	p.replayMarks = slices.Delete(p.replayMarks, 0, i)
+	for i := range p.replayMarks {
+		p.replayMarks[i].end -= cut
+	}
+	p.replay = append([]byte(nil), p.replay[cut:]...)
+	return lines
+}
+
+// replayOutput returns the replay to send a client. The caller must hold
+// p.replayMutex.
+func (p *Pane) replayOutput() []byte {
+	var output []byte
+	for _, b := range p.replayBlocks {
+		data, _ := io.ReadAll(flate.NewReader(bytes.NewReader(b.data)))
+		output = append(output, data...)
+	}
+	return append(output, p.replay...)
+}
+
+// writeScreen writes output to the pane's screen, dropping what only an
+// outer terminal could use.
+func (p *Pane) writeScreen(output []byte) {
+	if len(output) == 0 {
+		return
+	}
+	p.screen.Write(output)
+	p.screen.TakePassthrough()
+	p.screen.TakeImages()
+}
+
+// AddClientReplaying adds a client to the session after sending it the
+// recent output of every pane, so what happened before it attached is on
+// its screens and in their history.
+func (s *Session) AddClientReplaying(conn net.Conn) {
+	s.mutex.Lock()
+	var panes []*Pane
+	for _, w := range s.windows {
+		panes = append(panes, w.panes...)
+	}
+	for _, f := range s.floats {
+		panes = append(panes, f.pane)
+	}
+	s.mutex.Unlock()
+
+	for _, p := range panes {
+		p.replayMutex.Lock()
+		defer p.replayMutex.Unlock()
+		if output := p.replayOutput(); len(output) > 0 {
+			conn.Write(createDataMessage(p.id, output))
+		}
+	}
+	s.AddClient(conn)
+}
+
+// createDataMessage frames a pane's output with its id as a 4-byte prefix.
+func createDataMessage(paneID int, output []byte) []byte {
+	payload := make([]byte, 4+len(output))
+	binary.BigEndian.PutUint32(payload[:4], uint32(paneID))
+	copy(payload[4:], output)
+	return protocol.Encode(protocol.MsgData, payload)
+}
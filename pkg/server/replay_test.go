@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"term/pkg/vt"
+)
+
+func TestKeepOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		writes []int // lines per write
+	}{
+		{"under the limit", 64 * 1024, []int{10, 10}},
+		{"small limit, many writes", 4 * 1024, []int{100, 1, 300, 7, 2000}},
+		{"one large write", 64 * 1024, []int{30000}},
+		{"blocks", 64 * 1024, []int{3000, 3000, 3000, 3000, 3000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pane{screen: vt.NewPaneBuffer(80, 24)}
+			var all bytes.Buffer
+			next := 0
+			for _, n := range tt.writes {
+				var output strings.Builder
+				for range n {
+					fmt.Fprintf(&output, "%d\r\n", next)
+					next++
+				}
+				all.WriteString(output.String())
+				p.keepOutput([]byte(output.String()), tt.limit)
+			}
+			if all.Len() > 2*replayBlockSize && tt.limit > 2*replayBlockSize && len(p.replayBlocks) == 0 {
+				t.Errorf("none of the replay is compressed")
+			}
+			replay := p.replayOutput()
+			if len(replay) > tt.limit {
+				t.Errorf("replay of %d bytes, over the limit of %d", len(replay), tt.limit)
+			}
+			if all.Len() > tt.limit && len(replay) < tt.limit-replayBlockSize-replayMarkGap {
+				t.Errorf("replay of %d bytes, want nearer the limit of %d", len(replay), tt.limit)
+			}
+			if !bytes.HasSuffix(all.Bytes(), replay) {
+				t.Fatalf("replay is not the end of the output")
+			}
+			dropped := all.Bytes()[:all.Len()-len(replay)]
+			if len(dropped) > 0 && dropped[len(dropped)-1] != '\n' {
+				t.Errorf("replay starts in the middle of a line")
+			}
+			if lines := bytes.Count(dropped, []byte("\n")); p.replayTop != lines {
+				t.Errorf("replayTop = %d, want the %d lines before the replay", p.replayTop, lines)
+			}
+		})
+	}
+}
+
+func TestKeepOutputNoReplay(t *testing.T) {
+	p := &Pane{screen: vt.NewPaneBuffer(80, 24)}
+	p.keepOutput([]byte(strings.Repeat("x\r\n", 100)), 0)
+	if replay := p.replayOutput(); len(replay) != 0 {
+		t.Errorf("replay of %d bytes with no limit", len(replay))
+	}
+	if p.replayTop != p.screen.LiveTop() {
+		t.Errorf("replayTop = %d, want %d", p.replayTop, p.screen.LiveTop())
+	}
+}
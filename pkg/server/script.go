@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"term/pkg/protocol"
+)
+
+// hookEvents are the events term.on can watch, each called with a table of
+// #{}-style fields.
+var hookEvents = map[string]bool{
+	"session-created": true, // session_name
+	"session-renamed": true, // session_name, old_name
+	"client-attached": true, // client_id, session_name
+	"client-detached": true, // client_id, session_name
+	"pane-exited":     true, // session_name, pane_id
+	"window-created":  true, // session_name, window_index, window_name
+	"window-closed":   true, // session_name, window_index
+	"layout-changed":  true, // session_name, window_index, window_panes
+	"command-done":    true, // session_name, pane_id, status, duration
+	"pane-matched":    true, // session_name, pane_id, pattern, line
+}
+
+// scriptTimeout is how long Lua may run for one script, command, key
+// binding or hook before it is stopped, so a loop that never ends can't
+// hold up the daemon.
+const scriptTimeout = 10 * time.Second
+
+// Scripts runs Lua: the script file ~/.term.lua, run-lua, and the functions
+// those register as commands, key bindings and hooks. They all share one
+// Lua state, which is not safe for concurrent use, so Lua only runs with
+// mutex held.
+type Scripts struct {
+	daemon   *Daemon
+	state    *lua.LState
+	commands map[string]*lua.LFunction // by command name
+	nextBind int                       // number of the next function bound with term.bind
+
+	// Functions watching each event; hooksMutex lets Fire read them
+	// without waiting for Lua that is running
+	hooks      map[string][]*lua.LFunction
+	hooksMutex sync.Mutex
+
+	// What the running Lua code runs commands against and where print
+	// writes, set by with
+	ctx    *CommandContext
+	output *strings.Builder
+	mutex  sync.Mutex
+}
+
+func scriptPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".term.lua")
+}
+
+func NewScripts(d *Daemon) *Scripts {
+	sc := &Scripts{
+		daemon:   d,
+		state:    lua.NewState(),
+		commands: make(map[string]*lua.LFunction),
+		hooks:    make(map[string][]*lua.LFunction),
+	}
+	L := sc.state
+	api := L.NewTable()
+	L.SetFuncs(api, map[string]lua.LGFunction{
+		"run":      sc.luaRun,
+		"command":  sc.luaCommand,
+		"bind":     sc.luaBind,
+		"on":       sc.luaOn,
+		"option":   sc.luaOption,
+		"sessions": sc.luaQuery("list-sessions"),
+		"clients":  sc.luaQuery("list-clients"),
+		"panes":    sc.luaQuery("list-panes"),
+		"info":     sc.luaQuery("info"),
+	})
+	L.SetGlobal("term", api)
+	L.SetGlobal("print", L.NewFunction(sc.luaPrint))
+	return sc
+}
+
+// with runs fn on the Lua state, with term.run running commands against
+// ctx, and returns what was printed. Lua not already running is stopped
+// after scriptTimeout. Commands run by Lua code get a context marked as
+// such, since the lock is already held.
+func (sc *Scripts) with(ctx *CommandContext, fn func(L *lua.LState) error) (string, error) {
+	if !ctx.script {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+	}
+	if sc.state.Context() == nil {
+		timeout, cancel := context.WithTimeout(context.Background(), scriptTimeout)
+		defer cancel()
+		sc.state.SetContext(timeout)
+		defer sc.state.RemoveContext()
+	}
+	inner := *ctx
+	inner.script = true
+	prevCtx, prevOutput := sc.ctx, sc.output
+	sc.ctx, sc.output = &inner, &strings.Builder{}
+	defer func() { sc.ctx, sc.output = prevCtx, prevOutput }()
+	err := fn(sc.state)
+	if apiErr, ok := err.(*lua.ApiError); ok {
+		err = fmt.Errorf("%s", apiErr.Object) // without the stack traceback
+	}
+	return sc.output.String(), err
+}
+
+// LoadFile runs a Lua file. A missing file is not an error.
+func (sc *Scripts) LoadFile(ctx *CommandContext, path string) (string, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+	return sc.with(ctx, func(L *lua.LState) error { return L.DoFile(path) })
+}
+
+// Run runs the command name if a script defined it, passing args to its
+// function and returning what that returns as the output.
+func (sc *Scripts) Run(ctx *CommandContext, name string, args []string) (string, bool, error) {
+	if !ctx.script {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+	}
+	fn, ok := sc.commands[name]
+	if !ok {
+		return "", false, nil
+	}
+	inner := *ctx
+	inner.script = true
+	output, err := sc.with(&inner, func(L *lua.LState) error {
+		table := L.NewTable()
+		for _, arg := range args {
+			table.Append(lua.LString(arg))
+		}
+		if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, table); err != nil {
+			return err
+		}
+		if ret := L.Get(-1); ret != lua.LNil {
+			sc.output.WriteString(lua.LVAsString(ret))
+		}
+		L.Pop(1)
+		return nil
+	})
+	return output, true, err
+}
+
+// Fire calls the functions watching event with fields. They run on their
+// own goroutine, as the event may come from a command a script is running.
+// Output and errors go to the daemon's messages.
+func (sc *Scripts) Fire(s *Session, event string, fields map[string]any) {
+	sc.hooksMutex.Lock()
+	hooks := slices.Clone(sc.hooks[event])
+	sc.hooksMutex.Unlock()
+	if len(hooks) == 0 {
+		return
+	}
+	go func() {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		defer recoverPanic(sc.daemon.errorf, event+" hook", nil)
+		for _, fn := range hooks {
+			ctx := &CommandContext{daemon: sc.daemon, session: s, script: true}
+			output, err := sc.with(ctx, func(L *lua.LState) error {
+				return L.CallByParam(lua.P{Fn: fn, Protect: true}, luaValue(L, fields))
+			})
+			if output != "" {
+				sc.daemon.logf("%s hook: %s", event, strings.TrimSuffix(output, "\n"))
+			}
+			if err != nil {
+				sc.daemon.errorf("%s hook failed: %v", event, err)
+			}
+		}
+	}()
+}
+
+// luaRun implements term.run(line) and term.run(command, args...), running
+// a command and returning its output. A failed command raises an error.
+func (sc *Scripts) luaRun(L *lua.LState) int {
+	var args []string
+	if L.GetTop() == 1 {
+		var err error
+		if args, err = protocol.ParseCommandLine(L.CheckString(1)); err != nil {
+			L.RaiseError("%v", err)
+		}
+	} else {
+		for i := 1; i <= L.GetTop(); i++ {
+			args = append(args, L.CheckString(i))
+		}
+	}
+	output, err := sc.ctx.RunCommand(args)
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	L.Push(lua.LString(output))
+	return 1
+}
+
+// luaCommand implements term.command(name, fn), defining a command that
+// calls fn with a table of its arguments.
+func (sc *Scripts) luaCommand(L *lua.LState) int {
+	name, fn := L.CheckString(1), L.CheckFunction(2)
+	if _, ok := commandTable[name]; ok {
+		L.ArgError(1, name+" is a built-in command")
+	}
+	sc.commands[name] = fn
+	return 0
+}
+
+// luaBind implements term.bind(key, command [, table]), where command is a
+// command line or a function, binding key in table, prefix by default.
+func (sc *Scripts) luaBind(L *lua.LState) int {
+	key := L.CheckString(1)
+	table := L.OptString(3, "prefix")
+	var line string
+	switch command := L.Get(2).(type) {
+	case lua.LString:
+		line = string(command)
+	case *lua.LFunction:
+		sc.nextBind++
+		line = fmt.Sprintf("lua-binding-%d", sc.nextBind)
+		sc.commands[line] = command
+	default:
+		L.ArgError(2, "command line or function expected")
+	}
+	sc.daemon.bindings.Bind(table, key, line, false)
+	sc.daemon.syncKeyBindings()
+	return 0
+}
+
+// luaOn implements term.on(event, fn).
+func (sc *Scripts) luaOn(L *lua.LState) int {
+	event, fn := L.CheckString(1), L.CheckFunction(2)
+	if !hookEvents[event] {
+		L.ArgError(1, "unknown event: "+event)
+	}
+	sc.hooksMutex.Lock()
+	sc.hooks[event] = append(sc.hooks[event], fn)
+	sc.hooksMutex.Unlock()
+	return 0
+}
+
+// luaOption implements term.option(name), returning nil for an unknown
+// option.
+func (sc *Scripts) luaOption(L *lua.LState) int {
+	value, ok := sc.daemon.options.Values()[L.CheckString(1)]
+	if !ok {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(lua.LString(value))
+	return 1
+}
+
+// luaQuery returns a function running a list command with --format json
+// and returning the result as Lua tables. term.panes takes an optional
+// target window and otherwise lists every pane of the session.
+func (sc *Scripts) luaQuery(command string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		args := []string{command, "--format", "json"}
+		if command == "list-panes" {
+			if target := L.OptString(1, ""); target != "" {
+				args = append(args, "-t", target)
+			} else {
+				args = append(args, "-a")
+			}
+		}
+		output, err := sc.ctx.RunCommand(args)
+		if err != nil {
+			L.RaiseError("%v", err)
+		}
+		var v any
+		json.Unmarshal([]byte(output), &v)
+		L.Push(luaValue(L, v))
+		return 1
+	}
+}
+
+// luaPrint replaces print, writing to the output of the running code.
+func (sc *Scripts) luaPrint(L *lua.LState) int {
+	for i := 1; i <= L.GetTop(); i++ {
+		if i > 1 {
+			sc.output.WriteString("\t")
+		}
+		sc.output.WriteString(L.ToStringMeta(L.Get(i)).String())
+	}
+	sc.output.WriteString("\n")
+	return 0
+}
+
+// luaValue converts a value decoded from JSON, or built the same way, to
+// Lua.
+func luaValue(L *lua.LState, v any) lua.LValue {
+	switch v := v.(type) {
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case []any:
+		table := L.NewTable()
+		for _, item := range v {
+			table.Append(luaValue(L, item))
+		}
+		return table
+	case map[string]any:
+		table := L.NewTable()
+		for key, item := range v {
+			table.RawSetString(key, luaValue(L, item))
+		}
+		return table
+	}
+	return lua.LNil
+}
+
+// cmdRunLua implements run-lua [-f file] [code...], running a Lua file or
+// chunk with the term API and returning what it prints.
+func cmdRunLua(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "f:")
+	file, isFile := flags['f']
+	if err != nil || isFile == (len(args) != 0) {
+		return "", fmt.Errorf("usage: run-lua -f file | run-lua code")
+	}
+	if isFile {
+		return ctx.daemon.scripts.with(ctx, func(L *lua.LState) error { return L.DoFile(file) })
+	}
+	code := strings.Join(args, " ")
+	return ctx.daemon.scripts.with(ctx, func(L *lua.LState) error { return L.DoString(code) })
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+
+	"term/pkg/protocol"
+)
+
+// A serial pane is an ordinary pane whose command is `term serial`, which
+// sets the device's line up with stty and copies bytes between it and the
+// pane's PTY, so everything that works on panes (copy mode, logging,
+// watches) works on the console too.
+
+// serialParities are the --parity values, with the stty settings for each.
+var serialParities = map[string][]string{
+	"none": {"-parenb"},
+	"even": {"parenb", "-parodd"},
+	"odd":  {"parenb", "parodd"},
+}
+
+// serialLine checks a baud rate and parity, returning them with the
+// defaults, 115200 and none, for those not given.
+func serialLine(baud, parity string) (string, string, error) {
+	if baud == "" {
+		baud = "115200"
+	}
+	if parity == "" {
+		parity = "none"
+	}
+	if n, err := strconv.Atoi(baud); err != nil || n < 1 {
+		return "", "", fmt.Errorf("bad baud rate: %s", baud)
+	}
+	if _, ok := serialParities[parity]; !ok {
+		return "", "", fmt.Errorf("bad parity %q: none, even or odd", parity)
+	}
+	return baud, parity, nil
+}
+
+// serialCommand is what a pane connected to device runs.
+func serialCommand(device, baud, parity string) ([]string, error) {
+	baud, parity, err := serialLine(baud, parity)
+	if err != nil {
+		return nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return []string{exe, "serial", "-b", baud, "-p", parity, device}, nil
+}
+
+// RunSerial implements `term serial [-b baud] [-p none|even|odd] device`,
+// run in a pane by new-window --serial: it puts the device in raw mode at
+// the baud rate with 8 data bits, the parity and one stop bit, ignoring
+// modem control lines, puts its own terminal in raw mode and copies
+// between the two until the device goes away.
+func RunSerial(args []string) int {
+	flags, args, err := protocol.ParseFlags(args, "b:p:")
+	if err != nil || len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: term serial [-b baud] [-p none|even|odd] device")
+		return 1
+	}
+	device := args[0]
+	baud, parity, err := serialLine(flags['b'], flags['p'])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	stty := slices.Concat([]string{sttyDevice, device, baud, "raw", "-echo", "cs8", "-cstopb", "clocal"}, serialParities[parity])
+	if out, err := exec.Command("stty", stty...).CombinedOutput(); err != nil {
+		// Some devices, such as USB CDC ones, take only part of it and work
+		fmt.Fprintf(os.Stderr, "Warning: stty %s: %v: %s\r\n", device, err, bytes.TrimSpace(out))
+	}
+	port, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer port.Close()
+
+	raw := exec.Command("stty", "raw", "-echo")
+	raw.Stdin = os.Stdin
+	if err := raw.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "stty: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Connected to %s at %s baud\r\n", device, baud)
+	go io.Copy(port, os.Stdin)
+	_, err = io.Copy(os.Stdout, port)
+	fmt.Printf("\r\nDisconnected from %s", device)
+	if err != nil {
+		fmt.Printf(": %v", err)
+	}
+	fmt.Print("\r\n")
+	return 0
+}
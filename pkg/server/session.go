@@ -0,0 +1,892 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+
+	"term/pkg/protocol"
+)
+
+type Session struct {
+	name         atomic.Pointer[string] // changed by rename-session
+	windows      []*Window
+	activeWindow int
+	nextWindowID int
+	options      *Options
+	mutex        *sync.Mutex // the daemon's sessionMutex, shared by every session
+	group        atomic.Pointer[sessionGroup]
+	clients      map[net.Conn]bool // Track connected clients and whether they have focus
+	clientMutex  sync.Mutex
+	focusedPane  *Pane // Pane last told it has focus
+	environ      *Environment
+	globalEnv    *Environment  // the daemon's, applied under environ
+	size         *pty.Winsize  // last size set by a client, for new panes
+	dir          string        // where new windows start without -c, see set-directory
+	lastWindowID int           // window and pane last left, for select-window -l
+	lastPaneID   int           // and select-pane -l run without a client
+	historyKey   string        // the daemon's, naming history files
+	messages     *messageLog   // the daemon's, for show-messages
+	floats       []*Float      // bottom to top
+	scripts      *Scripts      // the daemon's, for hooks
+	plugins      *Plugins      // the daemon's, for hooks and status segments
+	subscribers  *Subscribers  // the daemon's, for events
+	removed      chan struct{} // closed by removeSession, ending watchProcesses
+}
+
+func NewSession(name string, options *Options, globalEnv *Environment) *Session {
+	s := &Session{
+		options:   options,
+		mutex:     new(sync.Mutex),
+		clients:   make(map[net.Conn]bool),
+		environ:   NewEnvironment(),
+		globalEnv: globalEnv,
+		removed:   make(chan struct{}),
+
+		lastWindowID: -1,
+		lastPaneID:   -1,
+	}
+	s.name.Store(&name)
+	return s
+}
+
+// Name returns the session's name.
+func (s *Session) Name() string {
+	return *s.name.Load()
+}
+
+func (s *Session) AddClient(conn net.Conn) {
+	s.clientMutex.Lock()
+	s.clients[conn] = true // Assume focus until the client says otherwise
+	debugf("Session %s: Client %v added. Total clients: %d\n", s.Name(), conn.RemoteAddr(), len(s.clients))
+	s.clientMutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateFocus()
+}
+
+func (s *Session) RemoveClient(conn net.Conn) {
+	s.clientMutex.Lock()
+	delete(s.clients, conn)
+	debugf("Session %s: Client %v removed. Total clients: %d\n", s.Name(), conn.RemoteAddr(), len(s.clients))
+	s.clientMutex.Unlock()
+
+	// The pane loses focus if this was the last focused client
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateFocus()
+}
+
+// SetClientFocus records whether a client's terminal has focus.
+func (s *Session) SetClientFocus(conn net.Conn, focused bool) {
+	s.clientMutex.Lock()
+	if _, ok := s.clients[conn]; ok {
+		s.clients[conn] = focused
+	}
+	s.clientMutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateFocus()
+}
+
+// updateFocus sends focus-out to the pane that lost focus and focus-in to the
+// one that gained it. A pane has focus when it gets input, being active or
+// the top float, and at least one attached client's terminal has focus. The caller must hold s.mutex.
+func (s *Session) updateFocus() {
+	var focused *Pane
+	s.clientMutex.Lock()
+	for _, hasFocus := range s.clients {
+		if hasFocus {
+			focused = s.inputPane()
+			break
+		}
+	}
+	s.clientMutex.Unlock()
+
+	if focused == s.focusedPane {
+		return
+	}
+	if s.focusedPane != nil {
+		s.focusedPane.SendFocus(false)
+	}
+	if focused != nil {
+		focused.SendFocus(true)
+	}
+	s.focusedPane = focused
+}
+
+func (s *Session) Broadcast(data []byte) {
+	s.clientMutex.Lock()
+	defer s.clientMutex.Unlock()
+	debugf("Session %s: Broadcasting %d bytes to %d clients\n", s.Name(), len(data), len(s.clients))
+	for conn := range s.clients {
+		_, err := conn.Write(data)
+		if err != nil {
+			debugf("Session %s: Error writing to client %v: %v\n", s.Name(), conn.RemoteAddr(), err)
+			// Consider removing client if write fails consistently
+		}
+	}
+}
+
+// newPane starts a pane of size ws running command, or the default command
+// or shell, in dir, and its broadcast goroutine. The caller must hold
+// s.mutex.
+func (s *Session) newPane(command []string, dir string, ws *pty.Winsize) (*Pane, error) {
+	p, err := NewPane(s.paneEnvironment(), paneArgs(s.options, command), dir, ws)
+	if err != nil {
+		return nil, err
+	}
+	p.command, p.dir = command, dir
+	p.shownIn.Store(&[]*Session{s})
+	if s.options.Flag("history-file") {
+		if err := p.startHistory(historyDir(s.options.String("history-dir")), s.historyKey, s.options.Number("history-limit")); err != nil {
+			s.errorf("History file for pane %d: %v", p.id, err)
+		}
+	}
+	p.onKeysChange = func(keys protocol.KeyEncoding) {
+		p.broadcast(createKeyEncodingMessage(keys))
+	}
+	p.onCommandDone = func(status int, duration time.Duration) {
+		s.commandDone(p, status, duration)
+	}
+	p.outputLimit = func() int {
+		return s.options.Number("output-limit") * 1024
+	}
+	p.Start(s.errorf)
+	go p.checkForeground()
+
+	// Start a goroutine to read from the new pane and broadcast. A panic
+	// closes the pane, whose reader's output is then thrown away.
+	go func(pane *Pane) {
+		defer recoverPanic(s.errorf, fmt.Sprintf("pane %d", pane.id), func() {
+			pane.Close()
+			go func() {
+				for range pane.output {
+				}
+			}()
+			pane.StopLog()
+			s.paneExited(pane)
+		})
+		var last time.Time
+		for {
+			output, ok := pane.NextOutput(last)
+			if !ok {
+				pane.StopLog()
+				s.paneExited(pane)
+				return
+			}
+			last = time.Now()
+			pane.writeLog(output)
+			s.checkTriggers(pane, output)
+			if s.subscribers.Wants("pane-output") {
+				s.subscribers.Send("pane-output", map[string]any{"session_name": s.Name(), "pane_id": pane.id, "data": string(output)})
+			}
+			s.sendOutput(pane, output)
+		}
+	}(p)
+	return p, nil
+}
+
+// announcePane tells clients about a new pane in the layout, which they
+// switch to.
+func (s *Session) announcePane(p *Pane) {
+	payload, _ := json.Marshal(p.id) // Send the new pane ID
+	msg := protocol.Encode(protocol.MsgNewPane, payload)
+	debugf("Session: Broadcasting new pane notification for pane %d, message length %d\n", p.id, len(msg))
+	s.Broadcast(msg)
+}
+
+// NewWindow creates a window with a single pane and makes it active.
+func (s *Session) NewWindow() (*Window, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.newWindow(nil, "", "")
+}
+
+// newWindow creates a window whose pane runs command, or the default shell,
+// in dir, or the session's directory. It is named name, kept by
+// automatic-rename, or else after the command. The caller must hold
+// s.mutex.
+func (s *Session) newWindow(command []string, dir, name string) (*Window, error) {
+	if dir == "" {
+		dir = s.dir
+	}
+	p, err := s.newPane(command, dir, s.size)
+	if err != nil {
+		return nil, err
+	}
+	s.announcePane(p)
+	w := &Window{
+		id:    s.nextWindowID,
+		index: s.nextWindowIndex(),
+		windowContent: &windowContent{
+			name:  name,
+			panes: []*Pane{p},
+			named: name != "",
+			dir:   dir,
+			links: []*Session{s},
+		},
+	}
+	if !w.named {
+		w.name = s.options.String("default-shell")
+		if len(command) > 0 {
+			if words := strings.Fields(command[0]); len(words) > 0 {
+				w.name = words[0]
+			}
+		}
+		w.name = filepath.Base(w.name)
+	}
+	s.nextWindowID++
+	s.activeWindow = s.insertWindow(w)
+	debugf("Session %s: New window %d created with pane %d\n", s.Name(), w.index, p.id)
+	s.fire("window-created", map[string]any{"session_name": s.Name(), "window_index": w.index, "window_name": w.name})
+
+	s.syncWindows(nil)
+	s.updateFocus()
+	s.redraw() // Redraw all clients after new window
+	return w, nil
+}
+
+// insertWindow adds w to the windows, kept in order of index, and returns
+// its position. The caller must hold s.mutex.
+func (s *Session) insertWindow(w *Window) int {
+	pos := len(s.windows)
+	for i, other := range s.windows {
+		if other.index > w.index {
+			pos = i
+			break
+		}
+	}
+	s.windows = slices.Insert(s.windows, pos, w)
+	return pos
+}
+
+// SplitWindow adds a pane running command, or the default shell, started
+// in dir, or the window's directory, to w, or to the active window when w
+// is nil, and makes the pane and its window active.
+func (s *Session) SplitWindow(w *Window, command []string, dir string) (*Pane, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.windows) == 0 {
+		w, err := s.newWindow(command, dir, "")
+		if err != nil {
+			return nil, err
+		}
+		return w.ActivePane(), nil
+	}
+
+	pos := s.activeWindow
+	if w != nil {
+		if pos = slices.Index(s.windows, w); pos < 0 {
+			return nil, fmt.Errorf("window %d is gone", w.index)
+		}
+	}
+	w = s.windows[pos]
+	if dir == "" {
+		dir = w.dir
+	}
+	p, err := s.newPane(command, dir, s.size)
+	if err != nil {
+		return nil, err
+	}
+	p.showIn(w.links)
+	s.announcePane(p)
+	s.activeWindow = pos
+	w.panes = append(w.panes, p)
+	w.activePane = len(w.panes) - 1
+	s.windowChanged(w)
+	debugf("Session %s: New pane %d in window %d. Active pane: %d\n", s.Name(), p.id, w.index, w.activePane)
+	s.fire("layout-changed", map[string]any{"session_name": s.Name(), "window_index": w.index, "window_panes": len(w.panes)})
+
+	s.updateFocus()
+	s.redraw()
+	return p, nil
+}
+
+// respawnWindow starts each of w's panes' commands again and puts the new
+// panes in place of the old ones, which are closed, so the window keeps
+// its index, name and layout. If any fails to start, the ones started are
+// closed and the window is left as it was. Clients are told of each new
+// pane and then switched to the active one. The caller must hold s.mutex.
+func (s *Session) respawnWindow(w *Window) error {
+	panes := make([]*Pane, 0, len(w.panes))
+	for _, old := range w.panes {
+		p, err := s.newPane(old.command, old.dir, s.size)
+		if err != nil {
+			for _, p := range panes {
+				p.Signal(syscall.SIGTERM)
+				p.Close()
+			}
+			return err
+		}
+		panes = append(panes, p)
+	}
+	for i, old := range w.panes {
+		old.Signal(syscall.SIGTERM)
+		old.Close()
+		panes[i].showIn(w.links)
+		s.announcePane(panes[i])
+		w.panes[i] = panes[i]
+	}
+	debugf("Session %s: Respawned window %d\n", s.Name(), w.index)
+	s.windowChanged(w)
+	s.switchPane(s.ActivePane().id)
+	return nil
+}
+
+// nextWindowIndex returns the lowest unused window index starting at
+// base-index.
+func (s *Session) nextWindowIndex() int {
+	index := s.options.Number("base-index")
+	for _, w := range s.windows {
+		if w.index == index {
+			index++
+		} else if w.index > index {
+			break
+		}
+	}
+	return index
+}
+
+// renumberWindows closes any gaps in the window indexes.
+func (s *Session) renumberWindows() {
+	base := s.options.Number("base-index")
+	for i, w := range s.windows {
+		w.index = base + i
+	}
+}
+
+// ActivePane returns the active pane of the active window. The caller must
+// hold s.mutex.
+func (s *Session) ActivePane() *Pane {
+	if len(s.windows) == 0 {
+		return nil
+	}
+	return s.windows[s.activeWindow].ActivePane()
+}
+
+// selectWindow makes the window at position i active and tells clients which
+// pane to show. The caller must hold s.mutex.
+func (s *Session) selectWindow(i int) {
+	if i < 0 || i >= len(s.windows) {
+		return
+	}
+	s.activeWindow = i
+	s.windows[i].alert = false
+	s.windows[i].matched = false
+	s.switchPane(s.ActivePane().id)
+}
+
+// Current returns the ids of the active window and its active pane.
+func (s *Session) Current() (windowID, paneID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.current()
+}
+
+// current is Current for callers holding s.mutex.
+func (s *Session) current() (windowID, paneID int) {
+	if len(s.windows) == 0 {
+		return -1, -1
+	}
+	return s.windows[s.activeWindow].id, s.ActivePane().id
+}
+
+// trackLast records the window or pane the session just left, as
+// SessionManager.trackLast does for a client. The caller must hold
+// s.mutex.
+func (s *Session) trackLast(prevWindowID, prevPaneID int) {
+	windowID, paneID := s.current()
+	if windowID != prevWindowID {
+		s.lastWindowID = prevWindowID
+	} else if paneID != prevPaneID {
+		s.lastPaneID = prevPaneID
+	}
+}
+
+// SelectWindowID makes the window with the given id active.
+func (s *Session) SelectWindowID(id int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, w := range s.windows {
+		if w.id == id {
+			prevWindowID, prevPaneID := s.current()
+			s.selectWindow(i)
+			s.trackLast(prevWindowID, prevPaneID)
+			return true
+		}
+	}
+	return false
+}
+
+// SelectPaneID makes the pane with the given id active, along with its
+// window.
+func (s *Session) SelectPaneID(id int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	wi, pi := s.findPane(id)
+	if wi < 0 {
+		return false
+	}
+	prevWindowID, prevPaneID := s.current()
+	s.windows[wi].activePane = pi
+	s.selectWindow(wi)
+	s.windowChanged(s.windows[wi])
+	s.trackLast(prevWindowID, prevPaneID)
+	return true
+}
+
+func (s *Session) NextWindow() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.windows) > 0 {
+		prevWindowID, prevPaneID := s.current()
+		s.selectWindow((s.activeWindow + 1) % len(s.windows))
+		s.trackLast(prevWindowID, prevPaneID)
+		debugf("Session %s: Switched to next window: %d\n", s.Name(), s.activeWindow)
+	}
+}
+
+func (s *Session) PrevWindow() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.windows) > 0 {
+		prevWindowID, prevPaneID := s.current()
+		s.selectWindow((s.activeWindow - 1 + len(s.windows)) % len(s.windows))
+		s.trackLast(prevWindowID, prevPaneID)
+		debugf("Session %s: Switched to previous window: %d\n", s.Name(), s.activeWindow)
+	}
+}
+
+// NextPane cycles through the panes of the active window.
+func (s *Session) NextPane() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.windows) > 0 {
+		w := s.windows[s.activeWindow]
+		s.lastPaneID = w.ActivePane().id
+		w.activePane = (w.activePane + 1) % len(w.panes)
+		s.switchPane(w.ActivePane().id)
+		s.windowChanged(w)
+	}
+}
+
+func (s *Session) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, w := range s.windows {
+		for _, p := range w.panes {
+			p.Close()
+		}
+	}
+	for _, f := range s.floats {
+		f.pane.Close()
+	}
+}
+
+type SessionManager struct {
+	conn    net.Conn
+	daemon  *Daemon
+	session *Session
+
+	// Previously selected window and pane for this client, used by
+	// last-window and last-pane
+	lastWindowID int
+	lastPaneID   int
+
+	// Messages shown to this client, such as errors of commands it ran,
+	// for show-messages
+	messages messageLog
+
+	// Number and attach time shown by list-clients, set by addClient
+	id       int
+	attached time.Time
+
+	// Macro being recorded by record-macro, or nil
+	recording *macroRecording
+}
+
+func NewSessionManager(conn net.Conn, daemon *Daemon) *SessionManager {
+	return &SessionManager{conn: conn, daemon: daemon, session: daemon.mainSession, lastWindowID: -1, lastPaneID: -1}
+}
+
+// trackLast records the window or pane this client just left.
+func (sm *SessionManager) trackLast(prevWindowID, prevPaneID int) {
+	windowID, paneID := sm.session.Current()
+	if windowID != prevWindowID {
+		sm.lastWindowID = prevWindowID
+	} else if paneID != prevPaneID {
+		sm.lastPaneID = prevPaneID
+	}
+}
+
+func (sm *SessionManager) Run() {
+	msgType, payload, err := protocol.Read(sm.conn)
+	if err != nil {
+		return
+	}
+	var cliPane *Pane
+	if msgType == protocol.MsgCLIPane { // the pane the CLI runs in
+		if t, ok := sm.daemon.clientPane(string(payload)); ok {
+			sm.session, cliPane = t.session, t.pane
+		}
+		if msgType, payload, err = protocol.Read(sm.conn); err != nil {
+			return
+		}
+	}
+	if msgType == protocol.MsgSubscribe { // event stream, see events.go
+		sm.daemon.subscribers.Serve(sm.conn, payload)
+		return
+	}
+	if msgType == protocol.MsgCLICommand { // one-shot command from the CLI
+		sm.runCLICommand(payload, cliPane)
+		return
+	}
+	if msgType == protocol.MsgAttachSession { // attach to a named session
+		if sm.session = sm.daemon.FindSession(string(payload)); sm.session == nil {
+			return
+		}
+		if msgType, payload, err = protocol.Read(sm.conn); err != nil {
+			return
+		}
+	}
+
+	sm.daemon.addClient(sm)
+	defer sm.daemon.removeClient(sm)
+	sm.attach(sm.session, true)
+	defer func() { sm.session.RemoveClient(sm.conn) }()
+
+	for msgType != protocol.MsgDetach {
+		sm.handleMessage(msgType, payload)
+		msgType, payload, err = protocol.Read(sm.conn)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// attach adds this client to s and sends what it needs to show it: options,
+// key bindings, the panes' key encodings and a snapshot of the sessions
+// (snapshot.go), then with replay the panes' recent output (replay.go).
+func (sm *SessionManager) attach(s *Session, replay bool) {
+	sm.session = s
+	if !replay {
+		s.AddClient(sm.conn)
+	}
+	sm.conn.Write(s.createOptionsMessage())
+	sm.conn.Write(sm.daemon.createKeyBindingsMessage())
+	for _, keys := range s.KeyEncodings() {
+		sm.conn.Write(createKeyEncodingMessage(keys))
+	}
+	sm.conn.Write(sm.daemon.createSnapshotMessage(s))
+	if replay {
+		s.AddClientReplaying(sm.conn)
+	}
+	s.redraw()
+}
+
+// switchSession moves this client from its session to s. Last window and
+// pane are forgotten, as they belonged to the old session.
+func (sm *SessionManager) switchSession(s *Session) {
+	if s == sm.session {
+		return
+	}
+	sm.session.RemoveClient(sm.conn)
+	sm.lastWindowID, sm.lastPaneID = -1, -1
+	sm.attach(s, false)
+}
+
+// runCLICommand runs a command sent by `term <command>` and replies with its
+// output or error. pane is the pane the CLI was run from, if any. CLI
+// connections are never added as clients.
+func (sm *SessionManager) runCLICommand(payload []byte, pane *Pane) {
+	var args []string
+	var result struct {
+		Output string `json:"output,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(payload, &args); err != nil {
+		result.Error = err.Error()
+	} else {
+		ctx := &CommandContext{daemon: sm.daemon, session: sm.session, pane: pane}
+		output, err := ctx.RunCommand(args)
+		result.Output = output
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+	reply, _ := json.Marshal(result)
+	sm.conn.Write(protocol.Encode(protocol.MsgCLIResult, reply))
+}
+
+func (sm *SessionManager) handleMessage(msgType byte, payload []byte) {
+	prevSession := sm.session
+	prevWindowID, prevPaneID := sm.session.Current()
+	switch msgType {
+	case protocol.MsgData:
+		if sm.recording != nil {
+			sm.recording.keys.Write(payload)
+		}
+		sm.session.WriteToActivePane(payload)
+	case protocol.MsgResize:
+		var ws pty.Winsize
+		if err := json.Unmarshal(payload, &ws); err != nil {
+			sm.showError("Bad resize message: %v", err)
+		} else {
+			sm.session.Resize(&ws)
+		}
+	case protocol.MsgNewWindow:
+		debugf("SessionManager: Received new window command\n") // Debug print
+		if _, err := sm.session.NewWindow(); err != nil {
+			sm.showError("Error creating new window: %v", err)
+		}
+	case protocol.MsgNextWindow:
+		sm.session.NextWindow()
+	case protocol.MsgPrevWindow:
+		sm.session.PrevWindow()
+	case protocol.MsgKillPane:
+		if err := sm.session.KillActivePane(); err != nil {
+			sm.showError("Error killing pane: %v", err)
+		}
+	case protocol.MsgSplitPane: // split horizontal (new pane in the active window)
+		debugf("SessionManager: Received split horizontal command (creating new pane)\n")
+		pane, err := sm.session.SplitWindow(nil, nil, "")
+		if err != nil {
+			sm.showError("Error creating new pane: %v", err)
+		} else {
+			debugf("SessionManager: Successfully created new pane with ID %d\n", pane.id)
+		}
+	case protocol.MsgNextPane: // next pane in the active window
+		sm.session.NextPane()
+	case protocol.MsgLastWindow:
+		sm.session.SelectWindowID(sm.lastWindowID)
+	case protocol.MsgLastPane:
+		sm.session.SelectPaneID(sm.lastPaneID)
+	case protocol.MsgCommand:
+		var args []string
+		if err := json.Unmarshal(payload, &args); err != nil {
+			sm.showError("Bad command message: %v", err)
+			break
+		}
+		ctx := &CommandContext{daemon: sm.daemon, session: sm.session, client: sm}
+		output, err := ctx.RunCommand(args)
+		if err != nil {
+			sm.showError("%v", err)
+		} else if output != "" {
+			sm.redrawWithContent(output)
+		}
+	case protocol.MsgFocus: // client focus changed
+		var focused bool
+		if err := json.Unmarshal(payload, &focused); err == nil {
+			sm.session.SetClientFocus(sm.conn, focused)
+		}
+	case protocol.MsgYank: // text yanked by the client
+		sm.daemon.AddBuffer(string(payload))
+	case protocol.MsgEnvironment: // client environment, sent on attach
+		var env []string
+		if err := json.Unmarshal(payload, &env); err == nil {
+			sm.session.UpdateEnvironment(env)
+		}
+	default:
+		sm.showError("Unknown message type 0x%02x", msgType)
+	}
+	if sm.session == prevSession {
+		sm.trackLast(prevWindowID, prevPaneID)
+	}
+}
+
+// WriteToActivePane sends input to the active pane's PTY, or to the top
+// float's while one is shown.
+func (s *Session) WriteToActivePane(data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if p := s.inputPane(); p != nil {
+		debugf("SessionManager: Writing %d bytes to active pane %d\n", len(data), p.id) // Debug print
+		p.ptmx.Write(data)
+	}
+}
+
+func (s *Session) Resize(ws *pty.Winsize) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.size = ws
+	for _, w := range s.windows {
+		for _, p := range w.panes {
+			p.Resize(ws)
+		}
+	}
+}
+
+// statusLine is the session's name, its windows with the active one marked
+// with *, and the active pane's index and whether it is being logged or
+// frozen. Tabs separate the three, which clients align (UI.drawStatus).
+func (s *Session) statusLine() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\t", s.Name())
+	for i, w := range s.windows {
+		flag := ""
+		if i == s.activeWindow {
+			flag = "*"
+		} else if w.alert {
+			flag = "!"
+		} else if w.matched {
+			flag = "+"
+		}
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%d:%s%s", w.index, w.name, flag)
+	}
+	if len(s.windows) > 0 {
+		w := s.windows[s.activeWindow]
+		fmt.Fprintf(&b, "\tPane: %d", w.paneIndex(w.activePane, s.options))
+		if p := w.ActivePane(); p != nil && p.LogPath() != "" {
+			b.WriteString(" [logging]")
+		}
+		if p := w.ActivePane(); p != nil && p.Frozen() {
+			b.WriteString(" [frozen]")
+		}
+		if right := s.options.String("status-right"); right != "" && w.ActivePane() != nil {
+			vars := s.paneFormatVars(w, w.activePane)
+			maps.Copy(vars, s.plugins.Segments())
+			b.WriteString("  " + expandFormat(right, vars))
+		}
+	}
+	return b.String()
+}
+
+// StatusLine returns the status line as clients show it.
+func (s *Session) StatusLine() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.statusLine()
+}
+
+func (s *Session) redraw() {
+	s.Broadcast(s.createRedrawMessage(s.statusLine()))
+	if s.options.Flag("set-titles") {
+		s.Broadcast(protocol.Encode(protocol.MsgTitle, []byte(s.title())))
+	}
+}
+
+// defaultTitlesString is set-titles-string unless set, as tmux has it.
+const defaultTitlesString = `#{session_name}:#{window_index}:#{window_name} - "#{pane_title}"`
+
+// title is set-titles-string expanded with the active pane's variables,
+// for clients to set as their terminal's title.
+func (s *Session) title() string {
+	if len(s.windows) == 0 {
+		return s.Name()
+	}
+	w := s.windows[s.activeWindow]
+	return expandFormat(s.options.String("set-titles-string"), s.paneFormatVars(w, w.activePane))
+}
+
+func (sm *SessionManager) redrawWithContent(content string) {
+	// Send redraw message to this specific client
+	sm.conn.Write(sm.session.createRedrawMessage(content))
+}
+
+func (s *Session) createRedrawMessage(content string) []byte {
+	return protocol.Encode(protocol.MsgRedraw, []byte(content))
+}
+
+func (s *Session) createOptionsMessage() []byte {
+	payload, _ := json.Marshal(s.options.Values())
+	return protocol.Encode(protocol.MsgOptions, payload)
+}
+
+func createKeyEncodingMessage(keys protocol.KeyEncoding) []byte {
+	payload, _ := json.Marshal(keys)
+	return protocol.Encode(protocol.MsgKeyEncoding, payload)
+}
+
+// KeyEncodings returns the extended key encoding of every pane that asked
+// for one.
+func (s *Session) KeyEncodings() []protocol.KeyEncoding {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var panes []*Pane
+	for _, w := range s.windows {
+		panes = append(panes, w.panes...)
+	}
+	for _, f := range s.floats {
+		panes = append(panes, f.pane)
+	}
+	var encodings []protocol.KeyEncoding
+	for _, p := range panes {
+		if keys := p.KeyEncoding(); keys != (protocol.KeyEncoding{PaneID: p.id}) {
+			encodings = append(encodings, keys)
+		}
+	}
+	return encodings
+}
+
+func (s *Session) switchPane(paneID int) {
+	// Send pane switch notification to clients
+	payload, _ := json.Marshal(paneID)
+	s.Broadcast(protocol.Encode(protocol.MsgSwitchPane, payload))
+	s.updateFocus()
+	s.redraw()
+}
+
+// KillActivePane kills the active pane with SIGTERM, as kill-pane does.
+func (s *Session) KillActivePane() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if p := s.ActivePane(); p != nil {
+		return s.killPane(p, syscall.SIGTERM)
+	}
+	return nil
+}
+
+// KillPane sends sig to a pane's processes and closes it.
+func (s *Session) KillPane(p *Pane, sig syscall.Signal) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.killPane(p, sig)
+}
+
+// killPane sends sig to the process groups of a pane's command and its
+// foreground job, so what it started doesn't outlive it, then closes the
+// pane. The caller must hold s.mutex.
+func (s *Session) killPane(p *Pane, sig syscall.Signal) error {
+	err := p.Signal(sig)
+	s.removePane(p.id)
+	return err
+}
+
+// removePane closes a pane and drops its window once it has no panes left.
+// The caller must hold s.mutex.
+func (s *Session) removePane(id int) {
+	for i, w := range s.windows {
+		for _, p := range w.panes {
+			if p.id != id {
+				continue
+			}
+			p.Close()
+			w.removePane(id)
+			if len(w.panes) > 0 {
+				s.fire("layout-changed", map[string]any{"session_name": s.Name(), "window_index": w.index, "window_panes": len(w.panes)})
+				s.switchPane(s.ActivePane().id)
+			} else {
+				s.fire("window-closed", map[string]any{"session_name": s.Name(), "window_index": w.index})
+				s.dropWindow(i)
+			}
+			s.windowChanged(w)
+			return
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/creack/pty"
+
+	"term/pkg/protocol"
+)
+
+// Default size of a session created without a client, like an 80x24
+// terminal with one line for the status line.
+const (
+	defaultSessionWidth  = 80
+	defaultSessionHeight = 24
+)
+
+// addSession creates a session named name, empty or sharing peer's windows
+// in a group, and starts watching its panes' processes.
+func (d *Daemon) addSession(name string, peer *Session) (*Session, error) {
+	if !validSessionName(name) {
+		return nil, fmt.Errorf("bad session name: %q", name)
+	}
+	s := NewSession(name, d.options, d.environ)
+	s.mutex = &d.sessionMutex
+	s.messages = d.messages
+	s.scripts, s.plugins, s.subscribers = d.scripts, d.plugins, d.subscribers
+	s.historyKey = d.historyKey
+	d.mutex.Lock()
+	for _, other := range d.sessions {
+		if other.Name() == name {
+			d.mutex.Unlock()
+			return nil, fmt.Errorf("duplicate session: %s", name)
+		}
+	}
+	d.sessions = append(d.sessions, s)
+	d.mutex.Unlock()
+	if peer != nil {
+		s.joinGroup(peer)
+	}
+	go s.watchProcesses()
+	s.fire("session-created", map[string]any{"session_name": name})
+	return s, nil
+}
+
+// removeSession forgets a session just added by addSession, one whose first
+// window failed to start, so its name is free again.
+func (d *Daemon) removeSession(s *Session) {
+	d.mutex.Lock()
+	d.sessions = slices.DeleteFunc(d.sessions, func(other *Session) bool { return other == s })
+	d.mutex.Unlock()
+	close(s.removed)
+}
+
+// validSessionName reports whether name can name a session: it can't be
+// empty or contain the separators of a target.
+func validSessionName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ":.")
+}
+
+// renameSession gives s a new name, which its group takes too when named
+// after it, and redraws its status line.
+func (d *Daemon) renameSession(s *Session, name string) error {
+	if !validSessionName(name) {
+		return fmt.Errorf("bad session name: %q", name)
+	}
+	d.mutex.Lock()
+	for _, other := range d.sessions {
+		if other != s && other.Name() == name {
+			d.mutex.Unlock()
+			return fmt.Errorf("duplicate session: %s", name)
+		}
+	}
+	old := s.Name()
+	s.name.Store(&name)
+	d.mutex.Unlock()
+	if g := s.group.Load(); g != nil {
+		g.mutex.Lock()
+		if g.name == old {
+			g.name = name
+		}
+		g.mutex.Unlock()
+	}
+	s.fire("session-renamed", map[string]any{"session_name": name, "old_name": old})
+	s.mutex.Lock()
+	s.redraw()
+	s.mutex.Unlock()
+	return nil
+}
+
+// FindSession returns the session named name, or nil.
+func (d *Daemon) FindSession(name string) *Session {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, s := range d.sessions {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Sessions returns every session in the order they were created.
+func (d *Daemon) Sessions() []*Session {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]*Session(nil), d.sessions...)
+}
+
+// broadcast sends msg to the clients of every session.
+func (d *Daemon) broadcast(msg []byte) {
+	for _, s := range d.Sessions() {
+		s.Broadcast(msg)
+	}
+}
+
+// nextSessionName returns the lowest number not yet used as a session name.
+func (d *Daemon) nextSessionName() string {
+	for i := 0; ; i++ {
+		if name := strconv.Itoa(i); d.FindSession(name) == nil {
+			return name
+		}
+	}
+}
+
+// cmdNewSession implements new-session [-d] [-c start-directory]
+// [-n window-name] [-s name] [-t group-with] [-x width] [-y height] [--]
+// [command...]. The session starts detached with one window running
+// command, or the default shell, sized as a width by height terminal until
+// a client attaches. With -t it has no window of its own but shares those of
+// the session group-with, in a group. -d is accepted for compatibility.
+func cmdNewSession(ctx *CommandContext, args []string) (string, error) {
+	name, dir, windowName, groupWith := "", "", "", ""
+	width, height := defaultSessionWidth, defaultSessionHeight
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		switch args[0] {
+		case "-d":
+		case "-c", "-n", "-s", "-t", "-x", "-y":
+			if len(args) < 2 {
+				return "", fmt.Errorf("%s needs a value", args[0])
+			}
+			switch args[0] {
+			case "-c":
+				dir = ctx.startDirectory(args[1])
+			case "-n":
+				windowName = args[1]
+			case "-s":
+				name = args[1]
+			case "-t":
+				groupWith = args[1]
+			default:
+				n, err := strconv.Atoi(args[1])
+				if err != nil || n < 2 || n > math.MaxUint16 {
+					return "", fmt.Errorf("bad size: %s", args[1])
+				}
+				if args[0] == "-x" {
+					width = n
+				} else {
+					height = n
+				}
+			}
+			args = args[1:]
+		default:
+			return "", fmt.Errorf("unknown flag: %s", args[0])
+		}
+		args = args[1:]
+	}
+	if name == "" {
+		name = ctx.daemon.nextSessionName()
+	}
+	if groupWith != "" {
+		if len(args) > 0 || dir != "" || windowName != "" {
+			return "", fmt.Errorf("a grouped session takes no window of its own")
+		}
+		peer, err := ctx.resolveSession(groupWith)
+		if err != nil {
+			return "", err
+		}
+		_, err = ctx.daemon.addSession(name, peer)
+		return "", err
+	}
+
+	s, err := ctx.daemon.addSession(name, nil)
+	if err != nil {
+		return "", err
+	}
+	s.mutex.Lock()
+	s.size = &pty.Winsize{Rows: uint16(height - 1), Cols: uint16(width)} // -1 for status line
+	s.dir = dir
+	_, err = s.newWindow(args, dir, windowName)
+	s.mutex.Unlock()
+	if err != nil {
+		ctx.daemon.removeSession(s)
+		return "", err
+	}
+	return "", nil
+}
+
+// SessionInfo describes a session for list-sessions --format json.
+type SessionInfo struct {
+	Name     string `json:"session_name"`
+	Windows  int    `json:"session_windows"`
+	Attached int    `json:"session_attached"`        // number of clients
+	Group    string `json:"session_group,omitempty"` // the session its group was made from
+}
+
+// cmdListSessions implements list-sessions [--format json], one line per
+// session.
+func cmdListSessions(ctx *CommandContext, args []string) (string, error) {
+	asJSON, args, err := formatFlag(args)
+	if err != nil {
+		return "", err
+	}
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: list-sessions [--format json]")
+	}
+	sessions := make([]SessionInfo, 0)
+	for _, s := range ctx.daemon.Sessions() {
+		s.mutex.Lock()
+		windows := len(s.windows)
+		s.mutex.Unlock()
+		s.clientMutex.Lock()
+		clients := len(s.clients)
+		s.clientMutex.Unlock()
+		sessions = append(sessions, SessionInfo{Name: s.Name(), Windows: windows, Attached: clients, Group: s.GroupName()})
+	}
+	if asJSON {
+		return jsonOutput(sessions)
+	}
+
+	var b strings.Builder
+	for _, s := range sessions {
+		fmt.Fprintf(&b, "%s: %d windows", s.Name, s.Windows)
+		if s.Group != "" {
+			fmt.Fprintf(&b, " (group %s)", s.Group)
+		}
+		if s.Attached > 0 {
+			b.WriteString(" (attached)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// cmdHasSession implements has-session -t target-session, failing when
+// there is no such session.
+func cmdHasSession(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 2 || args[0] != "-t" {
+		return "", fmt.Errorf("usage: has-session -t target-session")
+	}
+	_, err := ctx.resolveSession(args[1])
+	return "", err
+}
+
+// cmdRenameSession implements rename-session [-t target-session] new-name.
+func cmdRenameSession(ctx *CommandContext, args []string) (string, error) {
+	spec, args, err := targetFlag(args)
+	if err != nil || len(args) != 1 {
+		return "", fmt.Errorf("usage: rename-session [-t target-session] new-name")
+	}
+	s, err := ctx.resolveSession(spec)
+	if err != nil {
+		return "", err
+	}
+	return "", ctx.daemon.renameSession(s, args[0])
+}
+
+// cmdSetDirectory implements set-directory [-w] [-t target] [directory],
+// setting where the session's new windows, or with -w the window's new
+// panes, start when not given -c. With no directory they start in the
+// daemon's again.
+func cmdSetDirectory(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "wt:")
+	if err != nil || len(args) > 1 {
+		return "", fmt.Errorf("usage: set-directory [-w] [-t target] [directory]")
+	}
+	dir := ""
+	if len(args) == 1 {
+		dir = ctx.startDirectory(args[0])
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("not a directory: %s", dir)
+		}
+	}
+	if _, ok := flags['w']; ok {
+		t, err := ctx.resolveTarget(flags['t'])
+		if err != nil {
+			return "", err
+		}
+		t.session.mutex.Lock()
+		defer t.session.mutex.Unlock()
+		t.window.dir = dir
+		return "", nil
+	}
+	s, err := ctx.resolveSession(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dir = dir
+	return "", nil
+}
+
+// cmdSwitchClient implements switch-client -t target for an attached
+// client: it shows the target's session, switching to the target pane.
+// switch-client -T is handled by the client itself.
+func cmdSwitchClient(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 2 || args[0] != "-t" || ctx.client == nil {
+		return "", fmt.Errorf("usage: switch-client -t target")
+	}
+	t, err := ctx.resolveTarget(args[1])
+	if err != nil {
+		return "", err
+	}
+	ctx.client.switchSession(t.session)
+	t.session.SelectPaneID(t.pane.id)
+	return "", nil
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"term/pkg/protocol"
+)
+
+// shareInterval is how often a shared pane's screen is checked for
+// changes to send to viewers.
+const shareInterval = 200 * time.Millisecond
+
+// paneShare is a pane shown read-only to web browsers by share-pane. The
+// daemon serves a page at /<token> whose script opens a WebSocket at
+// /<token>/ws and is sent the pane's screen as text (Pane.dumpScreen)
+// whenever it changes. Nothing viewers send reaches the pane.
+type paneShare struct {
+	paneID  int
+	url     string
+	server  *http.Server
+	expires time.Time
+	done    chan struct{}
+
+	viewers map[net.Conn]*shareViewer
+	screen  string // the last screen sent
+	mutex   sync.Mutex
+}
+
+// shareViewer is a browser watching a share. Its writer sends it the
+// screens offered, so a slow viewer holds up only itself; one that has
+// fallen behind is sent just the latest screen.
+type shareViewer struct {
+	conn    net.Conn
+	screens chan string
+}
+
+// cmdSharePane implements share-pane [-l address] [-m minutes]
+// [-t target-pane], sharing a pane read-only over HTTP on address for
+// minutes (default 60) and printing the URL, whose random token is all
+// that protects it. The default address is a free port on the loopback
+// interface, for a viewer on this host or through an SSH tunnel; others
+// are reached only with an explicit -l, such as -l :8080. A pane already
+// shared prints its URL again.
+func cmdSharePane(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "l:m:t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: share-pane [-l address] [-m minutes] [-t target-pane]")
+	}
+	minutes := 60
+	if m := flags['m']; m != "" {
+		if minutes, err = strconv.Atoi(m); err != nil || minutes < 1 {
+			return "", fmt.Errorf("bad minutes: %s", m)
+		}
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	d := ctx.daemon
+	d.mutex.Lock()
+	share := d.shares[t.pane.id]
+	d.mutex.Unlock()
+	if share != nil {
+		return share.url + "\n", nil
+	}
+
+	addr := flags['l']
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		listener.Close()
+		return "", err
+	}
+	token := hex.EncodeToString(key)
+	share = &paneShare{
+		paneID:  t.pane.id,
+		url:     shareURL(listener.Addr().(*net.TCPAddr), token),
+		expires: time.Now().Add(time.Duration(minutes) * time.Minute),
+		done:    make(chan struct{}),
+		viewers: make(map[net.Conn]*shareViewer),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /"+token, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, sharePage, html.EscapeString(fmt.Sprintf("%%%d", share.paneID)))
+	})
+	mux.HandleFunc("GET /"+token+"/ws", share.serveViewer)
+	share.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	d.mutex.Lock()
+	if other := d.shares[t.pane.id]; other != nil {
+		d.mutex.Unlock()
+		listener.Close()
+		return other.url + "\n", nil
+	}
+	d.shares[t.pane.id] = share
+	d.mutex.Unlock()
+	go share.server.Serve(listener)
+	go share.run(d, t.pane)
+	d.logf("Sharing pane %%%d at %s", t.pane.id, share.url)
+	return share.url + "\n", nil
+}
+
+// cmdUnsharePane implements unshare-pane [-t target-pane], ending a
+// pane's share and disconnecting its viewers.
+func cmdUnsharePane(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "t:")
+	if err != nil || len(args) != 0 {
+		return "", fmt.Errorf("usage: unshare-pane [-t target-pane]")
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	if !ctx.daemon.unshare(t.pane.id) {
+		return "", fmt.Errorf("pane %%%d isn't shared", t.pane.id)
+	}
+	return "", nil
+}
+
+// unshare ends the share of the pane with id, reporting whether it had one.
+func (d *Daemon) unshare(id int) bool {
+	d.mutex.Lock()
+	share := d.shares[id]
+	delete(d.shares, id)
+	d.mutex.Unlock()
+	if share == nil {
+		return false
+	}
+	close(share.done)
+	share.server.Close()
+	share.mutex.Lock()
+	for conn := range share.viewers {
+		conn.Close()
+	}
+	share.mutex.Unlock()
+	d.logf("Stopped sharing pane %%%d", id)
+	return true
+}
+
+// shareURL is the URL of a share listening on addr, naming this host when
+// it listens on every interface.
+func shareURL(addr *net.TCPAddr, token string) string {
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() {
+		if name, err := os.Hostname(); err == nil {
+			host = name
+		}
+	}
+	return fmt.Sprintf("http://%s/%s", net.JoinHostPort(host, strconv.Itoa(addr.Port)), token)
+}
+
+// run sends the pane's screen to the viewers when it changes, until the
+// share ends, expires or the pane is gone.
+func (share *paneShare) run(d *Daemon, p *Pane) {
+	ticker := time.NewTicker(shareInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-share.done:
+			return
+		case <-ticker.C:
+		}
+		if _, err := d.findPane(p.id); err != nil || time.Now().After(share.expires) {
+			d.unshare(p.id)
+			return
+		}
+		screen := p.dumpScreen(false)
+		share.mutex.Lock()
+		if screen != share.screen {
+			share.screen = screen
+			for _, viewer := range share.viewers {
+				viewer.offer(screen)
+			}
+		}
+		share.mutex.Unlock()
+	}
+}
+
+// serveViewer upgrades a request to a WebSocket, sends it the screen, if
+// one was taken yet, and adds it to the viewers until it goes away. What
+// it sends is read and thrown away.
+func (share *paneShare) serveViewer(w http.ResponseWriter, r *http.Request) {
+	conn, err := acceptWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	viewer := &shareViewer{conn: conn, screens: make(chan string, 1)}
+	go viewer.write()
+	share.mutex.Lock()
+	share.viewers[conn] = viewer
+	if share.screen != "" {
+		viewer.offer(share.screen)
+	}
+	share.mutex.Unlock()
+	io.Copy(io.Discard, conn)
+	share.mutex.Lock()
+	delete(share.viewers, conn)
+	share.mutex.Unlock()
+	close(viewer.screens)
+	conn.Close()
+}
+
+// offer queues a screen for the viewer in place of any it hasn't been
+// sent yet. The caller must hold share.mutex, which makes it the only
+// sender.
+func (viewer *shareViewer) offer(screen string) {
+	select {
+	case <-viewer.screens:
+	default:
+	}
+	viewer.screens <- screen
+}
+
+// write sends the viewer its screens as text messages, closing a viewer
+// that doesn't take one in time.
+func (viewer *shareViewer) write() {
+	for screen := range viewer.screens {
+		viewer.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := viewer.conn.Write(webSocketFrame(0x1, []byte(screen))); err != nil {
+			viewer.conn.Close()
+			return
+		}
+	}
+}
+
+// webSocketGUID is the key suffix of the WebSocket opening handshake
+// (RFC 6455).
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// acceptWebSocket answers a WebSocket opening handshake and returns the
+// connection, taken over from the HTTP server. Browsers send the page's
+// origin, which must be this server, so another site a viewer has open
+// can't watch through them; clients that aren't browsers send none.
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	hijacker, ok := w.(http.Hijacker)
+	if key == "" || r.Header.Get("Upgrade") != "websocket" || !ok {
+		http.Error(w, "expected a WebSocket", http.StatusBadRequest)
+		return nil, fmt.Errorf("not a WebSocket request")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "cross-origin WebSocket", http.StatusForbidden)
+			return nil, fmt.Errorf("WebSocket from origin %s", origin)
+		}
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// webSocketFrame frames a whole unmasked message from the server.
+func webSocketFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode} // FIN
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n < 1<<16:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+// sharePage is the page viewers load, with the pane's name for its title.
+const sharePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>term: pane %s</title>
+<style>
+body { background: #000; color: #ddd; margin: 1em; }
+pre { font: 14px/1.2 monospace; margin: 0; }
+#status { color: #888; font: 12px sans-serif; margin-bottom: 0.5em; }
+</style>
+</head>
+<body>
+<div id="status">Connecting...</div>
+<pre id="screen"></pre>
+<script>
+const status = document.getElementById("status");
+const screen = document.getElementById("screen");
+const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + location.pathname + "/ws");
+ws.onopen = () => { status.textContent = "Watching, read-only"; };
+ws.onmessage = (e) => { screen.textContent = e.data; };
+ws.onclose = () => { status.textContent = "The share has ended"; };
+</script>
+</body>
+</html>
+`
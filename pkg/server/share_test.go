@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFrame reads a text message framed by webSocketFrame.
+func readFrame(r io.Reader) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	n := uint64(header[1])
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return "", err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return "", err
+		}
+		n = binary.BigEndian.Uint64(ext)
+	}
+	payload := make([]byte, n)
+	_, err := io.ReadFull(r, payload)
+	return string(payload), err
+}
+
+func TestWebSocketFrame(t *testing.T) {
+	for _, n := range []int{0, 1, 125, 126, 65535, 65536, 100000} {
+		payload := strings.Repeat("x", n)
+		frame := webSocketFrame(0x1, []byte(payload))
+		if frame[0] != 0x81 {
+			t.Errorf("%d bytes: first byte %#x, want FIN and text", n, frame[0])
+		}
+		if got, err := readFrame(strings.NewReader(string(frame))); err != nil || got != payload {
+			t.Errorf("%d bytes: read back %d bytes, %v", n, len(got), err)
+		}
+	}
+}
+
+func TestAcceptWebSocket(t *testing.T) {
+	share := &paneShare{viewers: make(map[net.Conn]*shareViewer), screen: "hello"}
+	server := httptest.NewServer(http.HandlerFunc(share.serveViewer))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	tests := []struct {
+		name    string
+		headers string
+		status  int
+	}{
+		{"no origin", "Upgrade: websocket\r\nSec-WebSocket-Key: a2V5\r\n", 101},
+		{"same origin", "Upgrade: websocket\r\nSec-WebSocket-Key: a2V5\r\nOrigin: " + server.URL + "\r\n", 101},
+		{"another site", "Upgrade: websocket\r\nSec-WebSocket-Key: a2V5\r\nOrigin: http://evil.example\r\n", 403},
+		{"not a WebSocket", "", 400},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\n%s\r\n", host, tt.headers)
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil || resp.StatusCode != tt.status {
+			t.Errorf("%s: %v, %v, want status %d", tt.name, resp, err, tt.status)
+		} else if tt.status == 101 {
+			// The screen taken so far is sent on connecting
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if screen, err := readFrame(r); err != nil || screen != "hello" {
+				t.Errorf("%s: viewer was sent %q, %v, want the screen", tt.name, screen, err)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestShareViewerFallenBehind(t *testing.T) {
+	// A viewer that isn't reading holds up nobody, and is sent the latest
+	// screen once it reads
+	server, client := net.Pipe()
+	defer client.Close()
+	viewer := &shareViewer{conn: server, screens: make(chan string, 1)}
+	go viewer.write()
+	done := make(chan struct{})
+	go func() {
+		for i := range 100 {
+			viewer.offer(fmt.Sprint(i))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("offer blocked on a viewer that isn't reading")
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		screen, err := readFrame(client)
+		if err != nil {
+			t.Fatalf("never sent the latest screen: %v", err)
+		}
+		if screen == "99" {
+			break
+		}
+	}
+	close(viewer.screens)
+}
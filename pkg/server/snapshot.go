@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/creack/pty"
+
+	"term/pkg/protocol"
+)
+
+// state describes the session for a protocol.Snapshot.
+func (s *Session) state() protocol.SessionState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state := protocol.SessionState{Name: s.Name(), Windows: make([]protocol.WindowState, 0, len(s.windows)), Floats: s.floatInfos()}
+	for wi, w := range s.windows {
+		ws := protocol.WindowState{Index: w.index, Name: w.name, Active: wi == s.activeWindow}
+		for i, p := range w.panes {
+			rows, cols, _ := pty.Getsize(p.ptmx)
+			p.replayMutex.Lock()
+			historyFile, historyLines := p.historyPath, p.replayTop
+			p.replayMutex.Unlock()
+			ws.Panes = append(ws.Panes, protocol.PaneState{
+				ID:           p.id,
+				Index:        w.paneIndex(i, s.options),
+				Title:        p.Title(),
+				Width:        cols,
+				Height:       rows,
+				Active:       i == w.activePane,
+				HistoryFile:  historyFile,
+				HistoryLines: historyLines,
+			})
+		}
+		state.Windows = append(state.Windows, ws)
+	}
+	return state
+}
+
+// createSnapshotMessage describes every session for a client attaching to
+// attached.
+func (d *Daemon) createSnapshotMessage(attached *Session) []byte {
+	snapshot := protocol.Snapshot{Session: attached.Name(), Sessions: make([]protocol.SessionState, 0)}
+	for _, s := range d.Sessions() {
+		snapshot.Sessions = append(snapshot.Sessions, s.state())
+	}
+	_, snapshot.ActivePane = attached.Current()
+	payload, _ := json.Marshal(snapshot)
+	return protocol.Encode(protocol.MsgSnapshot, payload)
+}
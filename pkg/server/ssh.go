@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// sshCommand is what a pane connected to host runs. The -- ends ssh's
+// options, so a host such as -oProxyCommand=... is only ever a host name.
+func sshCommand(host string) []string {
+	return []string{"ssh", "--", host}
+}
+
+// sshHosts returns the hosts choose-host offers: those in the ssh-hosts
+// option, then the Host entries of ~/.ssh/config without wildcards or
+// negations, each once.
+func sshHosts(configured string) []string {
+	hosts := strings.Fields(configured)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return hosts
+	}
+	f, err := os.Open(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		return hosts
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Host") {
+			continue
+		}
+		for _, host := range fields[1:] {
+			if !strings.ContainsAny(host, "*?!") && !slices.Contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// cmdChooseHost implements choose-host [-s], opening a chooser on the SSH
+// hosts (sshHosts). Picking one opens a window connected to it, named
+// after it, or with -s a pane in the current window.
+func cmdChooseHost(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "s")
+	if err != nil || len(args) != 0 || ctx.client == nil {
+		return "", fmt.Errorf("usage: choose-host [-s]")
+	}
+	command := "new-window --ssh "
+	if _, ok := flags['s']; ok {
+		command = "split-window --ssh "
+	}
+	list := protocol.ChooserList{Title: "Connect to a host"}
+	for _, host := range sshHosts(ctx.daemon.options.String("ssh-hosts")) {
+		list.Items = append(list.Items, protocol.ChooserItem{Text: host, Command: command + protocol.ShellQuote(host)})
+	}
+	if len(list.Items) == 0 {
+		return "", fmt.Errorf("no hosts: set ssh-hosts or add them to ~/.ssh/config")
+	}
+	payload, _ := json.Marshal(list)
+	ctx.client.conn.Write(protocol.Encode(protocol.MsgChooser, payload))
+	return "", nil
+}
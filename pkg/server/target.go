@@ -0,0 +1,226 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// target is what a -t argument names: a pane, with its window and session.
+type target struct {
+	session *Session
+	window  *Window
+	pane    *Pane
+}
+
+// resolveTarget finds the pane a -t argument names. Targets have the form
+// session:window.pane where any part may be left out for the current one:
+//
+//	work:2.1   pane 1 of window 2 in session work
+//	:1         window 1 of the current session
+//	:+1 .-1    the next window, the previous pane
+//	editor     a session, or else a window of the current session, by name
+//	%5         the pane with id 5, in any session
+//	~          the marked pane, also {marked}
+//
+// Windows are given by index or name and panes by index. The current pane
+// is the one a CLI command was run from, or else the session's active pane.
+func (ctx *CommandContext) resolveTarget(spec string) (target, error) {
+	switch {
+	case spec == "~" || spec == "{marked}":
+		if id := ctx.daemon.MarkedPane(); id >= 0 {
+			return ctx.daemon.findPane(id)
+		}
+		return target{}, fmt.Errorf("no marked pane")
+	case strings.HasPrefix(spec, "%"):
+		id, err := strconv.Atoi(spec[1:])
+		if err != nil {
+			return target{}, fmt.Errorf("bad pane id: %s", spec)
+		}
+		return ctx.daemon.findPane(id)
+	}
+
+	sessionName, rest, hasSession := strings.Cut(spec, ":")
+	if !hasSession {
+		sessionName, rest = "", spec
+	}
+	windowSpec, paneSpec, _ := strings.Cut(rest, ".")
+	s := ctx.session
+	if sessionName != "" {
+		if s = ctx.daemon.FindSession(sessionName); s == nil {
+			return target{}, fmt.Errorf("can't find session: %s", sessionName)
+		}
+	} else if !hasSession && !strings.Contains(rest, ".") {
+		if named := ctx.daemon.FindSession(windowSpec); named != nil {
+			s, windowSpec = named, ""
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.windows) == 0 {
+		return target{}, fmt.Errorf("session %s has no windows", s.Name())
+	}
+	current, currentPane := s.activeWindow, s.windows[s.activeWindow].activePane
+	if s == ctx.session && ctx.pane != nil {
+		if wi, pi := s.findPane(ctx.pane.id); wi >= 0 {
+			current, currentPane = wi, pi
+		}
+	}
+
+	wi, err := s.findWindow(windowSpec, current)
+	if err != nil {
+		return target{}, err
+	}
+	w := s.windows[wi]
+	if wi != current {
+		currentPane = w.activePane
+	}
+	pi, err := findIndex(paneSpec, currentPane, len(w.panes), func(n int) int {
+		if i := n - s.options.Number("pane-base-index"); i >= 0 && i < len(w.panes) {
+			return i
+		}
+		return -1
+	})
+	if err != nil {
+		return target{}, fmt.Errorf("can't find pane: %s", paneSpec)
+	}
+	return target{session: s, window: w, pane: w.panes[pi]}, nil
+}
+
+// resolveSession finds the session a -t argument names. Unlike in other
+// targets, a bare name is always a session name, and it or an empty spec
+// names a session even before it has windows, as the config file may
+// create them.
+func (ctx *CommandContext) resolveSession(spec string) (*Session, error) {
+	if !strings.ContainsAny(spec, ":%~{") {
+		if spec == "" && ctx.pane == nil && ctx.session != nil {
+			return ctx.session, nil
+		}
+		if s := ctx.daemon.FindSession(spec); s != nil {
+			return s, nil
+		}
+		spec += ":"
+	}
+	t, err := ctx.resolveTarget(spec)
+	return t.session, err
+}
+
+// findWindow returns the position of the window spec names, by index, name
+// or relative to current. The caller must hold s.mutex.
+func (s *Session) findWindow(spec string, current int) (int, error) {
+	i, err := findIndex(spec, current, len(s.windows), func(n int) int {
+		for i, w := range s.windows {
+			if w.index == n {
+				return i
+			}
+		}
+		return -1
+	})
+	if err == nil {
+		return i, nil
+	}
+	found := -1
+	for i, w := range s.windows {
+		if w.name == spec {
+			if found >= 0 {
+				return -1, fmt.Errorf("more than one window named %s", spec)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("can't find window: %s", spec)
+	}
+	return found, nil
+}
+
+// findPane returns the positions of the window and pane with the given
+// pane id, or -1, -1. The caller must hold s.mutex.
+func (s *Session) findPane(id int) (int, int) {
+	for wi, w := range s.windows {
+		for pi, p := range w.panes {
+			if p.id == id {
+				return wi, pi
+			}
+		}
+	}
+	return -1, -1
+}
+
+// findIndex resolves the part of a target that picks one of n items: empty
+// for current, +k or -k relative to it, wrapping around, or a number that
+// byNumber turns into a position.
+func findIndex(spec string, current, n int, byNumber func(int) int) (int, error) {
+	if spec == "" {
+		return current, nil
+	}
+	if spec[0] == '+' || spec[0] == '-' {
+		k := 1
+		if len(spec) > 1 {
+			var err error
+			if k, err = strconv.Atoi(spec[1:]); err != nil {
+				return -1, fmt.Errorf("bad offset: %s", spec)
+			}
+		}
+		if spec[0] == '-' {
+			k = -k
+		}
+		return ((current+k)%n + n) % n, nil
+	}
+	num, err := strconv.Atoi(spec)
+	if err != nil {
+		return -1, fmt.Errorf("not a number: %s", spec)
+	}
+	if i := byNumber(num); i >= 0 {
+		return i, nil
+	}
+	return -1, fmt.Errorf("no such index: %s", spec)
+}
+
+// findPane looks for the pane with the given id in every session.
+func (d *Daemon) findPane(id int) (target, error) {
+	for _, s := range d.Sessions() {
+		s.mutex.Lock()
+		wi, pi := s.findPane(id)
+		var t target
+		if wi >= 0 {
+			t = target{session: s, window: s.windows[wi], pane: s.windows[wi].panes[pi]}
+		}
+		s.mutex.Unlock()
+		if t.pane != nil {
+			return t, nil
+		}
+	}
+	return target{}, fmt.Errorf("can't find pane: %%%d", id)
+}
+
+// MarkedPane returns the id of the pane marked with select-pane -m, or -1.
+func (d *Daemon) MarkedPane() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.markedPane
+}
+
+func (d *Daemon) SetMarkedPane(id int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.markedPane = id
+}
+
+// clientPane finds the pane a CLI command was run from, given the TERM_MUX
+// value the CLI found in its environment. It fails when the command was not
+// run from one of this daemon's panes.
+func (d *Daemon) clientPane(termMux string) (target, bool) {
+	parts := strings.Split(termMux, ",")
+	if len(parts) != 3 || parts[0] != socketPath || parts[1] != strconv.Itoa(os.Getpid()) {
+		return target{}, false
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return target{}, false
+	}
+	t, err := d.findPane(id)
+	return t, err == nil
+}
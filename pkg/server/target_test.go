@@ -0,0 +1,148 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fixtureDaemon is a daemon with no socket, sessions or processes, for
+// fixtureSession to add to.
+func fixtureDaemon() *Daemon {
+	d := &Daemon{options: NewOptions(), environ: NewEnvironment(), markedPane: -1, messages: &messageLog{}}
+	d.scripts, d.plugins, d.subscribers = NewScripts(d), NewPlugins(d), NewSubscribers()
+	return d
+}
+
+// fixtureSession adds a session showing windows to d, as addSession does
+// but without watching its panes' processes.
+func fixtureSession(d *Daemon, name string, windows ...*Window) *Session {
+	s := NewSession(name, d.options, d.environ)
+	s.mutex = &d.sessionMutex
+	s.messages = d.messages
+	s.scripts, s.plugins, s.subscribers = d.scripts, d.plugins, d.subscribers
+	s.windows = windows
+	for _, w := range windows {
+		w.links = []*Session{s}
+		for _, p := range w.panes {
+			p.shownIn.Store(&[]*Session{s})
+		}
+		s.nextWindowID = max(s.nextWindowID, w.id+1)
+	}
+	d.sessions = append(d.sessions, s)
+	return s
+}
+
+// fixtureWindow is a window at index whose panes have ids and run nothing.
+func fixtureWindow(index int, name string, active int, ids ...int) *Window {
+	w := &Window{id: index, index: index, windowContent: &windowContent{name: name, activePane: active}}
+	for _, id := range ids {
+		w.panes = append(w.panes, &Pane{id: id})
+	}
+	return w
+}
+
+// targetFixture builds a daemon with two sessions:
+//
+//	work   0:editor (panes 10, 11*)  1:logs (12)  3:dup (13)  4:dup (14)
+//	other  0:shell (20)
+func targetFixture() (*Daemon, *Session) {
+	d := fixtureDaemon()
+	work := fixtureSession(d, "work",
+		fixtureWindow(0, "editor", 1, 10, 11),
+		fixtureWindow(1, "logs", 0, 12),
+		fixtureWindow(3, "dup", 0, 13),
+		fixtureWindow(4, "dup", 0, 14))
+	fixtureSession(d, "other", fixtureWindow(0, "shell", 0, 20))
+	return d, work
+}
+
+func TestResolveTarget(t *testing.T) {
+	d, work := targetFixture()
+	tests := []struct {
+		spec     string
+		fromPane int // the pane a CLI command ran from, or -1
+		want     int // pane id
+		session  string
+	}{
+		{"", -1, 11, "work"},
+		{"work:1", -1, 12, "work"},
+		{"work:1.0", -1, 12, "work"},
+		{":0.0", -1, 10, "work"},
+		{":editor", -1, 11, "work"},
+		{"other", -1, 20, "other"},
+		{"other:", -1, 20, "other"},
+		{"logs", -1, 12, "work"},
+		{":+1", -1, 12, "work"},
+		{":-1", -1, 14, "work"},
+		{":+2", -1, 13, "work"},
+		{".-1", -1, 10, "work"},
+		{".+1", -1, 10, "work"},
+		{"%20", -1, 20, "other"},
+		{"", 10, 10, "work"},
+		{".+1", 10, 11, "work"},
+		{":+1", 12, 13, "work"},
+		{"other:", 12, 20, "other"},
+	}
+	for _, tt := range tests {
+		ctx := &CommandContext{daemon: d, session: work}
+		if tt.fromPane >= 0 {
+			from, err := d.findPane(tt.fromPane)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx.pane = from.pane
+		}
+		got, err := ctx.resolveTarget(tt.spec)
+		if err != nil {
+			t.Errorf("resolveTarget(%q) from %d: %v", tt.spec, tt.fromPane, err)
+			continue
+		}
+		if got.pane.id != tt.want || got.session.Name() != tt.session {
+			t.Errorf("resolveTarget(%q) from %d = %s pane %d, want %s pane %d",
+				tt.spec, tt.fromPane, got.session.Name(), got.pane.id, tt.session, tt.want)
+		}
+		if !slices.Contains(got.window.panes, got.pane) {
+			t.Errorf("resolveTarget(%q): pane %d is not in its window", tt.spec, got.pane.id)
+		}
+	}
+}
+
+func TestResolveTargetMarked(t *testing.T) {
+	d, work := targetFixture()
+	ctx := &CommandContext{daemon: d, session: work}
+	if _, err := ctx.resolveTarget("~"); err == nil {
+		t.Error("resolveTarget(~) with no marked pane succeeded")
+	}
+	d.SetMarkedPane(13)
+	for _, spec := range []string{"~", "{marked}"} {
+		got, err := ctx.resolveTarget(spec)
+		if err != nil || got.pane.id != 13 || got.window.index != 3 {
+			t.Errorf("resolveTarget(%q) = %v, %v, want pane 13 in window 3", spec, got.pane, err)
+		}
+	}
+}
+
+func TestResolveTargetErrors(t *testing.T) {
+	d, work := targetFixture()
+	tests := []struct {
+		spec string
+		want string // in the error
+	}{
+		{"nope:", "can't find session: nope"},
+		{":9", "can't find window: 9"},
+		{":dup", "more than one window named dup"},
+		{"work:0.5", "can't find pane: 5"},
+		{":0.x", "can't find pane: x"},
+		{"%x", "bad pane id: %x"},
+		{"%99", "can't find pane: %99"},
+		{"nothing", "can't find window: nothing"},
+	}
+	for _, tt := range tests {
+		ctx := &CommandContext{daemon: d, session: work}
+		_, err := ctx.resolveTarget(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("resolveTarget(%q) = %v, want an error with %q", tt.spec, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"term/pkg/protocol"
+)
+
+// Trigger watches a pane's output for lines matching pattern. Lines are
+// matched without escape sequences, as vt.LineScanner gives them.
+type Trigger struct {
+	pattern *regexp.Regexp
+	command []string // run on a match after #{} expansion, may be empty
+	once    bool     // removed after its first match
+	daemon  *Daemon  // what command runs against
+}
+
+func (p *Pane) AddTrigger(t *Trigger) {
+	p.triggerMutex.Lock()
+	defer p.triggerMutex.Unlock()
+	p.triggers = append(p.triggers, t)
+}
+
+// RemoveTriggers removes the triggers with the given pattern, or all of
+// them when it is empty, and returns how many were removed.
+func (p *Pane) RemoveTriggers(pattern string) int {
+	p.triggerMutex.Lock()
+	defer p.triggerMutex.Unlock()
+	n := len(p.triggers)
+	p.triggers = slices.DeleteFunc(p.triggers, func(t *Trigger) bool {
+		return pattern == "" || t.pattern.String() == pattern
+	})
+	return n - len(p.triggers)
+}
+
+func (p *Pane) Triggers() []*Trigger {
+	p.triggerMutex.Lock()
+	defer p.triggerMutex.Unlock()
+	return slices.Clone(p.triggers)
+}
+
+// matchTriggers returns the triggers matching line, removing those that
+// only fire once.
+func (p *Pane) matchTriggers(line string) []*Trigger {
+	p.triggerMutex.Lock()
+	defer p.triggerMutex.Unlock()
+	var matched []*Trigger
+	p.triggers = slices.DeleteFunc(p.triggers, func(t *Trigger) bool {
+		if !t.pattern.MatchString(line) {
+			return false
+		}
+		matched = append(matched, t)
+		return t.once
+	})
+	return matched
+}
+
+// checkTriggers matches each line of a pane's output against its
+// triggers and its window's monitor-content. It is called from the pane's
+// output goroutine, which owns p.lines.
+func (s *Session) checkTriggers(p *Pane, output []byte) {
+	s.mutex.Lock()
+	var monitor *regexp.Regexp
+	if wi, _ := s.findPane(p.id); wi >= 0 {
+		monitor = s.windows[wi].monitorContent
+	}
+	s.mutex.Unlock()
+	if len(p.Triggers()) == 0 && monitor == nil {
+		return
+	}
+	matched := false
+	p.lines.Scan(output, func(line string) {
+		if monitor != nil && monitor.MatchString(line) {
+			matched = true
+		}
+		for _, t := range p.matchTriggers(line) {
+			s.triggered(p, t, line)
+		}
+	})
+	if matched {
+		s.contentMatched(p)
+	}
+}
+
+// contentMatched flags the pane's window in the status line, unless it is
+// the active one, after its output matched monitor-content.
+func (s *Session) contentMatched(p *Pane) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if wi, _ := s.findPane(p.id); wi >= 0 && wi != s.activeWindow && !s.windows[wi].matched {
+		s.windows[wi].matched = true
+		s.redraw()
+	}
+}
+
+// triggered acts on a match: the pane's window is flagged in the status
+// line unless it is the active one, the match is logged and sent as a
+// pane-matched event, and the trigger's command is run.
+func (s *Session) triggered(p *Pane, t *Trigger, line string) {
+	s.logf("Pane %%%d matched %q: %s", p.id, t.pattern.String(), line)
+	s.fire("pane-matched", map[string]any{"session_name": s.Name(), "pane_id": p.id, "pattern": t.pattern.String(), "line": line})
+
+	vars := map[string]string{"session_name": s.Name(), "pane_id": fmt.Sprint(p.id)}
+	s.mutex.Lock()
+	if wi, pi := s.findPane(p.id); wi >= 0 {
+		if wi != s.activeWindow {
+			s.windows[wi].alert = true
+		}
+		vars = s.paneFormatVars(s.windows[wi], pi)
+	}
+	s.redraw()
+	s.mutex.Unlock()
+
+	if len(t.command) == 0 {
+		return
+	}
+	args, env := t.commandLine(vars, line)
+	// Not on the output goroutine, which the command may wait on
+	go func() {
+		defer recoverPanic(s.errorf, "watch-pane command", nil)
+		ctx := &CommandContext{daemon: t.daemon, session: s, pane: p, env: env}
+		if _, err := ctx.RunCommand(args); err != nil {
+			s.errorf("watch-pane command failed: %v", err)
+		}
+	}()
+}
+
+// commandLine is the trigger's command for a match of line in the pane
+// with vars. Only #{watch_pattern}, which the user gave, is expanded into
+// its words: the line and the pane's variables, among them a title or
+// path anything in the pane can set, are never put where run-shell would
+// hand them to the shell, and go in its environment instead, as
+// $TERM_MUX_WATCH_LINE and $TERM_MUX_<NAME>, such as $TERM_MUX_PANE_TITLE.
+func (t *Trigger) commandLine(vars map[string]string, line string) (args, env []string) {
+	pattern := map[string]string{"watch_pattern": t.pattern.String()}
+	args = make([]string, len(t.command))
+	for i, word := range t.command {
+		args[i] = expandFormat(word, pattern)
+	}
+	for name, value := range vars {
+		env = append(env, "TERM_MUX_"+strings.ToUpper(name)+"="+value)
+	}
+	slices.Sort(env)
+	env = append(env, "TERM_MUX_WATCH_LINE="+line, "TERM_MUX_WATCH_PATTERN="+t.pattern.String(), "TERM_MUX_PANE="+vars["pane_id"])
+	return args, env
+}
+
+// cmdWatchPane implements watch-pane [-o] [-c command] [-t target-pane]
+// pattern. Lines of the pane's output matching the regular expression
+// flag its window, are logged and fire pane-matched; -c also runs a
+// command line, with #{watch_pattern} the pattern and, for run-shell,
+// $TERM_MUX_WATCH_LINE the matching line and the pane's variables as
+// $TERM_MUX_<NAME> (see Trigger.commandLine), and -o removes the watch
+// after its first match.
+func cmdWatchPane(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "c:ot:")
+	if err != nil || len(args) != 1 {
+		return "", fmt.Errorf("usage: watch-pane [-o] [-c command] [-t target-pane] pattern")
+	}
+	pattern, err := regexp.Compile(args[0])
+	if err != nil {
+		return "", fmt.Errorf("bad pattern: %v", err)
+	}
+	command, err := protocol.ParseCommandLine(flags['c'])
+	if err != nil {
+		return "", err
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	_, once := flags['o']
+	t.pane.AddTrigger(&Trigger{pattern: pattern, command: command, once: once, daemon: ctx.daemon})
+	return "", nil
+}
+
+// cmdUnwatchPane implements unwatch-pane [-t target-pane] [pattern],
+// removing the pane's watches for pattern, or all of them.
+func cmdUnwatchPane(ctx *CommandContext, args []string) (string, error) {
+	flags, args, err := protocol.ParseFlags(args, "t:")
+	if err != nil || len(args) > 1 {
+		return "", fmt.Errorf("usage: unwatch-pane [-t target-pane] [pattern]")
+	}
+	t, err := ctx.resolveTarget(flags['t'])
+	if err != nil {
+		return "", err
+	}
+	pattern := strings.Join(args, "")
+	if t.pane.RemoveTriggers(pattern) == 0 && pattern != "" {
+		return "", fmt.Errorf("no watch for %s in pane %%%d", pattern, t.pane.id)
+	}
+	return "", nil
+}
+
+// cmdListWatches implements list-watches, one line per watch in every
+// session.
+func cmdListWatches(ctx *CommandContext, args []string) (string, error) {
+	if len(args) != 0 {
+		return "", fmt.Errorf("usage: list-watches")
+	}
+	var b strings.Builder
+	for _, s := range ctx.daemon.Sessions() {
+		s.mutex.Lock()
+		for _, w := range s.windows {
+			for _, p := range w.panes {
+				for _, t := range p.Triggers() {
+					fmt.Fprintf(&b, "%s:%d %%%d: %s", s.Name(), w.index, p.id, t.pattern)
+					if len(t.command) > 0 {
+						fmt.Fprintf(&b, " -> %s", strings.Join(t.command, " "))
+					}
+					if t.once {
+						b.WriteString(" (once)")
+					}
+					b.WriteString("\n")
+				}
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return b.String(), nil
+}
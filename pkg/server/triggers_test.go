@@ -0,0 +1,46 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"term/pkg/protocol"
+)
+
+func TestTriggerCommandLine(t *testing.T) {
+	// A title, path or window name is whatever the pane's programs set,
+	// so none of them may reach the shell's command line
+	marker := filepath.Join(t.TempDir(), "injected")
+	hostile := "$(touch " + marker + ")`touch " + marker + "`;touch " + marker
+	command, err := protocol.ParseCommandLine(`run-shell "echo #{watch_pattern} #{pane_title}#{pane_current_path}#{window_name} \"$TERM_MUX_PANE_TITLE\""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger := &Trigger{pattern: regexp.MustCompile("done"), command: command}
+	vars := map[string]string{"pane_id": "3", "pane_title": hostile, "pane_current_path": hostile, "window_name": hostile}
+	args, env := trigger.commandLine(vars, "build done "+hostile)
+
+	want := []string{"run-shell", `echo done  "$TERM_MUX_PANE_TITLE"`}
+	if !slices.Equal(args, want) {
+		t.Errorf("command = %q, want %q", args, want)
+	}
+	for _, v := range []string{"TERM_MUX_PANE_TITLE=" + hostile, "TERM_MUX_PANE_CURRENT_PATH=" + hostile, "TERM_MUX_PANE=3", "TERM_MUX_PANE_ID=3", "TERM_MUX_WATCH_PATTERN=done"} {
+		if !slices.Contains(env, v) {
+			t.Errorf("environment %q is missing %q", env, v)
+		}
+	}
+
+	out, err := cmdRunShell(&CommandContext{env: env}, args[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "done "+hostile+"\n" {
+		t.Errorf("run-shell printed %q, want the title as it was", out)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("the pane's title ran as a command")
+	}
+}
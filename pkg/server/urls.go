@@ -0,0 +1,11 @@
+package server
+
+import "runtime"
+
+// defaultURLOpener is the program that opens URLs on this platform.
+func defaultURLOpener() string {
+	if runtime.GOOS == "darwin" {
+		return "open"
+	}
+	return "xdg-open"
+}
@@ -0,0 +1,58 @@
+package server
+
+import "regexp"
+
+// Window groups one or more panes. Only the active pane of the active window
+// is shown by clients. A window linked into several sessions with
+// link-window is a Window in each, with its own index, sharing the
+// windowContent.
+type Window struct {
+	id    int
+	index int
+	*windowContent
+
+	alert   bool // a long command finished or a watch matched here while not looked at
+	matched bool // output matched monitor-content here while not looked at
+}
+
+// windowContent is what the links of a window share.
+type windowContent struct {
+	name       string
+	panes      []*Pane
+	activePane int
+	named      bool   // given its name with -n, which automatic-rename keeps
+	dir        string // where new panes start without -c, see set-directory
+
+	// Set with set-option -w monitor-content, matched against the panes'
+	// lines of output
+	monitorContent *regexp.Regexp
+
+	// Sessions the window is linked into, one per group; it is closed
+	// when the last unlinks it
+	links []*Session
+}
+
+func (w *Window) ActivePane() *Pane {
+	if len(w.panes) == 0 {
+		return nil
+	}
+	return w.panes[w.activePane]
+}
+
+// paneIndex returns the user-visible number of the pane at position i.
+func (w *Window) paneIndex(i int, opts *Options) int {
+	return i + opts.Number("pane-base-index")
+}
+
+func (w *Window) removePane(id int) bool {
+	for i, p := range w.panes {
+		if p.id == id {
+			w.panes = append(w.panes[:i], w.panes[i+1:]...)
+			if w.activePane >= len(w.panes) {
+				w.activePane = len(w.panes) - 1
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,386 @@
+// Package vt emulates the terminal a pane's program writes to, for the
+// daemon's copy of each screen and each client's: PaneBuffer runs the
+// output through vt10x, keeping its scrollback and history file, and
+// reads back as a Grid of styled cells. It also names and encodes keys
+// and scans output for the sequences both sides act on.
+package vt
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/hinshun/vt10x"
+)
+
+// PaneBuffer holds the content for a single pane using vt10x terminal emulator
+type PaneBuffer struct {
+	terminal vt10x.Terminal
+	width    int
+	height   int
+	filter   seqFilter
+	// Passthrough payloads waiting to be written to the outer terminal
+	passthrough [][]byte
+
+	// Lines scrolled off the top of the screen; historyBase is the line
+	// number of the oldest
+	history       scrollback
+	historyBase   int
+	historyLimit  int
+	historyMemory int  // bytes
+	historyOpened bool // history file looked for
+	esc           escState
+	marks         []promptMark // shell integration marks, oldest first
+
+	imageSupport ImageSupport
+	images       []Image // images to draw on the outer terminal
+	screen       *Grid   // reused by Content
+
+	// Cursor shape (DECSCUSR) and color (OSC 12) set by the application,
+	// and blinking turned on or off since (mode 12), which vt10x ignores
+	cursorStyle tcell.CursorStyle
+	cursorColor string
+	cursorBlink cursorBlink
+	csi         CSIScanner
+}
+
+func NewPaneBuffer(width, height int) *PaneBuffer {
+	term := vt10x.New(vt10x.WithSize(width, height))
+
+	return &PaneBuffer{
+		terminal: term,
+		width:    width,
+		height:   height,
+	}
+}
+
+func (pb *PaneBuffer) Write(p []byte) (n int, err error) {
+	pb.csi.Scan(p, pb.handleCSI)
+	// Let vt10x handle all the ANSI parsing except the sequences it doesn't
+	// know, which the filter pulls out
+	for _, seg := range pb.filter.Split(p) {
+		if seg.isSeq {
+			pb.handleSequence(seg)
+		} else if err := pb.writeTracked(seg.data); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (pb *PaneBuffer) handleSequence(seg outputSegment) {
+	switch seg.kind {
+	case seqPassthrough:
+		pb.passthrough = append(pb.passthrough, seg.payload)
+	case seqPromptMark:
+		if len(seg.payload) > 0 {
+			pb.addPromptMark(seg.payload[0])
+		}
+	case seqSixel:
+		pb.addSixel(seg.payload)
+	case seqInlineImage:
+		pb.addInlineImage(seg.payload)
+	case seqCursorStyle:
+		pb.handleCursorStyle(seg.payload)
+	case seqCursorColor:
+		pb.handleCursorColor(seg.payload)
+	}
+}
+
+// TakePassthrough returns and clears the pending passthrough payloads.
+func (pb *PaneBuffer) TakePassthrough() [][]byte {
+	payloads := pb.passthrough
+	pb.passthrough = nil
+	return payloads
+}
+
+// Content returns the screen as a grid of cells. The grid is reused, so it
+// is only valid until the next call.
+func (pb *PaneBuffer) Content() *Grid {
+	pb.terminal.Lock()
+	defer pb.terminal.Unlock()
+
+	if pb.screen == nil {
+		pb.screen = NewGrid(pb.width, pb.height)
+	} else if w, h := pb.screen.Size(); w != pb.width || h != pb.height {
+		pb.screen.Resize(pb.width, pb.height)
+	}
+	var gc glyphCache
+	for y := 0; y < pb.height; y++ {
+		row := pb.screen.Row(y)
+		for x := range row {
+			row[x] = gc.cell(pb.terminal.Cell(x, y))
+		}
+	}
+	return pb.screen
+}
+
+// Mode returns the terminal modes set by the application, such as
+// application cursor keys.
+func (pb *PaneBuffer) Mode() vt10x.ModeFlag {
+	pb.terminal.Lock()
+	defer pb.terminal.Unlock()
+	return pb.terminal.Mode()
+}
+
+// Resize changes the size of the pane's screen.
+func (pb *PaneBuffer) Resize(width, height int) {
+	pb.width = width
+	pb.height = height
+	pb.terminal.Resize(width, height)
+}
+
+// Size returns the width and height of the pane's screen.
+func (pb *PaneBuffer) Size() (int, int) {
+	return pb.width, pb.height
+}
+
+// CursorVisible reports whether the application shows the cursor (mode 25).
+func (pb *PaneBuffer) CursorVisible() bool {
+	pb.terminal.Lock()
+	defer pb.terminal.Unlock()
+	return pb.terminal.CursorVisible()
+}
+
+func (pb *PaneBuffer) GetCursor() (int, int) {
+	pb.terminal.Lock()
+	defer pb.terminal.Unlock()
+
+	cursor := pb.terminal.Cursor()
+	return cursor.X, cursor.Y
+}
+
+// writeTracked feeds plain output to the emulator, saving each line that
+// scrolls off the top of the screen to the history first. vt10x has no
+// scrollback of its own, so output is written in pieces that end just
+// before anything that could scroll: a line feed, IND/NEL, or a printable
+// character once the cursor is waiting to wrap on the bottom row.
+func (pb *PaneBuffer) writeTracked(data []byte) error {
+	for len(data) > 0 {
+		pb.terminal.Lock()
+		cur := pb.terminal.Cursor()
+		mode := pb.terminal.Mode()
+		cols, rows := pb.terminal.Size()
+		pb.terminal.Unlock()
+
+		if mode&vt10x.ModeAltScreen != 0 {
+			// Full screen applications don't add to the history
+			_, err := pb.terminal.Write(data)
+			pb.esc = pb.esc.advance(data)
+			return err
+		}
+		wrapNext := cur.State&2 != 0 && mode&vt10x.ModeWrap != 0 // vt10x's cursorWrapNext
+
+		// Printable characters that fit before the cursor could wrap off
+		// the bottom row; counting bytes only makes the pieces smaller
+		budget := (rows-1-cur.Y)*cols + cols - cur.X
+		if wrapNext {
+			budget -= cols - cur.X
+		}
+		st := pb.esc
+		n, trigger, newline := 0, 0, false
+	scan:
+		for ; n < len(data); n++ {
+			c := data[n]
+			switch {
+			case (c == '\n' || c == '\v' || c == '\f') && st != escString,
+				(c == 'D' || c == 'E') && st == escEscape: // LF, IND, NEL
+				trigger, newline = 1, true
+				break scan
+			case c >= 0x20 && c != 0x7f && st == escGround:
+				if budget == 0 {
+					for n > 0 && !utf8.RuneStart(data[n]) {
+						n--
+					}
+					if n == 0 {
+						_, trigger = utf8.DecodeRune(data)
+					}
+					break scan
+				}
+				budget--
+			}
+			st = st.next(c)
+		}
+		if n == 0 {
+			if cur.Y == rows-1 && (newline || wrapNext) {
+				pb.saveTopLine()
+			}
+			n = trigger
+		}
+		if _, err := pb.terminal.Write(data[:n]); err != nil {
+			return err
+		}
+		pb.esc = pb.esc.advance(data[:n])
+		data = data[n:]
+	}
+	return nil
+}
+
+// escState follows just enough of the escape sequence syntax to tell text
+// from sequence bytes, carried across writes like the emulator's parser.
+type escState int
+
+const (
+	escGround escState = iota
+	escEscape
+	escCSI
+	escString       // OSC, DCS, APC, PM and SOS run to BEL or ST
+	escStringEscape // ESC inside a string, maybe starting ST
+	escCharset      // ESC ( and friends take one more byte
+)
+
+func (s escState) next(c byte) escState {
+	if c == 0x18 || c == 0x1a { // CAN and SUB abort a sequence
+		return escGround
+	}
+	switch s {
+	case escEscape:
+		switch {
+		case c == '[':
+			return escCSI
+		case c == ']' || c == 'P' || c == '_' || c == '^' || c == 'X':
+			return escString
+		case c == '(' || c == ')' || c == '*' || c == '+' || c == '#' || c == '%':
+			return escCharset
+		case c < 0x20 && c != 0x1b:
+			return s // controls still run inside a sequence
+		}
+	case escCSI:
+		if c < 0x40 || c > 0x7e {
+			return s
+		}
+		return escGround
+	case escString:
+		if c == 0x07 {
+			return escGround
+		}
+		if c == 0x1b {
+			return escStringEscape
+		}
+		return s
+	case escStringEscape:
+		if c == '\\' {
+			return escGround
+		}
+		return escString
+	case escCharset:
+		return escGround
+	}
+	if c == 0x1b {
+		return escEscape
+	}
+	return escGround
+}
+
+func (s escState) advance(data []byte) escState {
+	for _, c := range data {
+		s = s.next(c)
+	}
+	return s
+}
+
+// saveTopLine copies the top row of the screen to the history, dropping the
+// oldest lines beyond history-limit or history-memory.
+func (pb *PaneBuffer) saveTopLine() {
+	pb.terminal.Lock()
+	line := make(Row, pb.width)
+	var gc glyphCache
+	for x := range line {
+		line[x] = gc.cell(pb.terminal.Cell(x, 0))
+	}
+	pb.terminal.Unlock()
+
+	pb.history.Append(line)
+	if over := pb.history.Len() - max(pb.historyLimit, 0); over > 0 {
+		pb.history.Drop(over)
+		pb.historyBase += over
+	}
+	pb.historyBase += pb.history.Trim(pb.historyMemory)
+}
+
+// HistoryBase is the line number of the oldest line in the history.
+func (pb *PaneBuffer) HistoryBase() int {
+	return pb.historyBase
+}
+
+// HistoryLen is the number of lines in the history.
+func (pb *PaneBuffer) HistoryLen() int {
+	return pb.history.Len()
+}
+
+// SetHistoryLimit keeps at most lines lines of history, and of those at
+// most memory bytes in memory; 0 is no cap. With a history file the
+// lines dropped from memory are read back from it.
+func (pb *PaneBuffer) SetHistoryLimit(lines, memory int) {
+	pb.historyLimit = lines
+	pb.historyMemory = memory
+}
+
+// LiveTop is the line number of the top row of the screen. Lines are
+// numbered from the first line the pane ever printed, so a position in the
+// history stays valid as more output arrives.
+func (pb *PaneBuffer) LiveTop() int {
+	return pb.historyBase + pb.history.Len()
+}
+
+// Lines returns count lines starting at line number top, taken from the
+// history and then the screen.
+func (pb *PaneBuffer) Lines(top, count int) []Row {
+	screen := pb.Content().Rows()
+	lines := make([]Row, 0, count)
+	for n := top; n < top+count; n++ {
+		switch i := n - pb.historyBase; {
+		case i < 0:
+			lines = append(lines, nil)
+		case i < pb.history.Len():
+			lines = append(lines, pb.history.Line(i))
+		case i-pb.history.Len() < len(screen):
+			lines = append(lines, screen[i-pb.history.Len()])
+		}
+	}
+	return lines
+}
+
+// Selection runs from where it was started to where it was extended to,
+// both by line number and column, including both ends.
+type Selection struct {
+	StartLine, StartCol int
+	EndLine, EndCol     int
+}
+
+// bounds returns the ends of the selection in reading order.
+func (sel *Selection) bounds() (line1, col1, line2, col2 int) {
+	if sel.EndLine < sel.StartLine || sel.EndLine == sel.StartLine && sel.EndCol < sel.StartCol {
+		return sel.EndLine, sel.EndCol, sel.StartLine, sel.StartCol
+	}
+	return sel.StartLine, sel.StartCol, sel.EndLine, sel.EndCol
+}
+
+func (sel *Selection) Contains(line, col int) bool {
+	line1, col1, line2, col2 := sel.bounds()
+	if line < line1 || line > line2 {
+		return false
+	}
+	return (line > line1 || col >= col1) && (line < line2 || col <= col2)
+}
+
+// Text returns the selected text with trailing blanks removed from each
+// line.
+func (sel *Selection) Text(pb *PaneBuffer) string {
+	line1, col1, line2, col2 := sel.bounds()
+	lines := RowsText(pb.Lines(line1, line2-line1+1))
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		from, to := 0, len(l)
+		if i == 0 {
+			from = min(col1, len(l))
+		}
+		if i == len(lines)-1 {
+			to = min(col2+1, len(l))
+		}
+		if from < to {
+			out[i] = strings.TrimRight(string(l[from:to]), " ")
+		}
+	}
+	return strings.Join(out, "\n")
+}
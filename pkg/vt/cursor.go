@@ -0,0 +1,131 @@
+package vt
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Cursor color changes: OSC 12 ; color sets it and OSC 112 resets it.
+var (
+	cursorColorPrefix      = []byte("\x1b]12;")
+	cursorColorResetPrefix = []byte("\x1b]112")
+)
+
+// cursorStyleSequence reports the length of a DECSCUSR (CSI Ps SP q) at the
+// start of buf, or 0 if buf starts with something else. complete is false if
+// buf ends before it can tell.
+func cursorStyleSequence(buf []byte) (n int, complete bool) {
+	if len(buf) < 2 {
+		return 0, false
+	}
+	if buf[1] != '[' {
+		return 0, true
+	}
+	j := 2
+	for ; j < len(buf) && buf[j] >= '0' && buf[j] <= '9'; j++ {
+	}
+	switch {
+	case j < len(buf) && buf[j] != ' ':
+		return 0, true
+	case j+1 >= len(buf):
+		return 0, j-2 > 8 // only digits so far
+	case buf[j+1] == 'q':
+		return j + 2, true
+	}
+	return 0, true
+}
+
+// cursorBlink is whether mode 12 turned blinking on or off since the last
+// DECSCUSR, which says whether its shape blinks.
+type cursorBlink int
+
+const (
+	blinkUnset cursorBlink = iota
+	blinkOn
+	blinkOff
+)
+
+// handleCursorStyle follows a DECSCUSR from the pane's application; payload
+// is the whole sequence.
+func (pb *PaneBuffer) handleCursorStyle(payload []byte) {
+	param := bytes.TrimSuffix(bytes.TrimPrefix(payload, []byte("\x1b[")), []byte(" q"))
+	style, _ := strconv.Atoi(string(param))
+	if style >= 0 && style <= int(tcell.CursorStyleSteadyBar) {
+		pb.cursorStyle = tcell.CursorStyle(style)
+		pb.cursorBlink = blinkUnset
+	}
+}
+
+// handleCSI follows the blinking cursor mode (CSI ? 12 h/l).
+func (pb *PaneBuffer) handleCSI(marker byte, params []int, final byte) {
+	if marker != '?' || (final != 'h' && final != 'l') {
+		return
+	}
+	for _, mode := range params {
+		if mode == 12 && final == 'h' {
+			pb.cursorBlink = blinkOn
+		} else if mode == 12 {
+			pb.cursorBlink = blinkOff
+		}
+	}
+}
+
+// CursorStyle returns the shape the outer cursor takes for the pane: the
+// DECSCUSR shape, made blinking or steady by mode 12. With no shape set,
+// blinking on is a blinking block and off leaves the outer terminal's own
+// cursor, as xterm's cnorm turns blinking off.
+func (pb *PaneBuffer) CursorStyle() tcell.CursorStyle {
+	style := pb.cursorStyle
+	switch {
+	case pb.cursorBlink == blinkUnset:
+	case style == tcell.CursorStyleDefault:
+		if pb.cursorBlink == blinkOn {
+			style = tcell.CursorStyleBlinkingBlock
+		}
+	case pb.cursorBlink == blinkOn && style%2 == 0: // steady shapes are even
+		style--
+	case pb.cursorBlink == blinkOff && style%2 == 1:
+		style++
+	}
+	return style
+}
+
+// handleCursorColor follows OSC 12 from the pane's application, or OSC 112
+// with an empty payload. Queries (OSC 12 ; ?) are ignored.
+func (pb *PaneBuffer) handleCursorColor(payload []byte) {
+	if string(payload) != "?" {
+		pb.cursorColor = string(payload)
+	}
+}
+
+// parseXColor reads a color as X11 and OSC 12 write them: a name, #rrggbb
+// or rgb:rr/gg/bb with one to four hex digits per component.
+func parseXColor(spec string) tcell.Color {
+	if rgb, ok := strings.CutPrefix(spec, "rgb:"); ok {
+		parts := strings.Split(rgb, "/")
+		if len(parts) != 3 {
+			return tcell.ColorDefault
+		}
+		var c [3]int32
+		for i, part := range parts {
+			v, err := strconv.ParseUint(part, 16, 16)
+			if err != nil || len(part) == 0 || len(part) > 4 {
+				return tcell.ColorDefault
+			}
+			c[i] = int32(v * 255 / (1<<(4*len(part)) - 1)) // scale to 8 bits
+		}
+		return tcell.NewRGBColor(c[0], c[1], c[2])
+	}
+	return tcell.GetColor(spec)
+}
+
+// CursorColor returns the cursor color the application set, if any.
+func (pb *PaneBuffer) CursorColor() (tcell.Color, bool) {
+	if pb.cursorColor == "" {
+		return tcell.ColorDefault, false
+	}
+	return parseXColor(pb.cursorColor), true
+}
@@ -0,0 +1,85 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hinshun/vt10x"
+)
+
+// Dump returns the screen as text, a line per row without trailing blanks,
+// and with escapes set its colours and attributes as SGR sequences.
+func (pb *PaneBuffer) Dump(escapes bool) string {
+	term := pb.terminal
+	term.Lock()
+	defer term.Unlock()
+	cols, rows := term.Size()
+	var b strings.Builder
+	for y := range rows {
+		// Up to the last cell that isn't a blank in the default style
+		end := cols
+		for ; end > 0; end-- {
+			g := term.Cell(end-1, y)
+			if g.Char != ' ' && g.Char != 0 || escapes && glyphStyle(g) != defaultGlyphStyle {
+				break
+			}
+		}
+		current := defaultGlyphStyle
+		for x := range end {
+			g := term.Cell(x, y)
+			if a := glyphStyle(g); escapes && a != current {
+				b.WriteString(sgr(a))
+				current = a
+			}
+			if g.Char == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteRune(g.Char)
+			}
+		}
+		if current != defaultGlyphStyle {
+			b.WriteString("\x1b[m")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// defaultGlyphStyle is a cell with no colours or attributes.
+var defaultGlyphStyle = glyphAttrs{fg: vt10x.DefaultFG, bg: vt10x.DefaultBG}
+
+// glyphStyle returns a cell's colours and the attributes sgr shows,
+// leaving out vt10x's own marks such as the line drawing set or a wrapped
+// line.
+func glyphStyle(g vt10x.Glyph) glyphAttrs {
+	const shown = glyphBold | glyphItalic | glyphUnderline | glyphBlink | glyphReverse
+	return glyphAttrs{fg: g.FG, bg: g.BG, mode: g.Mode & shown}
+}
+
+// sgr returns the escape sequence setting a vt10x style from scratch.
+func sgr(a glyphAttrs) string {
+	params := []string{"0"}
+	for _, attr := range []struct {
+		mode  int16
+		param string
+	}{{glyphBold, "1"}, {glyphItalic, "3"}, {glyphUnderline, "4"}, {glyphBlink, "5"}, {glyphReverse, "7"}} {
+		if a.mode&attr.mode != 0 {
+			params = append(params, attr.param)
+		}
+	}
+	params = append(params, sgrColor(a.fg, "38")...)
+	params = append(params, sgrColor(a.bg, "48")...)
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// sgrColor returns the SGR parameters for a vt10x colour: none for the
+// default, else base (38 or 48) with a palette index or 24-bit value.
+func sgrColor(c vt10x.Color, base string) []string {
+	switch {
+	case c < 256:
+		return []string{base, "5", strconv.Itoa(int(c))}
+	case c < 1<<24:
+		return []string{base, "2", strconv.Itoa(int(c >> 16 & 0xff)), strconv.Itoa(int(c >> 8 & 0xff)), strconv.Itoa(int(c & 0xff))}
+	}
+	return nil
+}
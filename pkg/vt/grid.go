@@ -0,0 +1,162 @@
+package vt
+
+// Cell is one character cell of a pane.
+type Cell struct {
+	Rune  rune
+	Style StyleID
+	Width uint8 // columns the character takes, 0 for the cell a wide one covers
+}
+
+// BlankCell is an empty cell in the default style.
+var BlankCell = Cell{Rune: ' ', Width: 1}
+
+// Row is one line of cells.
+type Row []Cell
+
+// Text returns the characters of the row.
+func (r Row) Text() []rune {
+	text := make([]rune, 0, len(r))
+	for _, c := range r {
+		if c.Width > 0 {
+			text = append(text, c.Rune)
+		}
+	}
+	return text
+}
+
+// Equal reports whether two rows hold the same cells.
+func (r Row) Equal(other Row) bool {
+	if len(r) != len(other) {
+		return false
+	}
+	for i := range r {
+		if r[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Clear blanks every cell of the row.
+func (r Row) Clear() {
+	for i := range r {
+		r[i] = BlankCell
+	}
+}
+
+// RowsText returns the characters of each row.
+func RowsText(rows []Row) [][]rune {
+	text := make([][]rune, len(rows))
+	for i, r := range rows {
+		text[i] = r.Text()
+	}
+	return text
+}
+
+// Grid is a screen of cells. Rows are separate slices so scrolling moves
+// them rather than the cells in them.
+type Grid struct {
+	width, height int
+	rows          []Row
+}
+
+func NewGrid(width, height int) *Grid {
+	g := &Grid{}
+	g.Resize(width, height)
+	return g
+}
+
+func (g *Grid) Size() (int, int) {
+	return g.width, g.height
+}
+
+// Row returns row y, which shares its cells with the grid.
+func (g *Grid) Row(y int) Row {
+	return g.rows[y]
+}
+
+func (g *Grid) Rows() []Row {
+	return g.rows
+}
+
+// Cell returns the cell at x, y.
+func (g *Grid) Cell(x, y int) Cell {
+	return g.rows[y][x]
+}
+
+// Set replaces the cell at x, y.
+func (g *Grid) Set(x, y int, c Cell) {
+	g.rows[y][x] = c
+}
+
+// Resize changes the size of the grid, keeping the cells that still fit
+// and reusing row storage where it is big enough.
+func (g *Grid) Resize(width, height int) {
+	if height <= cap(g.rows) {
+		g.rows = g.rows[:height]
+	} else {
+		g.rows = append(g.rows[:cap(g.rows)], make([]Row, height-cap(g.rows))...)
+	}
+	for y, r := range g.rows {
+		old := len(r)
+		if width <= cap(r) {
+			r = r[:width]
+		} else {
+			r = append(r[:cap(r)], make(Row, width-cap(r))...)
+		}
+		if y >= g.height {
+			old = 0 // a row that was not in use
+		}
+		for x := min(old, width); x < width; x++ {
+			r[x] = BlankCell
+		}
+		g.rows[y] = r
+	}
+	g.width, g.height = width, height
+}
+
+// ScrollUp moves rows top to bottom (inclusive) up by n, blanking the rows
+// that come in at the bottom.
+func (g *Grid) ScrollUp(top, bottom, n int) {
+	n = min(n, bottom-top+1)
+	region := g.rows[top : bottom+1]
+	scrolled := append([]Row(nil), region[:n]...)
+	copy(region, region[n:])
+	copy(region[len(region)-n:], scrolled)
+	for _, r := range scrolled {
+		r.Clear()
+	}
+}
+
+// ScrollDown moves rows top to bottom (inclusive) down by n, blanking the
+// rows that come in at the top.
+func (g *Grid) ScrollDown(top, bottom, n int) {
+	n = min(n, bottom-top+1)
+	region := g.rows[top : bottom+1]
+	scrolled := append([]Row(nil), region[len(region)-n:]...)
+	copy(region[n:], region)
+	copy(region, scrolled)
+	for _, r := range scrolled {
+		r.Clear()
+	}
+}
+
+// Clear blanks the whole grid.
+func (g *Grid) Clear() {
+	for _, r := range g.rows {
+		r.Clear()
+	}
+}
+
+// Diff returns the rows that differ from other, or every row if the grids
+// are different sizes.
+func (g *Grid) Diff(other *Grid) []int {
+	var changed []int
+	sameSize := other != nil && other.width == g.width && other.height == g.height
+	for y, r := range g.rows {
+		if !sameSize || !r.Equal(other.rows[y]) {
+			changed = append(changed, y)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,131 @@
+package vt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// HistoryFile is a pane's compressed history chunks on disk, each stored as
+// a 4 byte big-endian length and the chunk. The daemon writes it, holding
+// its lock, from the pane's screen (Pane.screen), so output is saved
+// whether or not a client is attached; clients read what was there when
+// they opened it.
+type HistoryFile struct {
+	f        *os.File
+	offsets  []int64 // where each chunk's data starts
+	sizes    []int
+	end      int64
+	writable bool
+}
+
+// CreateHistoryFile starts an empty history file for the daemon to write.
+func CreateHistoryFile(path string) (*HistoryFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if !lockFile(f) {
+		f.Close()
+		return nil, fmt.Errorf("%s is in use", path)
+	}
+	return &HistoryFile{f: f, writable: true}, nil
+}
+
+// openHistoryFile opens a history file to read and returns the chunks in
+// it.
+func openHistoryFile(path string) (*HistoryFile, []historyChunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	hf := &HistoryFile{f: f}
+	var chunks []historyChunk
+	header := make([]byte, 4)
+	for {
+		if _, err := f.ReadAt(header, hf.end); err != nil {
+			break
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := f.ReadAt(data, hf.end+4); err != nil {
+			break // still being written
+		}
+		chunks = append(chunks, historyChunk{data: data, disk: len(hf.offsets)})
+		hf.offsets = append(hf.offsets, hf.end+4)
+		hf.sizes = append(hf.sizes, len(data))
+		hf.end += 4 + int64(len(data))
+	}
+	return hf, chunks, nil
+}
+
+// append writes a chunk at the end of the file, returning its index.
+func (hf *HistoryFile) append(data []byte) (int, error) {
+	if !hf.writable {
+		return -1, fmt.Errorf("history file is read only")
+	}
+	record := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	if _, err := hf.f.WriteAt(append(record, data...), hf.end); err != nil {
+		return -1, err
+	}
+	hf.offsets = append(hf.offsets, hf.end+4)
+	hf.sizes = append(hf.sizes, len(data))
+	hf.end += 4 + int64(len(data))
+	return len(hf.offsets) - 1, nil
+}
+
+// read returns chunk i.
+func (hf *HistoryFile) read(i int) ([]byte, error) {
+	data := make([]byte, hf.sizes[i])
+	if _, err := hf.f.ReadAt(data, hf.offsets[i]); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteHistory makes the screen write its history to hf, which must be
+// empty, keeping limit lines and, once a chunk is on disk, none of it in
+// memory. At least a chunk's worth is kept, so chunk i of the file always
+// holds the lines from i*historyChunkLines on.
+func (pb *PaneBuffer) WriteHistory(hf *HistoryFile, limit int) {
+	pb.history.Load(hf, nil)
+	pb.SetHistoryLimit(max(limit, historyChunkLines), 1)
+}
+
+// OpenHistory loads the first lines lines of a pane's history file, those
+// from before its replay starts, as the history the replay goes on from.
+// It only happens once, and for a pane with no history yet, as the file
+// would otherwise miss lines. The file stays open for reading chunks
+// dropped from memory back.
+func (pb *PaneBuffer) OpenHistory(path string, lines int) error {
+	if pb.historyOpened {
+		return nil
+	}
+	pb.historyOpened = true
+	if pb.history.Len() > 0 {
+		return nil
+	}
+	hf, chunks, err := openHistoryFile(path)
+	if err != nil {
+		return err
+	}
+	full, rest := lines/historyChunkLines, lines%historyChunkLines
+	if full >= len(chunks) {
+		full, rest = len(chunks), 0
+	}
+	var partial []Row
+	if rest > 0 {
+		partial = decompressLines(chunks[full].data)
+		partial = partial[:min(rest, len(partial))]
+	}
+	chunks = chunks[:full]
+	keep := (max(pb.historyLimit, 0) + historyChunkLines - 1) / historyChunkLines
+	if len(chunks) > keep {
+		chunks = chunks[len(chunks)-keep:]
+	}
+	pb.history.Load(hf, chunks)
+	for _, line := range partial {
+		pb.history.Append(line)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package vt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+)
+
+// Image is an image waiting to be drawn, at the pane cell where its top
+// left corner goes. data is the sequence that draws it.
+type Image struct {
+	Data []byte
+	X, Y int
+}
+
+// ImageSupport says which images a pane buffer may draw on the outer
+// terminal. The cell size is zero when none may be drawn.
+type ImageSupport struct {
+	CellWidth, CellHeight int
+	Sixel                 bool
+	Inline                bool // iTerm2 OSC 1337 images
+	Placeholder           bool // write a placeholder for images not drawn
+}
+
+// sixelHeight returns the height of a sixel image in pixels, from its raster
+// attributes (" Pan ; Pad ; Ph ; Pv) or else by counting its rows of sixels.
+func sixelHeight(data []byte) int {
+	q := bytes.IndexByte(data, 'q')
+	if q < 0 {
+		return 0
+	}
+	body := data[q+1:]
+	if len(body) > 0 && body[0] == '"' {
+		end := 1
+		for end < len(body) && (body[end] >= '0' && body[end] <= '9' || body[end] == ';') {
+			end++
+		}
+		if params := strings.Split(string(body[1:end]), ";"); len(params) == 4 {
+			if pv, err := strconv.Atoi(params[3]); err == nil && pv > 0 {
+				return pv
+			}
+		}
+	}
+	return (bytes.Count(body, []byte("-")) + 1) * 6
+}
+
+// addSixel places a sixel image at the cursor.
+func (pb *PaneBuffer) addSixel(data []byte) {
+	if !pb.imageSupport.Sixel {
+		pb.imagePlaceholder("sixel image")
+		return
+	}
+	pb.placeImage(data, (sixelHeight(data)+pb.imageSupport.CellHeight-1)/pb.imageSupport.CellHeight)
+}
+
+// addInlineImage places an iTerm2 inline image at the cursor. Files sent
+// for download rather than display are dropped.
+func (pb *PaneBuffer) addInlineImage(data []byte) {
+	body := bytes.TrimPrefix(data, inlineImagePrefix)
+	body = bytes.TrimSuffix(bytes.TrimSuffix(body, []byte("\x07")), []byte("\x1b\\"))
+	argText, content, _ := bytes.Cut(body, []byte(":"))
+	args := make(map[string]string)
+	for _, arg := range strings.Split(string(argText), ";") {
+		if k, v, ok := strings.Cut(arg, "="); ok {
+			args[k] = v
+		}
+	}
+	if args["inline"] != "1" {
+		return
+	}
+	if !pb.imageSupport.Inline {
+		label := "image"
+		if name, err := base64.StdEncoding.DecodeString(args["name"]); err == nil && len(name) > 0 {
+			label += " " + string(name)
+		}
+		pb.imagePlaceholder(label)
+		return
+	}
+	pb.placeImage(data, pb.inlineImageRows(args, content))
+}
+
+// inlineImageRows works out how many rows an inline image covers from its
+// width and height arguments (N cells, Npx, N% or auto) and, for auto, the
+// size of the image itself. Images are scaled down to fit the pane's width.
+func (pb *PaneBuffer) inlineImageRows(args map[string]string, content []byte) int {
+	cw, ch := pb.imageSupport.CellWidth, pb.imageSupport.CellHeight
+	var imgW, imgH int
+	if raw, err := base64.StdEncoding.DecodeString(string(content)); err == nil {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(raw)); err == nil {
+			imgW, imgH = cfg.Width, cfg.Height
+		}
+	}
+	w := imageDimension(args["width"], pb.width*cw, cw)
+	h := imageDimension(args["height"], pb.height*ch, ch)
+	switch {
+	case h > 0:
+	case imgW == 0 || imgH == 0:
+		return 1 // unknown size
+	case w > 0 && args["preserveAspectRatio"] != "0":
+		h = imgH * w / imgW
+	default:
+		w, h = imgW, imgH
+	}
+	if w > pb.width*cw && args["preserveAspectRatio"] != "0" {
+		h = h * pb.width * cw / w
+	}
+	return max((h+ch-1)/ch, 1)
+}
+
+// imageDimension converts an inline image width or height argument to
+// pixels, given the pane's size and the size of a cell in pixels. auto and
+// missing arguments are 0.
+func imageDimension(arg string, pane, cell int) int {
+	switch {
+	case strings.HasSuffix(arg, "px"):
+		n, _ := strconv.Atoi(strings.TrimSuffix(arg, "px"))
+		return n
+	case strings.HasSuffix(arg, "%"):
+		n, _ := strconv.Atoi(strings.TrimSuffix(arg, "%"))
+		return pane * n / 100
+	}
+	n, _ := strconv.Atoi(arg)
+	return n * cell
+}
+
+// placeImage puts an image rows high at the cursor and moves the cursor
+// below it, scrolling if the image runs past the bottom of the pane, as the
+// outer terminal would. Images taller than the pane are dropped.
+func (pb *PaneBuffer) placeImage(data []byte, rows int) {
+	pb.terminal.Lock()
+	x := pb.terminal.Cursor().X
+	pb.terminal.Unlock()
+	pb.writeTracked([]byte(strings.Repeat("\n", rows) + "\r"))
+	pb.terminal.Lock()
+	y := pb.terminal.Cursor().Y - rows
+	pb.terminal.Unlock()
+	if y < 0 {
+		return
+	}
+	pb.images = append(pb.images, Image{Data: data, X: x, Y: y})
+}
+
+// imagePlaceholder writes a line standing in for an image that is not drawn,
+// if placeholders are on.
+func (pb *PaneBuffer) imagePlaceholder(label string) {
+	if pb.imageSupport.Placeholder {
+		pb.writeTracked([]byte(fmt.Sprintf("[%s]\r\n", label)))
+	}
+}
+
+// TakeImages returns and clears the images waiting to be drawn.
+func (pb *PaneBuffer) TakeImages() []Image {
+	images := pb.images
+	pb.images = nil
+	return images
+}
+
+// SetImageSupport sets which images the pane buffer may draw.
+func (pb *PaneBuffer) SetImageSupport(support ImageSupport) {
+	pb.imageSupport = support
+}
@@ -0,0 +1,288 @@
+package vt
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+
+	"term/pkg/protocol"
+)
+
+var specialKeyNames = map[tcell.Key]string{
+	tcell.KeyUp:        "Up",
+	tcell.KeyDown:      "Down",
+	tcell.KeyLeft:      "Left",
+	tcell.KeyRight:     "Right",
+	tcell.KeyHome:      "Home",
+	tcell.KeyEnd:       "End",
+	tcell.KeyPgUp:      "PageUp",
+	tcell.KeyPgDn:      "PageDown",
+	tcell.KeyInsert:    "Insert",
+	tcell.KeyDelete:    "Delete",
+	tcell.KeyEnter:     "Enter",
+	tcell.KeyTab:       "Tab",
+	tcell.KeyBacktab:   "BTab",
+	tcell.KeyEscape:    "Escape",
+	tcell.KeyBackspace: "BSpace",
+	tcell.KeyF1:        "F1",
+	tcell.KeyF2:        "F2",
+	tcell.KeyF3:        "F3",
+	tcell.KeyF4:        "F4",
+	tcell.KeyF5:        "F5",
+	tcell.KeyF6:        "F6",
+	tcell.KeyF7:        "F7",
+	tcell.KeyF8:        "F8",
+	tcell.KeyF9:        "F9",
+	tcell.KeyF10:       "F10",
+	tcell.KeyF11:       "F11",
+	tcell.KeyF12:       "F12",
+}
+
+// KeyName returns the binding name of a key event, for example "C-a", "M-x",
+// "S-Up" or "Space".
+func KeyName(ev *tcell.EventKey) string {
+	key := ev.Key()
+	mods := ev.Modifiers()
+
+	var name string
+	switch {
+	case key == tcell.KeyRune:
+		if ev.Rune() == ' ' {
+			name = "Space"
+		} else {
+			name = string(ev.Rune())
+		}
+		mods &^= tcell.ModShift // already reflected in the rune
+	case key == tcell.KeyBackspace2:
+		name = "BSpace"
+	case specialKeyNames[key] != "":
+		name = specialKeyNames[key]
+	case key >= tcell.KeyCtrlA && key <= tcell.KeyCtrlZ:
+		name = string(rune('a' + key - tcell.KeyCtrlA))
+		mods |= tcell.ModCtrl
+	case key == tcell.KeyCtrlSpace:
+		name = "Space"
+		mods |= tcell.ModCtrl
+	default:
+		name = fmt.Sprintf("Key%d", key)
+	}
+
+	prefix := ""
+	if mods&tcell.ModCtrl != 0 {
+		prefix += "C-"
+	}
+	if mods&tcell.ModAlt != 0 {
+		prefix += "M-"
+	}
+	if mods&tcell.ModShift != 0 {
+		prefix += "S-"
+	}
+	return prefix + name
+}
+
+// KeyEvent returns the key a name such as "C-c", "M-x", "Enter" or "S-Up"
+// stands for, or nil if name is not a key name.
+func KeyEvent(name string) *tcell.EventKey {
+	name = protocol.NormalizeKeyName(name)
+	var mods tcell.ModMask
+prefixes:
+	for len(name) > 2 && name[1] == '-' {
+		switch name[0] {
+		case 'C':
+			mods |= tcell.ModCtrl
+		case 'M':
+			mods |= tcell.ModAlt
+		case 'S':
+			mods |= tcell.ModShift
+		default:
+			break prefixes
+		}
+		name = name[2:]
+	}
+	if name == "Space" {
+		if mods&tcell.ModCtrl != 0 {
+			return tcell.NewEventKey(tcell.KeyCtrlSpace, 0, mods)
+		}
+		return tcell.NewEventKey(tcell.KeyRune, ' ', mods)
+	}
+	for key, keyName := range specialKeyNames {
+		if keyName == name {
+			return tcell.NewEventKey(key, 0, mods)
+		}
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	if r == utf8.RuneError || size != len(name) {
+		return nil
+	}
+	if mods&tcell.ModCtrl != 0 && r >= 'a' && r <= 'z' {
+		return tcell.NewEventKey(tcell.KeyRune, r-'a'+1, mods)
+	}
+	return tcell.NewEventKey(tcell.KeyRune, r, mods)
+}
+
+// cursorKeyFinals are the final bytes of keys sent as CSI/SS3 letter
+// sequences.
+var cursorKeyFinals = map[tcell.Key]byte{
+	tcell.KeyUp:    'A',
+	tcell.KeyDown:  'B',
+	tcell.KeyRight: 'C',
+	tcell.KeyLeft:  'D',
+	tcell.KeyHome:  'H',
+	tcell.KeyEnd:   'F',
+	tcell.KeyF1:    'P',
+	tcell.KeyF2:    'Q',
+	tcell.KeyF3:    'R',
+	tcell.KeyF4:    'S',
+}
+
+// tildeKeyCodes are the parameters of keys sent as CSI n ~.
+var tildeKeyCodes = map[tcell.Key]int{
+	tcell.KeyInsert: 2,
+	tcell.KeyDelete: 3,
+	tcell.KeyPgUp:   5,
+	tcell.KeyPgDn:   6,
+	tcell.KeyF5:     15,
+	tcell.KeyF6:     17,
+	tcell.KeyF7:     18,
+	tcell.KeyF8:     19,
+	tcell.KeyF9:     20,
+	tcell.KeyF10:    21,
+	tcell.KeyF11:    23,
+	tcell.KeyF12:    24,
+}
+
+// xtermModifier returns the xterm modifier parameter (1 + shift + 2*alt +
+// 4*ctrl), or 1 when no modifier is held.
+func xtermModifier(mods tcell.ModMask) int {
+	m := 1
+	if mods&tcell.ModShift != 0 {
+		m += 1
+	}
+	if mods&tcell.ModAlt != 0 {
+		m += 2
+	}
+	if mods&tcell.ModCtrl != 0 {
+		m += 4
+	}
+	return m
+}
+
+// KeyMode is the pane and client state that changes how keys are encoded.
+type KeyMode struct {
+	AppCursor       bool // DECCKM: cursor keys and Home/End send SS3 sequences
+	Meta8bit        bool // meta-encoding 8bit: Alt sets the high bit instead of prefixing ESC
+	ModifyOtherKeys int  // xterm modifyOtherKeys level requested by the pane
+	KeyboardFlags   int  // CSI u keyboard protocol flags requested by the pane
+}
+
+// textKey returns the Unicode code point and modifiers of a key that types
+// text or a C0 control, or -1 for other keys.
+func textKey(ev *tcell.EventKey) (rune, tcell.ModMask) {
+	key := ev.Key()
+	mods := ev.Modifiers()
+	switch {
+	case key == tcell.KeyRune:
+		return ev.Rune(), mods &^ tcell.ModShift // shift is already in the rune
+	case mods&tcell.ModCtrl != 0 && key >= tcell.KeyCtrlA && key <= tcell.KeyCtrlZ:
+		return 'a' + rune(key-tcell.KeyCtrlA), mods
+	case key == tcell.KeyEnter, key == tcell.KeyTab, key == tcell.KeyEscape:
+		return rune(key), mods
+	case key == tcell.KeyBackspace, key == tcell.KeyBackspace2:
+		return 0x7f, mods
+	}
+	return -1, mods
+}
+
+// extendedKey encodes a key with the CSI u keyboard protocol or xterm's
+// modifyOtherKeys when the pane asked for one, or returns nil to use the
+// legacy encoding.
+func extendedKey(ev *tcell.EventKey, mode KeyMode) []byte {
+	code, mods := textKey(ev)
+	if code < 0 {
+		return nil
+	}
+	mod := xtermModifier(mods)
+
+	// CSI u: flag 1 disambiguates modified keys and Escape, flag 8 reports
+	// every key as an escape code
+	if mode.KeyboardFlags&8 != 0 || (mode.KeyboardFlags&1 != 0 && (mod > 1 || code == 0x1b)) {
+		if mod > 1 {
+			return []byte(fmt.Sprintf("\x1b[%d;%du", code, mod))
+		}
+		return []byte(fmt.Sprintf("\x1b[%du", code))
+	}
+
+	// modifyOtherKeys level 2 encodes every modified key; level 1 only those
+	// a plain control character can't represent, such as Ctrl+Shift+P or
+	// Ctrl+1
+	if mod == 1 {
+		return nil
+	}
+	ctrl := mods&tcell.ModCtrl != 0
+	ambiguous := ctrl && (mods&tcell.ModShift != 0 || !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz@[\\]^_ ", code))
+	if mode.ModifyOtherKeys == 2 || (mode.ModifyOtherKeys == 1 && ambiguous) {
+		return []byte(fmt.Sprintf("\x1b[27;%d;%d~", mod, code))
+	}
+	return nil
+}
+
+// KeyToBytes returns the bytes a key sends to a pane, or nil if the key has
+// no encoding.
+func KeyToBytes(ev *tcell.EventKey, mode KeyMode) []byte {
+	if b := extendedKey(ev, mode); b != nil {
+		return b
+	}
+	if ev.Rune() != 0 {
+		b := []byte(string(ev.Rune()))
+		if ev.Modifiers()&tcell.ModAlt == 0 {
+			return b
+		}
+		if mode.Meta8bit && len(b) == 1 && b[0] < 0x80 {
+			return []byte{b[0] | 0x80}
+		}
+		return append([]byte{0x1b}, b...)
+	}
+
+	key := ev.Key()
+	mod := xtermModifier(ev.Modifiers())
+	if final, ok := cursorKeyFinals[key]; ok {
+		switch {
+		case mod > 1:
+			return []byte(fmt.Sprintf("\x1b[1;%d%c", mod, final))
+		case key >= tcell.KeyF1 && key <= tcell.KeyF4:
+			return []byte{0x1b, 'O', final}
+		case mode.AppCursor:
+			return []byte{0x1b, 'O', final}
+		default:
+			return []byte{0x1b, '[', final}
+		}
+	}
+	if code, ok := tildeKeyCodes[key]; ok {
+		if mod > 1 {
+			return []byte(fmt.Sprintf("\x1b[%d;%d~", code, mod))
+		}
+		return []byte(fmt.Sprintf("\x1b[%d~", code))
+	}
+
+	var b []byte
+	switch key {
+	case tcell.KeyEnter:
+		b = []byte{13}
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		b = []byte{0x7f} // ASCII DEL for backspace
+	case tcell.KeyTab:
+		b = []byte{9}
+	case tcell.KeyBacktab:
+		return []byte("\x1b[Z")
+	case tcell.KeyEscape:
+		b = []byte{0x1b}
+	case tcell.KeyCtrlSpace:
+		b = []byte{0}
+	}
+	if b != nil && ev.Modifiers()&tcell.ModAlt != 0 {
+		b = append([]byte{0x1b}, b...)
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+package vt
+
+import "testing"
+
+func TestKeyToBytes(t *testing.T) {
+	appCursor := KeyMode{AppCursor: true}
+	meta8bit := KeyMode{Meta8bit: true}
+	csiU := KeyMode{KeyboardFlags: 1}
+	csiUAll := KeyMode{KeyboardFlags: 1 | 8}
+	otherKeys1 := KeyMode{ModifyOtherKeys: 1}
+	otherKeys2 := KeyMode{ModifyOtherKeys: 2}
+	tests := []struct {
+		key  string
+		mode KeyMode
+		want string
+	}{
+		// Legacy encodings
+		{"a", KeyMode{}, "a"},
+		{"A", KeyMode{}, "A"},
+		{"é", KeyMode{}, "é"},
+		{"Space", KeyMode{}, " "},
+		{"C-c", KeyMode{}, "\x03"},
+		{"C-Space", KeyMode{}, "\x00"},
+		{"M-x", KeyMode{}, "\x1bx"},
+		{"M-x", meta8bit, "\xf8"},
+		{"M-é", meta8bit, "\x1bé"},
+		{"Enter", KeyMode{}, "\r"},
+		{"M-Enter", KeyMode{}, "\x1b\r"},
+		{"Tab", KeyMode{}, "\t"},
+		{"BTab", KeyMode{}, "\x1b[Z"},
+		{"Escape", KeyMode{}, "\x1b"},
+		{"BSpace", KeyMode{}, "\x7f"},
+
+		// Cursor keys, with DECCKM and xterm modifiers
+		{"Up", KeyMode{}, "\x1b[A"},
+		{"Up", appCursor, "\x1bOA"},
+		{"Home", KeyMode{}, "\x1b[H"},
+		{"End", appCursor, "\x1bOF"},
+		{"S-Up", KeyMode{}, "\x1b[1;2A"},
+		{"M-Left", KeyMode{}, "\x1b[1;3D"},
+		{"C-Right", appCursor, "\x1b[1;5C"},
+		{"F1", KeyMode{}, "\x1bOP"},
+		{"S-F1", KeyMode{}, "\x1b[1;2P"},
+
+		// Keys sent as CSI n ~
+		{"Insert", KeyMode{}, "\x1b[2~"},
+		{"Delete", KeyMode{}, "\x1b[3~"},
+		{"PageUp", KeyMode{}, "\x1b[5~"},
+		{"PageDown", KeyMode{}, "\x1b[6~"},
+		{"F5", KeyMode{}, "\x1b[15~"},
+		{"F12", KeyMode{}, "\x1b[24~"},
+		{"C-F5", KeyMode{}, "\x1b[15;5~"},
+		{"C-S-Delete", KeyMode{}, "\x1b[3;6~"},
+
+		// CSI u: flag 1 disambiguates, flag 8 reports every key
+		{"a", csiU, "a"},
+		{"C-c", csiU, "\x1b[99;5u"},
+		{"M-x", csiU, "\x1b[120;3u"},
+		{"Escape", csiU, "\x1b[27u"},
+		{"Enter", csiU, "\r"},
+		{"a", csiUAll, "\x1b[97u"},
+		{"Enter", csiUAll, "\x1b[13u"},
+		{"BSpace", csiUAll, "\x1b[127u"},
+		{"Up", csiUAll, "\x1b[A"},
+
+		// modifyOtherKeys: level 1 only where a control character is
+		// ambiguous, level 2 for every modified key
+		{"C-c", otherKeys1, "\x03"},
+		{"C-S-p", otherKeys1, "\x1b[27;6;112~"},
+		{"C-1", otherKeys1, "\x1b[27;5;49~"},
+		{"M-x", otherKeys1, "\x1bx"},
+		{"C-c", otherKeys2, "\x1b[27;5;99~"},
+		{"M-x", otherKeys2, "\x1b[27;3;120~"},
+		{"a", otherKeys2, "a"},
+	}
+	for _, tt := range tests {
+		ev := KeyEvent(tt.key)
+		if ev == nil {
+			t.Errorf("keyEvent(%q) = nil", tt.key)
+			continue
+		}
+		if got := string(KeyToBytes(ev, tt.mode)); got != tt.want {
+			t.Errorf("keyToBytes(%s, %+v) = %q, want %q", tt.key, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestKeyEventNames(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // KeyName of the event, "" for no key
+	}{
+		{"a", "a"},
+		{"C-a", "C-a"},
+		{"C-A", "C-a"},
+		{"M-x", "M-x"},
+		{"C-M-x", "C-M-x"},
+		{"Space", "Space"},
+		{"C-Space", "C-Space"},
+		{"S-Up", "S-Up"},
+		{"F12", "F12"},
+		{"BTab", "BTab"},
+		{"Nope", ""},
+		{"ab", ""},
+	}
+	for _, tt := range tests {
+		ev := KeyEvent(tt.name)
+		got := ""
+		if ev != nil {
+			got = KeyName(ev)
+		}
+		if got != tt.want {
+			t.Errorf("keyName(keyEvent(%q)) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
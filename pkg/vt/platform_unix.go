@@ -0,0 +1,14 @@
+//go:build unix
+
+package vt
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f without waiting, reporting
+// whether it got it. The lock goes with the file's closing.
+func lockFile(f *os.File) bool {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) == nil
+}
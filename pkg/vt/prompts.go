@@ -0,0 +1,78 @@
+package vt
+
+// promptMark is where a shell integration mark (OSC 133) was printed, by
+// line number and column. kind is A (prompt start), B (command start),
+// C (output start) or D (command finished).
+type promptMark struct {
+	kind      byte
+	line, col int
+}
+
+// addPromptMark records a mark at the cursor.
+func (pb *PaneBuffer) addPromptMark(kind byte) {
+	if kind < 'A' || kind > 'D' {
+		return
+	}
+	pb.terminal.Lock()
+	cur := pb.terminal.Cursor()
+	pb.terminal.Unlock()
+	pb.marks = append(pb.marks, promptMark{kind: kind, line: pb.LiveTop() + cur.Y, col: cur.X})
+
+	// Drop marks for lines that have left the history
+	for len(pb.marks) > 0 && pb.marks[0].line < pb.historyBase {
+		pb.marks = pb.marks[1:]
+	}
+}
+
+// PromptAbove returns the line of the last prompt before line.
+func (pb *PaneBuffer) PromptAbove(line int) (int, bool) {
+	for i := len(pb.marks) - 1; i >= 0; i-- {
+		if m := pb.marks[i]; m.kind == 'A' && m.line < line {
+			return m.line, true
+		}
+	}
+	return 0, false
+}
+
+// PromptBelow returns the line of the first prompt after line.
+func (pb *PaneBuffer) PromptBelow(line int) (int, bool) {
+	for _, m := range pb.marks {
+		if m.kind == 'A' && m.line > line {
+			return m.line, true
+		}
+	}
+	return 0, false
+}
+
+// LastOutput returns the selection covering the output of the last command
+// that printed any: from its C mark to just before the D mark that ended it,
+// or to the cursor if it is still running.
+func (pb *PaneBuffer) LastOutput() (*Selection, bool) {
+	for i := len(pb.marks) - 1; i >= 0; i-- {
+		start := pb.marks[i]
+		if start.kind != 'C' {
+			continue
+		}
+		pb.terminal.Lock()
+		cur := pb.terminal.Cursor()
+		pb.terminal.Unlock()
+		endLine, endCol := pb.LiveTop()+cur.Y, cur.X
+		for _, m := range pb.marks[i+1:] {
+			if m.kind == 'D' || m.kind == 'A' {
+				endLine, endCol = m.line, m.col
+				break
+			}
+		}
+		// The end mark comes after the output
+		if endCol > 0 {
+			endCol--
+		} else {
+			endLine, endCol = endLine-1, pb.width-1
+		}
+		if endLine < start.line || endLine == start.line && endCol < start.col {
+			continue // no output
+		}
+		return &Selection{StartLine: start.line, StartCol: start.col, EndLine: endLine, EndCol: endCol}, true
+	}
+	return nil, false
+}
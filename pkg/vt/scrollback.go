@@ -0,0 +1,221 @@
+package vt
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"slices"
+	"sync"
+	"unsafe"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// cellSize is the memory a cell takes, for counting the size of lines
+// not yet compressed.
+const cellSize = int(unsafe.Sizeof(Cell{}))
+
+// historyChunkLines is how many history lines are compressed together.
+const historyChunkLines = 256
+
+// scrollback holds a pane's history lines, oldest first. The newest lines
+// are kept as they are; older ones are compressed in chunks, which are
+// decompressed one at a time when read. With a history file, chunks are
+// also written to disk and may be dropped from memory.
+type scrollback struct {
+	chunks []historyChunk // full chunks, oldest first
+	first  int            // lines already dropped from chunks[0]
+	hot    []Row          // lines not yet compressed
+	n      int            // lines held
+	size   int            // bytes held, compressed chunks plus hot lines
+	disk   *HistoryFile   // nil unless history-file is on
+
+	// The last chunk read, decompressed
+	cached      int // index into chunks
+	cachedLines []Row
+}
+
+type historyChunk struct {
+	data []byte // nil if only on disk
+	disk int    // index in the history file, or -1
+}
+
+// Len returns the number of lines held.
+func (sb *scrollback) Len() int {
+	return sb.n
+}
+
+// Append adds a line at the end, compressing the hot lines once there are a
+// chunk's worth.
+func (sb *scrollback) Append(line Row) {
+	sb.hot = append(sb.hot, line)
+	sb.n++
+	sb.size += cellSize * len(line)
+	if len(sb.hot) < historyChunkLines {
+		return
+	}
+	chunk := compressLines(sb.hot)
+	for _, l := range sb.hot {
+		sb.size -= cellSize * len(l)
+	}
+	sb.size += len(chunk.data)
+	chunk.disk = -1
+	if sb.disk != nil && sb.disk.writable {
+		var err error
+		if chunk.disk, err = sb.disk.append(chunk.data); err != nil {
+			sb.disk.writable = false // keep going in memory only
+		}
+	}
+	sb.chunks = append(sb.chunks, chunk)
+	sb.hot = nil
+}
+
+// Line returns line i, counting from the oldest held.
+func (sb *scrollback) Line(i int) Row {
+	i += sb.first
+	c := i / historyChunkLines
+	if c >= len(sb.chunks) {
+		return sb.hot[i-len(sb.chunks)*historyChunkLines]
+	}
+	if sb.cachedLines == nil || sb.cached != c {
+		data := sb.chunks[c].data
+		if data == nil {
+			data, _ = sb.disk.read(sb.chunks[c].disk)
+		}
+		sb.cached, sb.cachedLines = c, decompressLines(data)
+	}
+	if i%historyChunkLines >= len(sb.cachedLines) {
+		return nil // unreadable
+	}
+	return sb.cachedLines[i%historyChunkLines]
+}
+
+// Drop removes the oldest n lines.
+func (sb *scrollback) Drop(n int) {
+	n = min(n, sb.n)
+	sb.n -= n
+	sb.first += n
+	for len(sb.chunks) > 0 && sb.first >= historyChunkLines {
+		sb.size -= len(sb.chunks[0].data)
+		sb.chunks = sb.chunks[1:]
+		sb.first -= historyChunkLines
+		sb.cached--
+	}
+	if len(sb.chunks) == 0 && sb.first > 0 {
+		for _, l := range sb.hot[:sb.first] {
+			sb.size -= cellSize * len(l)
+		}
+		sb.hot = append(sb.hot[:0], sb.hot[sb.first:]...)
+		sb.first = 0
+	}
+}
+
+// Trim frees the oldest chunks while more than limit bytes are held,
+// returning how many lines were dropped. Chunks in the history file only
+// leave memory; others are dropped. A limit of 0 or less means no limit.
+func (sb *scrollback) Trim(limit int) int {
+	dropped := 0
+	for limit > 0 && sb.size > limit {
+		i := slices.IndexFunc(sb.chunks, func(c historyChunk) bool { return c.data != nil })
+		if i < 0 {
+			break
+		}
+		if sb.chunks[i].disk >= 0 {
+			sb.size -= len(sb.chunks[i].data)
+			sb.chunks[i].data = nil
+			continue
+		}
+		n := (i+1)*historyChunkLines - sb.first
+		sb.Drop(n)
+		dropped += n
+	}
+	return dropped
+}
+
+// Load starts an empty scrollback from chunks read from a history file.
+func (sb *scrollback) Load(hf *HistoryFile, chunks []historyChunk) {
+	sb.disk = hf
+	sb.chunks = chunks
+	sb.n = len(chunks) * historyChunkLines
+	for _, c := range chunks {
+		sb.size += len(c.data)
+	}
+}
+
+// flateWriters are reused, as each one allocates a lot of state.
+var flateWriters = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return w
+}}
+
+// compressLines packs lines into a chunk. Each line is a run of cells in
+// one style (a count, the colors and attributes, then each cell's rune and
+// width), repeated, and ended by a zero count.
+func compressLines(lines []Row) historyChunk {
+	var enc []byte
+	for _, l := range lines {
+		for i := 0; i < len(l); {
+			n := 1
+			for i+n < len(l) && l[i+n].Style == l[i].Style {
+				n++
+			}
+			fg, bg, attrs := l[i].Style.Style().Decompose()
+			enc = binary.AppendUvarint(enc, uint64(n))
+			enc = binary.AppendUvarint(enc, uint64(fg))
+			enc = binary.AppendUvarint(enc, uint64(bg))
+			enc = binary.AppendUvarint(enc, uint64(attrs))
+			for _, c := range l[i : i+n] {
+				enc = binary.AppendUvarint(enc, uint64(c.Rune)<<2|uint64(c.Width&3))
+			}
+			i += n
+		}
+		enc = binary.AppendUvarint(enc, 0)
+	}
+	return historyChunk{data: Compress(enc)}
+}
+
+// Compress deflates data, quickly rather than small.
+func Compress(data []byte) []byte {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	w.Write(data)
+	w.Close()
+	flateWriters.Put(w)
+	return bytes.Clone(buf.Bytes())
+}
+
+// decompressLines unpacks a chunk, stopping at anything it cannot read.
+func decompressLines(data []byte) []Row {
+	enc, _ := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	r := bytes.NewReader(enc)
+	var lines []Row
+	var line Row
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return lines
+		}
+		if n == 0 {
+			lines, line = append(lines, line), nil
+			continue
+		}
+		var v [3]uint64
+		for i := range v {
+			if v[i], err = binary.ReadUvarint(r); err != nil {
+				return lines
+			}
+		}
+		attrs := tcell.AttrMask(v[2])
+		style := InternStyle(tcell.StyleDefault.Foreground(tcell.Color(v[0])).Background(tcell.Color(v[1])).
+			Attributes(attrs &^ tcell.AttrUnderline).Underline(attrs&tcell.AttrUnderline != 0))
+		for ; n > 0; n-- {
+			c, err := binary.ReadUvarint(r)
+			if err != nil {
+				return lines
+			}
+			line = append(line, Cell{Rune: rune(c >> 2), Style: style, Width: uint8(c & 3)})
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package vt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// textRow makes a row of s in one style.
+func textRow(s string, style StyleID) Row {
+	var row Row
+	for _, r := range s {
+		row = append(row, Cell{Rune: r, Style: style, Width: 1})
+	}
+	return row
+}
+
+func rowsEqual(a, b []Row) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestCompressLines(t *testing.T) {
+	bold := InternStyle(tcell.StyleDefault.Bold(true).Foreground(tcell.ColorRed))
+	underlined := InternStyle(tcell.StyleDefault.Underline(true).Background(tcell.NewRGBColor(1, 2, 3)))
+	wide := Row{{Rune: '世', Width: 2}, {Rune: ' ', Width: 0}, {Rune: 'x', Width: 1}}
+	mixed := append(textRow("plain ", 0), append(textRow("bold", bold), textRow(" under", underlined)...)...)
+	tests := []struct {
+		name  string
+		lines []Row
+	}{
+		{"none", nil},
+		{"one line", []Row{textRow("hello", 0)}},
+		{"empty lines", []Row{{}, textRow("between", 0), {}}},
+		{"styles", []Row{mixed, textRow("all bold", bold)}},
+		{"wide characters", []Row{wide}},
+		{"a full chunk", func() []Row {
+			var lines []Row
+			for i := range historyChunkLines {
+				style := StyleID(0)
+				if i%2 == 1 {
+					style = bold
+				}
+				lines = append(lines, textRow(fmt.Sprintf("line %d", i), style))
+			}
+			return lines
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := compressLines(tt.lines)
+			if got := decompressLines(chunk.data); !rowsEqual(got, tt.lines) {
+				t.Errorf("decompressLines(compressLines(lines)) = %v, want %v", got, tt.lines)
+			}
+		})
+	}
+}
+
+func TestDecompressLinesDamaged(t *testing.T) {
+	lines := []Row{textRow("first", 0), textRow("second", 0)}
+	data := compressLines(lines).data
+	for _, damaged := range [][]byte{nil, []byte("not flate"), data[:len(data)/2]} {
+		got := decompressLines(damaged)
+		if len(got) > len(lines) || !rowsEqual(got, lines[:len(got)]) {
+			t.Errorf("decompressLines(%q) = %v, want a prefix of the lines", damaged, got)
+		}
+	}
+}
+
+func TestScrollback(t *testing.T) {
+	var sb scrollback
+	n := 2*historyChunkLines + 88
+	for i := range n {
+		sb.Append(textRow(fmt.Sprintf("line %d", i), 0))
+	}
+	line := func(i int) string { return string(sb.Line(i).Text()) }
+	if sb.Len() != n || len(sb.chunks) != 2 || len(sb.hot) != 88 {
+		t.Fatalf("%d lines in %d chunks and %d hot, want %d in 2 and 88", sb.Len(), len(sb.chunks), len(sb.hot), n)
+	}
+	for _, i := range []int{0, 1, historyChunkLines, 2*historyChunkLines - 1, n - 1} {
+		if got, want := line(i), fmt.Sprintf("line %d", i); got != want {
+			t.Errorf("Line(%d) = %q, want %q", i, got, want)
+		}
+	}
+
+	sb.Drop(historyChunkLines + 10)
+	if sb.Len() != n-historyChunkLines-10 || len(sb.chunks) != 1 {
+		t.Errorf("after Drop, %d lines in %d chunks", sb.Len(), len(sb.chunks))
+	}
+	if got, want := line(0), fmt.Sprintf("line %d", historyChunkLines+10); got != want {
+		t.Errorf("after Drop, Line(0) = %q, want %q", got, want)
+	}
+
+	hot := sb.size
+	for _, l := range sb.hot {
+		hot -= cellSize * len(l)
+	}
+	if hot != len(sb.chunks[0].data) {
+		t.Errorf("size counts %d bytes of chunks, want %d", hot, len(sb.chunks[0].data))
+	}
+	if dropped := sb.Trim(1); dropped != historyChunkLines-10 || sb.Len() != 88 {
+		t.Errorf("Trim dropped %d lines leaving %d, want %d leaving 88", dropped, sb.Len(), historyChunkLines-10)
+	}
+	if got, want := line(0), fmt.Sprintf("line %d", 2*historyChunkLines); got != want {
+		t.Errorf("after Trim, Line(0) = %q, want %q", got, want)
+	}
+}
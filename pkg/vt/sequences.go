@@ -0,0 +1,485 @@
+package vt
+
+import (
+	"bytes"
+	"slices"
+)
+
+// maxPendingSequence bounds how much of an unterminated sequence is held
+// between writes before it is given up on and passed to the emulator. Sixel
+// images are the largest sequences held.
+const maxPendingSequence = 8 << 20
+
+type seqKind int
+
+const (
+	seqPassthrough seqKind = iota // DCS tmux;/term; ... ST, payload unwrapped
+	seqKeyMode                    // CSI > 4 ; Pm m and the CSI u keyboard protocol
+	seqPromptMark                 // OSC 133 ; A/B/C/D shell integration marks
+	seqSixel                      // DCS Pm q ... ST, payload is the whole sequence
+	seqInlineImage                // OSC 1337 ; File= ... ST, payload is the whole sequence
+	seqCursorStyle                // CSI Ps SP q, payload is the whole sequence
+	seqCursorColor                // OSC 12 ; color ST or OSC 112 ST, payload is the color
+)
+
+// outputSegment is either plain output for the emulator or a sequence pulled
+// out of the stream.
+type outputSegment struct {
+	data    []byte
+	kind    seqKind
+	isSeq   bool
+	payload []byte
+}
+
+// seqFilter pulls sequences that vt10x does not understand out of a pane's
+// output stream, keeping their order relative to the surrounding output. A
+// sequence split across reads is held until the rest arrives.
+type seqFilter struct {
+	pending []byte
+	held    bool // the buffer being split starts with pending, which it owns
+	// How far into the held sequence the search for its ST has got, so a
+	// large image arriving in pieces is not rescanned from the start
+	searched int
+}
+
+var passthroughPrefixes = [][]byte{[]byte("\x1bPterm;"), []byte("\x1bPtmux;")}
+
+var promptMarkPrefix = []byte("\x1b]133;")
+
+var inlineImagePrefix = []byte("\x1b]1337;File=")
+
+// filterPrefixes are the starts of every string sequence the filter pulls out.
+var filterPrefixes = append(slices.Clip(passthroughPrefixes), promptMarkPrefix, inlineImagePrefix, cursorColorPrefix, cursorColorResetPrefix)
+
+func (f *seqFilter) Split(data []byte) []outputSegment {
+	buf := data
+	searched := f.searched
+	f.held, f.searched = len(f.pending) > 0, 0
+	if f.held {
+		buf = append(f.pending, data...)
+		f.pending = nil
+	}
+
+	var segments []outputSegment
+	start := 0 // first byte not yet emitted
+	i := 0
+	for {
+		idx := bytes.IndexByte(buf[i:], 0x1b)
+		if idx < 0 {
+			break
+		}
+		i += idx
+
+		if n, complete := keyModeSequence(buf[i:]); n > 0 || !complete {
+			if !complete {
+				return f.hold(segments, buf, start, i)
+			}
+			if i > start {
+				segments = append(segments, outputSegment{data: buf[start:i]})
+			}
+			segments = append(segments, outputSegment{isSeq: true, kind: seqKeyMode, payload: buf[i : i+n]})
+			i += n
+			start = i
+			continue
+		}
+
+		if n, complete := cursorStyleSequence(buf[i:]); n > 0 || !complete {
+			if !complete {
+				return f.hold(segments, buf, start, i)
+			}
+			if i > start {
+				segments = append(segments, outputSegment{data: buf[start:i]})
+			}
+			segments = append(segments, outputSegment{isSeq: true, kind: seqCursorStyle, payload: buf[i : i+n]})
+			i += n
+			start = i
+			continue
+		}
+
+		if n, complete := sixelIntroducer(buf[i:]); n > 0 || !complete {
+			if !complete {
+				return f.hold(segments, buf, start, i)
+			}
+			from := i + n
+			if i == 0 && f.held && searched > n {
+				from = searched - 1 // the ESC of the ST may have ended the last read
+			}
+			end := bytes.Index(buf[from:], []byte("\x1b\\"))
+			if end < 0 {
+				segments = f.hold(segments, buf, start, i)
+				if f.pending != nil {
+					f.searched = len(buf) - i
+				}
+				return segments
+			}
+			end += from + 2
+			if i > start {
+				segments = append(segments, outputSegment{data: buf[start:i]})
+			}
+			segments = append(segments, outputSegment{isSeq: true, kind: seqSixel, payload: buf[i:end]})
+			i = end
+			start = i
+			continue
+		}
+
+		prefix, complete := matchPrefix(buf[i:], filterPrefixes)
+		if prefix == nil {
+			if !complete {
+				// Might still become one of ours
+				return f.hold(segments, buf, start, i)
+			}
+			i++
+			continue
+		}
+
+		var kind seqKind
+		var payload []byte
+		var end int
+		var ok bool
+		switch {
+		case bytes.Equal(prefix, promptMarkPrefix):
+			kind = seqPromptMark
+			payload, end, ok = oscPayload(buf[i+len(prefix):])
+		case bytes.Equal(prefix, cursorColorPrefix), bytes.Equal(prefix, cursorColorResetPrefix):
+			kind = seqCursorColor
+			payload, end, ok = oscPayload(buf[i+len(prefix):])
+		case bytes.Equal(prefix, inlineImagePrefix):
+			kind = seqInlineImage
+			from := len(prefix)
+			if i == 0 && f.held && searched > from {
+				from = searched - 1
+			}
+			_, end, ok = oscPayload(buf[i+from:])
+			end += from - len(prefix)
+			payload = buf[i : i+len(prefix)+end]
+		default:
+			kind = seqPassthrough
+			payload, end, ok = unwrapPassthrough(buf[i+len(prefix):])
+		}
+		if !ok {
+			segments = f.hold(segments, buf, start, i)
+			if kind == seqInlineImage && f.pending != nil {
+				f.searched = len(buf) - i
+			}
+			return segments
+		}
+		if i > start {
+			segments = append(segments, outputSegment{data: buf[start:i]})
+		}
+		segments = append(segments, outputSegment{isSeq: true, kind: kind, payload: payload})
+		i += len(prefix) + end
+		start = i
+	}
+	if start < len(buf) {
+		segments = append(segments, outputSegment{data: buf[start:]})
+	}
+	return segments
+}
+
+// hold emits output up to seqStart and keeps the rest for the next Split.
+func (f *seqFilter) hold(segments []outputSegment, buf []byte, start, seqStart int) []outputSegment {
+	if len(buf)-seqStart > maxPendingSequence {
+		// Never terminated; let the emulator have it
+		return append(segments, outputSegment{data: buf[start:]})
+	}
+	if seqStart > start {
+		segments = append(segments, outputSegment{data: buf[start:seqStart]})
+	}
+	if seqStart == 0 && f.held {
+		f.pending = buf // already a copy; keep growing it
+	} else {
+		f.pending = append([]byte(nil), buf[seqStart:]...)
+	}
+	return segments
+}
+
+// keyModeSequence reports the length of a key encoding request at the start
+// of buf (CSI > Pm m, CSI > Pm u, CSI < Pm u, CSI = Pm u, CSI ? u), or 0 if
+// buf starts with something else. vt10x would read these as SGR resets or
+// cursor restores. complete is false if buf ends before it can tell.
+func keyModeSequence(buf []byte) (n int, complete bool) {
+	if len(buf) < 2 {
+		return 0, false
+	}
+	if buf[1] != '[' {
+		return 0, true
+	}
+	if len(buf) < 3 {
+		return 0, false
+	}
+	if buf[2] != '>' && buf[2] != '<' && buf[2] != '=' && buf[2] != '?' {
+		return 0, true
+	}
+	for j := 3; j < len(buf); j++ {
+		c := buf[j]
+		if (c >= '0' && c <= '9') || c == ';' {
+			continue
+		}
+		if c == 'u' || (c == 'm' && buf[2] == '>') {
+			return j + 1, true
+		}
+		return 0, true
+	}
+	return 0, len(buf) > 32
+}
+
+// sixelIntroducer reports the length of the DCS Pm q that starts a sixel
+// image at the start of buf, or 0 if buf starts with something else.
+// complete is false if buf ends before it can tell.
+func sixelIntroducer(buf []byte) (n int, complete bool) {
+	if len(buf) < 2 {
+		return 0, false
+	}
+	if buf[1] != 'P' {
+		return 0, true
+	}
+	for j := 2; j < len(buf); j++ {
+		c := buf[j]
+		if (c >= '0' && c <= '9') || c == ';' {
+			continue
+		}
+		if c == 'q' {
+			return j + 1, true
+		}
+		return 0, true
+	}
+	return 0, len(buf) > 32
+}
+
+// matchPrefix returns the prefix buf starts with. If none matches, complete
+// reports whether buf was long enough to be sure.
+func matchPrefix(buf []byte, prefixes [][]byte) (prefix []byte, complete bool) {
+	complete = true
+	for _, p := range prefixes {
+		if bytes.HasPrefix(buf, p) {
+			return p, true
+		}
+		if len(buf) < len(p) && bytes.HasPrefix(p, buf) {
+			complete = false
+		}
+	}
+	return nil, complete
+}
+
+// unwrapPassthrough reads up to the ST (ESC \) ending a passthrough sequence,
+// undoubling the escaped ESCs inside it. end is the offset just past the ST.
+func unwrapPassthrough(buf []byte) (payload []byte, end int, ok bool) {
+	for i := 0; i < len(buf); i++ {
+		if buf[i] != 0x1b {
+			payload = append(payload, buf[i])
+			continue
+		}
+		if i+1 >= len(buf) {
+			return nil, 0, false
+		}
+		switch buf[i+1] {
+		case '\\':
+			return payload, i + 2, true
+		case 0x1b:
+			payload = append(payload, 0x1b)
+			i++
+		default:
+			payload = append(payload, 0x1b)
+		}
+	}
+	return nil, 0, false
+}
+
+// oscPayload reads up to the BEL or ST ending an OSC sequence. end is the
+// offset just past the terminator.
+func oscPayload(buf []byte) (payload []byte, end int, ok bool) {
+	for i, c := range buf {
+		if c == 0x07 {
+			return buf[:i], i + 1, true
+		}
+		if c == 0x1b && i+1 < len(buf) && buf[i+1] == '\\' {
+			return buf[:i], i + 2, true
+		}
+	}
+	return nil, 0, false
+}
+
+// CSIScanner watches a pane's output for CSI sequences the daemon needs to
+// follow, such as DEC private mode changes (CSI ? Pm h) and key encoding
+// requests (CSI > 4 ; Pm m), without running a full emulator.
+type CSIScanner struct {
+	tail []byte // start of a sequence cut off by the end of the last read
+}
+
+// Scan calls fn for each CSI sequence in data that starts with a parameter
+// marker (one of < = > ?) and has only numeric parameters.
+func (m *CSIScanner) Scan(data []byte, fn func(marker byte, params []int, final byte)) {
+	buf := data
+	if len(m.tail) > 0 {
+		buf = append(m.tail, data...)
+		m.tail = nil
+	}
+	for i := 0; i < len(buf); i++ {
+		if buf[i] != 0x1b {
+			continue
+		}
+		if len(buf)-i < 3 {
+			m.keepTail(buf[i:])
+			return
+		}
+		marker := buf[i+2]
+		if buf[i+1] != '[' || marker < '<' || marker > '?' {
+			continue
+		}
+		var params []int
+		n, seen := 0, false
+		j := i + 3
+		for ; j < len(buf); j++ {
+			c := buf[j]
+			if c >= '0' && c <= '9' {
+				n = n*10 + int(c-'0')
+				seen = true
+			} else if c == ';' {
+				params = append(params, n)
+				n, seen = 0, false
+			} else {
+				break
+			}
+		}
+		if j == len(buf) {
+			m.keepTail(buf[i:])
+			return
+		}
+		if seen {
+			params = append(params, n)
+		}
+		if buf[j] >= 0x40 && buf[j] <= 0x7e {
+			fn(marker, params, buf[j])
+		}
+		i = j
+	}
+}
+
+func (m *CSIScanner) keepTail(tail []byte) {
+	if len(tail) <= 64 {
+		m.tail = append([]byte(nil), tail...)
+	}
+}
+
+// maxOSC bounds how much of an OSC sequence OSCScanner keeps; longer ones,
+// such as clipboard or image data, are skipped.
+const maxOSC = 4096
+
+// OSCScanner watches a pane's output for OSC sequences, such as shell
+// integration marks, without running a full emulator.
+type OSCScanner struct {
+	inOSC   bool
+	escSeen bool   // last byte was ESC, maybe starting ESC ] or ST
+	payload []byte // OSC read so far
+	skip    bool   // payload outgrew maxOSC
+}
+
+// Scan calls fn with the payload of each complete OSC sequence in data.
+func (o *OSCScanner) Scan(data []byte, fn func(payload []byte)) {
+	for _, c := range data {
+		esc := o.escSeen
+		o.escSeen = c == 0x1b
+		switch {
+		case !o.inOSC:
+			if esc && c == ']' {
+				o.inOSC, o.skip, o.payload = true, false, o.payload[:0]
+			}
+		case c == 0x07 || esc && c == '\\':
+			if !o.skip {
+				fn(o.payload)
+			}
+			o.inOSC = false
+		case c == 0x18 || c == 0x1a: // CAN and SUB abort it
+			o.inOSC = false
+		case c != 0x1b && !o.skip:
+			if esc {
+				o.inOSC = false // any other escape ends the string
+				continue
+			}
+			o.payload = append(o.payload, c)
+			o.skip = len(o.payload) > maxOSC
+		}
+	}
+}
+
+// maxLine bounds the text LineScanner keeps for a line that has not ended;
+// longer lines are passed on in pieces.
+const maxLine = 4096
+
+const (
+	lineText   = iota
+	lineEscape // after ESC
+	lineCSI    // in CSI ... final
+	lineString // in OSC, DCS, APC, PM or SOS, up to BEL or ST
+	lineStringEscape
+)
+
+// LineScanner turns a pane's output into lines of plain text, without
+// escape sequences or control characters, for matching and logging. A
+// carriage return not followed by a newline starts the line over, as when
+// a progress bar redraws itself.
+type LineScanner struct {
+	state int
+	cr    bool // the last byte was a carriage return
+	line  []byte
+}
+
+// Scan calls fn for each line data completes.
+func (l *LineScanner) Scan(data []byte, fn func(line string)) {
+	for _, c := range data {
+		switch l.state {
+		case lineEscape:
+			switch {
+			case c == '[':
+				l.state = lineCSI
+			case c == ']' || c == 'P' || c == '_' || c == '^' || c == 'X':
+				l.state = lineString
+			case c >= 0x20 && c <= 0x2f: // intermediate, as in ESC ( B
+			default:
+				l.state = lineText
+			}
+			continue
+		case lineCSI:
+			if c >= 0x40 && c <= 0x7e {
+				l.state = lineText
+			}
+			continue
+		case lineString:
+			if c == 0x07 {
+				l.state = lineText
+			} else if c == 0x1b {
+				l.state = lineStringEscape
+			}
+			continue
+		case lineStringEscape:
+			l.state = lineString
+			if c == '\\' {
+				l.state = lineText
+			}
+			continue
+		}
+
+		if l.cr && c != '\n' {
+			l.line = l.line[:0]
+		}
+		l.cr = c == '\r'
+		switch {
+		case c == 0x1b:
+			l.state = lineEscape
+		case c == '\n':
+			fn(string(l.line))
+			l.line = l.line[:0]
+		case c == '\t' || (c >= 0x20 && c != 0x7f):
+			l.line = append(l.line, c)
+			if len(l.line) >= maxLine {
+				fn(string(l.line))
+				l.line = l.line[:0]
+			}
+		}
+	}
+}
+
+// Partial returns the line the data so far has begun but not completed.
+func (l *LineScanner) Partial() string {
+	return string(l.line)
+}
@@ -0,0 +1,135 @@
+package vt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// seqKindNames name the kinds of sequence in test expectations.
+var seqKindNames = map[seqKind]string{
+	seqPassthrough: "passthrough",
+	seqKeyMode:     "key-mode",
+	seqPromptMark:  "prompt-mark",
+	seqSixel:       "sixel",
+	seqInlineImage: "inline-image",
+	seqCursorStyle: "cursor-style",
+	seqCursorColor: "cursor-color",
+}
+
+func TestSeqFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string // "text" or "kind:payload", in order
+	}{
+		{
+			name:   "plain output",
+			writes: []string{"hello\r\n"},
+			want:   []string{"hello\r\n"},
+		},
+		{
+			name:   "sequences vt10x understands",
+			writes: []string{"\x1b[1mbold\x1b[0m\x1b]0;title\x07"},
+			want:   []string{"\x1b[1mbold\x1b[0m\x1b]0;title\x07"},
+		},
+		{
+			name:   "passthrough",
+			writes: []string{"a\x1bPtmux;\x1b\x1b]52;c;eA==\x07\x1b\\b"},
+			want:   []string{"a", "passthrough:\x1b]52;c;eA==\x07", "b"},
+		},
+		{
+			name:   "passthrough split across reads",
+			writes: []string{"a\x1bPtm", "ux;\x1b\x1b]2;x\x07\x1b", "\\b"},
+			want:   []string{"a", "passthrough:\x1b]2;x\x07", "b"},
+		},
+		{
+			name:   "key modes",
+			writes: []string{"\x1b[>4;2mx\x1b[>1uy\x1b[<u\x1b[?u"},
+			want:   []string{"key-mode:\x1b[>4;2m", "x", "key-mode:\x1b[>1u", "y", "key-mode:\x1b[<u", "key-mode:\x1b[?u"},
+		},
+		{
+			name:   "key mode split after CSI",
+			writes: []string{"x\x1b[", ">4;1m"},
+			want:   []string{"x", "key-mode:\x1b[>4;1m"},
+		},
+		{
+			name:   "prompt marks",
+			writes: []string{"\x1b]133;A\x07$ \x1b]133;B\x1b\\"},
+			want:   []string{"prompt-mark:A", "$ ", "prompt-mark:B"},
+		},
+		{
+			name:   "prompt mark split across reads",
+			writes: []string{"ab\x1b]13", "3;D;0", "\x07cd"},
+			want:   []string{"ab", "prompt-mark:D;0", "cd"},
+		},
+		{
+			name:   "sixel",
+			writes: []string{"\x1bPq#0;2;100;0;0~-\x1b\\"},
+			want:   []string{"sixel:\x1bPq#0;2;100;0;0~-\x1b\\"},
+		},
+		{
+			name:   "sixel in pieces, ST split",
+			writes: []string{"\x1bPq", "#0~~", "~\x1b", "\\z"},
+			want:   []string{"sixel:\x1bPq#0~~~\x1b\\", "z"},
+		},
+		{
+			name:   "inline image",
+			writes: []string{"a\x1b]1337;File=inline=1:AAAA\x07b"},
+			want:   []string{"a", "inline-image:\x1b]1337;File=inline=1:AAAA\x07", "b"},
+		},
+		{
+			name:   "inline image split across reads, ST",
+			writes: []string{"\x1b]1337;File=", "inline=1:AA", "AA\x1b\\"},
+			want:   []string{"inline-image:\x1b]1337;File=inline=1:AAAA\x1b\\"},
+		},
+		{
+			name:   "cursor style and color",
+			writes: []string{"\x1b[5 q\x1b]12;#ff0000\x07\x1b]112\x07"},
+			want:   []string{"cursor-style:\x1b[5 q", "cursor-color:#ff0000", "cursor-color:"},
+		},
+		{
+			name:   "lone ESC at the end of a read",
+			writes: []string{"a\x1b", "[1m"},
+			want:   []string{"a", "\x1b[1m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f seqFilter
+			var got []string
+			for _, w := range tt.writes {
+				for _, seg := range f.Split([]byte(w)) {
+					if seg.isSeq {
+						got = append(got, seqKindNames[seg.kind]+":"+string(seg.payload))
+					} else {
+						got = append(got, string(seg.data))
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split = %q, want %q", got, tt.want)
+			}
+			if len(f.pending) != 0 {
+				t.Errorf("%q left pending", f.pending)
+			}
+		})
+	}
+}
+
+func TestSeqFilterUnterminated(t *testing.T) {
+	// A sequence that never ends is given to the emulator once it is too
+	// long to hold
+	var f seqFilter
+	if segs := f.Split([]byte("\x1bPtmux;")); len(segs) != 0 {
+		t.Fatalf("Split gave %d segments, want it held", len(segs))
+	}
+	long := strings.Repeat("x", maxPendingSequence)
+	segs := f.Split([]byte(long))
+	if len(segs) != 1 || segs[0].isSeq || string(segs[0].data) != "\x1bPtmux;"+long {
+		t.Errorf("Split of an overlong sequence gave %d segments, want it passed on as output", len(segs))
+	}
+	if len(f.pending) != 0 {
+		t.Errorf("%d bytes left pending", len(f.pending))
+	}
+}
@@ -0,0 +1,234 @@
+package vt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/hinshun/vt10x"
+)
+
+// StyleID is an interned style. Cells hold one rather than a tcell.Style,
+// which is many times bigger, and the same combination of colors and
+// attributes always gets the same ID.
+type StyleID uint16
+
+// maxStyles bounds the style table; styles beyond it are drawn in the
+// default style.
+const maxStyles = 1 << 16
+
+// glyphAttrs is a style as vt10x keeps it.
+type glyphAttrs struct {
+	fg, bg vt10x.Color
+	mode   int16
+}
+
+// styleTable holds every style interned so far. It only grows, so a slice
+// taken from it stays valid.
+var styleTable = struct {
+	sync.RWMutex
+	styles []tcell.Style
+	ids    map[tcell.Style]StyleID
+	glyphs map[glyphAttrs]StyleID
+}{
+	styles: []tcell.Style{tcell.StyleDefault},
+	ids:    map[tcell.Style]StyleID{tcell.StyleDefault: 0},
+	glyphs: make(map[glyphAttrs]StyleID),
+}
+
+// InternStyle returns the ID of a style, adding it if it is new.
+func InternStyle(s tcell.Style) StyleID {
+	styleTable.RLock()
+	id, ok := styleTable.ids[s]
+	styleTable.RUnlock()
+	if ok {
+		return id
+	}
+	styleTable.Lock()
+	defer styleTable.Unlock()
+	return addStyle(s)
+}
+
+// addStyle interns a style with the table locked.
+func addStyle(s tcell.Style) StyleID {
+	if id, ok := styleTable.ids[s]; ok {
+		return id
+	}
+	if len(styleTable.styles) >= maxStyles {
+		return 0
+	}
+	id := StyleID(len(styleTable.styles))
+	styleTable.styles = append(styleTable.styles, s)
+	styleTable.ids[s] = id
+	return id
+}
+
+// internGlyph returns the ID of a vt10x style.
+func internGlyph(a glyphAttrs) StyleID {
+	styleTable.RLock()
+	id, ok := styleTable.glyphs[a]
+	styleTable.RUnlock()
+	if ok {
+		return id
+	}
+	style := tcell.StyleDefault.Foreground(vtColor(a.fg)).Background(vtColor(a.bg))
+	style = style.Reverse(a.mode&glyphReverse != 0).Underline(a.mode&glyphUnderline != 0).
+		Bold(a.mode&glyphBold != 0).Italic(a.mode&glyphItalic != 0).Blink(a.mode&glyphBlink != 0)
+	styleTable.Lock()
+	defer styleTable.Unlock()
+	id = addStyle(style)
+	styleTable.glyphs[a] = id
+	return id
+}
+
+// Glyph attributes; vt10x does not export them
+const (
+	glyphReverse = 1 << iota
+	glyphUnderline
+	glyphBold
+	glyphGfx
+	glyphItalic
+	glyphBlink
+)
+
+// vtColor converts a vt10x color: palette colors below 256, 24-bit colors
+// up to 1<<24 and the defaults above.
+func vtColor(c vt10x.Color) tcell.Color {
+	switch {
+	case c < 256:
+		return tcell.PaletteColor(int(c))
+	case c < 1<<24:
+		return tcell.NewHexColor(int32(c))
+	}
+	return tcell.ColorDefault
+}
+
+// Styles returns the style table, indexed by StyleID, for looking up many
+// styles without locking for each.
+func Styles() []tcell.Style {
+	styleTable.RLock()
+	defer styleTable.RUnlock()
+	return styleTable.styles
+}
+
+// Style returns the style an ID stands for.
+func (id StyleID) Style() tcell.Style {
+	return Styles()[id]
+}
+
+// glyphCache remembers the last style converted, as neighbouring cells
+// usually share one.
+type glyphCache struct {
+	attrs glyphAttrs
+	id    StyleID
+	valid bool
+}
+
+// cell converts a vt10x cell, which always takes one column.
+func (gc *glyphCache) cell(g vt10x.Glyph) Cell {
+	a := glyphAttrs{fg: g.FG, bg: g.BG, mode: g.Mode}
+	if !gc.valid || a != gc.attrs {
+		gc.attrs, gc.id, gc.valid = a, internGlyph(a), true
+	}
+	r := g.Char
+	if r == 0 {
+		r = ' '
+	}
+	return Cell{Rune: r, Style: gc.id, Width: 1}
+}
+
+// PaneStyle is a window-style or window-active-style: colors for the cells
+// of a pane that leave them at the default, and attributes added to all.
+type PaneStyle struct {
+	fg, bg tcell.Color // tcell.ColorDefault to leave as they are
+	attrs  tcell.AttrMask
+	ids    map[StyleID]StyleID // styles with it applied, by the original
+}
+
+// paneStyleAttrs are the attributes a pane style can add.
+var paneStyleAttrs = map[string]tcell.AttrMask{
+	"bold":       tcell.AttrBold,
+	"dim":        tcell.AttrDim,
+	"italics":    tcell.AttrItalic,
+	"underscore": tcell.AttrUnderline,
+	"reverse":    tcell.AttrReverse,
+	"blink":      tcell.AttrBlink,
+}
+
+// ParsePaneStyle reads a style such as "fg=colour245,bg=#1c1c1c,dim":
+// fg= and bg= take a color name, colourN or #rrggbb, and the other words
+// are attributes. "" and "default" are no style, nil.
+func ParsePaneStyle(spec string) (*PaneStyle, error) {
+	if spec == "" || spec == "default" {
+		return nil, nil
+	}
+	ps := &PaneStyle{fg: tcell.ColorDefault, bg: tcell.ColorDefault, ids: make(map[StyleID]StyleID)}
+	for _, word := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' }) {
+		key, value, isColor := strings.Cut(word, "=")
+		if !isColor {
+			attr, ok := paneStyleAttrs[word]
+			if !ok {
+				return nil, fmt.Errorf("bad style attribute: %s", word)
+			}
+			ps.attrs |= attr
+			continue
+		}
+		color, err := parseColor(value)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "fg":
+			ps.fg = color
+		case "bg":
+			ps.bg = color
+		default:
+			return nil, fmt.Errorf("bad style: %s", word)
+		}
+	}
+	return ps, nil
+}
+
+// parseColor reads a color name, colourN (or colorN) or #rrggbb.
+func parseColor(name string) (tcell.Color, error) {
+	for _, prefix := range []string{"colour", "color"} {
+		if n, ok := strings.CutPrefix(name, prefix); ok {
+			if i, err := strconv.Atoi(n); err == nil && i >= 0 && i < 256 {
+				return tcell.PaletteColor(i), nil
+			}
+		}
+	}
+	if color := tcell.GetColor(name); color != tcell.ColorDefault {
+		return color, nil
+	}
+	return tcell.ColorDefault, fmt.Errorf("bad color: %s", name)
+}
+
+// Apply returns the style of a pane's cell with ps applied.
+func (ps *PaneStyle) Apply(id StyleID) StyleID {
+	if ps == nil {
+		return id
+	}
+	if out, ok := ps.ids[id]; ok {
+		return out
+	}
+	style := id.Style()
+	fg, bg, attrs := style.Decompose()
+	if ps.fg != tcell.ColorDefault && (fg == tcell.ColorDefault || fg == tcell.ColorReset) {
+		style = style.Foreground(ps.fg)
+	}
+	if ps.bg != tcell.ColorDefault && (bg == tcell.ColorDefault || bg == tcell.ColorReset) {
+		style = style.Background(ps.bg)
+	}
+	out := InternStyle(style.Attributes(attrs | ps.attrs))
+	ps.ids[id] = out
+	return out
+}
+
+// CheckPaneStyle validates a window-style or window-active-style value.
+func CheckPaneStyle(spec string) error {
+	_, err := ParsePaneStyle(spec)
+	return err
+}